@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"tire-pepair-record-service/pkg/csvimport"
+)
+
+// mappingFlag повторяемый флаг -map поле:Заголовок
+type mappingFlag []string
+
+func (m *mappingFlag) String() string { return strings.Join(*m, ",") }
+
+func (m *mappingFlag) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
+
+// runImport выполняет команду импорта записей из CSV:
+//
+//	tire-service import [-dry-run] [-skip-time-checks] [-map поле:Заголовок] файл.csv
+//
+// Файл "-" читается из стандартного ввода. Возвращает код завершения:
+// 0 - импорт выполнен или проверка прошла, 1 - есть ошибки, 2 - неверный вызов
+func runImport(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dryRun := flags.Bool("dry-run", false, "проверить файл без добавления записей")
+	skipTimeChecks := flags.Bool("skip-time-checks", false, "не проверять часы работы, интервал и неявки (занятость времени проверяется)")
+	var mappings mappingFlag
+	flags.Var(&mappings, "map", "сопоставление поля и колонки, например plate:Гос номер")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Использование: import [флаги] файл.csv")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	mapping, err := csvimport.ParseMapping(mappings)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	var input io.Reader = os.Stdin
+	if name := flags.Arg(0); name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+
+	options := csvimport.Options{Mapping: mapping}
+	options.DryRun = *dryRun
+	options.SkipTimeChecks = *skipTimeChecks
+
+	report, err := csvimport.Import(input, options, time.Now())
+	if err != nil {
+		fmt.Fprintln(stderr, "ошибка импорта:", err)
+		return 1
+	}
+
+	printImportReport(stdout, report)
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// printImportReport печатает сопоставление колонок, ошибки строк и итог
+func printImportReport(w io.Writer, report *csvimport.Report) {
+	fields := make([]string, 0, len(report.Columns))
+	for field := range report.Columns {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		fmt.Fprintf(w, "колонка %q -> %s\n", report.Columns[field], field)
+	}
+
+	for _, row := range report.Rows {
+		for _, err := range row.Errors {
+			fmt.Fprintf(w, "строка %d (%s): %v\n", row.Line, row.Plate, err)
+		}
+	}
+
+	switch {
+	case report.Committed:
+		fmt.Fprintf(w, "импортировано записей: %d\n", len(report.Rows))
+	case report.Failed > 0:
+		fmt.Fprintf(w, "строк с ошибками: %d из %d, ничего не импортировано\n", report.Failed, len(report.Rows))
+	default:
+		fmt.Fprintf(w, "проверка пройдена, строк: %d (без -dry-run будут импортированы)\n", len(report.Rows))
+	}
+}
@@ -4,7 +4,15 @@ import (
 	"log"
 	"os"
 	"tire-pepair-record-service/pkg/api"
+	"tire-pepair-record-service/pkg/commerceml"
 	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/documents"
+	"tire-pepair-record-service/pkg/events"
+	"tire-pepair-record-service/pkg/notify"
+	"tire-pepair-record-service/pkg/scheduler"
+	"tire-pepair-record-service/pkg/tickets"
+	"tire-pepair-record-service/pkg/waitlist"
+	"tire-pepair-record-service/pkg/webhooks"
 	"tire-pepair-record-service/server"
 )
 
@@ -17,6 +25,16 @@ func main() {
 	api.SetPassword()
 
 	logger := log.New(os.Stdout, "server: ", log.LstdFlags)
+	db.SetNoShowPolicy(logger)
+	db.SetWaitlistPolicy(logger)
+	db.SetSlotHoldPolicy(logger)
+	api.SetHoldPolicy(logger)
+	documents.SetConfig(logger)
+	tickets.SetConfig(logger)
+	notify.SetConfig(logger)
+	webhooks.SetConfig(logger)
+	commerceml.SetConfig(logger)
+	events.SetLogger(logger)
 
 	err := db.Init(dbDefault, logger)
 	if err != nil {
@@ -24,6 +42,32 @@ func main() {
 	}
 	defer db.CloseDatabase()
 
+	// Команда импорта работает с базой и завершается без запуска сервера
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		code := runImport(os.Args[2:], os.Stdout, os.Stderr)
+		db.CloseDatabase()
+		os.Exit(code)
+	}
+
+	waitlist.Subscribe(logger)
+	tickets.Subscribe(logger)
+	notify.Subscribe(logger)
+	webhooks.Subscribe(logger)
+	defer events.Wait()
+
+	jobs := scheduler.New(logger)
+	jobs.Add(scheduler.NoShowJob(logger))
+	jobs.Add(scheduler.WaitlistJob(logger))
+	jobs.Add(scheduler.SlotHoldJob(logger))
+	jobs.Add(scheduler.NotificationJob(logger))
+	jobs.Add(scheduler.ReminderJob(logger))
+	jobs.Add(scheduler.WebhookJob(logger))
+	if commerceml.DropDir != "" {
+		jobs.Add(scheduler.CommerceMLJob(logger))
+	}
+	jobs.Start()
+	defer jobs.Stop()
+
 	srv := server.StartServer(portDefault, logger)
 	if err := srv.HTTPServer.ListenAndServe(); err != nil {
 		logger.Fatal("FATAL: error while server start: ", err)
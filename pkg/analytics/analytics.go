@@ -0,0 +1,263 @@
+// Package analytics считает показатели работы шиномонтажа по записям, истории
+// статусов и оплаченным заказ-нарядам: поток машин, долю живой очереди,
+// ожидание и длительность работ, отмены, неявки и выручку
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+)
+
+// Metrics показатели за день или период
+type Metrics struct {
+	Records   int // записей со временем записи в периоде
+	Booked    int // по предварительной записи
+	WalkIn    int // из живой очереди
+	Served    int // завершено
+	Cancelled int
+	NoShows   int
+	Open      int // еще ожидают или в работе
+
+	CancelRate float64 // доля отмененных среди всех записей
+	NoShowRate float64 // доля неявок среди предварительных записей
+
+	Wait    Duration // от приезда до начала работ
+	Service Duration // от начала до окончания работ
+
+	PaidOrders   int
+	Revenue      int64 // оплачено, копейки
+	RevenueVAT   int64 // НДС в составе выручки
+	AverageCheck int64
+	ByPayment    map[string]int64 // способ оплаты -> сумма
+}
+
+// Duration распределение длительностей
+type Duration struct {
+	Samples int
+	Average time.Duration
+	P90     time.Duration
+}
+
+// ServiceStats показатели по виду работ
+type ServiceStats struct {
+	Service string
+	Records int
+	Served  int
+	Time    Duration // длительность работ
+}
+
+// Day показатели за день
+type Day struct {
+	Date time.Time // начало дня по местному времени
+	Metrics
+}
+
+// Report показатели за период [From, To) по дням и в целом
+type Report struct {
+	From     time.Time
+	To       time.Time
+	Total    Metrics
+	Days     []Day
+	Services []ServiceStats
+}
+
+// accumulator собирает значения для одного набора показателей
+type accumulator struct {
+	metrics Metrics
+	waits   []time.Duration
+	times   []time.Duration
+}
+
+// Compute считает показатели за период [from, to). Запись относится ко дню
+// времени записи, для живой очереди - дню постановки в очередь. Выручка
+// относится ко дню оплаты
+func Compute(from, to time.Time) (*Report, error) {
+	records, err := db.ListAnalyticsRecords(from, to)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := db.ListPaidOrders(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to = from.Local(), to.Local()
+	report := &Report{From: from, To: to}
+
+	var days []*accumulator
+	index := make(map[string]*accumulator)
+	for day := dayStart(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		acc := &accumulator{}
+		days = append(days, acc)
+		index[day.Format("2006-01-02")] = acc
+		report.Days = append(report.Days, Day{Date: day})
+	}
+
+	total := &accumulator{}
+	services := make(map[string]*accumulator)
+
+	for _, record := range records {
+		at := record.Date
+		if record.Record.Record != nil {
+			at = *record.Record.Record
+		}
+
+		service := services[record.Service]
+		if service == nil {
+			service = &accumulator{}
+			services[record.Service] = service
+		}
+
+		for _, acc := range []*accumulator{total, index[at.Local().Format("2006-01-02")], service} {
+			if acc != nil {
+				acc.addRecord(record)
+			}
+		}
+	}
+
+	for _, order := range orders {
+		for _, acc := range []*accumulator{total, index[order.PaidAt.Local().Format("2006-01-02")]} {
+			if acc != nil {
+				acc.addOrder(order)
+			}
+		}
+	}
+
+	report.Total = total.result()
+	for i, acc := range days {
+		report.Days[i].Metrics = acc.result()
+	}
+
+	for code, acc := range services {
+		metrics := acc.result()
+		report.Services = append(report.Services, ServiceStats{
+			Service: code,
+			Records: metrics.Records,
+			Served:  metrics.Served,
+			Time:    metrics.Service,
+		})
+	}
+	sort.Slice(report.Services, func(i, j int) bool {
+		if report.Services[i].Records != report.Services[j].Records {
+			return report.Services[i].Records > report.Services[j].Records
+		}
+		return report.Services[i].Service < report.Services[j].Service
+	})
+
+	return report, nil
+}
+
+func (a *accumulator) addRecord(record db.AnalyticsRecord) {
+	m := &a.metrics
+	m.Records++
+	if record.Record.Record != nil {
+		m.Booked++
+	} else {
+		m.WalkIn++
+	}
+
+	switch record.Status {
+	case "done":
+		m.Served++
+	case "cancel":
+		m.Cancelled++
+	case "no_show":
+		m.NoShows++
+	default:
+		m.Open++
+	}
+
+	if wait, ok := waitToStart(record); ok {
+		a.waits = append(a.waits, wait)
+	}
+	if record.Status == "done" && record.StartedAt != nil && record.FinishedAt != nil {
+		if d := record.FinishedAt.Sub(*record.StartedAt); d >= 0 {
+			a.times = append(a.times, d)
+		}
+	}
+}
+
+func (a *accumulator) addOrder(order db.PaidOrder) {
+	m := &a.metrics
+	m.PaidOrders++
+	m.Revenue += order.Total
+	m.RevenueVAT += order.VAT
+	if m.ByPayment == nil {
+		m.ByPayment = make(map[string]int64)
+	}
+	m.ByPayment[order.Payment] += order.Total
+}
+
+func (a *accumulator) result() Metrics {
+	m := a.metrics
+	if m.Records > 0 {
+		m.CancelRate = rate(m.Cancelled, m.Records)
+	}
+	if m.Booked > 0 {
+		m.NoShowRate = rate(m.NoShows, m.Booked)
+	}
+	if m.PaidOrders > 0 {
+		m.AverageCheck = m.Revenue / int64(m.PaidOrders)
+	}
+	if m.ByPayment == nil {
+		m.ByPayment = map[string]int64{}
+	}
+	m.Wait = distribution(a.waits)
+	m.Service = distribution(a.times)
+	return m
+}
+
+// waitToStart ожидание от приезда до начала работ. Приезд - отметка "Принят",
+// без нее - постановка в живую очередь (для опоздавших - перевод в нее) или
+// время предварительной записи.
+// Клиента, начатого раньше своего времени, считаем не ожидавшим
+func waitToStart(record db.AnalyticsRecord) (time.Duration, bool) {
+	if record.StartedAt == nil {
+		return 0, false
+	}
+
+	arrived := record.Date
+	switch {
+	case record.WelcomedAt != nil:
+		arrived = *record.WelcomedAt
+	case record.ConvertedAt != nil:
+		arrived = *record.ConvertedAt
+	case record.Record.Record != nil:
+		arrived = *record.Record.Record
+	}
+
+	return max(record.StartedAt.Sub(arrived), 0), true
+}
+
+// distribution среднее и 90-й процентиль (по ближайшему рангу)
+func distribution(values []time.Duration) Duration {
+	if len(values) == 0 {
+		return Duration{}
+	}
+
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum time.Duration
+	for _, v := range sorted {
+		sum += v
+	}
+
+	rank := int(math.Ceil(0.9*float64(len(sorted)))) - 1
+	return Duration{
+		Samples: len(sorted),
+		Average: sum / time.Duration(len(sorted)),
+		P90:     sorted[rank],
+	}
+}
+
+// rate доля с точностью до десятых процента
+func rate(part, whole int) float64 {
+	return math.Round(float64(part)/float64(whole)*1000) / 1000
+}
+
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"time"
+	"tire-pepair-record-service/pkg/analytics"
+)
+
+// Ограничения периода показателей
+const (
+	analyticsDefaultDays = 30
+	analyticsMaxPeriod   = 366 * 24 * time.Hour
+)
+
+// minutes длительность в минутах с точностью до десятых
+func minutes(d time.Duration) float64 {
+	return math.Round(d.Minutes()*10) / 10
+}
+
+func normalizeDuration(d analytics.Duration) map[string]any {
+	return map[string]any{
+		"samples":        d.Samples,
+		"averageMinutes": minutes(d.Average),
+		"p90Minutes":     minutes(d.P90),
+	}
+}
+
+// normalizeMetrics преобразует показатели в формат ответа. Суммы в копейках
+func normalizeMetrics(m analytics.Metrics) map[string]any {
+	return map[string]any{
+		"records":      m.Records,
+		"booked":       m.Booked,
+		"walkIn":       m.WalkIn,
+		"served":       m.Served,
+		"cancelled":    m.Cancelled,
+		"noShows":      m.NoShows,
+		"open":         m.Open,
+		"cancelRate":   m.CancelRate,
+		"noShowRate":   m.NoShowRate,
+		"wait":         normalizeDuration(m.Wait),
+		"service":      normalizeDuration(m.Service),
+		"paidOrders":   m.PaidOrders,
+		"revenue":      m.Revenue,
+		"revenueVat":   m.RevenueVAT,
+		"averageCheck": m.AverageCheck,
+		"byPayment":    m.ByPayment,
+	}
+}
+
+func normalizeServiceStats(stats []analytics.ServiceStats) []map[string]any {
+	normalized := make([]map[string]any, len(stats))
+	for i, s := range stats {
+		normalized[i] = map[string]any{
+			"service": s.Service,
+			"records": s.Records,
+			"served":  s.Served,
+			"time":    normalizeDuration(s.Time),
+		}
+	}
+	return normalized
+}
+
+// GET /api/v1/analytics?from=&to=
+// Показатели за период и по дням. По умолчанию - последние 30 дней
+func analyticsHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	query := req.URL.Query()
+
+	from, err := parseTimeParam(query.Get("from"), false)
+	if err != nil {
+		logger.Printf("WARN: invalid from, %v", err)
+		writeError(res, req, errInvalidDate)
+		return
+	}
+	to, err := parseTimeParam(query.Get("to"), true)
+	if err != nil {
+		logger.Printf("WARN: invalid to, %v", err)
+		writeError(res, req, errInvalidDate)
+		return
+	}
+
+	now := time.Now()
+	if to == nil {
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.Local)
+		to = &tomorrow
+	}
+	if from == nil {
+		start := to.AddDate(0, 0, -analyticsDefaultDays)
+		from = &start
+	}
+	if !to.After(*from) || to.Sub(*from) > analyticsMaxPeriod {
+		logger.Printf("WARN: invalid analytics period %s - %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+		writeError(res, req, errInvalidPeriod)
+		return
+	}
+
+	report, err := analytics.Compute(*from, *to)
+	if err != nil {
+		logger.Printf("ERROR: computing analytics error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	days := make([]map[string]any, len(report.Days))
+	for i, day := range report.Days {
+		days[i] = map[string]any{
+			"date":    day.Date.Format("2006-01-02"),
+			"metrics": normalizeMetrics(day.Metrics),
+		}
+	}
+
+	logger.Printf("INFO: analytics for %s - %s computed", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	writeJson(res, http.StatusOK, map[string]any{
+		"from":     report.From,
+		"to":       report.To,
+		"total":    normalizeMetrics(report.Total),
+		"days":     days,
+		"services": normalizeServiceStats(report.Services),
+	})
+}
+
+// GET /api/v1/analytics/daily?date=
+// Отчет за день: показатели и разбивка по видам работ. По умолчанию - сегодня
+func dailyReportHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	now := time.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	if value := req.URL.Query().Get("date"); value != "" {
+		date, err := parseDateParam(value)
+		if err != nil {
+			logger.Printf("WARN: invalid date, %v", err)
+			writeError(res, req, errInvalidDate)
+			return
+		}
+		day = date
+	}
+
+	report, err := analytics.Compute(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		logger.Printf("ERROR: computing daily report error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: daily report for %s computed", day.Format("2006-01-02"))
+	writeJson(res, http.StatusOK, map[string]any{
+		"date":     day.Format("2006-01-02"),
+		"metrics":  normalizeMetrics(report.Total),
+		"services": normalizeServiceStats(report.Services),
+	})
+}
@@ -5,12 +5,30 @@ import (
 	"log"
 	"net/http"
 	"time"
+	"tire-pepair-record-service/pkg/db"
 )
 
 type AddRecordRequest struct {
 	Title   string     `json:"title"`
 	Record  *time.Time `json:"record,omitempty"`
 	Comment string     `json:"comment"`
+	Service string     `json:"service,omitempty"`
+
+	HoldToken string `json:"holdToken,omitempty"` // токен удержания выбранного времени
+
+	Contacts *ContactsRequest `json:"contacts,omitempty"` // куда присылать уведомления о записи
+}
+
+// ContactsRequest контакты клиента для уведомлений. Пустое поле - канал не используется
+type ContactsRequest struct {
+	Phone    string `json:"phone,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Telegram string `json:"telegram,omitempty"`
+	Lang     string `json:"lang,omitempty"`
+}
+
+func (c ContactsRequest) toContacts() db.Contacts {
+	return db.Contacts{Phone: c.Phone, Email: c.Email, Telegram: c.Telegram, Language: c.Lang}
 }
 
 type UpdateRecordRequest struct {
@@ -34,6 +52,11 @@ type StatusRequest struct {
 	Status string `json:"status"`
 }
 
+type CallNextRequest struct {
+	Bay        int    `json:"bay,omitempty"`
+	MechanicID *int64 `json:"mechanicId,omitempty"`
+}
+
 type PaginationRequest struct {
 	Limit  int `json:"limit"`
 	Offset int `json:"offset"`
@@ -48,30 +71,26 @@ func writeJson(res http.ResponseWriter, status int, data interface{}) {
 	}
 }
 
-// Вспомогательная функции для JSON ошибок
-func writeJsonError(res http.ResponseWriter, status int, message string) {
-	writeJson(res, status, map[string]string{"error": message})
-}
-
 // Функция инициализации API
 func Init(mux *http.ServeMux, logger *log.Logger) {
 	mux.HandleFunc("/api/signin", func(res http.ResponseWriter, req *http.Request) {
 		signin(res, req, logger)
 	})
 
+	// Устаревшие RPC-эндпоинты, сохранены как псевдонимы ресурсного API /api/v1
 	// Публичные эндпоинты
-	mux.HandleFunc("/api/GetAvailableSlots", func(res http.ResponseWriter, req *http.Request) {
+	mux.HandleFunc("/api/GetAvailableSlots", deprecated(func(res http.ResponseWriter, req *http.Request) {
 		getAvailableSlotsHandler(res, req, logger)
-	})
-	mux.HandleFunc("/api/GetRecordsByDate", func(res http.ResponseWriter, req *http.Request) {
+	}, "/api/v1/slots"))
+	mux.HandleFunc("/api/GetRecordsByDate", deprecated(func(res http.ResponseWriter, req *http.Request) {
 		getRecordsByDateHandler(res, req, logger)
-	})
-	mux.HandleFunc("/api/AddRecord", func(res http.ResponseWriter, req *http.Request) {
+	}, "/api/v1/records"))
+	mux.HandleFunc("/api/AddRecord", deprecated(idempotent(func(res http.ResponseWriter, req *http.Request) {
 		addRecordHandler(res, req, logger)
-	})
-	mux.HandleFunc("/api/GetTodayRecords", func(res http.ResponseWriter, req *http.Request) {
+	}, logger), "/api/v1/records"))
+	mux.HandleFunc("/api/GetTodayRecords", deprecated(func(res http.ResponseWriter, req *http.Request) {
 		getTodayRecordsHandler(res, req, logger)
-	})
+	}, "/api/v1/records/today"))
 
 	getPendingRecords := func(res http.ResponseWriter, req *http.Request) { getPendingRecordsHandler(res, req, logger) }
 	getActiveRecords := func(res http.ResponseWriter, req *http.Request) { getActiveRecordsHandler(res, req, logger) }
@@ -81,14 +100,20 @@ func Init(mux *http.ServeMux, logger *log.Logger) {
 	getAllRecords := func(res http.ResponseWriter, req *http.Request) { getAllRecordsHandler(res, req, logger) }
 	getRecordsByStatus := func(res http.ResponseWriter, req *http.Request) { getRecordsByStatusHandler(res, req, logger) }
 	getRecordByID := func(res http.ResponseWriter, req *http.Request) { getRecordByIDHandler(res, req, logger) }
+	callNext := func(res http.ResponseWriter, req *http.Request) { callNextHandler(res, req, logger) }
 
 	// Защищенные эндпоинты (требуют авторизации)
-	mux.HandleFunc("/api/GetPendingRecords", auth(getPendingRecords, logger))
-	mux.HandleFunc("/api/GetActiveRecords", auth(getActiveRecords, logger))
-	mux.HandleFunc("/api/UpdateRecord", auth(updateRecord, logger))
-	mux.HandleFunc("/api/DeleteRecord", auth(deleteRecord, logger))
-	mux.HandleFunc("/api/UpdateRecordStatus", auth(updateRecordStatus, logger))
-	mux.HandleFunc("/api/GetAllRecords", auth(getAllRecords, logger))
-	mux.HandleFunc("/api/GetRecordsByStatus", auth(getRecordsByStatus, logger))
-	mux.HandleFunc("/api/GetRecordByID", auth(getRecordByID, logger))
+	mux.HandleFunc("/api/GetPendingRecords", deprecated(auth(getPendingRecords, logger), "/api/v1/records?status=wait"))
+	mux.HandleFunc("/api/GetActiveRecords", deprecated(auth(getActiveRecords, logger), "/api/v1/records"))
+	mux.HandleFunc("/api/UpdateRecord", deprecated(auth(updateRecord, logger), "/api/v1/records/{id}"))
+	mux.HandleFunc("/api/DeleteRecord", deprecated(auth(deleteRecord, logger), "/api/v1/records/{id}"))
+	mux.HandleFunc("/api/UpdateRecordStatus", deprecated(auth(updateRecordStatus, logger), "/api/v1/records/{id}"))
+	mux.HandleFunc("/api/GetAllRecords", deprecated(auth(getAllRecords, logger), "/api/v1/records"))
+	mux.HandleFunc("/api/GetRecordsByStatus", deprecated(auth(getRecordsByStatus, logger), "/api/v1/records"))
+	mux.HandleFunc("/api/GetRecordByID", deprecated(auth(getRecordByID, logger), "/api/v1/records/{id}"))
+
+	mux.HandleFunc("/api/CallNext", auth(callNext, logger))
+
+	// Ресурсное API
+	initV1(mux, logger)
 }
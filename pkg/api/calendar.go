@@ -0,0 +1,130 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+)
+
+var errInvalidDuration = newApiError("invalid_duration", http.StatusBadRequest, "Некорректная длительность работ", "Invalid service duration")
+
+// GET /api/v1/calendar?from=YYYY-MM-DD&to=YYYY-MM-DD
+// Свободное время по дням, по умолчанию на две недели вперед
+func calendarV1Handler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	query := req.URL.Query()
+
+	from := time.Now()
+	if value := query.Get("from"); value != "" {
+		date, err := parseDateParam(value)
+		if err != nil {
+			logger.Printf("WARN: invalid date, %v", err)
+			writeError(res, req, errInvalidDate)
+			return
+		}
+		from = date
+	}
+
+	to := from.AddDate(0, 0, 13)
+	if value := query.Get("to"); value != "" {
+		date, err := parseDateParam(value)
+		if err != nil {
+			logger.Printf("WARN: invalid date, %v", err)
+			writeError(res, req, errInvalidDate)
+			return
+		}
+		to = date
+	}
+
+	availability, err := db.GetAvailability(from, to)
+	if err != nil {
+		logger.Printf("WARN: getting availability error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	days := make([]map[string]any, len(availability))
+	for i, day := range availability {
+		slots := day.Slots
+		if slots == nil {
+			slots = []time.Time{}
+		}
+		days[i] = map[string]any{
+			"date":  day.Date.Format("2006-01-02"),
+			"total": day.Total,
+			"free":  len(day.Slots),
+			"slots": slots,
+		}
+	}
+
+	logger.Printf("INFO: availability for %d days retrieved successfully", len(days))
+	writeJson(res, http.StatusOK, map[string]any{"days": days})
+}
+
+// GET /api/v1/slots/next?after=&service=&duration=&times=09:00-12:00,15:00-18:00
+// Ближайшее время, когда подряд свободно достаточно слотов для работы
+func nextSlotV1Handler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	query := req.URL.Query()
+
+	after, err := parseTimeParam(query.Get("after"), false)
+	if err != nil {
+		logger.Printf("WARN: invalid date, %v", err)
+		writeError(res, req, errInvalidDate)
+		return
+	}
+	if after == nil {
+		now := time.Now()
+		after = &now
+	}
+
+	// Длительность задается явно в минутах или видом работ
+	duration := time.Duration(db.Interval) * time.Minute
+	if service := query.Get("service"); service != "" {
+		if !db.IsValidService(service) {
+			logger.Printf("WARN: invalid service %s", service)
+			writeError(res, req, db.ErrInvalidService)
+			return
+		}
+		duration = db.ServiceDuration(service)
+	}
+	if value := query.Get("duration"); value != "" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes <= 0 || minutes > 24*60 {
+			logger.Printf("WARN: invalid duration %s", value)
+			writeError(res, req, errInvalidDuration)
+			return
+		}
+		duration = time.Duration(minutes) * time.Minute
+	}
+
+	var ranges []db.DayRange
+	for _, value := range query["times"] {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			r, err := db.ParseDayRange(part)
+			if err != nil {
+				logger.Printf("WARN: invalid time range %s", part)
+				writeError(res, req, err)
+				return
+			}
+			ranges = append(ranges, r)
+		}
+	}
+
+	slot, err := db.FindNextAvailable(*after, duration, ranges)
+	if err != nil {
+		logger.Printf("WARN: finding next available slot error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: next available slot %s found", slot.Format(time.RFC3339))
+	writeJson(res, http.StatusOK, map[string]any{
+		"record":   slot,
+		"duration": int(duration / time.Minute),
+	})
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"tire-pepair-record-service/pkg/commerceml"
+)
+
+// commerceMLMaxPeriod наибольший период выгрузки в 1С
+const commerceMLMaxPeriod = 366 * 24 * time.Hour
+
+// GET /api/v1/accounting/commerceml?from=&to=
+// Выгрузка закрытых заказ-нарядов и оплат в формате CommerceML для 1С. По
+// умолчанию - с начала текущего месяца по сегодня включительно
+func commerceMLHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	query := req.URL.Query()
+	now := time.Now()
+
+	from, err := parseTimeParam(query.Get("from"), false)
+	if err != nil {
+		logger.Printf("WARN: invalid period start, %v", err)
+		writeError(res, req, errInvalidDate)
+		return
+	}
+	to, err := parseTimeParam(query.Get("to"), true)
+	if err != nil {
+		logger.Printf("WARN: invalid period end, %v", err)
+		writeError(res, req, errInvalidDate)
+		return
+	}
+
+	if from == nil {
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+		from = &monthStart
+	}
+	if to == nil {
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.Local)
+		to = &tomorrow
+	}
+	if !to.After(*from) || to.Sub(*from) > commerceMLMaxPeriod {
+		logger.Printf("WARN: invalid 1C export period %s - %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+		writeError(res, req, errInvalidPeriod)
+		return
+	}
+
+	// Выгрузка собирается целиком, чтобы ошибка базы не оборвала файл посередине
+	var buf bytes.Buffer
+	if err := commerceml.Export(&buf, *from, *to, now); err != nil {
+		logger.Printf("ERROR: 1C export error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	filename := fmt.Sprintf("1c-%s-%s.xml", from.Format("2006-01-02"), to.AddDate(0, 0, -1).Format("2006-01-02"))
+	res.Header().Set("Content-Type", commerceml.ContentType)
+	res.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	res.Header().Set("Cache-Control", "no-cache")
+	res.WriteHeader(http.StatusOK)
+	res.Write(buf.Bytes())
+
+	logger.Printf("INFO: 1C export for %s - %s sent", from.Format("2006-01-02"), to.Format("2006-01-02"))
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"tire-pepair-record-service/pkg/csvimport"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/documents"
+	"tire-pepair-record-service/pkg/escpos"
+	"tire-pepair-record-service/pkg/pdf"
+	"tire-pepair-record-service/pkg/queue"
+	"tire-pepair-record-service/pkg/tickets"
+)
+
+// ApiError ошибка API со стабильным машиночитаемым кодом и локализованными сообщениями
+type ApiError struct {
+	Code     string
+	Status   int
+	Messages map[string]string // язык -> текст сообщения
+	Detail   string            // техническая подробность (например, ошибка разбора JSON)
+}
+
+func (e *ApiError) Error() string {
+	if e.Detail != "" {
+		return e.Code + ": " + e.Detail
+	}
+	return e.Code
+}
+
+// withDetail возвращает копию ошибки с технической подробностью
+func (e *ApiError) withDetail(detail string) *ApiError {
+	copied := *e
+	copied.Detail = detail
+	return &copied
+}
+
+// Message возвращает сообщение на языке lang, по умолчанию на русском
+func (e *ApiError) Message(lang string) string {
+	if message, ok := e.Messages[lang]; ok {
+		return message
+	}
+	return e.Messages[defaultLanguage]
+}
+
+func newApiError(code string, status int, ru, en string) *ApiError {
+	return &ApiError{
+		Code:     code,
+		Status:   status,
+		Messages: map[string]string{"ru": ru, "en": en},
+	}
+}
+
+const defaultLanguage = "ru"
+
+var supportedLanguages = []string{"ru", "en"}
+
+// Ошибки уровня API
+var (
+	errInternal              = newApiError("internal", http.StatusInternalServerError, "Внутренняя ошибка сервера", "Internal server error")
+	errMethodNotAllowed      = newApiError("method_not_allowed", http.StatusMethodNotAllowed, "Метод не поддерживается", "Method not allowed")
+	errInvalidJSON           = newApiError("invalid_json", http.StatusBadRequest, "Некорректное тело запроса", "Malformed request body")
+	errUnauthorized          = newApiError("unauthorized", http.StatusUnauthorized, "Требуется авторизация", "Authentication required")
+	errInvalidPassword       = newApiError("invalid_password", http.StatusUnauthorized, "Неверный пароль", "Incorrect password")
+	errTitleRequired         = newApiError("title_required", http.StatusUnprocessableEntity, "Укажите номер автомобиля", "Car number is required")
+	errIDRequired            = newApiError("id_required", http.StatusBadRequest, "Не указан ID записи", "Record ID is required")
+	errInvalidID             = newApiError("invalid_id", http.StatusBadRequest, "Некорректный ID записи", "Invalid record ID")
+	errInvalidDate           = newApiError("invalid_date", http.StatusBadRequest, "Некорректная дата", "Invalid date")
+	errInvalidBay            = newApiError("invalid_bay", http.StatusBadRequest, "Некорректный номер поста", "Invalid bay number")
+	errInvalidKind           = newApiError("invalid_kind", http.StatusBadRequest, "Тип записи должен быть booked или walkin", "Record kind must be booked or walkin")
+	errInvalidExportFormat   = newApiError("invalid_export_format", http.StatusBadRequest, "Формат выгрузки должен быть csv или xlsx", "Export format must be csv or xlsx")
+	errInvalidStaffID        = newApiError("invalid_staff_id", http.StatusBadRequest, "Некорректный ID мастера", "Invalid staff ID")
+	errInvalidQRFormat       = newApiError("invalid_qr_format", http.StatusBadRequest, "Формат QR-кода должен быть svg или png", "QR code format must be svg or png")
+	errInvalidNotifyID       = newApiError("invalid_notification_id", http.StatusBadRequest, "Некорректный ID уведомления", "Invalid notification ID")
+	errInvalidNotifyStatus   = newApiError("invalid_notification_status", http.StatusBadRequest, "Статус уведомления должен быть pending, sent или failed", "Notification status must be pending, sent or failed")
+	errInvalidWebhookID      = newApiError("invalid_webhook_id", http.StatusBadRequest, "Некорректный ID вебхука", "Invalid webhook ID")
+	errInvalidDeliveryID     = newApiError("invalid_delivery_id", http.StatusBadRequest, "Некорректный ID доставки", "Invalid delivery ID")
+	errInvalidDeliveryStatus = newApiError("invalid_delivery_status", http.StatusBadRequest, "Статус доставки должен быть pending, delivered или dead", "Delivery status must be pending, delivered or dead")
+	errInvalidFeedID         = newApiError("invalid_feed_id", http.StatusBadRequest, "Некорректный ID подписки на календарь", "Invalid calendar feed ID")
+	errInvalidPeriod         = newApiError("invalid_period", http.StatusBadRequest, "Некорректный период: конец позже начала, не более года", "Invalid period: the end must be after the start, at most one year")
+	errImportRejected        = newApiError("import_rejected", http.StatusUnprocessableEntity, "Импорт не выполнен: в файле есть строки с ошибками", "Nothing was imported: some rows have errors")
+	errImportTooLarge        = newApiError("import_too_large", http.StatusRequestEntityTooLarge, "Файл импорта слишком большой", "The import file is too large")
+	errInvalidQRScale        = newApiError("invalid_qr_scale", http.StatusBadRequest, "Масштаб QR-кода должен быть от 1 до 32", "QR code scale must be between 1 and 32")
+)
+
+// dbErrors сопоставление ошибок пакета db с ошибками API
+var dbErrors = []struct {
+	target error
+	apiErr *ApiError
+}{
+	{db.ErrRecordNotFound, newApiError("not_found", http.StatusNotFound, "Запись не найдена", "Record not found")},
+	{db.ErrVersionConflict, newApiError("version_conflict", http.StatusConflict, "Запись была изменена другим пользователем", "The record was modified by someone else")},
+	{db.ErrCutoffPassed, newApiError("cutoff_passed", http.StatusUnprocessableEntity, "До записи осталось слишком мало времени, изменить ее можно только по телефону", "It is too late to change this booking online")},
+	{db.ErrNotModifiable, newApiError("not_modifiable", http.StatusConflict, "Запись в текущем статусе нельзя изменить", "The booking can no longer be changed")},
+	{db.ErrWalkInRecord, newApiError("walk_in_record", http.StatusConflict, "Место в живой очереди нельзя перенести на другое время, запишитесь заново", "A walk-in queue entry cannot be rescheduled, please make a new booking")},
+	{db.ErrTimeSlotTaken, newApiError("slot_taken", http.StatusConflict, "Время записи уже занято", "The time slot is already taken")},
+	{db.ErrInvalidStatus, newApiError("invalid_status", http.StatusUnprocessableEntity, "Недопустимый статус записи", "Invalid record status")},
+	{db.ErrTimeTooEarly, newApiError("time_too_early", http.StatusUnprocessableEntity, "Время записи раньше начала рабочего дня", "The time is before opening hours")},
+	{db.ErrTimeTooLate, newApiError("time_too_late", http.StatusUnprocessableEntity, "Время записи позже окончания рабочего дня", "The time is after closing hours")},
+	{db.ErrTimeNotAligned, newApiError("time_not_aligned", http.StatusUnprocessableEntity, "Время записи не кратно интервалу", "The time is not aligned to the booking interval")},
+	{db.ErrTimeTooClose, newApiError("time_too_close", http.StatusUnprocessableEntity, "Время записи слишком близко к текущему времени", "The time is too close to now")},
+	{db.ErrInvalidSort, newApiError("invalid_sort", http.StatusBadRequest, "Недопустимое поле сортировки", "Unsupported sort field")},
+	{db.ErrInvalidCursor, newApiError("invalid_cursor", http.StatusBadRequest, "Некорректный курсор", "Invalid cursor")},
+	{db.ErrInvalidService, newApiError("invalid_service", http.StatusUnprocessableEntity, "Неизвестный вид работ", "Unknown service type")},
+	{queue.ErrQueueEmpty, newApiError("queue_empty", http.StatusNotFound, "В очереди нет клиентов, которых можно вызвать", "Nobody in the queue can be called now")},
+	{queue.ErrBayBusy, newApiError("bay_busy", http.StatusConflict, "Пост занят", "The bay is busy")},
+	{queue.ErrNoFreeBay, newApiError("no_free_bay", http.StatusConflict, "Нет свободных постов", "All bays are busy")},
+	{queue.ErrInvalidBay, errInvalidBay},
+	{db.ErrBookingRestricted, newApiError("booking_restricted", http.StatusForbidden, "Предварительная запись недоступна из-за неявок, запишитесь в живую очередь", "Booking is unavailable due to missed appointments, please join the walk-in queue")},
+	{db.ErrInvalidWindow, newApiError("invalid_window", http.StatusUnprocessableEntity, "Некорректное окно времени: начало должно быть раньше конца, конец - в будущем", "Invalid time window: it must start before it ends and end in the future")},
+	{db.ErrNoOffer, newApiError("no_offer", http.StatusConflict, "Нет действующего предложения времени", "There is no active offer")},
+	{db.ErrOfferExpired, newApiError("offer_expired", http.StatusGone, "Срок предложения истек", "The offer has expired")},
+	{db.ErrHoldNotFound, newApiError("hold_not_found", http.StatusNotFound, "Удержание времени не найдено", "Slot hold not found")},
+	{db.ErrHoldExpired, newApiError("hold_expired", http.StatusGone, "Время удержания истекло, выберите время заново", "The slot hold has expired, please pick the time again")},
+	{db.ErrHoldMismatch, newApiError("hold_mismatch", http.StatusUnprocessableEntity, "Удержание относится к другому времени", "The hold is for a different time")},
+	{db.ErrHoldLimit, newApiError("hold_limit", http.StatusServiceUnavailable, "Сейчас удерживается слишком много времени, попробуйте через несколько минут", "Too many slots are held right now, please try again in a few minutes")},
+	{db.ErrInvalidRange, newApiError("invalid_range", http.StatusBadRequest, "Некорректный период: не более 60 дней, конец не раньше начала", "Invalid date range: at most 60 days, end not before start")},
+	{db.ErrInvalidTimeRange, newApiError("invalid_time_range", http.StatusBadRequest, "Некорректный интервал времени суток, ожидается ЧЧ:ММ-ЧЧ:ММ", "Invalid time of day range, expected HH:MM-HH:MM")},
+	{db.ErrNoAvailableSlot, newApiError("no_available_slot", http.StatusNotFound, "Свободного времени не найдено", "No available time found")},
+	{db.ErrStaffNotFound, newApiError("staff_not_found", http.StatusNotFound, "Мастер не найден", "Staff member not found")},
+	{db.ErrStaffInactive, newApiError("staff_inactive", http.StatusUnprocessableEntity, "Мастер деактивирован, назначить на него запись нельзя", "The staff member is inactive and cannot be assigned")},
+	{db.ErrStaffNameNeeded, newApiError("staff_name_required", http.StatusUnprocessableEntity, "Укажите имя мастера", "Staff name is required")},
+	{db.ErrCatalogItemNotFound, newApiError("catalog_item_not_found", http.StatusNotFound, "Позиция справочника не найдена", "Catalog item not found")},
+	{db.ErrInvalidCatalogItem, newApiError("invalid_catalog_item", http.StatusUnprocessableEntity, "Некорректная позиция справочника", "Invalid catalog item")},
+	{db.ErrWorkOrderNotFound, newApiError("work_order_not_found", http.StatusNotFound, "Заказ-наряд не найден", "Work order not found")},
+	{db.ErrWorkOrderClosed, newApiError("work_order_closed", http.StatusConflict, "Заказ-наряд закрыт для изменений", "The work order is closed")},
+	{db.ErrWorkOrderNotReady, newApiError("work_order_not_ready", http.StatusUnprocessableEntity, "Заказ-наряд нельзя закрыть: он пуст, работы не завершены или итог не зафиксирован", "The work order cannot be closed yet")},
+	{db.ErrOrderLineNotFound, newApiError("order_line_not_found", http.StatusNotFound, "Строка заказ-наряда не найдена", "Work order line not found")},
+	{db.ErrInvalidOrderLine, newApiError("invalid_order_line", http.StatusUnprocessableEntity, "Некорректное количество или скидка", "Invalid quantity or discount")},
+	{db.ErrInvalidPayment, newApiError("invalid_payment", http.StatusUnprocessableEntity, "Неизвестный способ оплаты", "Unknown payment method")},
+	{documents.ErrNoFont, newApiError("pdf_unavailable", http.StatusServiceUnavailable, "Печать недоступна: не найден шрифт, задайте TODO_PDF_FONT", "Printing is unavailable: no font found, set TODO_PDF_FONT")},
+	{documents.ErrNotPaid, newApiError("not_paid", http.StatusConflict, "Чек печатается только по оплаченному заказ-наряду", "A receipt is only available for a paid work order")},
+	{pdf.ErrTemplate, newApiError("template_error", http.StatusInternalServerError, "Ошибка в шаблоне печатной формы", "The print template is invalid")},
+	{tickets.ErrNoPrinter, newApiError("printer_not_configured", http.StatusServiceUnavailable, "Принтер талонов не настроен, задайте TODO_TICKET_PRINTER", "The ticket printer is not configured, set TODO_TICKET_PRINTER")},
+	{escpos.ErrPrinter, newApiError("printer_unavailable", http.StatusBadGateway, "Принтер талонов недоступен", "The ticket printer is unavailable")},
+	{db.ErrInvalidPhone, newApiError("invalid_phone", http.StatusUnprocessableEntity, "Некорректный номер телефона", "Invalid phone number")},
+	{db.ErrInvalidEmail, newApiError("invalid_email", http.StatusUnprocessableEntity, "Некорректный адрес электронной почты", "Invalid email address")},
+	{db.ErrInvalidTelegram, newApiError("invalid_telegram", http.StatusUnprocessableEntity, "Некорректный идентификатор чата Telegram", "Invalid Telegram chat ID")},
+	{db.ErrInvalidLanguage, newApiError("invalid_language", http.StatusUnprocessableEntity, "Язык уведомлений должен быть ru или en", "Notification language must be ru or en")},
+	{db.ErrNotificationMissing, newApiError("notification_not_found", http.StatusNotFound, "Уведомление не найдено или уже доставлено", "Notification not found or already delivered")},
+	{db.ErrWebhookNotFound, newApiError("webhook_not_found", http.StatusNotFound, "Вебхук не найден", "Webhook not found")},
+	{db.ErrInvalidWebhookURL, newApiError("invalid_webhook_url", http.StatusUnprocessableEntity, "Адрес вебхука должен быть абсолютным http(s) URL", "Webhook URL must be an absolute http(s) URL")},
+	{db.ErrInvalidWebhookEvent, newApiError("invalid_webhook_event", http.StatusUnprocessableEntity, "Неизвестное событие вебхука", "Unknown webhook event")},
+	{db.ErrDeliveryNotFound, newApiError("delivery_not_found", http.StatusNotFound, "Доставка вебхука не найдена", "Webhook delivery not found")},
+	{db.ErrFeedNotFound, newApiError("feed_not_found", http.StatusNotFound, "Подписка на календарь не найдена или отозвана", "Calendar feed not found or revoked")},
+	{db.ErrInvalidTime, newApiError("invalid_time", http.StatusUnprocessableEntity, "Некорректное время записи", "Invalid record time")},
+	{db.ErrPlateRequired, errTitleRequired},
+	{csvimport.ErrEmptyFile, newApiError("import_empty", http.StatusBadRequest, "Файл импорта пуст", "The import file is empty")},
+	{csvimport.ErrNoPlate, newApiError("import_no_plate", http.StatusBadRequest, "В файле нет колонки с номером автомобиля, укажите сопоставление plate", "The file has no car number column, map the plate field")},
+	{csvimport.ErrUnknownField, newApiError("import_unknown_field", http.StatusBadRequest, "Неизвестное поле в сопоставлении колонок", "Unknown field in the column mapping")},
+	{csvimport.ErrNoColumn, newApiError("import_no_column", http.StatusBadRequest, "Колонка из сопоставления не найдена в заголовке файла", "A mapped column is missing from the file header")},
+	{csvimport.ErrInvalidCSV, newApiError("invalid_csv", http.StatusBadRequest, "Некорректный CSV", "Malformed CSV")},
+}
+
+// toApiError приводит произвольную ошибку к ошибке API
+func toApiError(err error) *ApiError {
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	for _, mapping := range dbErrors {
+		if errors.Is(err, mapping.target) {
+			return mapping.apiErr
+		}
+	}
+
+	return errInternal
+}
+
+// preferredLanguage выбирает язык ответа по заголовку Accept-Language
+func preferredLanguage(req *http.Request) string {
+	header := req.Header.Get("Accept-Language")
+	if header == "" {
+		return defaultLanguage
+	}
+
+	type candidate struct {
+		lang    string
+		quality float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		lang := strings.ToLower(strings.TrimSpace(fields[0]))
+		if i := strings.IndexByte(lang, '-'); i >= 0 {
+			lang = lang[:i]
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if value, ok := strings.CutPrefix(param, "q="); ok {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		candidates = append(candidates, candidate{lang, quality})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+
+	for _, c := range candidates {
+		for _, supported := range supportedLanguages {
+			if c.lang == supported && c.quality > 0 {
+				return supported
+			}
+		}
+	}
+
+	return defaultLanguage
+}
+
+// writeError отправляет ошибку в формате {"error", "code"} с подходящим HTTP статусом
+func writeError(res http.ResponseWriter, req *http.Request, err error) {
+	writeErrorWith(res, req, err, nil)
+}
+
+// writeErrorWith отправляет ошибку с дополнительными полями ответа
+func writeErrorWith(res http.ResponseWriter, req *http.Request, err error, extra map[string]any) {
+	apiErr := toApiError(err)
+
+	body := map[string]any{
+		"error": apiErr.Message(preferredLanguage(req)),
+		"code":  apiErr.Code,
+	}
+	if apiErr.Detail != "" {
+		body["detail"] = apiErr.Detail
+	}
+	for key, value := range extra {
+		body[key] = value
+	}
+
+	writeJson(res, apiErr.Status, body)
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"tire-pepair-record-service/pkg/db"
+)
+
+var errInvalidIfMatch = newApiError("invalid_if_match", http.StatusBadRequest,
+	"Некорректный заголовок If-Match", "Malformed If-Match header")
+
+// recordETag возвращает ETag записи, построенный по ее версии
+func recordETag(record db.Record) string {
+	return fmt.Sprintf(`"%d"`, record.Version)
+}
+
+// parseIfMatch возвращает ожидаемую версию записи из заголовка If-Match.
+// 0 означает, что проверка версии не требуется (заголовок отсутствует или равен *)
+func parseIfMatch(req *http.Request) (int64, error) {
+	value := strings.TrimSpace(req.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+
+	value = strings.TrimPrefix(value, "W/")
+	value = strings.Trim(value, `"`)
+
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, errInvalidIfMatch
+	}
+	return version, nil
+}
+
+// writeRecordError отправляет ошибку изменения записи. При конфликте версий
+// ответ 409 содержит текущее состояние записи и ее ETag
+func writeRecordError(res http.ResponseWriter, req *http.Request, recordID int64, err error, logger *log.Logger) {
+	if !errors.Is(err, db.ErrVersionConflict) {
+		writeError(res, req, err)
+		return
+	}
+
+	current, getErr := db.GetRecordByID(recordID)
+	if getErr != nil {
+		logger.Printf("ERROR: getting current record state error, %v", getErr)
+		writeError(res, req, err)
+		return
+	}
+
+	res.Header().Set("ETag", recordETag(*current))
+	writeErrorWith(res, req, err, map[string]any{"record": normalizeRecord(*current)})
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/xlsx"
+)
+
+// Форматы выгрузки записей
+const (
+	exportCSV  = "csv"
+	exportXLSX = "xlsx"
+)
+
+// utf8BOM метка порядка байт, без нее Excel открывает CSV в кодировке Windows-1251
+const utf8BOM = "\uFEFF"
+
+// exportWriteTimeout срок записи одной пачки выгрузки. WriteTimeout сервера
+// ограничивает весь ответ и оборвал бы большую выгрузку, поэтому срок
+// продлевается перед каждой пачкой
+const exportWriteTimeout = 30 * time.Second
+
+// exportHeader колонки выгрузки в порядке exportCells
+var exportHeader = []string{
+	"Талон", "ID", "Госномер", "Тип", "Время записи", "Создана", "Вид работ", "Статус",
+	"Пост", "Мастер", "Комментарий",
+	"Принят", "В работе", "Завершен", "Отменен", "Не явился",
+	"Заказ-наряд", "Оплата", "Сумма", "Скидка", "Итого", "НДС",
+}
+
+var orderStatusLabels = map[string]string{
+	db.WorkOrderDraft: "Черновик",
+	db.WorkOrderFinal: "Закрыт",
+	db.WorkOrderPaid:  "Оплачен",
+}
+
+// exportCells значения колонок строки выгрузки. Время - *time.Time,
+// суммы - xlsx.Money, пустые значения - nil
+func exportCells(row db.ExportRow) []any {
+	kind := "Очередь"
+	if row.Record.Record != nil {
+		kind = "Запись"
+	}
+
+	service := row.ServiceName
+	if service == "" {
+		service = row.Service
+	}
+
+	status := db.StatusLabels[row.Status]
+	if status == "" {
+		status = row.Status
+	}
+
+	var bay any
+	if row.Bay != nil {
+		bay = *row.Bay
+	}
+
+	cells := []any{
+		generateTicketNumber(row.ID, row.Record.Record), row.ID, row.Title, kind, row.Record.Record, &row.Date,
+		service, status, bay, row.MechanicName, row.Comment,
+		row.WelcomedAt, row.InWorkAt, row.DoneAt, row.CancelledAt, row.NoShowAt,
+	}
+
+	if row.OrderStatus == "" {
+		return append(cells, nil, nil, nil, nil, nil, nil)
+	}
+	return append(cells, orderStatusLabels[row.OrderStatus], db.PaymentMethods[row.Payment],
+		xlsx.Money(row.OrderSubtotal), xlsx.Money(row.OrderDiscount), xlsx.Money(row.OrderTotal), xlsx.Money(row.OrderVAT))
+}
+
+// csvValue форматирует значение для CSV под русский Excel: время по местным
+// часам, суммы с десятичной запятой без разделителя разрядов
+func csvValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return csvText(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.Local().Format("02.01.2006 15:04")
+	case xlsx.Money:
+		return fmt.Sprintf("%d,%02d", v/100, v%100)
+	}
+	return fmt.Sprint(value)
+}
+
+// csvText защищает текст от выполнения как формулы: Excel считает формулой
+// ячейку, начинающуюся с =, +, -, @, табуляции или перевода строки, и госномер
+// или комментарий клиента вида =HYPERLINK(...) сработал бы у бухгалтера.
+// Апостроф в начале Excel показывает как текст
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// GET /api/v1/records/export?format=csv|xlsx&from=&to=&status=
+// Выгрузка записей для отчетов. Фильтры как у /records/search. Файл пишется
+// по мере чтения записей, ошибка посреди выгрузки обрывает ответ
+func exportRecordsHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	query := req.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = exportCSV
+	}
+	if format != exportCSV && format != exportXLSX {
+		logger.Printf("WARN: invalid export format %s", format)
+		writeError(res, req, errInvalidExportFormat)
+		return
+	}
+
+	filter, err := parseRecordFilter(query)
+	if err != nil {
+		logger.Printf("WARN: invalid record filter, %v", err)
+		writeError(res, req, err)
+		return
+	}
+	for _, status := range filter.Statuses {
+		if !db.IsValidStatus(status) {
+			logger.Printf("WARN: invalid status %s", status)
+			writeError(res, req, fmt.Errorf("%w: %s", db.ErrInvalidStatus, status))
+			return
+		}
+	}
+
+	// Срок записи продлевается перед каждой пачкой записей, см. exportWriteTimeout
+	controller := http.NewResponseController(res)
+	extendDeadline := func() {
+		err := controller.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			logger.Printf("WARN: extending export write deadline error, %v", err)
+		}
+	}
+	extendDeadline()
+
+	filename := "records-" + time.Now().Format("2006-01-02") + "." + format
+	res.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	res.Header().Set("Cache-Control", "no-cache")
+
+	var count int
+	if format == exportXLSX {
+		res.Header().Set("Content-Type", xlsx.ContentType)
+		res.WriteHeader(http.StatusOK)
+
+		var book *xlsx.Writer
+		book, err = xlsx.NewWriter(res, "Записи", exportHeader...)
+		if err == nil {
+			err = db.ExportRecords(filter, func(row db.ExportRow) error {
+				if count++; count%db.ExportBatch == 0 {
+					extendDeadline()
+				}
+				return book.WriteRow(exportCells(row)...)
+			})
+		}
+		if err == nil {
+			err = book.Close()
+		}
+	} else {
+		res.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		res.WriteHeader(http.StatusOK)
+
+		writer := csv.NewWriter(res)
+		writer.Comma = ';' // разделитель списков в русской локали Excel
+		res.Write([]byte(utf8BOM))
+		writer.Write(exportHeader)
+
+		line := make([]string, len(exportHeader))
+		err = db.ExportRecords(filter, func(row db.ExportRow) error {
+			if count++; count%db.ExportBatch == 0 {
+				extendDeadline()
+			}
+			for i, value := range exportCells(row) {
+				line[i] = csvValue(value)
+			}
+			return writer.Write(line)
+		})
+		writer.Flush()
+		if err == nil {
+			err = writer.Error()
+		}
+	}
+
+	if err != nil {
+		// Заголовок уже отправлен: обрываем соединение, чтобы клиент не принял
+		// неполный файл за готовый
+		logger.Printf("ERROR: exporting records error after %d rows, %v", count, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	logger.Printf("INFO: %d records exported as %s", count, format)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/xlsx"
+)
+
+func TestCSVValue(t *testing.T) {
+	at := time.Date(2026, 3, 14, 8, 5, 0, 0, time.UTC)
+	savedLocal := time.Local
+	t.Cleanup(func() { time.Local = savedLocal })
+	time.Local = time.FixedZone("MSK", 3*60*60)
+
+	for _, tt := range []struct {
+		value any
+		want  string
+	}{
+		{nil, ""},
+		{"А123ВС77", "А123ВС77"},
+		{"", ""},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+79991234567", "'+79991234567"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"колесо = 4 шт", "колесо = 4 шт"},
+		{42, "42"},
+		{int64(7), "7"},
+		{&at, "14.03.2026 11:05"},
+		{(*time.Time)(nil), ""},
+		{xlsx.Money(302000), "3020,00"},
+		{xlsx.Money(5), "0,05"},
+	} {
+		if got := csvValue(tt.value); got != tt.want {
+			t.Errorf("csvValue(%#v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+// setupExport открывает пустую базу во временном каталоге с одной записью,
+// комментарий которой похож на формулу
+func setupExport(t *testing.T) {
+	t.Helper()
+
+	setupDB(t)
+	if _, err := db.AddRecord(db.Record{Title: "А123ВС77", Comment: `=HYPERLINK("http://evil","ok")`}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readCSV разбирает выгрузку без BOM
+func readCSV(t *testing.T, body []byte) [][]string {
+	t.Helper()
+
+	if !bytes.HasPrefix(body, []byte(utf8BOM)) {
+		t.Fatal("export has no UTF-8 BOM")
+	}
+	reader := csv.NewReader(bytes.NewReader(body[len(utf8BOM):]))
+	reader.Comma = ';'
+	rows, err := reader.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestExportCSV(t *testing.T) {
+	setupExport(t)
+
+	res := httptest.NewRecorder()
+	exportRecordsHandler(res, httptest.NewRequest(http.MethodGet, "/api/v1/records/export?format=csv", nil),
+		log.New(io.Discard, "", 0))
+	if res.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", res.Code, res.Body)
+	}
+
+	rows := readCSV(t, res.Body.Bytes())
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want header and one record", len(rows))
+	}
+	comment := rows[1][slices.Index(exportHeader, "Комментарий")]
+	if comment != `'=HYPERLINK("http://evil","ok")` {
+		t.Errorf("comment exported as %q", comment)
+	}
+}
+
+func TestExportOutlivesWriteTimeout(t *testing.T) {
+	setupExport(t)
+
+	// Выгрузка начинает писать позже WriteTimeout сервера и все равно доходит целиком
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		exportRecordsHandler(res, req, log.New(io.Discard, "", 0))
+	}))
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL + "/api/v1/records/export?format=csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("export interrupted: %v", err)
+	}
+	if rows := readCSV(t, body); len(rows) != 2 || !strings.HasPrefix(rows[1][0], "О") {
+		t.Errorf("got %v", rows)
+	}
+}
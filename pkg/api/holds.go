@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+)
+
+var errTooManyRequests = newApiError("too_many_requests", http.StatusTooManyRequests,
+	"Слишком много запросов, попробуйте позже", "Too many requests, please try again later")
+
+var (
+	HoldRateLimit  = 10          // сколько раз клиент может удержать время за HoldRateWindow
+	HoldRateWindow = time.Minute // окно ограничения частоты удержаний
+	TrustProxy     = false       // адрес клиента берется из X-Forwarded-For от обратного прокси
+)
+
+// holdLimiter ограничивает частоту POST /api/v1/holds с одного адреса
+var holdLimiter = &rateLimiter{counts: make(map[string]int)}
+
+// SetHoldPolicy читает ограничение частоты удержаний из TODO_HOLD_RATE_LIMIT
+// (число запросов в минуту) и TODO_TRUST_PROXY
+func SetHoldPolicy(logger *log.Logger) {
+	if value := os.Getenv("TODO_HOLD_RATE_LIMIT"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			logger.Printf("WARN: invalid hold rate limit %s, is using %d\n", value, HoldRateLimit)
+		} else {
+			HoldRateLimit = limit
+		}
+	}
+
+	if value := os.Getenv("TODO_TRUST_PROXY"); value != "" {
+		trust, err := strconv.ParseBool(value)
+		if err != nil {
+			logger.Printf("WARN: invalid trust proxy flag %s, is using %t\n", value, TrustProxy)
+		} else {
+			TrustProxy = trust
+		}
+	}
+}
+
+// rateLimiter считает запросы с каждого адреса в текущем окне. Счетчики
+// сбрасываются целиком с началом нового окна, поэтому память не растет
+type rateLimiter struct {
+	mu     sync.Mutex
+	start  time.Time
+	counts map[string]int
+}
+
+// allow учитывает запрос клиента и возвращает, через сколько повторить, если лимит исчерпан
+func (l *rateLimiter) allow(client string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.start) >= HoldRateWindow || now.Before(l.start) {
+		l.start = now
+		clear(l.counts)
+	}
+
+	if l.counts[client] >= HoldRateLimit {
+		return l.start.Add(HoldRateWindow).Sub(now), false
+	}
+	l.counts[client]++
+	return 0, true
+}
+
+// clientAddress адрес клиента: последний адрес X-Forwarded-For, который добавил
+// прокси, если ему доверяем, иначе адрес соединения
+func clientAddress(req *http.Request) string {
+	if TrustProxy {
+		if forwarded := req.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			addresses := strings.Split(forwarded[len(forwarded)-1], ",")
+			if address := strings.TrimSpace(addresses[len(addresses)-1]); address != "" {
+				return address
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+type HoldRequest struct {
+	Record time.Time `json:"record"`
+}
+
+// POST /api/v1/holds
+// Удерживает выбранное время, пока клиент заполняет форму записи. Новое удержание
+// снимает предыдущее удержание того же клиента
+func createHoldHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	client := clientAddress(req)
+	if retry, ok := holdLimiter.allow(client, time.Now()); !ok {
+		logger.Printf("WARN: hold rate limit exceeded by %s", client)
+		res.Header().Set("Retry-After", strconv.Itoa(int((retry+time.Second-1)/time.Second)))
+		writeError(res, req, errTooManyRequests)
+		return
+	}
+
+	var holdReq HoldRequest
+	if err := json.NewDecoder(req.Body).Decode(&holdReq); err != nil {
+		logger.Printf("WARN: unmarshal error, %v", err)
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
+		return
+	}
+
+	hold, err := db.HoldSlot(holdReq.Record, db.SlotHoldTTL, client)
+	if err != nil {
+		logger.Printf("WARN: holding slot error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: slot %s held until %s", hold.Slot.Format(time.RFC3339), hold.ExpiresAt.Format(time.RFC3339))
+	writeJson(res, http.StatusCreated, map[string]any{
+		"token":     hold.Token,
+		"record":    hold.Slot,
+		"expiresAt": hold.ExpiresAt,
+	})
+}
+
+// DELETE /api/v1/holds/{token}
+func releaseHoldHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	if err := db.ReleaseSlotHold(req.PathValue("token")); err != nil {
+		logger.Printf("WARN: releasing slot hold error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: slot hold released")
+	res.WriteHeader(http.StatusNoContent)
+}
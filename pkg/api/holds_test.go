@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateHoldRateLimit(t *testing.T) {
+	setupDB(t)
+
+	savedLimit, savedLimiter := HoldRateLimit, holdLimiter
+	t.Cleanup(func() { HoldRateLimit, holdLimiter = savedLimit, savedLimiter })
+	HoldRateLimit = 2
+	holdLimiter = &rateLimiter{counts: make(map[string]int)}
+
+	body, err := json.Marshal(HoldRequest{Record: nextSlot(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/holds", strings.NewReader(string(body)))
+		req.RemoteAddr = remoteAddr
+		res := httptest.NewRecorder()
+		createHoldHandler(res, req, log.New(io.Discard, "", 0))
+		return res
+	}
+
+	// Повторное удержание того же времени заменяет свое предыдущее удержание
+	for i := range 2 {
+		if res := post("10.0.0.1:5000"); res.Code != http.StatusCreated {
+			t.Fatalf("request %d: status %d: %s", i, res.Code, res.Body)
+		}
+	}
+
+	res := post("10.0.0.1:5001")
+	if res.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the limit: status %d: %s", res.Code, res.Body)
+	}
+	if retry, err := strconv.Atoi(res.Header().Get("Retry-After")); err != nil || retry < 1 || retry > 60 {
+		t.Errorf("Retry-After %q", res.Header().Get("Retry-After"))
+	}
+
+	// Лимит у каждого адреса свой. Время удержано первым клиентом
+	if res := post("10.0.0.2:5000"); res.Code != http.StatusConflict {
+		t.Errorf("other client: status %d: %s", res.Code, res.Body)
+	}
+}
+
+func TestRateLimiterWindow(t *testing.T) {
+	savedLimit, savedWindow := HoldRateLimit, HoldRateWindow
+	t.Cleanup(func() { HoldRateLimit, HoldRateWindow = savedLimit, savedWindow })
+	HoldRateLimit, HoldRateWindow = 1, time.Minute
+
+	limiter := &rateLimiter{counts: make(map[string]int)}
+	start := time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		client string
+		at     time.Duration
+		want   bool
+		retry  time.Duration
+	}{
+		{"a", 0, true, 0},
+		{"a", 10 * time.Second, false, 50 * time.Second},
+		{"b", 10 * time.Second, true, 0},
+		{"a", 59 * time.Second, false, time.Second},
+		{"a", time.Minute, true, 0},
+		{"b", time.Minute, true, 0},
+	} {
+		retry, ok := limiter.allow(tt.client, start.Add(tt.at))
+		if ok != tt.want || retry != tt.retry {
+			t.Errorf("%s at %s: got %t, retry %s; want %t, retry %s", tt.client, tt.at, ok, retry, tt.want, tt.retry)
+		}
+	}
+}
+
+func TestClientAddress(t *testing.T) {
+	saved := TrustProxy
+	t.Cleanup(func() { TrustProxy = saved })
+
+	for _, tt := range []struct {
+		trust     bool
+		forwarded []string
+		want      string
+	}{
+		{false, nil, "192.0.2.1"},
+		// Без доверия к прокси заголовок подделывается клиентом и не учитывается
+		{false, []string{"10.0.0.9"}, "192.0.2.1"},
+		{true, nil, "192.0.2.1"},
+		// Адрес добавляет прокси в конец, начало списка задает клиент
+		{true, []string{"10.0.0.9, 10.0.0.7"}, "10.0.0.7"},
+		{true, []string{"10.0.0.9", "10.0.0.8"}, "10.0.0.8"},
+	} {
+		TrustProxy = tt.trust
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/holds", nil)
+		req.RemoteAddr = "192.0.2.1:41000"
+		for _, value := range tt.forwarded {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+
+		if got := clientAddress(req); got != tt.want {
+			t.Errorf("trust %t, X-Forwarded-For %q: got %s, want %s", tt.trust, tt.forwarded, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/documents"
+	"tire-pepair-record-service/pkg/ical"
+)
+
+var errNotBooked = newApiError("not_booked", http.StatusConflict, "Запись в живую очередь нельзя добавить в календарь", "A walk-in queue entry has no appointment time")
+
+// Период подписки: неделя назад и MaxCalendarDays вперед. Прошедшая неделя
+// остается в календаре, чтобы события не пропадали сразу после визита
+const (
+	feedPastDays = 7
+	feedRefresh  = 15 * time.Minute
+)
+
+type CalendarFeedRequest struct {
+	Name    string `json:"name"`
+	StaffID *int64 `json:"staffId,omitempty"` // только записи мастера
+}
+
+// feedURL ссылка подписки для календаря
+func feedURL(req *http.Request, feed db.CalendarFeed) string {
+	return publicURL(req) + "/api/v1/ical/" + feed.Token + ".ics"
+}
+
+func normalizeFeed(req *http.Request, feed db.CalendarFeed) map[string]any {
+	return map[string]any{
+		"id":        feed.ID,
+		"name":      feed.Name,
+		"staffId":   feed.StaffID,
+		"url":       feedURL(req, feed),
+		"createdAt": feed.CreatedAt,
+	}
+}
+
+// recordEvent преобразует предварительную запись в событие календаря. UID
+// постоянный, а SEQUENCE - версия записи, поэтому перенос и отмена обновляют
+// событие, а не создают новое
+func recordEvent(record db.Record) ical.Event {
+	service := record.Service
+	if item, err := db.GetCatalogItem(record.Service); err == nil {
+		service = item.Name
+	}
+
+	return ical.Event{
+		UID:       fmt.Sprintf("record-%d@tire-pepair-record-service", record.ID),
+		Sequence:  record.Version,
+		Stamp:     record.UpdatedAt,
+		Start:     *record.Record,
+		End:       record.Record.Add(db.ServiceDuration(record.Service)),
+		Summary:   record.Title + " - " + service,
+		Location:  documents.ShopInfo.Address,
+		Cancelled: record.Status == "cancel" || record.Status == "no_show",
+	}
+}
+
+// writeCalendar отправляет календарь
+func writeCalendar(res http.ResponseWriter, calendar ical.Calendar, filename string) {
+	res.Header().Set("Content-Type", ical.ContentType)
+	res.Header().Set("Cache-Control", "no-cache")
+	if filename != "" {
+		res.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	}
+	res.WriteHeader(http.StatusOK)
+	res.Write(calendar.Bytes())
+}
+
+// GET /api/v1/ical/{token}.ics
+// Подписка на календарь записей. Авторизация - секретный токен в ссылке
+func calendarFeedHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	feed, err := db.GetCalendarFeedByToken(strings.TrimSuffix(req.PathValue("token"), ".ics"))
+	if err != nil {
+		logger.Printf("WARN: calendar feed lookup error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	today := time.Now()
+	from := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location()).AddDate(0, 0, -feedPastDays)
+	records, err := db.GetBookings(from, from.AddDate(0, 0, feedPastDays+db.MaxCalendarDays), feed.StaffID)
+	if err != nil {
+		logger.Printf("ERROR: getting bookings for calendar feed error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	calendar := ical.Calendar{
+		Name:    documents.ShopInfo.Name + ": " + feed.Name,
+		Refresh: feedRefresh,
+		Events:  make([]ical.Event, len(records)),
+	}
+	for i, record := range records {
+		event := recordEvent(record)
+		event.Description = "Талон " + generateTicketNumber(record.ID, record.Record)
+		if record.Comment != "" {
+			event.Description += "\n" + record.Comment
+		}
+		calendar.Events[i] = event
+	}
+
+	logger.Printf("INFO: calendar feed %d served with %d events", feed.ID, len(records))
+	writeCalendar(res, calendar, "")
+}
+
+// GET /api/v1/self/{token}/event.ics
+// Запись клиента одним событием для кнопки "добавить в календарь"
+func selfServiceEventHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	record, err := db.GetRecordByAccessToken(req.PathValue("token"))
+	if err != nil {
+		logger.Printf("WARN: self-service record lookup error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	if record.Record == nil {
+		logger.Printf("WARN: record %d is a walk-in, no calendar event", record.ID)
+		writeError(res, req, errNotBooked)
+		return
+	}
+
+	event := recordEvent(*record)
+	event.Summary = documents.ShopInfo.Name + ": " + event.Summary
+	event.Description = "Талон " + generateTicketNumber(record.ID, record.Record)
+	if documents.ShopInfo.Phone != "" {
+		event.Description += "\n" + documents.ShopInfo.Phone
+	}
+	event.URL = publicURL(req) + selfServiceLink(*record)
+
+	logger.Printf("INFO: calendar event for record %d downloaded", record.ID)
+	writeCalendar(res, ical.Calendar{Events: []ical.Event{event}}, fmt.Sprintf("booking-%d.ics", record.ID))
+}
+
+// GET /api/v1/calendar-feeds
+func listCalendarFeedsHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	feeds, err := db.ListCalendarFeeds()
+	if err != nil {
+		logger.Printf("ERROR: listing calendar feeds error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	normalized := make([]map[string]any, len(feeds))
+	for i, feed := range feeds {
+		normalized[i] = normalizeFeed(req, feed)
+	}
+
+	logger.Printf("INFO: calendar feeds listed successfully")
+	writeJson(res, http.StatusOK, map[string]any{"feeds": normalized})
+}
+
+// POST /api/v1/calendar-feeds
+func createCalendarFeedHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	var feedReq CalendarFeedRequest
+	if err := json.NewDecoder(req.Body).Decode(&feedReq); err != nil {
+		logger.Printf("WARN: unmarshal error, %v", err)
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
+		return
+	}
+
+	feed, err := db.AddCalendarFeed(feedReq.Name, feedReq.StaffID, time.Now())
+	if err != nil {
+		logger.Printf("WARN: creating calendar feed error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: calendar feed %d created", feed.ID)
+	writeJson(res, http.StatusCreated, map[string]any{"feed": normalizeFeed(req, *feed)})
+}
+
+// DELETE /api/v1/calendar-feeds/{id}
+func deleteCalendarFeedHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	feedID, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+	if err != nil {
+		logger.Printf("WARN: invalid calendar feed ID, %v", err)
+		writeError(res, req, errInvalidFeedID)
+		return
+	}
+
+	if err := db.DeleteCalendarFeed(feedID); err != nil {
+		logger.Printf("WARN: deleting calendar feed error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: calendar feed %d revoked", feedID)
+	res.WriteHeader(http.StatusNoContent)
+}
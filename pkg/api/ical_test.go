@@ -0,0 +1,150 @@
+package api
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/ical"
+)
+
+// setupDB открывает пустую базу во временном каталоге
+func setupDB(t *testing.T) {
+	t.Helper()
+
+	if err := db.Init(filepath.Join(t.TempDir(), "test.db"), log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.CloseDatabase)
+}
+
+// vevent свойства события календаря
+type vevent map[string]string
+
+// parseEvents разбирает события календаря из ответа обработчика
+func parseEvents(t *testing.T, res *httptest.ResponseRecorder) []vevent {
+	t.Helper()
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", res.Code, res.Body)
+	}
+	if got := res.Header().Get("Content-Type"); got != ical.ContentType {
+		t.Errorf("content type %s", got)
+	}
+
+	data := strings.ReplaceAll(res.Body.String(), "\r\n ", "")
+	var events []vevent
+	var current vevent
+	for _, line := range strings.Split(strings.TrimSuffix(data, "\r\n"), "\r\n") {
+		switch line {
+		case "BEGIN:VEVENT":
+			current = make(vevent)
+		case "END:VEVENT":
+			events = append(events, current)
+			current = nil
+		default:
+			if name, value, ok := strings.Cut(line, ":"); ok && current != nil {
+				current[name] = value
+			}
+		}
+	}
+	return events
+}
+
+// nextSlot ближайшее свободное время для записи
+func nextSlot(t *testing.T) time.Time {
+	t.Helper()
+
+	slot, err := db.FindNextAvailable(time.Now().Add(db.MinLeadTime+time.Hour), time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *slot
+}
+
+func TestCalendarEventUpdates(t *testing.T) {
+	setupDB(t)
+	quiet := log.New(io.Discard, "", 0)
+
+	feed, err := db.AddCalendarFeed("Управляющий", nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := nextSlot(t)
+	record, err := db.AddRecord(db.Record{Title: "А123ВС77", Record: &first})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Событие одинаково в подписке и в файле для клиента
+	events := func() []vevent {
+		t.Helper()
+
+		feedReq := httptest.NewRequest(http.MethodGet, "/api/v1/ical/"+feed.Token+".ics", nil)
+		feedReq.SetPathValue("token", feed.Token+".ics")
+		feedRes := httptest.NewRecorder()
+		calendarFeedHandler(feedRes, feedReq, quiet)
+
+		selfReq := httptest.NewRequest(http.MethodGet, "/api/v1/self/"+record.AccessToken+"/event.ics", nil)
+		selfReq.SetPathValue("token", record.AccessToken)
+		selfRes := httptest.NewRecorder()
+		selfServiceEventHandler(selfRes, selfReq, quiet)
+
+		return append(parseEvents(t, feedRes), parseEvents(t, selfRes)...)
+	}
+
+	check := func(step string, start time.Time, status string) int64 {
+		t.Helper()
+
+		got := events()
+		if len(got) != 2 {
+			t.Fatalf("%s: got %d events, want one in the feed and one in the file", step, len(got))
+		}
+		sequence, err := strconv.ParseInt(got[0]["SEQUENCE"], 10, 64)
+		if err != nil {
+			t.Fatalf("%s: SEQUENCE %q", step, got[0]["SEQUENCE"])
+		}
+		for i, e := range got {
+			if e["UID"] != "record-"+strconv.FormatInt(record.ID, 10)+"@tire-pepair-record-service" {
+				t.Errorf("%s: event %d UID %s", step, i, e["UID"])
+			}
+			if e["SEQUENCE"] != got[0]["SEQUENCE"] {
+				t.Errorf("%s: event %d SEQUENCE %s, feed has %s", step, i, e["SEQUENCE"], got[0]["SEQUENCE"])
+			}
+			if want := start.UTC().Format("20060102T150405Z"); e["DTSTART"] != want {
+				t.Errorf("%s: event %d DTSTART %s, want %s", step, i, e["DTSTART"], want)
+			}
+			if e["STATUS"] != status {
+				t.Errorf("%s: event %d STATUS %s, want %s", step, i, e["STATUS"], status)
+			}
+		}
+		return sequence
+	}
+
+	created := check("created", first, "CONFIRMED")
+
+	// Перенос меняет время того же события и увеличивает SEQUENCE
+	second := nextSlot(t)
+	if _, err := db.PatchRecord(record.ID, db.RecordPatch{Record: &second}, 0); err != nil {
+		t.Fatal(err)
+	}
+	rescheduled := check("rescheduled", second, "CONFIRMED")
+	if rescheduled <= created {
+		t.Errorf("SEQUENCE %d after reschedule, was %d", rescheduled, created)
+	}
+
+	// Отмененное событие остается в календаре со статусом CANCELLED
+	if _, err := db.CancelRecordByCustomer(record.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	cancelled := check("cancelled", second, "CANCELLED")
+	if cancelled <= rescheduled {
+		t.Errorf("SEQUENCE %d after cancel, was %d", cancelled, rescheduled)
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+)
+
+var (
+	errIdempotencyKeyReused = newApiError("idempotency_key_reused", http.StatusUnprocessableEntity,
+		"Ключ идемпотентности уже использован для другого запроса", "The idempotency key was already used for a different request")
+	errIdempotencyInProgress = newApiError("idempotency_in_progress", http.StatusConflict,
+		"Запрос с этим ключом идемпотентности еще выполняется", "A request with this idempotency key is still in progress")
+)
+
+// idempotentHeaders заголовки ответа, которые сохраняются и повторяются вместе с телом
+var idempotentHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// responseRecorder запоминает статус и тело ответа для сохранения
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+// idempotent обрабатывает заголовок Idempotency-Key: повторный запрос с тем же ключом
+// и телом получает сохраненный ответ вместо повторного выполнения. Ключ занимается
+// в базе до выполнения запроса, поэтому одновременный повтор получает 409, а не
+// выполняется второй раз
+func idempotent(next http.HandlerFunc, logger *log.Logger) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get("Idempotency-Key")
+		if key == "" || len(key) > 255 {
+			next(res, req)
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			logger.Printf("WARN: request reading error, %v", err)
+			writeError(res, req, errInvalidJSON.withDetail(err.Error()))
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.Sum256(append([]byte(req.Method+" "+req.URL.Path+"\n"), body...))
+		requestHash := hex.EncodeToString(hash[:])
+
+		saved, err := db.ClaimIdempotencyKey(key, requestHash, time.Now())
+		if err != nil {
+			logger.Printf("ERROR: idempotency lookup error, %v", err)
+			writeError(res, req, err)
+			return
+		}
+
+		if saved != nil {
+			if saved.RequestHash != requestHash {
+				logger.Printf("WARN: idempotency key %s reused with a different request", key)
+				writeError(res, req, errIdempotencyKeyReused)
+				return
+			}
+
+			if saved.InProgress() {
+				logger.Printf("WARN: request with idempotency key %s is still in progress", key)
+				res.Header().Set("Retry-After", "1")
+				writeError(res, req, errIdempotencyInProgress)
+				return
+			}
+
+			logger.Printf("INFO: replaying stored response for idempotency key %s", key)
+			for name, value := range saved.Header {
+				res.Header().Set(name, value)
+			}
+			res.Header().Set("Idempotent-Replayed", "true")
+			res.WriteHeader(saved.Status)
+			res.Write(saved.Body)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: res}
+		next(recorder, req)
+
+		// Ошибки сервера не сохраняем, чтобы повтор мог завершиться успешно
+		if recorder.status == 0 || recorder.status >= http.StatusInternalServerError {
+			if err := db.ReleaseIdempotencyKey(key, requestHash); err != nil {
+				logger.Printf("ERROR: releasing idempotency key error, %v", err)
+			}
+			return
+		}
+
+		header := make(map[string]string)
+		for _, name := range idempotentHeaders {
+			if value := res.Header().Get(name); value != "" {
+				header[name] = value
+			}
+		}
+
+		err = db.SaveIdempotentResponse(db.IdempotentResponse{
+			Key:         key,
+			RequestHash: requestHash,
+			Status:      recorder.status,
+			Header:      header,
+			Body:        recorder.body.Bytes(),
+		})
+		if err != nil {
+			logger.Printf("ERROR: saving idempotent response error, %v", err)
+		}
+	}
+}
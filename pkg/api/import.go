@@ -0,0 +1,107 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"tire-pepair-record-service/pkg/csvimport"
+)
+
+// importMaxBytes предельный размер файла импорта
+const importMaxBytes = 10 << 20
+
+// normalizeImportReport преобразует отчет импорта в формат ответа. Ошибки строк
+// отдаются с кодами и сообщениями API на языке запроса
+func normalizeImportReport(req *http.Request, report *csvimport.Report) map[string]any {
+	lang := preferredLanguage(req)
+
+	rows := make([]map[string]any, len(report.Rows))
+	for i, row := range report.Rows {
+		errs := make([]map[string]any, len(row.Errors))
+		for j, err := range row.Errors {
+			apiErr := toApiError(err)
+			errs[j] = map[string]any{
+				"code":   apiErr.Code,
+				"error":  apiErr.Message(lang),
+				"detail": err.Error(),
+			}
+		}
+
+		normalized := map[string]any{
+			"line":   row.Line,
+			"plate":  row.Plate,
+			"errors": errs,
+		}
+		if row.RecordID != 0 {
+			normalized["recordId"] = row.RecordID
+		}
+		rows[i] = normalized
+	}
+
+	imported := 0
+	if report.Committed {
+		imported = len(report.Rows)
+	}
+
+	return map[string]any{
+		"dryRun":    report.DryRun,
+		"committed": report.Committed,
+		"total":     len(report.Rows),
+		"imported":  imported,
+		"failed":    report.Failed,
+		"columns":   report.Columns,
+		"rows":      rows,
+	}
+}
+
+// POST /api/v1/records/import?dryRun=true&skipTimeChecks=true&map=plate:Гос номер
+// Импорт записей из CSV в теле запроса. Файл добавляется целиком одной
+// транзакцией: при ошибке хоть в одной строке ответ 422 с отчетом по строкам.
+// В режиме dryRun файл только проверяется, отчет отдается с кодом 200
+func importRecordsHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	query := req.URL.Query()
+
+	mapping, err := csvimport.ParseMapping(query["map"])
+	if err != nil {
+		logger.Printf("WARN: invalid import mapping, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	options := csvimport.Options{Mapping: mapping}
+	options.DryRun = query.Get("dryRun") == "true"
+	options.SkipTimeChecks = query.Get("skipTimeChecks") == "true"
+
+	body := http.MaxBytesReader(res, req.Body, importMaxBytes)
+	report, err := csvimport.Import(body, options, time.Now())
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			logger.Printf("WARN: import file too large")
+			writeError(res, req, errImportTooLarge)
+			return
+		}
+		if toApiError(err) == errInternal {
+			logger.Printf("ERROR: importing records error, %v", err)
+		} else {
+			logger.Printf("WARN: invalid import file, %v", err)
+		}
+		writeError(res, req, err)
+		return
+	}
+
+	normalized := normalizeImportReport(req, report)
+	if report.Failed > 0 && !report.DryRun {
+		logger.Printf("WARN: import rejected, %d of %d rows failed", report.Failed, len(report.Rows))
+		writeErrorWith(res, req, errImportRejected, map[string]any{"import": normalized})
+		return
+	}
+
+	if report.Committed {
+		logger.Printf("INFO: %d records imported", len(report.Rows))
+	} else {
+		logger.Printf("INFO: import dry run, %d rows checked, %d failed", len(report.Rows), report.Failed)
+	}
+	writeJson(res, http.StatusOK, map[string]any{"import": normalized})
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+)
+
+// POST /api/v1/records/{id}/arrive
+// Опоздавший клиент пришел: запись переводится в конец живой очереди
+func arriveRecordV1Handler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	recordID, err := parseRecordID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid record ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(req)
+	if err != nil {
+		logger.Printf("WARN: invalid If-Match header, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	record, err := db.ConvertToWalkIn(recordID, expectedVersion, time.Now())
+	if err != nil {
+		logger.Printf("WARN: converting record to walk-in error, %v", err)
+		writeRecordError(res, req, recordID, err, logger)
+		return
+	}
+
+	logger.Printf("INFO: late record %d moved to the walk-in queue", recordID)
+	res.Header().Set("ETag", recordETag(*record))
+	writeJson(res, http.StatusOK, map[string]any{"record": normalizeRecord(*record)})
+}
+
+// GET /api/v1/customers/{plate}
+func getCustomerV1Handler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	customer, err := db.GetCustomer(req.PathValue("plate"))
+	if err != nil {
+		logger.Printf("ERROR: getting customer error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: customer %s retrieved successfully", customer.Plate)
+	writeJson(res, http.StatusOK, map[string]any{"customer": map[string]any{
+		"plate":        customer.Plate,
+		"noShows":      customer.NoShows,
+		"lastNoShowAt": customer.LastNoShowAt,
+		"restricted":   customer.Restricted(time.Now()),
+	}})
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/notify"
+)
+
+// notificationsLimit число уведомлений в ответе
+const notificationsLimit = 200
+
+// normalizeNotification преобразует уведомление в формат ответа
+func normalizeNotification(n db.Notification) map[string]any {
+	normalized := map[string]any{
+		"id":        n.ID,
+		"recordId":  n.RecordID,
+		"event":     n.Event,
+		"channel":   n.Channel,
+		"recipient": n.Recipient,
+		"subject":   n.Subject,
+		"body":      n.Body,
+		"status":    n.Status,
+		"attempts":  n.Attempts,
+		"lastError": n.LastError,
+		"createdAt": n.CreatedAt,
+		"sentAt":    n.SentAt,
+	}
+	if n.WaitlistID != 0 {
+		normalized["waitlistId"] = n.WaitlistID
+	}
+	if n.Status == db.NotificationPending {
+		normalized["nextAttemptAt"] = n.NextAttemptAt
+	}
+	return normalized
+}
+
+func normalizeNotifications(notifications []db.Notification) []map[string]any {
+	normalized := make([]map[string]any, len(notifications))
+	for i, n := range notifications {
+		normalized[i] = normalizeNotification(n)
+	}
+	return normalized
+}
+
+// GET /api/v1/records/{id}/notifications
+// Уведомления по записи и состояние напоминаний о ней
+func recordNotificationsHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	recordID, err := parseRecordID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid record ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+
+	if _, err := db.GetRecordByID(recordID); err != nil {
+		logger.Printf("ERROR: getting record by ID error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	notifications, err := db.ListNotifications(recordID, "", notificationsLimit)
+	if err != nil {
+		logger.Printf("ERROR: listing notifications error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	reminders, err := db.GetReminders(recordID)
+	if err != nil {
+		logger.Printf("ERROR: getting reminders error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	normalizedReminders := make([]map[string]any, len(reminders))
+	for i, r := range reminders {
+		normalizedReminders[i] = map[string]any{
+			"offsetMinutes": int(r.Offset / time.Minute),
+			"recordAt":      r.RecordAt,
+			"status":        r.Status,
+			"createdAt":     r.CreatedAt,
+		}
+	}
+
+	logger.Printf("INFO: notifications for record %d listed successfully", recordID)
+	writeJson(res, http.StatusOK, map[string]any{
+		"notifications": normalizeNotifications(notifications),
+		"reminders":     normalizedReminders,
+	})
+}
+
+// GET /api/v1/notifications?status=
+func listNotificationsHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	status := req.URL.Query().Get("status")
+	switch status {
+	case "", db.NotificationPending, db.NotificationSent, db.NotificationFailed:
+	default:
+		logger.Printf("WARN: invalid notification status %s", status)
+		writeError(res, req, errInvalidNotifyStatus)
+		return
+	}
+
+	notifications, err := db.ListNotifications(0, status, notificationsLimit)
+	if err != nil {
+		logger.Printf("ERROR: listing notifications error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: notifications listed successfully")
+	writeJson(res, http.StatusOK, map[string]any{"notifications": normalizeNotifications(notifications)})
+}
+
+// POST /api/v1/notifications/{id}/retry
+// Возвращает недоставленное уведомление в очередь и сразу пытается его отправить
+func retryNotificationHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+	if err != nil {
+		logger.Printf("WARN: invalid notification ID, %v", err)
+		writeError(res, req, errInvalidNotifyID)
+		return
+	}
+
+	if _, err := db.RetryNotification(id, time.Now()); err != nil {
+		logger.Printf("WARN: retrying notification error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	if err := notify.Dispatch(time.Now(), logger); err != nil {
+		logger.Printf("ERROR: sending notifications error, %v", err)
+	}
+
+	n, err := db.GetNotification(id)
+	if err != nil {
+		logger.Printf("ERROR: getting notification error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: notification %d retried, status %s", id, n.Status)
+	writeJson(res, http.StatusOK, map[string]any{"notification": normalizeNotification(*n)})
+}
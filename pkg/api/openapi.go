@@ -0,0 +1,17 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec описание ресурсного API /api/v1 в формате OpenAPI 3
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func openAPIHandler(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(openAPISpec)
+}
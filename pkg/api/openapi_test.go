@@ -0,0 +1,783 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"tire-pepair-record-service/pkg/analytics"
+	"tire-pepair-record-service/pkg/csvimport"
+	"tire-pepair-record-service/pkg/db"
+)
+
+// jsonObject объект JSON с ключами в порядке появления, повторы сохраняются
+type jsonObject struct {
+	keys   []string
+	values []json.RawMessage
+}
+
+func (o *jsonObject) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+		o.keys = append(o.keys, key.(string))
+		o.values = append(o.values, value)
+	}
+	return nil
+}
+
+// specOperations считает операции "METHOD /api/v1/path" в описании API
+func specOperations(t *testing.T) map[string]int {
+	t.Helper()
+
+	var spec struct {
+		Paths jsonObject `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+
+	operations := make(map[string]int)
+	for i, path := range spec.Paths.keys {
+		var item jsonObject
+		if err := json.Unmarshal(spec.Paths.values[i], &item); err != nil {
+			t.Fatalf("openapi.json %s: %v", path, err)
+		}
+		for _, method := range item.keys {
+			switch method {
+			case "get", "put", "post", "delete", "patch", "head", "options":
+				operations[strings.ToUpper(method)+" /api/v1"+path]++
+			}
+		}
+	}
+	return operations
+}
+
+// route маршрут /api/v1 и имя функции обработчика
+type route struct {
+	pattern string
+	handler string
+}
+
+// handlerName имя обработчика под обертками handle, auth и idempotent
+func handlerName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.CallExpr:
+		if len(e.Args) > 0 {
+			return handlerName(e.Args[0])
+		}
+	}
+	return ""
+}
+
+// registeredRoutes маршруты /api/v1, которые initV1 регистрирует в mux
+func registeredRoutes(t *testing.T) []route {
+	t.Helper()
+
+	file, err := parser.ParseFile(token.NewFileSet(), "v1.go", nil, 0)
+	if err != nil {
+		t.Fatalf("v1.go: %v", err)
+	}
+
+	var routes []route
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != "initV1" {
+			continue
+		}
+		ast.Inspect(fn.Body, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok || len(call.Args) < 2 {
+				return true
+			}
+			selector, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || selector.Sel.Name != "HandleFunc" {
+				return true
+			}
+			literal, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || literal.Kind != token.STRING {
+				t.Errorf("route pattern is not a string literal at offset %d", call.Pos())
+				return true
+			}
+			pattern, err := strconv.Unquote(literal.Value)
+			if err != nil {
+				t.Fatalf("route pattern %s: %v", literal.Value, err)
+			}
+			routes = append(routes, route{pattern: pattern, handler: handlerName(call.Args[1])})
+			return true
+		})
+	}
+
+	if len(routes) == 0 {
+		t.Fatal("no routes found in initV1")
+	}
+	return routes
+}
+
+func TestOpenAPIDescribesEveryRoute(t *testing.T) {
+	operations := specOperations(t)
+	routes := registeredRoutes(t)
+
+	registered := make(map[string]bool)
+	for _, r := range routes {
+		if registered[r.pattern] {
+			t.Errorf("route %s registered twice", r.pattern)
+		}
+		registered[r.pattern] = true
+
+		switch count := operations[r.pattern]; count {
+		case 1:
+		case 0:
+			t.Errorf("route %s is missing from openapi.json", r.pattern)
+		default:
+			t.Errorf("route %s is described %d times in openapi.json", r.pattern, count)
+		}
+	}
+
+	for operation := range operations {
+		if !registered[operation] {
+			t.Errorf("openapi.json describes %s, which is not registered", operation)
+		}
+	}
+}
+
+// specSchema схема OpenAPI в объеме, нужном для сверки с кодом
+type specSchema struct {
+	Ref        string                 `json:"$ref"`
+	Type       string                 `json:"type"`
+	Nullable   bool                   `json:"nullable"`
+	Required   []string               `json:"required"`
+	Properties map[string]*specSchema `json:"properties"`
+	Items      *specSchema            `json:"items"`
+	AllOf      []*specSchema          `json:"allOf"`
+}
+
+type specParameter struct {
+	Ref  string `json:"$ref"`
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+type specOperation struct {
+	Parameters  []specParameter `json:"parameters"`
+	RequestBody *struct {
+		Content map[string]struct {
+			Schema *specSchema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+// apiSpec разобранный openapi.json
+type apiSpec struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Parameters map[string]specParameter `json:"parameters"`
+		Schemas    map[string]*specSchema   `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadSpec(t *testing.T) *apiSpec {
+	t.Helper()
+
+	var spec apiSpec
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	return &spec
+}
+
+// resolve раскрывает $ref и объединяет свойства allOf
+func (spec *apiSpec) resolve(t *testing.T, schema *specSchema) *specSchema {
+	t.Helper()
+
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		target, ok := spec.Components.Schemas[name]
+		if !ok {
+			t.Fatalf("unknown schema %s", schema.Ref)
+		}
+		return spec.resolve(t, target)
+	}
+	if len(schema.AllOf) == 0 {
+		return schema
+	}
+
+	merged := &specSchema{Type: "object", Nullable: schema.Nullable, Properties: make(map[string]*specSchema)}
+	for _, part := range schema.AllOf {
+		part = spec.resolve(t, part)
+		merged.Required = append(merged.Required, part.Required...)
+		for name, property := range part.Properties {
+			merged.Properties[name] = property
+		}
+	}
+	return merged
+}
+
+// operation описание операции вместе с параметрами пути
+func (spec *apiSpec) operation(t *testing.T, pattern string) (specOperation, []specParameter) {
+	t.Helper()
+
+	method, path, _ := strings.Cut(pattern, " ")
+	item := spec.Paths[strings.TrimPrefix(path, "/api/v1")]
+
+	var op specOperation
+	if err := json.Unmarshal(item[strings.ToLower(method)], &op); err != nil {
+		t.Fatalf("openapi.json %s: %v", pattern, err)
+	}
+	var shared []specParameter
+	if raw, ok := item["parameters"]; ok {
+		if err := json.Unmarshal(raw, &shared); err != nil {
+			t.Fatalf("openapi.json %s parameters: %v", path, err)
+		}
+	}
+
+	params := append(shared, op.Parameters...)
+	for i, param := range params {
+		if param.Ref != "" {
+			resolved, ok := spec.Components.Parameters[strings.TrimPrefix(param.Ref, "#/components/parameters/")]
+			if !ok {
+				t.Fatalf("%s: unknown parameter %s", pattern, param.Ref)
+			}
+			params[i] = resolved
+		}
+	}
+	return op, params
+}
+
+// packageSource функции и структуры пакета api без тестов
+type packageSource struct {
+	funcs   map[string]*ast.FuncDecl
+	structs map[string]*ast.StructType
+}
+
+func parsePackage(t *testing.T) *packageSource {
+	t.Helper()
+
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := &packageSource{funcs: make(map[string]*ast.FuncDecl), structs: make(map[string]*ast.StructType)}
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil {
+					src.funcs[d.Name.Name] = d
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok {
+						if st, ok := ts.Type.(*ast.StructType); ok {
+							src.structs[ts.Name.Name] = st
+						}
+					}
+				}
+			}
+		}
+	}
+	return src
+}
+
+// handlerInputs что обработчик читает из запроса
+type handlerInputs struct {
+	query  map[string]bool // параметры строки запроса
+	path   map[string]bool // параметры пути
+	bodies []string        // типы, в которые декодируется тело JSON
+}
+
+// isURLQuery проверяет, что выражение - вызов req.URL.Query()
+func isURLQuery(expr ast.Expr) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	selector, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || selector.Sel.Name != "Query" {
+		return false
+	}
+	inner, ok := selector.X.(*ast.SelectorExpr)
+	return ok && inner.Sel.Name == "URL"
+}
+
+func stringArg(call *ast.CallExpr) (string, bool) {
+	if len(call.Args) == 0 {
+		return "", false
+	}
+	literal, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || literal.Kind != token.STRING {
+		return "", false
+	}
+	value, err := strconv.Unquote(literal.Value)
+	return value, err == nil
+}
+
+// inputs собирает параметры и тела, которые читает функция name и вызываемые
+// ею функции пакета
+func (src *packageSource) inputs(name string) handlerInputs {
+	in := handlerInputs{query: make(map[string]bool), path: make(map[string]bool)}
+	src.collect(name, &in, make(map[string]bool))
+	return in
+}
+
+func (src *packageSource) collect(name string, in *handlerInputs, visited map[string]bool) {
+	fn, ok := src.funcs[name]
+	if !ok || visited[name] {
+		return
+	}
+	visited[name] = true
+
+	// Переменные с параметрами строки запроса и типы объявленных переменных
+	queryVars := make(map[string]bool)
+	for _, field := range fn.Type.Params.List {
+		if selector, ok := field.Type.(*ast.SelectorExpr); ok && selector.Sel.Name == "Values" {
+			for _, ident := range field.Names {
+				queryVars[ident.Name] = true
+			}
+		}
+	}
+	varTypes := make(map[string]string)
+
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.ValueSpec:
+			if ident, ok := n.Type.(*ast.Ident); ok {
+				for _, name := range n.Names {
+					varTypes[name.Name] = ident.Name
+				}
+			}
+		case *ast.AssignStmt:
+			for i, rhs := range n.Rhs {
+				if ident, ok := n.Lhs[i].(*ast.Ident); ok && i < len(n.Lhs) && isURLQuery(rhs) {
+					queryVars[ident.Name] = true
+				}
+			}
+		case *ast.IndexExpr:
+			// Повторяющийся параметр: query["status"]
+			ident, isVar := n.X.(*ast.Ident)
+			literal, isString := n.Index.(*ast.BasicLit)
+			if isVar && queryVars[ident.Name] && isString && literal.Kind == token.STRING {
+				if value, err := strconv.Unquote(literal.Value); err == nil {
+					in.query[value] = true
+				}
+			}
+		case *ast.CallExpr:
+			switch fun := n.Fun.(type) {
+			case *ast.Ident:
+				src.collect(fun.Name, in, visited)
+			case *ast.SelectorExpr:
+				switch fun.Sel.Name {
+				case "Get":
+					ident, isVar := fun.X.(*ast.Ident)
+					if isURLQuery(fun.X) || isVar && queryVars[ident.Name] {
+						if value, ok := stringArg(n); ok {
+							in.query[value] = true
+						}
+					}
+				case "PathValue":
+					if value, ok := stringArg(n); ok {
+						in.path[value] = true
+					}
+				case "Decode":
+					if len(n.Args) == 1 {
+						if unary, ok := n.Args[0].(*ast.UnaryExpr); ok {
+							if ident, ok := unary.X.(*ast.Ident); ok && varTypes[ident.Name] != "" {
+								in.bodies = append(in.bodies, varTypes[ident.Name])
+							}
+						}
+					}
+				}
+			}
+		}
+		return true
+	})
+}
+
+// jsonType тип JSON для типа поля Go, пусто - любой
+func (src *packageSource) jsonType(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return src.jsonType(e.X)
+	case *ast.ArrayType:
+		return "array"
+	case *ast.MapType:
+		return "object"
+	case *ast.SelectorExpr:
+		if e.Sel.Name == "Time" {
+			return "string"
+		}
+	case *ast.Ident:
+		switch e.Name {
+		case "string":
+			return "string"
+		case "int", "int64", "int32":
+			return "integer"
+		case "float64":
+			return "number"
+		case "bool":
+			return "boolean"
+		}
+		if _, ok := src.structs[e.Name]; ok {
+			return "object"
+		}
+	}
+	return ""
+}
+
+// fields поля JSON структуры и их типы
+func (src *packageSource) fields(t *testing.T, typeName string) map[string]string {
+	t.Helper()
+
+	st, ok := src.structs[typeName]
+	if !ok {
+		t.Fatalf("struct %s not found", typeName)
+	}
+
+	fields := make(map[string]string)
+	for _, field := range st.Fields.List {
+		var names []string
+		for _, ident := range field.Names {
+			names = append(names, ident.Name)
+		}
+		if field.Tag != nil {
+			tag, _ := strconv.Unquote(field.Tag.Value)
+			if name, _, _ := strings.Cut(reflect.StructTag(tag).Get("json"), ","); name == "-" {
+				continue
+			} else if name != "" {
+				names = []string{name}
+			}
+		}
+		for _, name := range names {
+			fields[name] = src.jsonType(field.Type)
+		}
+	}
+	return fields
+}
+
+// TestOpenAPIParameters сверяет параметры пути и строки запроса в описании с
+// теми, что читают обработчики
+func TestOpenAPIParameters(t *testing.T) {
+	spec := loadSpec(t)
+	src := parsePackage(t)
+
+	for _, r := range registeredRoutes(t) {
+		in := src.inputs(r.handler)
+		_, params := spec.operation(t, r.pattern)
+
+		described := map[string]map[string]bool{"query": {}, "path": {}}
+		for _, param := range params {
+			if described[param.In] != nil {
+				described[param.In][param.Name] = true
+			}
+		}
+
+		pathParams := make(map[string]bool)
+		for _, segment := range strings.Split(r.pattern, "/") {
+			if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				pathParams[strings.Trim(segment, "{}")] = true
+			}
+		}
+		for name := range in.path {
+			if !pathParams[name] {
+				t.Errorf("%s: handler reads path value %s missing from the pattern", r.pattern, name)
+			}
+		}
+		compareSets(t, r.pattern+" path parameters", described["path"], pathParams)
+		compareSets(t, r.pattern+" query parameters", described["query"], in.query)
+	}
+}
+
+// TestOpenAPIRequestBodies сверяет схемы тел запросов со структурами, в которые
+// обработчики их декодируют
+func TestOpenAPIRequestBodies(t *testing.T) {
+	spec := loadSpec(t)
+	src := parsePackage(t)
+
+	for _, r := range registeredRoutes(t) {
+		in := src.inputs(r.handler)
+		op, _ := spec.operation(t, r.pattern)
+
+		var schema *specSchema
+		if op.RequestBody != nil {
+			schema = spec.resolve(t, op.RequestBody.Content["application/json"].Schema)
+		}
+
+		switch {
+		case len(in.bodies) > 1:
+			t.Errorf("%s: handler decodes several bodies %v", r.pattern, in.bodies)
+			continue
+		case len(in.bodies) == 0 && schema != nil:
+			t.Errorf("%s: JSON body is described, but the handler does not decode one", r.pattern)
+			continue
+		case len(in.bodies) == 0:
+			continue
+		case schema == nil:
+			t.Errorf("%s: handler decodes %s, but no JSON body is described", r.pattern, in.bodies[0])
+			continue
+		}
+
+		fields := src.fields(t, in.bodies[0])
+		described := make(map[string]bool)
+		for name, property := range schema.Properties {
+			described[name] = true
+			goType, ok := fields[name]
+			if !ok {
+				continue
+			}
+			if specType := spec.resolve(t, property).Type; goType != "" && specType != "" && goType != specType {
+				t.Errorf("%s: body field %s is %s in %s, %s in openapi.json", r.pattern, name, goType, in.bodies[0], specType)
+			}
+		}
+		for _, name := range schema.Required {
+			if !described[name] {
+				t.Errorf("%s: required field %s is not described", r.pattern, name)
+			}
+		}
+
+		names := make(map[string]bool)
+		for name := range fields {
+			names[name] = true
+		}
+		compareSets(t, r.pattern+" body fields of "+in.bodies[0], described, names)
+	}
+}
+
+// compareSets сообщает о расхождениях между описанием и кодом
+func compareSets(t *testing.T, what string, described, actual map[string]bool) {
+	t.Helper()
+
+	for name := range actual {
+		if !described[name] {
+			t.Errorf("%s: %s is missing from openapi.json", what, name)
+		}
+	}
+	for name := range described {
+		if !actual[name] {
+			t.Errorf("%s: openapi.json describes %s, which the code does not use", what, name)
+		}
+	}
+}
+
+// filled возвращает копию v, в которой заполнены все поля, указатели, срезы и
+// словари: так в ответ попадают все ключи, которые выдает обработчик
+func filled[T any](v T) T {
+	value := reflect.ValueOf(&v).Elem()
+	fill(value)
+	return v
+}
+
+func fill(v reflect.Value) {
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		v.Set(reflect.ValueOf(time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)))
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fill(v.Field(i))
+			}
+		}
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Interface {
+			return
+		}
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fill(v.Index(0))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		key, elem := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		fill(key)
+		fill(elem)
+		v.SetMapIndex(key, elem)
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1.5)
+	case reflect.Bool:
+		v.SetBool(true)
+	}
+}
+
+// checkValue сверяет значение из ответа со схемой: ключи объектов должны быть
+// описаны, типы совпадать, null допустим только для nullable. В seen
+// отмечаются встреченные ключи
+func (spec *apiSpec) checkValue(t *testing.T, path string, schema *specSchema, value any, seen map[string]bool) {
+	t.Helper()
+
+	schema = spec.resolve(t, schema)
+	if schema == nil {
+		return
+	}
+
+	if value == nil {
+		if !schema.Nullable {
+			t.Errorf("%s is null, but not nullable in openapi.json", path)
+		}
+		return
+	}
+
+	var actual string
+	switch v := value.(type) {
+	case string:
+		actual = "string"
+	case bool:
+		actual = "boolean"
+	case float64:
+		actual = "number"
+		if schema.Type == "integer" && v == float64(int64(v)) {
+			actual = "integer"
+		}
+	case []any:
+		actual = "array"
+		for i, item := range v {
+			spec.checkValue(t, path+"["+strconv.Itoa(i)+"]", schema.Items, item, seen)
+		}
+	case map[string]any:
+		actual = "object"
+		if schema.Properties == nil {
+			break
+		}
+		for key, item := range v {
+			seen[path+"."+key] = true
+			property, ok := schema.Properties[key]
+			if !ok {
+				t.Errorf("%s.%s is missing from openapi.json", path, key)
+				continue
+			}
+			spec.checkValue(t, path+"."+key, property, item, seen)
+		}
+	}
+
+	if schema.Type != "" && schema.Type != actual {
+		t.Errorf("%s is %s, %s in openapi.json", path, actual, schema.Type)
+	}
+}
+
+// described ключи объектов схемы, включая вложенные
+func (spec *apiSpec) described(t *testing.T, path string, schema *specSchema, keys map[string]bool) {
+	t.Helper()
+
+	schema = spec.resolve(t, schema)
+	if schema == nil {
+		return
+	}
+	if schema.Items != nil {
+		spec.described(t, path+"[0]", schema.Items, keys)
+	}
+	for key, property := range schema.Properties {
+		keys[path+"."+key] = true
+		spec.described(t, path+"."+key, property, keys)
+	}
+}
+
+// TestOpenAPIResponseSchemas сверяет схемы ответов с тем, что выдают функции
+// normalize*: каждый ключ ответа описан с верным типом, и каждое описанное
+// поле встречается хотя бы в одном из примеров
+func TestOpenAPIResponseSchemas(t *testing.T) {
+	spec := loadSpec(t)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/calendar-feeds", nil)
+
+	pendingNotification := filled(db.Notification{})
+	pendingNotification.Status = db.NotificationPending
+	pendingDelivery := filled(db.Delivery{})
+	pendingDelivery.Status = db.DeliveryPending
+	report := filled(csvimport.Report{})
+	report.Rows[0].Errors = []error{db.ErrInvalidStatus}
+
+	for _, tt := range []struct {
+		schema  string
+		samples []any
+	}{
+		{"Record", []any{normalizeRecord(filled(db.Record{})), normalizeRecord(db.Record{})}},
+		{"RecordEnvelope", []any{
+			map[string]any{"record": recordWithContacts(filled(db.Record{}))},
+			map[string]any{"record": recordWithContacts(db.Record{})},
+		}},
+		{"WaitlistEntry", []any{
+			waitlistEntryWithContacts(filled(db.WaitlistEntry{})),
+			normalizeWaitlistEntry(db.WaitlistEntry{}),
+		}},
+		{"Staff", []any{normalizeStaff(filled(db.Staff{})), normalizeStaff(db.Staff{})}},
+		{"CatalogItem", []any{normalizeCatalogItem(filled(db.CatalogItem{}))}},
+		{"WorkOrder", []any{normalizeWorkOrder(filled(db.WorkOrder{})), normalizeWorkOrder(db.WorkOrder{})}},
+		{"Notification", []any{
+			normalizeNotification(filled(db.Notification{})),
+			normalizeNotification(pendingNotification),
+			normalizeNotification(db.Notification{}),
+		}},
+		// В базе список событий не бывает пустым: "*" - все события
+		{"Webhook", []any{normalizeWebhook(filled(db.Webhook{}), true), normalizeWebhook(db.Webhook{Events: []string{"*"}}, false)}},
+		{"WebhookDelivery", []any{
+			normalizeDelivery(filled(db.Delivery{})),
+			normalizeDelivery(pendingDelivery),
+			normalizeDelivery(db.Delivery{}),
+		}},
+		{"CalendarFeed", []any{normalizeFeed(req, filled(db.CalendarFeed{})), normalizeFeed(req, db.CalendarFeed{})}},
+		{"ImportReport", []any{normalizeImportReport(req, &report)}},
+		{"AnalyticsMetrics", []any{normalizeMetrics(filled(analytics.Metrics{}))}},
+		{"ServiceStats", []any{normalizeServiceStats(filled([]analytics.ServiceStats{}))[0]}},
+	} {
+		schema := &specSchema{Ref: "#/components/schemas/" + tt.schema}
+
+		seen := make(map[string]bool)
+		for _, sample := range tt.samples {
+			data, err := json.Marshal(sample)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var value any
+			if err := json.Unmarshal(data, &value); err != nil {
+				t.Fatal(err)
+			}
+			spec.checkValue(t, tt.schema, schema, value, seen)
+		}
+
+		keys := make(map[string]bool)
+		spec.described(t, tt.schema, schema, keys)
+		for key := range keys {
+			if !seen[key] {
+				t.Errorf("openapi.json describes %s, which the response never contains", key)
+			}
+		}
+	}
+}
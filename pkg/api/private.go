@@ -2,23 +2,26 @@ package api
 
 import (
 	"encoding/json"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/queue"
 )
 
 func getPendingRecordsHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
 	if req.Method != http.MethodGet {
 		logger.Printf("WARN: incorrect request type")
-		writeJsonError(res, http.StatusMethodNotAllowed, "Method not allowed")
+		writeError(res, req, errMethodNotAllowed)
 		return
 	}
 
 	records, err := db.GetPendingRecords()
 	if err != nil {
 		logger.Printf("ERROR: getting pending records error, %v", err)
-		writeJsonError(res, http.StatusInternalServerError, err.Error())
+		writeError(res, req, err)
 		return
 	}
 
@@ -29,14 +32,14 @@ func getPendingRecordsHandler(res http.ResponseWriter, req *http.Request, logger
 func getActiveRecordsHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
 	if req.Method != http.MethodGet {
 		logger.Printf("WARN: incorrect request type")
-		writeJsonError(res, http.StatusMethodNotAllowed, "Method not allowed")
+		writeError(res, req, errMethodNotAllowed)
 		return
 	}
 
 	records, err := db.GetActiveRecords()
 	if err != nil {
 		logger.Printf("ERROR: getting active records error, %v", err)
-		writeJsonError(res, http.StatusInternalServerError, err.Error())
+		writeError(res, req, err)
 		return
 	}
 
@@ -47,14 +50,21 @@ func getActiveRecordsHandler(res http.ResponseWriter, req *http.Request, logger
 func updateRecordHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
 	if req.Method != http.MethodPut {
 		logger.Printf("WARN: incorrect request type")
-		writeJsonError(res, http.StatusMethodNotAllowed, "Method not allowed")
+		writeError(res, req, errMethodNotAllowed)
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(req)
+	if err != nil {
+		logger.Printf("WARN: invalid If-Match header, %v", err)
+		writeError(res, req, err)
 		return
 	}
 
 	var updateReq UpdateRecordRequest
 	if err := json.NewDecoder(req.Body).Decode(&updateReq); err != nil {
 		logger.Printf("WARN: unmarshal error, %v", err)
-		writeJsonError(res, http.StatusBadRequest, err.Error())
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
 		return
 	}
 
@@ -66,18 +76,11 @@ func updateRecordHandler(res http.ResponseWriter, req *http.Request, logger *log
 		Status:  updateReq.Status,
 	}
 
-	if record.Record != nil {
-		if err := db.ValidateRecordTime(*record.Record); err != nil {
-			logger.Printf("WARN: validation error, %v", err)
-			writeJsonError(res, http.StatusBadRequest, err.Error())
-			return
-		}
-	}
-
-	err := db.UpdateRecord(record.ID, record)
+	// Время записи проверяет UpdateRecord: без учета самой записи и в одной транзакции с изменением
+	err = db.UpdateRecord(record.ID, record, expectedVersion)
 	if err != nil {
 		logger.Printf("ERROR: updating record error, %v", err)
-		writeJsonError(res, http.StatusInternalServerError, err.Error())
+		writeRecordError(res, req, record.ID, err, logger)
 		return
 	}
 
@@ -88,28 +91,35 @@ func updateRecordHandler(res http.ResponseWriter, req *http.Request, logger *log
 func deleteRecordHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
 	if req.Method != http.MethodDelete {
 		logger.Printf("WARN: incorrect request type")
-		writeJsonError(res, http.StatusMethodNotAllowed, "Method not allowed")
+		writeError(res, req, errMethodNotAllowed)
 		return
 	}
 
 	recordIDStr := req.URL.Query().Get("id")
 	if recordIDStr == "" {
 		logger.Printf("WARN: missing record ID")
-		writeJsonError(res, http.StatusBadRequest, "Record ID is required")
+		writeError(res, req, errIDRequired)
 		return
 	}
 
 	recordID, err := strconv.ParseInt(recordIDStr, 10, 64)
 	if err != nil {
 		logger.Printf("WARN: invalid record ID, %v", err)
-		writeJsonError(res, http.StatusBadRequest, "Invalid record ID")
+		writeError(res, req, errInvalidID)
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(req)
+	if err != nil {
+		logger.Printf("WARN: invalid If-Match header, %v", err)
+		writeError(res, req, err)
 		return
 	}
 
-	err = db.DeleteRecord(recordID)
+	err = db.DeleteRecord(recordID, expectedVersion)
 	if err != nil {
 		logger.Printf("ERROR: deleting record error, %v", err)
-		writeJsonError(res, http.StatusInternalServerError, err.Error())
+		writeRecordError(res, req, recordID, err, logger)
 		return
 	}
 
@@ -120,21 +130,28 @@ func deleteRecordHandler(res http.ResponseWriter, req *http.Request, logger *log
 func updateRecordStatusHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
 	if req.Method != http.MethodPut {
 		logger.Printf("WARN: incorrect request type")
-		writeJsonError(res, http.StatusMethodNotAllowed, "Method not allowed")
+		writeError(res, req, errMethodNotAllowed)
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(req)
+	if err != nil {
+		logger.Printf("WARN: invalid If-Match header, %v", err)
+		writeError(res, req, err)
 		return
 	}
 
 	var statusReq UpdateStatusRequest
 	if err := json.NewDecoder(req.Body).Decode(&statusReq); err != nil {
 		logger.Printf("WARN: unmarshal error, %v", err)
-		writeJsonError(res, http.StatusBadRequest, err.Error())
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
 		return
 	}
 
-	err := db.UpdateRecordStatus(statusReq.ID, statusReq.Status)
+	err = db.UpdateRecordStatus(statusReq.ID, statusReq.Status, expectedVersion)
 	if err != nil {
 		logger.Printf("ERROR: updating record status error, %v", err)
-		writeJsonError(res, http.StatusInternalServerError, err.Error())
+		writeRecordError(res, req, statusReq.ID, err, logger)
 		return
 	}
 
@@ -145,7 +162,7 @@ func updateRecordStatusHandler(res http.ResponseWriter, req *http.Request, logge
 func getAllRecordsHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
 	if req.Method != http.MethodPost {
 		logger.Printf("WARN: incorrect request type")
-		writeJsonError(res, http.StatusMethodNotAllowed, "Method not allowed")
+		writeError(res, req, errMethodNotAllowed)
 		return
 	}
 
@@ -166,7 +183,7 @@ func getAllRecordsHandler(res http.ResponseWriter, req *http.Request, logger *lo
 	records, err := db.GetAllRecords(pagination.Limit, pagination.Offset)
 	if err != nil {
 		logger.Printf("ERROR: getting all records error, %v", err)
-		writeJsonError(res, http.StatusInternalServerError, err.Error())
+		writeError(res, req, err)
 		return
 	}
 
@@ -177,21 +194,21 @@ func getAllRecordsHandler(res http.ResponseWriter, req *http.Request, logger *lo
 func getRecordsByStatusHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
 	if req.Method != http.MethodPost {
 		logger.Printf("WARN: incorrect request type")
-		writeJsonError(res, http.StatusMethodNotAllowed, "Method not allowed")
+		writeError(res, req, errMethodNotAllowed)
 		return
 	}
 
 	var statusReq StatusRequest
 	if err := json.NewDecoder(req.Body).Decode(&statusReq); err != nil {
 		logger.Printf("WARN: unmarshal error, %v", err)
-		writeJsonError(res, http.StatusBadRequest, err.Error())
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
 		return
 	}
 
 	records, err := db.GetRecordsByStatus(statusReq.Status)
 	if err != nil {
 		logger.Printf("ERROR: getting records by status error, %v", err)
-		writeJsonError(res, http.StatusInternalServerError, err.Error())
+		writeError(res, req, err)
 		return
 	}
 
@@ -202,31 +219,66 @@ func getRecordsByStatusHandler(res http.ResponseWriter, req *http.Request, logge
 func getRecordByIDHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
 	if req.Method != http.MethodGet {
 		logger.Printf("WARN: incorrect request type")
-		writeJsonError(res, http.StatusMethodNotAllowed, "Method not allowed")
+		writeError(res, req, errMethodNotAllowed)
 		return
 	}
 
 	recordIDStr := req.URL.Query().Get("id")
 	if recordIDStr == "" {
 		logger.Printf("WARN: missing record ID")
-		writeJsonError(res, http.StatusBadRequest, "Record ID is required")
+		writeError(res, req, errIDRequired)
 		return
 	}
 
 	recordID, err := strconv.ParseInt(recordIDStr, 10, 64)
 	if err != nil {
 		logger.Printf("WARN: invalid record ID, %v", err)
-		writeJsonError(res, http.StatusBadRequest, "Invalid record ID")
+		writeError(res, req, errInvalidID)
 		return
 	}
 
 	record, err := db.GetRecordByID(recordID)
 	if err != nil {
 		logger.Printf("ERROR: getting record by ID error, %v", err)
-		writeJsonError(res, http.StatusInternalServerError, err.Error())
+		writeError(res, req, err)
 		return
 	}
 
 	logger.Printf("INFO: record %d retrieved successfully", recordID)
+	res.Header().Set("ETag", recordETag(*record))
 	writeJson(res, http.StatusOK, map[string]any{"record": record})
 }
+
+// callNextHandler вызывает следующего клиента на освободившийся пост
+func callNextHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	if req.Method != http.MethodPost {
+		logger.Printf("WARN: incorrect request type")
+		writeError(res, req, errMethodNotAllowed)
+		return
+	}
+
+	// Тело запроса необязательно: без номера поста выбирается пост мастера или первый свободный
+	var callReq CallNextRequest
+	if err := json.NewDecoder(req.Body).Decode(&callReq); err != nil && err != io.EOF {
+		logger.Printf("WARN: unmarshal error, %v", err)
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
+		return
+	}
+
+	if callReq.Bay < 0 || callReq.Bay > db.Bays {
+		logger.Printf("WARN: invalid bay %d", callReq.Bay)
+		writeError(res, req, errInvalidBay)
+		return
+	}
+
+	record, err := queue.CallNext(time.Now(), callReq.Bay, callReq.MechanicID)
+	if err != nil {
+		logger.Printf("WARN: calling next record error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: record %d called to bay %d", record.ID, *record.Bay)
+	res.Header().Set("ETag", recordETag(*record))
+	writeJson(res, http.StatusOK, map[string]any{"record": normalizeRecord(*record)})
+}
@@ -7,17 +7,27 @@ import (
 	"net/http"
 	"time"
 	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/queue"
+	"tire-pepair-record-service/pkg/tickets"
 )
 
 // normalizeRecord преобразует запись в единый формат для фронтенда
 func normalizeRecord(record db.Record) map[string]interface{} {
 	normalized := map[string]interface{}{
-		"id":      record.ID,
-		"date":    record.Date,
-		"title":   record.Title,
-		"record":  record.Record,
-		"comment": record.Comment,
-		"status":  record.Status,
+		"id":          record.ID,
+		"date":        record.Date,
+		"title":       record.Title,
+		"record":      record.Record,
+		"comment":     record.Comment,
+		"status":      record.Status,
+		"service":     record.Service,
+		"bay":         record.Bay,
+		"mechanicId":  record.MechanicID,
+		"startedAt":   record.StartedAt,
+		"finishedAt":  record.FinishedAt,
+		"convertedAt": record.ConvertedAt,
+		"version":     record.Version,
+		"updatedAt":   record.UpdatedAt,
 	}
 
 	// Генерируем номер талона
@@ -27,22 +37,43 @@ func normalizeRecord(record db.Record) map[string]interface{} {
 	return normalized
 }
 
+// recordWithContacts дополняет запись контактами клиента. Только для ответов
+// администратору: в публичных списках контактов быть не должно
+func recordWithContacts(record db.Record) map[string]interface{} {
+	normalized := normalizeRecord(record)
+	normalized["contacts"] = map[string]string{
+		"phone":    record.Contacts.Phone,
+		"email":    record.Contacts.Email,
+		"telegram": record.Contacts.Telegram,
+		"lang":     record.Contacts.Language,
+	}
+	return normalized
+}
+
 // generateTicketNumber генерирует номер талона
 func generateTicketNumber(id int64, recordTime *time.Time) string {
-	prefix := "О" // Очередь
-	if recordTime != nil {
-		prefix = "З" // Запись
-	}
+	return tickets.Number(id, recordTime)
+}
 
-	// Берем последние 3 цифры ID
-	idStr := fmt.Sprintf("%d", id)
-	if len(idStr) > 3 {
-		idStr = idStr[len(idStr)-3:]
-	} else {
-		idStr = fmt.Sprintf("%03s", idStr)
-	}
+// selfServiceLink возвращает ссылку, по которой клиент может следить за своей записью,
+// отменить или перенести ее
+func selfServiceLink(record db.Record) string {
+	return tickets.StatusPath(record.AccessToken)
+}
 
-	return prefix + idStr
+// withEstimates упорядочивает записи по очереди вызова и дополняет ожидающие
+// местом в очереди и ожидаемым временем начала
+func withEstimates(records []db.Record, estimates map[int64]queue.Estimate) []map[string]interface{} {
+	records = queue.Order(records, estimates)
+	normalized := normalizeRecords(records)
+	for i, record := range records {
+		if estimate, ok := estimates[record.ID]; ok {
+			normalized[i]["position"] = estimate.Position
+			normalized[i]["eta"] = estimate.ETA
+			normalized[i]["waitMinutes"] = estimate.Minutes()
+		}
+	}
+	return normalized
 }
 
 // normalizeRecords преобразует массив записей
@@ -57,41 +88,48 @@ func normalizeRecords(records []db.Record) []map[string]interface{} {
 func getTodayRecordsHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
 	if req.Method != http.MethodGet {
 		logger.Printf("WARN: incorrect request type")
-		writeJsonError(res, http.StatusMethodNotAllowed, "Method not allowed")
+		writeError(res, req, errMethodNotAllowed)
 		return
 	}
 
 	records, err := db.GetTodayRecords("")
 	if err != nil {
 		logger.Printf("ERROR: getting today's records error, %v", err)
-		writeJsonError(res, http.StatusInternalServerError, err.Error())
+		writeError(res, req, err)
+		return
+	}
+
+	estimates, err := queue.Today(time.Now())
+	if err != nil {
+		logger.Printf("ERROR: estimating queue error, %v", err)
+		writeError(res, req, err)
 		return
 	}
 
 	logger.Printf("INFO: today's records retrieved successfully")
 	writeJson(res, http.StatusOK, map[string]any{
-		"records": normalizeRecords(records),
+		"records": withEstimates(records, estimates),
 	})
 }
 
 func getAvailableSlotsHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
 	if req.Method != http.MethodPost {
 		logger.Printf("WARN: incorrect request type")
-		writeJsonError(res, http.StatusMethodNotAllowed, "Method not allowed")
+		writeError(res, req, errMethodNotAllowed)
 		return
 	}
 
 	var dateReq DateRequest
 	if err := json.NewDecoder(req.Body).Decode(&dateReq); err != nil {
 		logger.Printf("WARN: unmarshal error, %v", err)
-		writeJsonError(res, http.StatusBadRequest, err.Error())
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
 		return
 	}
 
 	slots, err := db.GetAvailableSlots(dateReq.Date)
 	if err != nil {
 		logger.Printf("ERROR: getting available slots error, %v", err)
-		writeJsonError(res, http.StatusInternalServerError, err.Error())
+		writeError(res, req, err)
 		return
 	}
 
@@ -102,21 +140,21 @@ func getAvailableSlotsHandler(res http.ResponseWriter, req *http.Request, logger
 func getRecordsByDateHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
 	if req.Method != http.MethodPost {
 		logger.Printf("WARN: incorrect request type")
-		writeJsonError(res, http.StatusMethodNotAllowed, "Method not allowed")
+		writeError(res, req, errMethodNotAllowed)
 		return
 	}
 
 	var dateReq DateRequest
 	if err := json.NewDecoder(req.Body).Decode(&dateReq); err != nil {
 		logger.Printf("WARN: unmarshal error, %v", err)
-		writeJsonError(res, http.StatusBadRequest, err.Error())
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
 		return
 	}
 
 	records, err := db.GetRecordsByDate(dateReq.Date)
 	if err != nil {
 		logger.Printf("ERROR: getting records by date error, %v", err)
-		writeJsonError(res, http.StatusInternalServerError, err.Error())
+		writeError(res, req, err)
 		return
 	}
 
@@ -127,51 +165,57 @@ func getRecordsByDateHandler(res http.ResponseWriter, req *http.Request, logger
 func addRecordHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
 	if req.Method != http.MethodPost {
 		logger.Printf("WARN: incorrect request type")
-		writeJsonError(res, http.StatusMethodNotAllowed, "Method not allowed")
+		writeError(res, req, errMethodNotAllowed)
 		return
 	}
 
 	var addReq AddRecordRequest
 	if err := json.NewDecoder(req.Body).Decode(&addReq); err != nil {
 		logger.Printf("WARN: unmarshal error, %v", err)
-		writeJsonError(res, http.StatusBadRequest, err.Error())
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
 		return
 	}
 
 	// Валидация обязательных полей
 	if addReq.Title == "" {
 		logger.Printf("WARN: missing required field 'title'")
-		writeJsonError(res, http.StatusBadRequest, "Car number is required")
+		writeError(res, req, errTitleRequired)
 		return
 	}
 
-	// Если время указано (предварительная запись), валидируем его
-	if addReq.Record != nil {
-		if err := db.ValidateRecordTime(*addReq.Record); err != nil {
-			logger.Printf("WARN: validation error, %v", err)
-			writeJsonError(res, http.StatusBadRequest, err.Error())
-			return
-		}
-	}
-	// Если время не указано - это запись в текущую очередь, валидация не нужна
+	// Время предварительной записи проверяется в db.AddRecordWithHold с учетом
+	// удержания клиента. Для текущей очереди время не указывается
 
 	record := db.Record{
 		Title:   addReq.Title,
 		Record:  addReq.Record, // может быть nil для текущей очереди
 		Comment: addReq.Comment,
 		Status:  "wait",
+		Service: addReq.Service,
+	}
+	if addReq.Contacts != nil {
+		record.Contacts = addReq.Contacts.toContacts()
+	}
+	// Уведомления приходят на языке, на котором клиент записывался
+	if record.Contacts.Language == "" {
+		record.Contacts.Language = preferredLanguage(req)
 	}
 
-	err := db.AddRecord(record)
+	created, err := db.AddRecordWithHold(record, addReq.HoldToken)
 	if err != nil {
 		logger.Printf("ERROR: adding record error, %v", err)
-		writeJsonError(res, http.StatusInternalServerError, err.Error())
+		writeError(res, req, err)
 		return
 	}
 
-	logger.Printf("INFO: record added successfully for car %s", record.Title)
-	writeJson(res, http.StatusOK, map[string]any{
-		"message": "Record added successfully",
-		"success": true,
+	logger.Printf("INFO: record %d added successfully for car %s", created.ID, created.Title)
+	res.Header().Set("Location", fmt.Sprintf("/api/v1/records/%d", created.ID))
+	writeJson(res, http.StatusCreated, map[string]any{
+		"message":      "Record added successfully",
+		"success":      true,
+		"id":           created.ID,
+		"ticketNumber": generateTicketNumber(created.ID, created.Record),
+		"link":         selfServiceLink(*created),
+		"record":       normalizeRecord(*created),
 	})
 }
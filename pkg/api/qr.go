@@ -0,0 +1,93 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/qr"
+)
+
+// writeQR отправляет QR-код ссылки на страницу статуса записи в формате
+// ?format=svg (по умолчанию) или png; для png ?scale= - пикселей на модуль (1-32)
+func writeQR(res http.ResponseWriter, req *http.Request, logger *log.Logger, record db.Record) {
+	query := req.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = "svg"
+	}
+	if format != "svg" && format != "png" {
+		logger.Printf("WARN: invalid QR format %s", format)
+		writeError(res, req, errInvalidQRFormat)
+		return
+	}
+
+	scale := 8
+	if value := query.Get("scale"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 32 {
+			logger.Printf("WARN: invalid QR scale %s", value)
+			writeError(res, req, errInvalidQRScale)
+			return
+		}
+		scale = parsed
+	}
+
+	code, err := qr.Encode(publicURL(req) + selfServiceLink(record))
+	if err != nil {
+		logger.Printf("ERROR: encoding QR code error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	contentType, data := "image/svg+xml", code.SVG()
+	if format == "png" {
+		contentType = "image/png"
+		if data, err = code.PNG(scale); err != nil {
+			logger.Printf("ERROR: encoding QR image error, %v", err)
+			writeError(res, req, err)
+			return
+		}
+	}
+
+	logger.Printf("INFO: QR code for record %d generated", record.ID)
+	res.Header().Set("Content-Type", contentType)
+	res.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	res.Header().Set("Cache-Control", "private, max-age=86400")
+	res.WriteHeader(http.StatusOK)
+	res.Write(data)
+}
+
+// GET /api/v1/records/{id}/qr
+// QR-код ссылки на страницу статуса записи для талона или печатной формы
+func recordQRHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	recordID, err := parseRecordID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid record ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+
+	record, err := db.GetRecordByID(recordID)
+	if err != nil {
+		logger.Printf("WARN: getting record error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	writeQR(res, req, logger, *record)
+}
+
+// GET /api/v1/self/{token}/qr
+// QR-код ссылки на страницу статуса для экрана подтверждения записи
+func selfServiceQRHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	record, err := db.GetRecordByAccessToken(req.PathValue("token"))
+	if err != nil {
+		logger.Printf("WARN: self-service record lookup error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	writeQR(res, req, logger, *record)
+}
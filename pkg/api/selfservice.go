@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/queue"
+)
+
+type RescheduleRequest struct {
+	Record time.Time `json:"record"`
+}
+
+// selfServiceView представление записи для клиента
+func selfServiceView(record db.Record) (map[string]any, error) {
+	estimates, err := queue.Today(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	view := normalizeRecord(record)
+	view["position"] = 0
+	if estimate, ok := estimates[record.ID]; ok {
+		view["position"] = estimate.Position
+		view["eta"] = estimate.ETA
+		view["waitMinutes"] = estimate.Minutes()
+	}
+	view["canChange"] = db.CheckCustomerChange(record, time.Now()) == nil
+	if !record.WalkIn() {
+		view["changeDeadline"] = record.Record.Add(-db.SelfServiceCutoff)
+	}
+
+	return view, nil
+}
+
+// GET /api/v1/self/{token}
+func selfServiceStatusHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	record, err := db.GetRecordByAccessToken(req.PathValue("token"))
+	if err != nil {
+		logger.Printf("WARN: self-service record lookup error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	view, err := selfServiceView(*record)
+	if err != nil {
+		logger.Printf("ERROR: getting queue position error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: self-service status for record %d retrieved", record.ID)
+	writeJson(res, http.StatusOK, map[string]any{"record": view})
+}
+
+// POST /api/v1/self/{token}/cancel
+func selfServiceCancelHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	record, err := db.CancelRecordByCustomer(req.PathValue("token"))
+	if err != nil {
+		logger.Printf("WARN: self-service cancel error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	view, err := selfServiceView(*record)
+	if err != nil {
+		logger.Printf("ERROR: getting queue position error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: record %d cancelled by customer", record.ID)
+	writeJson(res, http.StatusOK, map[string]any{"record": view})
+}
+
+// POST /api/v1/self/{token}/reschedule
+func selfServiceRescheduleHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	var rescheduleReq RescheduleRequest
+	if err := json.NewDecoder(req.Body).Decode(&rescheduleReq); err != nil {
+		logger.Printf("WARN: unmarshal error, %v", err)
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
+		return
+	}
+
+	record, err := db.RescheduleRecordByCustomer(req.PathValue("token"), rescheduleReq.Record)
+	if err != nil {
+		logger.Printf("WARN: self-service reschedule error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	view, err := selfServiceView(*record)
+	if err != nil {
+		logger.Printf("ERROR: getting queue position error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: record %d rescheduled by customer to %s", record.ID, rescheduleReq.Record.Format(time.RFC3339))
+	writeJson(res, http.StatusOK, map[string]any{"record": view})
+}
@@ -43,7 +43,7 @@ func auth(next http.HandlerFunc, logger *log.Logger) http.HandlerFunc {
 
 			if createToken(password) != jwt {
 				logger.Printf("WARN: Authentification required")
-				writeJsonError(res, http.StatusUnauthorized, "Authentification required")
+				writeError(res, req, errUnauthorized)
 				return
 			}
 		}
@@ -54,7 +54,7 @@ func auth(next http.HandlerFunc, logger *log.Logger) http.HandlerFunc {
 func signin(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
 	if req.Method != http.MethodPost {
 		logger.Printf("WARN: incorrect request type")
-		writeJsonError(res, http.StatusMethodNotAllowed, "Method not allowed")
+		writeError(res, req, errMethodNotAllowed)
 		return
 	}
 
@@ -66,26 +66,26 @@ func signin(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
 	_, err := buf.ReadFrom(req.Body)
 	if err != nil {
 		logger.Printf("WARN: request reading error, %v", err)
-		writeJsonError(res, http.StatusBadRequest, err.Error())
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
 		return
 	}
 
 	if err = json.Unmarshal(buf.Bytes(), &userPassword); err != nil {
 		logger.Printf("WARN: unmarshal error, %v", err)
-		writeJsonError(res, http.StatusBadRequest, err.Error())
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
 		return
 	}
 
 	if userPassword.Password != password {
 		logger.Printf("WARN: uncorrect password")
-		writeJsonError(res, http.StatusMethodNotAllowed, "Uncorrect password")
+		writeError(res, req, errInvalidPassword)
 		return
 	}
 
 	token := createToken(password)
 	if token == "" {
 		logger.Printf("WARN: creating token error")
-		writeJsonError(res, http.StatusMethodNotAllowed, "Creating token error")
+		writeError(res, req, errInternal)
 		return
 	}
 
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+)
+
+type StaffRequest struct {
+	Name string `json:"name"`
+	Bay  *int   `json:"bay,omitempty"`
+}
+
+// PatchStaffRequest частичное обновление мастера. Поле bay принимает null (снять пост)
+type PatchStaffRequest struct {
+	Name   *string         `json:"name,omitempty"`
+	Bay    json.RawMessage `json:"bay,omitempty"`
+	Active *bool           `json:"active,omitempty"`
+}
+
+// toPatch преобразует запрос в db.StaffPatch
+func (p PatchStaffRequest) toPatch() (db.StaffPatch, error) {
+	patch := db.StaffPatch{Name: p.Name, Active: p.Active}
+
+	if len(p.Bay) > 0 {
+		if bytes.Equal(bytes.TrimSpace(p.Bay), []byte("null")) {
+			patch.ClearBay = true
+		} else {
+			var bay int
+			if err := json.Unmarshal(p.Bay, &bay); err != nil || !validBay(bay) {
+				return patch, errInvalidBay
+			}
+			patch.Bay = &bay
+		}
+	}
+
+	return patch, nil
+}
+
+// validBay проверяет номер поста
+func validBay(bay int) bool {
+	return bay > 0 && bay <= db.Bays
+}
+
+func normalizeStaff(staff db.Staff) map[string]any {
+	return map[string]any{
+		"id":        staff.ID,
+		"name":      staff.Name,
+		"bay":       staff.Bay,
+		"active":    staff.Active,
+		"createdAt": staff.CreatedAt,
+	}
+}
+
+// parseStaffID извлекает ID мастера из пути запроса
+func parseStaffID(req *http.Request) (int64, error) {
+	return strconv.ParseInt(req.PathValue("id"), 10, 64)
+}
+
+// GET /api/v1/staff?all=true
+func listStaffHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	list, err := db.ListStaff(req.URL.Query().Get("all") == "true")
+	if err != nil {
+		logger.Printf("ERROR: listing staff error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	staff := make([]map[string]any, len(list))
+	for i, s := range list {
+		staff[i] = normalizeStaff(s)
+	}
+
+	logger.Printf("INFO: staff listed successfully")
+	writeJson(res, http.StatusOK, map[string]any{"staff": staff})
+}
+
+// POST /api/v1/staff
+func createStaffHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	var staffReq StaffRequest
+	if err := json.NewDecoder(req.Body).Decode(&staffReq); err != nil {
+		logger.Printf("WARN: unmarshal error, %v", err)
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
+		return
+	}
+
+	if staffReq.Bay != nil && !validBay(*staffReq.Bay) {
+		logger.Printf("WARN: invalid bay %d", *staffReq.Bay)
+		writeError(res, req, errInvalidBay)
+		return
+	}
+
+	staff, err := db.CreateStaff(staffReq.Name, staffReq.Bay)
+	if err != nil {
+		logger.Printf("WARN: creating staff error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: staff member %d created", staff.ID)
+	writeJson(res, http.StatusCreated, map[string]any{"staff": normalizeStaff(*staff)})
+}
+
+// PATCH /api/v1/staff/{id}
+// Уволенного мастера деактивируют полем active=false, история его работ сохраняется
+func patchStaffHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	staffID, err := parseStaffID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid staff ID, %v", err)
+		writeError(res, req, errInvalidStaffID)
+		return
+	}
+
+	var patchReq PatchStaffRequest
+	if err := json.NewDecoder(req.Body).Decode(&patchReq); err != nil {
+		logger.Printf("WARN: unmarshal error, %v", err)
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
+		return
+	}
+
+	patch, err := patchReq.toPatch()
+	if err != nil {
+		logger.Printf("WARN: invalid staff patch, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	staff, err := db.UpdateStaff(staffID, patch)
+	if err != nil {
+		logger.Printf("WARN: updating staff error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: staff member %d updated", staffID)
+	writeJson(res, http.StatusOK, map[string]any{"staff": normalizeStaff(*staff)})
+}
+
+// GET /api/v1/staff/{id}/jobs
+// Личная очередь мастера: текущие работы и назначенные ему записи
+func mechanicJobsHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	staffID, err := parseStaffID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid staff ID, %v", err)
+		writeError(res, req, errInvalidStaffID)
+		return
+	}
+
+	jobs, err := db.GetMechanicJobs(staffID, time.Now())
+	if err != nil {
+		logger.Printf("WARN: getting mechanic jobs error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: jobs of staff member %d retrieved", staffID)
+	writeJson(res, http.StatusOK, map[string]any{
+		"current": normalizeRecords(jobs.Current),
+		"next":    normalizeRecords(jobs.Next),
+	})
+}
+
+// GET /api/v1/staff/workload?from=&to=
+// Загрузка мастеров за период, по умолчанию за сегодня
+func staffWorkloadHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	query := req.URL.Query()
+
+	from, err := parseTimeParam(query.Get("from"), false)
+	if err != nil {
+		logger.Printf("WARN: invalid from, %v", err)
+		writeError(res, req, errInvalidDate)
+		return
+	}
+	to, err := parseTimeParam(query.Get("to"), true)
+	if err != nil {
+		logger.Printf("WARN: invalid to, %v", err)
+		writeError(res, req, errInvalidDate)
+		return
+	}
+
+	now := time.Now()
+	if from == nil {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		from = &today
+	}
+	if to == nil {
+		end := from.AddDate(0, 0, 1)
+		to = &end
+	}
+
+	workload, err := db.GetWorkload(*from, *to)
+	if err != nil {
+		logger.Printf("ERROR: getting workload error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	items := make([]map[string]any, len(workload))
+	for i, w := range workload {
+		items[i] = map[string]any{
+			"staff":          normalizeStaff(w.Staff),
+			"done":           w.Done,
+			"inWork":         w.InWork,
+			"totalMinutes":   int(w.Total.Minutes()),
+			"averageMinutes": int(w.Average.Minutes()),
+		}
+	}
+
+	logger.Printf("INFO: staff workload retrieved successfully")
+	writeJson(res, http.StatusOK, map[string]any{"from": from, "to": to, "workload": items})
+}
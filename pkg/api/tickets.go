@@ -0,0 +1,82 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/documents"
+	"tire-pepair-record-service/pkg/tickets"
+)
+
+// publicURL возвращает адрес сервиса для клиентских ссылок: TODO_PUBLIC_URL
+// или адрес, по которому пришел запрос
+func publicURL(req *http.Request) string {
+	if documents.PublicURL != "" {
+		return documents.PublicURL
+	}
+
+	scheme := "http"
+	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host
+}
+
+// recordTicket читает запись из пути запроса и заполняет по ней талон
+func recordTicket(res http.ResponseWriter, req *http.Request, logger *log.Logger) (tickets.Ticket, bool) {
+	recordID, err := parseRecordID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid record ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return tickets.Ticket{}, false
+	}
+
+	record, err := db.GetRecordByID(recordID)
+	if err != nil {
+		logger.Printf("WARN: getting record error, %v", err)
+		writeError(res, req, err)
+		return tickets.Ticket{}, false
+	}
+
+	return tickets.NewTicket(*record, publicURL(req), time.Now()), true
+}
+
+// GET /api/v1/records/{id}/ticket
+// Талон в командах ESC/POS для печати на принтере рабочего места
+func ticketHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	ticket, ok := recordTicket(res, req, logger)
+	if !ok {
+		return
+	}
+
+	data := ticket.Render()
+	logger.Printf("INFO: ticket %s rendered", ticket.Number)
+	res.Header().Set("Content-Type", "application/octet-stream")
+	res.Header().Set("Content-Disposition", `attachment; filename="ticket.bin"`)
+	res.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	res.WriteHeader(http.StatusOK)
+	res.Write(data)
+}
+
+// POST /api/v1/records/{id}/ticket
+// Печать талона на принтере TODO_TICKET_PRINTER
+func printTicketHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	ticket, ok := recordTicket(res, req, logger)
+	if !ok {
+		return
+	}
+
+	if err := tickets.Print(ticket); err != nil {
+		logger.Printf("ERROR: printing ticket %s error, %v", ticket.Number, err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: ticket %s printed", ticket.Number)
+	writeJson(res, http.StatusOK, map[string]any{
+		"printed":      true,
+		"ticketNumber": ticket.Number,
+	})
+}
@@ -0,0 +1,447 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/queue"
+)
+
+// PatchRecordRequest частичное обновление записи: отсутствующие поля не изменяются.
+// Поле record принимает время или null (перевод в текущую очередь)
+type PatchRecordRequest struct {
+	Title   *string         `json:"title,omitempty"`
+	Record  json.RawMessage `json:"record,omitempty"`
+	Comment *string         `json:"comment,omitempty"`
+	Status  *string         `json:"status,omitempty"`
+	Service *string         `json:"service,omitempty"`
+	Bay     json.RawMessage `json:"bay,omitempty"`
+
+	MechanicID json.RawMessage `json:"mechanicId,omitempty"`
+
+	Contacts *ContactsRequest `json:"contacts,omitempty"` // заменяет контакты целиком
+}
+
+// toPatch преобразует запрос в db.RecordPatch
+func (p PatchRecordRequest) toPatch() (db.RecordPatch, error) {
+	patch := db.RecordPatch{
+		Title:   p.Title,
+		Comment: p.Comment,
+		Status:  p.Status,
+		Service: p.Service,
+	}
+
+	if p.Contacts != nil {
+		contacts := p.Contacts.toContacts()
+		patch.Contacts = &contacts
+	}
+
+	if len(p.Record) > 0 {
+		if bytes.Equal(bytes.TrimSpace(p.Record), []byte("null")) {
+			patch.ClearRecord = true
+		} else {
+			var recordTime time.Time
+			if err := json.Unmarshal(p.Record, &recordTime); err != nil {
+				return patch, errInvalidJSON.withDetail(err.Error())
+			}
+			patch.Record = &recordTime
+		}
+	}
+
+	if len(p.Bay) > 0 {
+		if bytes.Equal(bytes.TrimSpace(p.Bay), []byte("null")) {
+			patch.ClearBay = true
+		} else {
+			var bay int
+			if err := json.Unmarshal(p.Bay, &bay); err != nil || !validBay(bay) {
+				return patch, errInvalidBay
+			}
+			patch.Bay = &bay
+		}
+	}
+
+	if len(p.MechanicID) > 0 {
+		if bytes.Equal(bytes.TrimSpace(p.MechanicID), []byte("null")) {
+			patch.ClearMechanic = true
+		} else {
+			var mechanicID int64
+			if err := json.Unmarshal(p.MechanicID, &mechanicID); err != nil || mechanicID <= 0 {
+				return patch, errInvalidStaffID
+			}
+			patch.MechanicID = &mechanicID
+		}
+	}
+
+	if patch.Title != nil && *patch.Title == "" {
+		return patch, errTitleRequired
+	}
+
+	return patch, nil
+}
+
+// parseRecordID извлекает ID записи из пути запроса
+func parseRecordID(req *http.Request) (int64, error) {
+	return strconv.ParseInt(req.PathValue("id"), 10, 64)
+}
+
+// parseDateParam разбирает дату формата YYYY-MM-DD в локальной зоне
+func parseDateParam(value string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+// GET /api/v1/records?status=&date=&limit=&offset=
+func listRecordsV1Handler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	query := req.URL.Query()
+
+	var records []db.Record
+	var err error
+
+	switch {
+	case query.Get("status") != "":
+		records, err = db.GetRecordsByStatus(query.Get("status"))
+	case query.Get("date") != "":
+		date, parseErr := parseDateParam(query.Get("date"))
+		if parseErr != nil {
+			logger.Printf("WARN: invalid date, %v", parseErr)
+			writeError(res, req, errInvalidDate)
+			return
+		}
+		records, err = db.GetRecordsByDate(date)
+	default:
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		offset, _ := strconv.Atoi(query.Get("offset"))
+		if limit <= 0 || limit > 100 {
+			limit = 50
+		}
+		if offset < 0 {
+			offset = 0
+		}
+		records, err = db.GetAllRecords(limit, offset)
+	}
+
+	if err != nil {
+		logger.Printf("ERROR: listing records error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: records listed successfully")
+	writeJson(res, http.StatusOK, map[string]any{"records": normalizeRecords(records)})
+}
+
+// parseTimeParam разбирает границу периода: дату YYYY-MM-DD или время RFC 3339.
+// Для даты в качестве конца периода берется конец дня
+func parseTimeParam(value string, endOfPeriod bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := parseDateParam(value)
+	if err != nil {
+		return nil, err
+	}
+	if endOfPeriod {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// parseRecordFilter разбирает параметры фильтра записей plate, q, status, from,
+// to, kind и bay
+func parseRecordFilter(query url.Values) (db.RecordFilter, error) {
+	filter := db.RecordFilter{
+		Plate: query.Get("plate"),
+		Text:  query.Get("q"),
+		Kind:  query.Get("kind"),
+	}
+
+	// Статусы передаются повторяющимся параметром или списком через запятую
+	for _, value := range query["status"] {
+		for _, status := range strings.Split(value, ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				filter.Statuses = append(filter.Statuses, status)
+			}
+		}
+	}
+
+	if filter.Kind != "" && filter.Kind != db.KindBooked && filter.Kind != db.KindWalkIn {
+		return filter, errInvalidKind
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(query.Get("from"), false); err != nil {
+		return filter, errInvalidDate
+	}
+	if filter.To, err = parseTimeParam(query.Get("to"), true); err != nil {
+		return filter, errInvalidDate
+	}
+
+	if value := query.Get("bay"); value != "" {
+		bay, err := strconv.Atoi(value)
+		if err != nil || bay <= 0 {
+			return filter, errInvalidBay
+		}
+		filter.Bay = &bay
+	}
+
+	return filter, nil
+}
+
+// GET /api/v1/records/search?plate=&q=&status=&from=&to=&kind=&bay=&sort=&order=&limit=&cursor=
+func searchRecordsV1Handler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	query := req.URL.Query()
+
+	filter, err := parseRecordFilter(query)
+	if err != nil {
+		logger.Printf("WARN: invalid record filter, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	filter.Sort = query.Get("sort")
+	filter.Desc = query.Get("order") == "desc"
+	filter.Cursor = query.Get("cursor")
+	filter.Limit, _ = strconv.Atoi(query.Get("limit"))
+
+	result, err := db.SearchRecords(filter)
+	if err != nil {
+		logger.Printf("ERROR: searching records error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: records search returned %d of %d", len(result.Records), result.Total)
+	writeJson(res, http.StatusOK, map[string]any{
+		"records":    normalizeRecords(result.Records),
+		"total":      result.Total,
+		"nextCursor": result.NextCursor,
+	})
+}
+
+// GET /api/v1/records/today
+func todayRecordsV1Handler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	records, err := db.GetTodayRecords(req.URL.Query().Get("status"))
+	if err != nil {
+		logger.Printf("ERROR: getting today's records error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	estimates, err := queue.Today(time.Now())
+	if err != nil {
+		logger.Printf("ERROR: estimating queue error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: today's records retrieved successfully")
+	writeJson(res, http.StatusOK, map[string]any{"records": withEstimates(records, estimates)})
+}
+
+// GET /api/v1/records/{id}
+func getRecordV1Handler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	recordID, err := parseRecordID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid record ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+
+	record, err := db.GetRecordByID(recordID)
+	if err != nil {
+		logger.Printf("ERROR: getting record by ID error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: record %d retrieved successfully", recordID)
+	res.Header().Set("ETag", recordETag(*record))
+	writeJson(res, http.StatusOK, map[string]any{"record": recordWithContacts(*record)})
+}
+
+// PATCH /api/v1/records/{id}
+func patchRecordV1Handler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	recordID, err := parseRecordID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid record ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(req)
+	if err != nil {
+		logger.Printf("WARN: invalid If-Match header, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	var patchReq PatchRecordRequest
+	if err := json.NewDecoder(req.Body).Decode(&patchReq); err != nil {
+		logger.Printf("WARN: unmarshal error, %v", err)
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
+		return
+	}
+
+	patch, err := patchReq.toPatch()
+	if err != nil {
+		logger.Printf("WARN: invalid patch, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	record, err := db.PatchRecord(recordID, patch, expectedVersion)
+	if err != nil {
+		logger.Printf("ERROR: patching record error, %v", err)
+		writeRecordError(res, req, recordID, err, logger)
+		return
+	}
+
+	logger.Printf("INFO: record %d patched successfully", recordID)
+	res.Header().Set("ETag", recordETag(*record))
+	writeJson(res, http.StatusOK, map[string]any{"record": recordWithContacts(*record)})
+}
+
+// DELETE /api/v1/records/{id}
+func deleteRecordV1Handler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	recordID, err := parseRecordID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid record ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(req)
+	if err != nil {
+		logger.Printf("WARN: invalid If-Match header, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	if err := db.DeleteRecord(recordID, expectedVersion); err != nil {
+		logger.Printf("ERROR: deleting record error, %v", err)
+		writeRecordError(res, req, recordID, err, logger)
+		return
+	}
+
+	logger.Printf("INFO: record %d deleted successfully", recordID)
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/v1/slots?date=YYYY-MM-DD
+func listSlotsV1Handler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	date, err := parseDateParam(req.URL.Query().Get("date"))
+	if err != nil {
+		logger.Printf("WARN: invalid date, %v", err)
+		writeError(res, req, errInvalidDate)
+		return
+	}
+
+	slots, err := db.GetAvailableSlots(date)
+	if err != nil {
+		logger.Printf("ERROR: getting available slots error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: available slots for %s retrieved successfully", date.Format("2006-01-02"))
+	writeJson(res, http.StatusOK, map[string]any{"date": date.Format("2006-01-02"), "slots": slots})
+}
+
+// deprecated помечает устаревший маршрут заголовками Deprecation и Link на замену
+func deprecated(next http.HandlerFunc, successor string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Deprecation", "true")
+		res.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+		next(res, req)
+	}
+}
+
+// initV1 регистрирует ресурсное API /api/v1
+func initV1(mux *http.ServeMux, logger *log.Logger) {
+	handle := func(h func(http.ResponseWriter, *http.Request, *log.Logger)) http.HandlerFunc {
+		return func(res http.ResponseWriter, req *http.Request) { h(res, req, logger) }
+	}
+
+	mux.HandleFunc("GET /api/v1/openapi.json", openAPIHandler)
+
+	// Публичные ресурсы
+	mux.HandleFunc("POST /api/v1/records", idempotent(handle(addRecordHandler), logger))
+	mux.HandleFunc("GET /api/v1/records/today", handle(todayRecordsV1Handler))
+	mux.HandleFunc("GET /api/v1/slots", handle(listSlotsV1Handler))
+	mux.HandleFunc("GET /api/v1/slots/next", handle(nextSlotV1Handler))
+	mux.HandleFunc("GET /api/v1/calendar", handle(calendarV1Handler))
+	mux.HandleFunc("POST /api/v1/holds", handle(createHoldHandler))
+	mux.HandleFunc("DELETE /api/v1/holds/{token}", handle(releaseHoldHandler))
+
+	// Самообслуживание клиента по секретной ссылке
+	mux.HandleFunc("GET /api/v1/self/{token}", handle(selfServiceStatusHandler))
+	mux.HandleFunc("POST /api/v1/self/{token}/cancel", handle(selfServiceCancelHandler))
+	mux.HandleFunc("POST /api/v1/self/{token}/reschedule", handle(selfServiceRescheduleHandler))
+	mux.HandleFunc("GET /api/v1/self/{token}/qr", handle(selfServiceQRHandler))
+	mux.HandleFunc("GET /api/v1/self/{token}/event.ics", handle(selfServiceEventHandler))
+	mux.HandleFunc("GET /api/v1/ical/{token}", handle(calendarFeedHandler))
+
+	// Лист ожидания
+	mux.HandleFunc("POST /api/v1/waitlist", idempotent(handle(joinWaitlistHandler), logger))
+	mux.HandleFunc("GET /api/v1/waitlist/{token}", handle(waitlistStatusHandler))
+	mux.HandleFunc("POST /api/v1/waitlist/{token}/claim", handle(claimWaitlistOfferHandler))
+	mux.HandleFunc("DELETE /api/v1/waitlist/{token}", handle(leaveWaitlistHandler))
+
+	// Защищенные ресурсы
+	mux.HandleFunc("GET /api/v1/waitlist", auth(handle(listWaitlistHandler), logger))
+	mux.HandleFunc("GET /api/v1/records", auth(handle(listRecordsV1Handler), logger))
+	mux.HandleFunc("GET /api/v1/records/search", auth(handle(searchRecordsV1Handler), logger))
+	mux.HandleFunc("GET /api/v1/records/export", auth(handle(exportRecordsHandler), logger))
+	mux.HandleFunc("POST /api/v1/records/import", auth(handle(importRecordsHandler), logger))
+	mux.HandleFunc("GET /api/v1/accounting/commerceml", auth(handle(commerceMLHandler), logger))
+	mux.HandleFunc("GET /api/v1/analytics", auth(handle(analyticsHandler), logger))
+	mux.HandleFunc("GET /api/v1/analytics/daily", auth(handle(dailyReportHandler), logger))
+	mux.HandleFunc("GET /api/v1/records/{id}", auth(handle(getRecordV1Handler), logger))
+	mux.HandleFunc("PATCH /api/v1/records/{id}", auth(handle(patchRecordV1Handler), logger))
+	mux.HandleFunc("DELETE /api/v1/records/{id}", auth(handle(deleteRecordV1Handler), logger))
+	mux.HandleFunc("POST /api/v1/records/{id}/arrive", auth(handle(arriveRecordV1Handler), logger))
+	mux.HandleFunc("GET /api/v1/customers/{plate}", auth(handle(getCustomerV1Handler), logger))
+	mux.HandleFunc("GET /api/v1/staff", auth(handle(listStaffHandler), logger))
+	mux.HandleFunc("POST /api/v1/staff", auth(handle(createStaffHandler), logger))
+	mux.HandleFunc("GET /api/v1/staff/workload", auth(handle(staffWorkloadHandler), logger))
+	mux.HandleFunc("PATCH /api/v1/staff/{id}", auth(handle(patchStaffHandler), logger))
+	mux.HandleFunc("GET /api/v1/staff/{id}/jobs", auth(handle(mechanicJobsHandler), logger))
+	mux.HandleFunc("GET /api/v1/catalog", auth(handle(listCatalogHandler), logger))
+	mux.HandleFunc("PUT /api/v1/catalog/{code}", auth(handle(saveCatalogItemHandler), logger))
+	mux.HandleFunc("GET /api/v1/records/{id}/order", auth(handle(getWorkOrderHandler), logger))
+	mux.HandleFunc("POST /api/v1/records/{id}/order", auth(handle(createWorkOrderHandler), logger))
+	mux.HandleFunc("POST /api/v1/records/{id}/order/lines", auth(handle(addOrderLineHandler), logger))
+	mux.HandleFunc("PATCH /api/v1/records/{id}/order/lines/{line}", auth(handle(updateOrderLineHandler), logger))
+	mux.HandleFunc("DELETE /api/v1/records/{id}/order/lines/{line}", auth(handle(removeOrderLineHandler), logger))
+	mux.HandleFunc("POST /api/v1/records/{id}/order/finalize", auth(handle(finalizeWorkOrderHandler), logger))
+	mux.HandleFunc("POST /api/v1/records/{id}/order/lock", auth(handle(lockWorkOrderHandler), logger))
+	mux.HandleFunc("GET /api/v1/records/{id}/order/pdf", auth(handle(workOrderPDFHandler), logger))
+	mux.HandleFunc("GET /api/v1/records/{id}/order/receipt", auth(handle(receiptPDFHandler), logger))
+	mux.HandleFunc("GET /api/v1/records/{id}/ticket", auth(handle(ticketHandler), logger))
+	mux.HandleFunc("POST /api/v1/records/{id}/ticket", auth(handle(printTicketHandler), logger))
+	mux.HandleFunc("GET /api/v1/records/{id}/qr", auth(handle(recordQRHandler), logger))
+	mux.HandleFunc("GET /api/v1/records/{id}/notifications", auth(handle(recordNotificationsHandler), logger))
+	mux.HandleFunc("GET /api/v1/notifications", auth(handle(listNotificationsHandler), logger))
+	mux.HandleFunc("POST /api/v1/notifications/{id}/retry", auth(handle(retryNotificationHandler), logger))
+	mux.HandleFunc("GET /api/v1/calendar-feeds", auth(handle(listCalendarFeedsHandler), logger))
+	mux.HandleFunc("POST /api/v1/calendar-feeds", auth(handle(createCalendarFeedHandler), logger))
+	mux.HandleFunc("DELETE /api/v1/calendar-feeds/{id}", auth(handle(deleteCalendarFeedHandler), logger))
+	mux.HandleFunc("GET /api/v1/webhooks", auth(handle(listWebhooksHandler), logger))
+	mux.HandleFunc("POST /api/v1/webhooks", auth(handle(createWebhookHandler), logger))
+	mux.HandleFunc("PATCH /api/v1/webhooks/{id}", auth(handle(patchWebhookHandler), logger))
+	mux.HandleFunc("DELETE /api/v1/webhooks/{id}", auth(handle(deleteWebhookHandler), logger))
+	mux.HandleFunc("GET /api/v1/webhooks/{id}/deliveries", auth(handle(webhookDeliveriesHandler), logger))
+	mux.HandleFunc("GET /api/v1/webhook-deliveries", auth(handle(listDeliveriesHandler), logger))
+	mux.HandleFunc("GET /api/v1/webhook-deliveries/{id}", auth(handle(getDeliveryHandler), logger))
+	mux.HandleFunc("POST /api/v1/webhook-deliveries/{id}/redeliver", auth(handle(redeliverHandler), logger))
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/tickets"
+)
+
+type WaitlistRequest struct {
+	Title   string    `json:"title"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Comment string    `json:"comment"`
+	Service string    `json:"service,omitempty"`
+
+	Contacts *ContactsRequest `json:"contacts,omitempty"` // куда прислать предложение времени
+}
+
+// waitlistLink возвращает ссылку, по которой клиент видит предложение и принимает его
+func waitlistLink(entry db.WaitlistEntry) string {
+	return tickets.WaitlistPath(entry.AccessToken)
+}
+
+// normalizeWaitlistEntry преобразует заявку в формат ответа
+func normalizeWaitlistEntry(entry db.WaitlistEntry) map[string]any {
+	return map[string]any{
+		"id":             entry.ID,
+		"title":          entry.Title,
+		"comment":        entry.Comment,
+		"service":        entry.Service,
+		"from":           entry.WindowStart,
+		"to":             entry.WindowEnd,
+		"status":         entry.Status,
+		"offerSlot":      entry.OfferSlot,
+		"offerExpiresAt": entry.OfferExpiresAt,
+		"recordId":       entry.RecordID,
+		"createdAt":      entry.CreatedAt,
+	}
+}
+
+// waitlistEntryWithContacts дополняет заявку контактами клиента. Только для
+// ответов администратору
+func waitlistEntryWithContacts(entry db.WaitlistEntry) map[string]any {
+	normalized := normalizeWaitlistEntry(entry)
+	normalized["contacts"] = map[string]string{
+		"phone":    entry.Contacts.Phone,
+		"email":    entry.Contacts.Email,
+		"telegram": entry.Contacts.Telegram,
+		"lang":     entry.Contacts.Language,
+	}
+	return normalized
+}
+
+// POST /api/v1/waitlist
+func joinWaitlistHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	var waitReq WaitlistRequest
+	if err := json.NewDecoder(req.Body).Decode(&waitReq); err != nil {
+		logger.Printf("WARN: unmarshal error, %v", err)
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
+		return
+	}
+
+	if waitReq.Title == "" {
+		logger.Printf("WARN: missing required field 'title'")
+		writeError(res, req, errTitleRequired)
+		return
+	}
+
+	entry := db.WaitlistEntry{
+		Title:       waitReq.Title,
+		Comment:     waitReq.Comment,
+		Service:     waitReq.Service,
+		WindowStart: waitReq.From,
+		WindowEnd:   waitReq.To,
+	}
+	if waitReq.Contacts != nil {
+		entry.Contacts = waitReq.Contacts.toContacts()
+	}
+	if entry.Contacts.Language == "" {
+		entry.Contacts.Language = preferredLanguage(req)
+	}
+
+	created, err := db.AddWaitlistEntry(entry)
+	if err != nil {
+		logger.Printf("WARN: adding waitlist entry error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: waitlist entry %d added for car %s", created.ID, created.Title)
+	writeJson(res, http.StatusCreated, map[string]any{
+		"entry": normalizeWaitlistEntry(*created),
+		"link":  waitlistLink(*created),
+	})
+}
+
+// GET /api/v1/waitlist/{token}
+func waitlistStatusHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	entry, err := db.GetWaitlistEntryByToken(req.PathValue("token"))
+	if err != nil {
+		logger.Printf("WARN: waitlist entry lookup error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: waitlist entry %d retrieved", entry.ID)
+	writeJson(res, http.StatusOK, map[string]any{"entry": normalizeWaitlistEntry(*entry)})
+}
+
+// POST /api/v1/waitlist/{token}/claim
+func claimWaitlistOfferHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	record, err := db.ClaimWaitlistOffer(req.PathValue("token"), time.Now())
+	if err != nil {
+		logger.Printf("WARN: claiming waitlist offer error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: waitlist offer claimed, record %d added for car %s", record.ID, record.Title)
+	res.Header().Set("Location", fmt.Sprintf("/api/v1/records/%d", record.ID))
+	writeJson(res, http.StatusCreated, map[string]any{
+		"id":           record.ID,
+		"ticketNumber": generateTicketNumber(record.ID, record.Record),
+		"link":         selfServiceLink(*record),
+		"record":       normalizeRecord(*record),
+	})
+}
+
+// DELETE /api/v1/waitlist/{token}
+func leaveWaitlistHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	if err := db.LeaveWaitlist(req.PathValue("token")); err != nil {
+		logger.Printf("WARN: leaving waitlist error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: waitlist entry left by customer")
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/v1/waitlist?status=
+func listWaitlistHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	entries, err := db.GetWaitlist(req.URL.Query().Get("status"))
+	if err != nil {
+		logger.Printf("ERROR: listing waitlist error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	normalized := make([]map[string]any, len(entries))
+	for i, entry := range entries {
+		normalized[i] = waitlistEntryWithContacts(entry)
+	}
+
+	logger.Printf("INFO: waitlist listed successfully")
+	writeJson(res, http.StatusOK, map[string]any{"entries": normalized})
+}
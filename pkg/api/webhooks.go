@@ -0,0 +1,298 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/webhooks"
+)
+
+// deliveriesLimit число доставок в ответе
+const deliveriesLimit = 200
+
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"` // пусто - все события
+	Secret string   `json:"secret,omitempty"` // пусто - сгенерировать
+}
+
+// PatchWebhookRequest частичное обновление вебхука. Пустой secret - сгенерировать новый ключ
+type PatchWebhookRequest struct {
+	URL    *string  `json:"url,omitempty"`
+	Events []string `json:"events,omitempty"`
+	Secret *string  `json:"secret,omitempty"`
+	Active *bool    `json:"active,omitempty"`
+}
+
+// normalizeWebhook преобразует вебхук в формат ответа. Ключ подписи показывается
+// только при создании и смене ключа
+func normalizeWebhook(webhook db.Webhook, withSecret bool) map[string]any {
+	normalized := map[string]any{
+		"id":        webhook.ID,
+		"url":       webhook.URL,
+		"events":    webhook.Events,
+		"active":    webhook.Active,
+		"createdAt": webhook.CreatedAt,
+	}
+	if withSecret {
+		normalized["secret"] = webhook.Secret
+	}
+	return normalized
+}
+
+// normalizeDelivery преобразует доставку в формат ответа
+func normalizeDelivery(d db.Delivery) map[string]any {
+	normalized := map[string]any{
+		"id":          d.ID,
+		"webhookId":   d.WebhookID,
+		"event":       d.Event,
+		"status":      d.Status,
+		"attempts":    d.Attempts,
+		"lastError":   d.LastError,
+		"createdAt":   d.CreatedAt,
+		"deliveredAt": d.DeliveredAt,
+	}
+	if d.Status == db.DeliveryPending {
+		normalized["nextAttemptAt"] = d.NextAttemptAt
+	}
+	return normalized
+}
+
+func normalizeDeliveries(deliveries []db.Delivery) []map[string]any {
+	normalized := make([]map[string]any, len(deliveries))
+	for i, d := range deliveries {
+		normalized[i] = normalizeDelivery(d)
+	}
+	return normalized
+}
+
+// parseDeliveryStatus проверяет фильтр по статусу доставки
+func parseDeliveryStatus(req *http.Request) (string, error) {
+	status := req.URL.Query().Get("status")
+	switch status {
+	case "", db.DeliveryPending, db.DeliveryDelivered, db.DeliveryDead:
+		return status, nil
+	}
+	return "", errInvalidDeliveryStatus
+}
+
+// GET /api/v1/webhooks
+func listWebhooksHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	list, err := db.ListWebhooks()
+	if err != nil {
+		logger.Printf("ERROR: listing webhooks error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	normalized := make([]map[string]any, len(list))
+	for i, webhook := range list {
+		normalized[i] = normalizeWebhook(webhook, false)
+	}
+
+	logger.Printf("INFO: webhooks listed successfully")
+	writeJson(res, http.StatusOK, map[string]any{"webhooks": normalized})
+}
+
+// POST /api/v1/webhooks
+func createWebhookHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	var webhookReq WebhookRequest
+	if err := json.NewDecoder(req.Body).Decode(&webhookReq); err != nil {
+		logger.Printf("WARN: unmarshal error, %v", err)
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
+		return
+	}
+
+	webhook, err := db.AddWebhook(db.Webhook{
+		URL:    webhookReq.URL,
+		Events: webhookReq.Events,
+		Secret: webhookReq.Secret,
+	}, time.Now())
+	if err != nil {
+		logger.Printf("WARN: creating webhook error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: webhook %d created for %s", webhook.ID, webhook.URL)
+	writeJson(res, http.StatusCreated, map[string]any{"webhook": normalizeWebhook(*webhook, true)})
+}
+
+// PATCH /api/v1/webhooks/{id}
+func patchWebhookHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	webhookID, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+	if err != nil {
+		logger.Printf("WARN: invalid webhook ID, %v", err)
+		writeError(res, req, errInvalidWebhookID)
+		return
+	}
+
+	var patchReq PatchWebhookRequest
+	if err := json.NewDecoder(req.Body).Decode(&patchReq); err != nil {
+		logger.Printf("WARN: unmarshal error, %v", err)
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
+		return
+	}
+
+	webhook, err := db.UpdateWebhook(webhookID, db.WebhookPatch{
+		URL:    patchReq.URL,
+		Events: patchReq.Events,
+		Secret: patchReq.Secret,
+		Active: patchReq.Active,
+	})
+	if err != nil {
+		logger.Printf("WARN: updating webhook error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: webhook %d updated", webhookID)
+	writeJson(res, http.StatusOK, map[string]any{"webhook": normalizeWebhook(*webhook, patchReq.Secret != nil)})
+}
+
+// DELETE /api/v1/webhooks/{id}
+func deleteWebhookHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	webhookID, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+	if err != nil {
+		logger.Printf("WARN: invalid webhook ID, %v", err)
+		writeError(res, req, errInvalidWebhookID)
+		return
+	}
+
+	if err := db.DeleteWebhook(webhookID); err != nil {
+		logger.Printf("WARN: deleting webhook error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: webhook %d deleted", webhookID)
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/v1/webhooks/{id}/deliveries?status=
+func webhookDeliveriesHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	webhookID, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+	if err != nil {
+		logger.Printf("WARN: invalid webhook ID, %v", err)
+		writeError(res, req, errInvalidWebhookID)
+		return
+	}
+
+	status, err := parseDeliveryStatus(req)
+	if err != nil {
+		logger.Printf("WARN: invalid delivery status %s", req.URL.Query().Get("status"))
+		writeError(res, req, err)
+		return
+	}
+
+	if _, err := db.GetWebhook(webhookID); err != nil {
+		logger.Printf("WARN: getting webhook error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	deliveries, err := db.ListDeliveries(webhookID, status, deliveriesLimit)
+	if err != nil {
+		logger.Printf("ERROR: listing deliveries error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: deliveries of webhook %d listed successfully", webhookID)
+	writeJson(res, http.StatusOK, map[string]any{"deliveries": normalizeDeliveries(deliveries)})
+}
+
+// GET /api/v1/webhook-deliveries?status=dead
+// Журнал доставок всех вебхуков; status=dead - список недоставленных
+func listDeliveriesHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	status, err := parseDeliveryStatus(req)
+	if err != nil {
+		logger.Printf("WARN: invalid delivery status %s", req.URL.Query().Get("status"))
+		writeError(res, req, err)
+		return
+	}
+
+	deliveries, err := db.ListDeliveries(0, status, deliveriesLimit)
+	if err != nil {
+		logger.Printf("ERROR: listing deliveries error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: deliveries listed successfully")
+	writeJson(res, http.StatusOK, map[string]any{"deliveries": normalizeDeliveries(deliveries)})
+}
+
+// GET /api/v1/webhook-deliveries/{id}
+// Доставка с телом запроса и журналом попыток
+func getDeliveryHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	deliveryID, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+	if err != nil {
+		logger.Printf("WARN: invalid delivery ID, %v", err)
+		writeError(res, req, errInvalidDeliveryID)
+		return
+	}
+
+	delivery, err := db.GetDelivery(deliveryID)
+	if err != nil {
+		logger.Printf("WARN: getting delivery error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	attempts, err := db.DeliveryAttempts(deliveryID)
+	if err != nil {
+		logger.Printf("ERROR: getting delivery attempts error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	attemptLog := make([]map[string]any, len(attempts))
+	for i, a := range attempts {
+		attemptLog[i] = map[string]any{
+			"attemptedAt": a.AttemptedAt,
+			"statusCode":  a.StatusCode,
+			"error":       a.Error,
+			"durationMs":  a.Duration.Milliseconds(),
+		}
+	}
+
+	normalized := normalizeDelivery(*delivery)
+	normalized["payload"] = json.RawMessage(delivery.Payload)
+	normalized["attemptLog"] = attemptLog
+
+	logger.Printf("INFO: delivery %d retrieved successfully", deliveryID)
+	writeJson(res, http.StatusOK, map[string]any{"delivery": normalized})
+}
+
+// POST /api/v1/webhook-deliveries/{id}/redeliver
+// Повторно отправляет тело доставки новой доставкой, в том числе из недоставленных
+func redeliverHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	deliveryID, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+	if err != nil {
+		logger.Printf("WARN: invalid delivery ID, %v", err)
+		writeError(res, req, errInvalidDeliveryID)
+		return
+	}
+
+	delivery, err := db.Redeliver(deliveryID, time.Now())
+	if err != nil {
+		logger.Printf("WARN: redelivering error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	if err := webhooks.Dispatch(time.Now(), logger); err != nil {
+		logger.Printf("ERROR: delivering webhooks error, %v", err)
+	}
+
+	if updated, err := db.GetDelivery(delivery.ID); err == nil {
+		delivery = updated
+	}
+
+	logger.Printf("INFO: delivery %d redelivered as %d, status %s", deliveryID, delivery.ID, delivery.Status)
+	writeJson(res, http.StatusAccepted, map[string]any{"delivery": normalizeDelivery(*delivery)})
+}
@@ -0,0 +1,381 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/documents"
+)
+
+// CatalogItemRequest позиция справочника. Цена в копейках с НДС
+type CatalogItemRequest struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Unit    string `json:"unit,omitempty"`
+	Price   int64  `json:"price"`
+	VATRate int    `json:"vatRate"`
+	Active  *bool  `json:"active,omitempty"`
+}
+
+// OrderLineRequest строка заказ-наряда. Скидка задается в копейках (discount)
+// или в процентах от суммы строки (discountPercent)
+type OrderLineRequest struct {
+	Code            string `json:"code,omitempty"`
+	Quantity        *int   `json:"quantity,omitempty"`
+	Discount        *int64 `json:"discount,omitempty"`
+	DiscountPercent *int   `json:"discountPercent,omitempty"`
+}
+
+type LockOrderRequest struct {
+	Payment string `json:"payment"`
+}
+
+func (r OrderLineRequest) toInput() db.OrderLineInput {
+	return db.OrderLineInput{
+		Code:            r.Code,
+		Quantity:        r.Quantity,
+		Discount:        r.Discount,
+		DiscountPercent: r.DiscountPercent,
+	}
+}
+
+func normalizeCatalogItem(item db.CatalogItem) map[string]any {
+	return map[string]any{
+		"code":    item.Code,
+		"kind":    item.Kind,
+		"name":    item.Name,
+		"unit":    item.Unit,
+		"price":   item.Price,
+		"vatRate": item.VATRate,
+		"active":  item.Active,
+	}
+}
+
+// normalizeWorkOrder преобразует заказ-наряд в формат API. Суммы в копейках
+func normalizeWorkOrder(order db.WorkOrder) map[string]any {
+	lines := make([]map[string]any, len(order.Lines))
+	for i, line := range order.Lines {
+		lines[i] = map[string]any{
+			"id":       line.ID,
+			"code":     line.Code,
+			"kind":     line.Kind,
+			"name":     line.Name,
+			"unit":     line.Unit,
+			"quantity": line.Quantity,
+			"price":    line.Price,
+			"discount": line.Discount,
+			"vatRate":  line.VATRate,
+			"amount":   line.Amount,
+			"vat":      line.VAT,
+		}
+	}
+
+	return map[string]any{
+		"id":          order.ID,
+		"recordId":    order.RecordID,
+		"status":      order.Status,
+		"payment":     order.Payment,
+		"lines":       lines,
+		"subtotal":    order.Subtotal,
+		"discount":    order.Discount,
+		"total":       order.Total,
+		"vat":         order.VAT,
+		"createdAt":   order.CreatedAt,
+		"updatedAt":   order.UpdatedAt,
+		"finalizedAt": order.FinalizedAt,
+		"paidAt":      order.PaidAt,
+	}
+}
+
+// parseLineID извлекает ID строки заказ-наряда из пути запроса
+func parseLineID(req *http.Request) (int64, error) {
+	return strconv.ParseInt(req.PathValue("line"), 10, 64)
+}
+
+// GET /api/v1/catalog?all=true
+func listCatalogHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	items, err := db.GetCatalog(req.URL.Query().Get("all") == "true")
+	if err != nil {
+		logger.Printf("ERROR: getting catalog error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	catalog := make([]map[string]any, len(items))
+	for i, item := range items {
+		catalog[i] = normalizeCatalogItem(item)
+	}
+
+	logger.Printf("INFO: catalog retrieved successfully")
+	writeJson(res, http.StatusOK, map[string]any{"items": catalog})
+}
+
+// PUT /api/v1/catalog/{code}
+func saveCatalogItemHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	var itemReq CatalogItemRequest
+	if err := json.NewDecoder(req.Body).Decode(&itemReq); err != nil {
+		logger.Printf("WARN: unmarshal error, %v", err)
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
+		return
+	}
+
+	item := db.CatalogItem{
+		Code:    req.PathValue("code"),
+		Kind:    itemReq.Kind,
+		Name:    itemReq.Name,
+		Unit:    itemReq.Unit,
+		Price:   itemReq.Price,
+		VATRate: itemReq.VATRate,
+		Active:  itemReq.Active == nil || *itemReq.Active,
+	}
+
+	saved, err := db.SaveCatalogItem(item)
+	if err != nil {
+		logger.Printf("WARN: saving catalog item error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: catalog item %s saved", saved.Code)
+	writeJson(res, http.StatusOK, map[string]any{"item": normalizeCatalogItem(*saved)})
+}
+
+// GET /api/v1/records/{id}/order
+func getWorkOrderHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	recordID, err := parseRecordID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid record ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+
+	order, err := db.GetWorkOrder(recordID)
+	if err != nil {
+		logger.Printf("WARN: getting work order error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: work order of record %d retrieved", recordID)
+	writeJson(res, http.StatusOK, map[string]any{"order": normalizeWorkOrder(*order)})
+}
+
+// POST /api/v1/records/{id}/order
+// Открывает заказ-наряд с работой из записи. Повторный вызов возвращает существующий наряд
+func createWorkOrderHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	recordID, err := parseRecordID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid record ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+
+	order, created, err := db.CreateWorkOrder(recordID, time.Now())
+	if err != nil {
+		logger.Printf("WARN: creating work order error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		logger.Printf("INFO: work order %d opened for record %d", order.ID, recordID)
+	}
+	writeJson(res, status, map[string]any{"order": normalizeWorkOrder(*order)})
+}
+
+// POST /api/v1/records/{id}/order/lines
+func addOrderLineHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	recordID, err := parseRecordID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid record ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+
+	var lineReq OrderLineRequest
+	if err := json.NewDecoder(req.Body).Decode(&lineReq); err != nil {
+		logger.Printf("WARN: unmarshal error, %v", err)
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
+		return
+	}
+
+	order, err := db.AddOrderLine(recordID, lineReq.toInput(), time.Now())
+	if err != nil {
+		logger.Printf("WARN: adding work order line error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: line %s added to work order of record %d", lineReq.Code, recordID)
+	writeJson(res, http.StatusOK, map[string]any{"order": normalizeWorkOrder(*order)})
+}
+
+// PATCH /api/v1/records/{id}/order/lines/{line}
+func updateOrderLineHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	recordID, err := parseRecordID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid record ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+	lineID, err := parseLineID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid line ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+
+	var lineReq OrderLineRequest
+	if err := json.NewDecoder(req.Body).Decode(&lineReq); err != nil {
+		logger.Printf("WARN: unmarshal error, %v", err)
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
+		return
+	}
+
+	order, err := db.UpdateOrderLine(recordID, lineID, lineReq.toInput(), time.Now())
+	if err != nil {
+		logger.Printf("WARN: updating work order line error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: line %d of work order of record %d updated", lineID, recordID)
+	writeJson(res, http.StatusOK, map[string]any{"order": normalizeWorkOrder(*order)})
+}
+
+// DELETE /api/v1/records/{id}/order/lines/{line}
+func removeOrderLineHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	recordID, err := parseRecordID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid record ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+	lineID, err := parseLineID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid line ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+
+	order, err := db.RemoveOrderLine(recordID, lineID, time.Now())
+	if err != nil {
+		logger.Printf("WARN: removing work order line error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: line %d removed from work order of record %d", lineID, recordID)
+	writeJson(res, http.StatusOK, map[string]any{"order": normalizeWorkOrder(*order)})
+}
+
+// POST /api/v1/records/{id}/order/finalize
+// Фиксирует итог: строки больше не меняются, наряд ожидает оплаты
+func finalizeWorkOrderHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	recordID, err := parseRecordID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid record ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+
+	order, err := db.FinalizeWorkOrder(recordID, time.Now())
+	if err != nil {
+		logger.Printf("WARN: finalizing work order error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: work order %d finalized, total %d", order.ID, order.Total)
+	writeJson(res, http.StatusOK, map[string]any{"order": normalizeWorkOrder(*order)})
+}
+
+// POST /api/v1/records/{id}/order/lock
+// Отмечает оплату и блокирует наряд
+func lockWorkOrderHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	recordID, err := parseRecordID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid record ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+
+	var lockReq LockOrderRequest
+	if err := json.NewDecoder(req.Body).Decode(&lockReq); err != nil {
+		logger.Printf("WARN: unmarshal error, %v", err)
+		writeError(res, req, errInvalidJSON.withDetail(err.Error()))
+		return
+	}
+
+	order, err := db.LockWorkOrder(recordID, lockReq.Payment, time.Now())
+	if err != nil {
+		logger.Printf("WARN: locking work order error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: work order %d paid by %s", order.ID, order.Payment)
+	writeJson(res, http.StatusOK, map[string]any{"order": normalizeWorkOrder(*order)})
+}
+
+// writePDF отдает печатную форму для просмотра в браузере
+func writePDF(res http.ResponseWriter, filename string, data []byte) {
+	res.Header().Set("Content-Type", "application/pdf")
+	res.Header().Set("Content-Disposition", `inline; filename="`+filename+`"`)
+	res.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	res.WriteHeader(http.StatusOK)
+	res.Write(data)
+}
+
+// GET /api/v1/records/{id}/order/pdf
+// Печатная форма заказ-наряда
+func workOrderPDFHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	printOrderDocument(res, req, logger, "work-order", documents.WorkOrderPDF)
+}
+
+// GET /api/v1/records/{id}/order/receipt
+// Товарный чек по оплаченному заказ-наряду
+func receiptPDFHandler(res http.ResponseWriter, req *http.Request, logger *log.Logger) {
+	printOrderDocument(res, req, logger, "receipt", documents.ReceiptPDF)
+}
+
+func printOrderDocument(res http.ResponseWriter, req *http.Request, logger *log.Logger, name string,
+	render func(db.Record, db.WorkOrder, string, string, time.Time) ([]byte, error)) {
+	recordID, err := parseRecordID(req)
+	if err != nil {
+		logger.Printf("WARN: invalid record ID, %v", err)
+		writeError(res, req, errInvalidID)
+		return
+	}
+
+	record, err := db.GetRecordByID(recordID)
+	if err != nil {
+		logger.Printf("WARN: getting record error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	order, err := db.GetWorkOrder(recordID)
+	if err != nil {
+		logger.Printf("WARN: getting work order error, %v", err)
+		writeError(res, req, err)
+		return
+	}
+
+	link := publicURL(req) + selfServiceLink(*record)
+	data, err := render(*record, *order, generateTicketNumber(record.ID, record.Record), link, time.Now())
+	if err != nil {
+		logger.Printf("ERROR: rendering %s error, %v", name, err)
+		writeError(res, req, err)
+		return
+	}
+
+	logger.Printf("INFO: %s for record %d printed", name, recordID)
+	writePDF(res, fmt.Sprintf("%s-%06d.pdf", name, order.ID), data)
+}
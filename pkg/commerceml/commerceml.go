@@ -0,0 +1,472 @@
+// Package commerceml выгружает закрытые заказ-наряды и оплаты в формате
+// CommerceML 2 для загрузки в 1С: контрагенты, номенклатура работ и
+// материалов, документы реализации и оплаты
+package commerceml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/documents"
+)
+
+// SchemaVersion версия схемы CommerceML
+const SchemaVersion = "2.05"
+
+// ContentType тип ответа с выгрузкой
+const ContentType = "application/xml; charset=utf-8"
+
+// Хозяйственные операции, роли, реквизиты и идентификаторы выгрузки
+const (
+	operationSale         = "Отпуск товара"
+	operationCashPayment  = "Выплата наличных денег"
+	operationBankPayment  = "Выплата безналичных денег"
+	roleSeller            = "Продавец"
+	roleBuyer             = "Покупатель"
+	currency              = "руб"
+	taxVAT                = "НДС"
+	classifierID          = "tire-service"
+	groupServices         = "services"
+	groupParts            = "parts"
+	nomenclatureService   = "Услуга"
+	nomenclatureGoods     = "Товар"
+	requisiteKind         = "ВидНоменклатуры"
+	requisiteType         = "ТипНоменклатуры"
+	requisitePaid         = "Заказ оплачен"
+	requisitePaidAt       = "Дата оплаты"
+	requisitePayment      = "Метод оплаты"
+	requisiteBasis        = "Документ-основание"
+	requisiteRecord       = "Номер записи"
+	requisitePlate        = "Госномер"
+	contactPhone          = "Телефон мобильный"
+	contactEmail          = "Почта"
+	documentSalePrefix    = "order-"
+	documentPaymentPrefix = "payment-"
+	counterpartyPrefix    = "car-"
+)
+
+// unitCodes коды единиц измерения по ОКЕИ
+var unitCodes = map[string]struct{ code, name string }{
+	"шт":    {"796", "Штука"},
+	"компл": {"839", "Комплект"},
+	"г":     {"163", "Грамм"},
+	"кг":    {"166", "Килограмм"},
+	"ч":     {"356", "Час"},
+	"усл":   {"876", "Условная единица"},
+}
+
+// Amount сумма в копейках, записывается в рублях с двумя знаками
+type Amount int64
+
+func (a Amount) MarshalText() ([]byte, error) {
+	sign := ""
+	if a < 0 {
+		sign, a = "-", -a
+	}
+	return []byte(fmt.Sprintf("%s%d.%02d", sign, a/100, a%100)), nil
+}
+
+// Info корневой элемент выгрузки
+type Info struct {
+	XMLName    xml.Name    `xml:"КоммерческаяИнформация"`
+	Version    string      `xml:"ВерсияСхемы,attr"`
+	Created    string      `xml:"ДатаФормирования,attr"`
+	Classifier *Classifier `xml:"Классификатор,omitempty"`
+	Catalog    *Catalog    `xml:"Каталог,omitempty"`
+	Documents  []Document  `xml:"Документ"`
+}
+
+type Classifier struct {
+	ID     string       `xml:"Ид"`
+	Name   string       `xml:"Наименование"`
+	Owner  Counterparty `xml:"Владелец"`
+	Groups []Group      `xml:"Группы>Группа"`
+}
+
+type Group struct {
+	ID   string `xml:"Ид"`
+	Name string `xml:"Наименование"`
+}
+
+// Catalog номенклатура, встречающаяся в документах выгрузки
+type Catalog struct {
+	ID           string       `xml:"Ид"`
+	ClassifierID string       `xml:"ИдКлассификатора"`
+	Name         string       `xml:"Наименование"`
+	Owner        Counterparty `xml:"Владелец"`
+	Products     []Product    `xml:"Товары>Товар"`
+}
+
+type Product struct {
+	ID         string     `xml:"Ид"`
+	Article    string     `xml:"Артикул"`
+	Name       string     `xml:"Наименование"`
+	Unit       Unit       `xml:"БазоваяЕдиница"`
+	Groups     GroupIDs   `xml:"Группы,omitempty"`
+	TaxRates   TaxRates   `xml:"СтавкиНалогов,omitempty"`
+	Requisites Requisites `xml:"ЗначенияРеквизитов,omitempty"`
+}
+
+type Unit struct {
+	Code     string `xml:"Код,attr,omitempty"`
+	FullName string `xml:"НаименованиеПолное,attr,omitempty"`
+	Name     string `xml:",chardata"`
+}
+
+type TaxRate struct {
+	Name string `xml:"Наименование"`
+	Rate int    `xml:"Ставка"`
+}
+
+type Tax struct {
+	Name     string `xml:"Наименование"`
+	Included bool   `xml:"УчтеноВСумме"`
+	Amount   Amount `xml:"Сумма"`
+}
+
+type Discount struct {
+	Amount   Amount `xml:"Сумма"`
+	Included bool   `xml:"УчтеноВСумме"`
+}
+
+type Requisite struct {
+	Name  string `xml:"Наименование"`
+	Value string `xml:"Значение"`
+}
+
+type Contact struct {
+	Type  string `xml:"Тип"`
+	Value string `xml:"Значение"`
+}
+
+type Counterparty struct {
+	ID       string   `xml:"Ид"`
+	Name     string   `xml:"Наименование"`
+	Role     string   `xml:"Роль,omitempty"`
+	FullName string   `xml:"ПолноеНаименование,omitempty"`
+	INN      string   `xml:"ИНН,omitempty"`
+	Contacts Contacts `xml:"Контакты,omitempty"`
+}
+
+// Document документ реализации или оплаты
+type Document struct {
+	ID             string         `xml:"Ид"`
+	Number         string         `xml:"Номер"`
+	Date           string         `xml:"Дата"`
+	Operation      string         `xml:"ХозОперация"`
+	Role           string         `xml:"Роль"`
+	Currency       string         `xml:"Валюта"`
+	Rate           int            `xml:"Курс"`
+	Amount         Amount         `xml:"Сумма"`
+	Counterparties []Counterparty `xml:"Контрагенты>Контрагент"`
+	Time           string         `xml:"Время"`
+	Comment        string         `xml:"Комментарий,omitempty"`
+	Taxes          Taxes          `xml:"Налоги,omitempty"`
+	Items          Items          `xml:"Товары,omitempty"`
+	Requisites     Requisites     `xml:"ЗначенияРеквизитов,omitempty"`
+}
+
+// Item строка документа
+type Item struct {
+	ID         string     `xml:"Ид"`
+	Article    string     `xml:"Артикул"`
+	Name       string     `xml:"Наименование"`
+	Unit       Unit       `xml:"БазоваяЕдиница"`
+	Price      Amount     `xml:"ЦенаЗаЕдиницу"`
+	Quantity   int        `xml:"Количество"`
+	Amount     Amount     `xml:"Сумма"`
+	Discounts  Discounts  `xml:"Скидки,omitempty"`
+	Taxes      Taxes      `xml:"Налоги,omitempty"`
+	TaxRates   TaxRates   `xml:"СтавкиНалогов,omitempty"`
+	Requisites Requisites `xml:"ЗначенияРеквизитов,omitempty"`
+}
+
+// Списки элементов. Пустой список не выводится совсем: у пути "a>b" в тегах
+// encoding/xml omitempty оставляет пустой родительский элемент
+type (
+	GroupIDs   []string
+	Contacts   []Contact
+	Discounts  []Discount
+	Taxes      []Tax
+	TaxRates   []TaxRate
+	Requisites []Requisite
+	Items      []Item
+)
+
+func (l GroupIDs) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return encodeList(e, start, "Ид", l)
+}
+
+func (l Contacts) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return encodeList(e, start, "Контакт", l)
+}
+
+func (l Discounts) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return encodeList(e, start, "Скидка", l)
+}
+
+func (l Taxes) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return encodeList(e, start, "Налог", l)
+}
+
+func (l TaxRates) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return encodeList(e, start, "СтавкаНалога", l)
+}
+
+func (l Requisites) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return encodeList(e, start, "ЗначениеРеквизита", l)
+}
+
+func (l Items) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return encodeList(e, start, "Товар", l)
+}
+
+// encodeList пишет элементы списка с именем item внутри start
+func encodeList[T any](e *xml.Encoder, start xml.StartElement, item string, items []T) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, value := range items {
+		if err := e.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: item}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// Export пишет выгрузку за период [from, to): документы реализации по нарядам,
+// итог которых зафиксирован в периоде, и документы оплаты по оплатам в периоде
+func Export(w io.Writer, from, to, now time.Time) error {
+	orders, err := db.ListClosedWorkOrders(from, to)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(Build(orders, from, to, now)); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// Build собирает выгрузку из закрытых заказ-нарядов
+func Build(orders []db.ClosedWorkOrder, from, to, now time.Time) *Info {
+	owner := shopCounterparty()
+
+	info := &Info{
+		Version: SchemaVersion,
+		Created: now.Local().Format("2006-01-02T15:04:05"),
+		Classifier: &Classifier{
+			ID:    classifierID,
+			Name:  "Классификатор " + owner.Name,
+			Owner: owner,
+			Groups: []Group{
+				{ID: groupServices, Name: "Работы"},
+				{ID: groupParts, Name: "Материалы"},
+			},
+		},
+	}
+
+	products := make(map[string]Product)
+	for _, order := range orders {
+		for _, line := range order.Lines {
+			if _, ok := products[line.Code]; !ok {
+				products[line.Code] = product(line)
+			}
+		}
+
+		if inPeriod(order.FinalizedAt, from, to) {
+			info.Documents = append(info.Documents, saleDocument(order, owner))
+		}
+		if inPeriod(order.PaidAt, from, to) {
+			info.Documents = append(info.Documents, paymentDocument(order, owner))
+		}
+	}
+
+	info.Catalog = &Catalog{
+		ID:           classifierID,
+		ClassifierID: classifierID,
+		Name:         "Работы и материалы " + owner.Name,
+		Owner:        owner,
+		Products:     make([]Product, 0, len(products)),
+	}
+	for _, p := range products {
+		info.Catalog.Products = append(info.Catalog.Products, p)
+	}
+	sort.Slice(info.Catalog.Products, func(i, j int) bool {
+		a, b := info.Catalog.Products[i], info.Catalog.Products[j]
+		if a.Groups[0] != b.Groups[0] {
+			return a.Groups[0] == groupServices
+		}
+		return a.Name < b.Name
+	})
+
+	return info
+}
+
+// shopCounterparty шиномонтаж как владелец каталога и продавец
+func shopCounterparty() Counterparty {
+	shop := documents.ShopInfo
+	id := "shop"
+	if shop.INN != "" {
+		id = shop.INN
+	}
+	return Counterparty{ID: id, Name: shop.Name, FullName: shop.Name, INN: shop.INN}
+}
+
+// customerCounterparty клиент. Клиенты узнаются по номеру автомобиля, как и в
+// истории визитов, поэтому номер служит идентификатором контрагента
+func customerCounterparty(record db.Record) Counterparty {
+	customer := Counterparty{
+		ID:       counterpartyPrefix + record.Title,
+		Name:     record.Title,
+		Role:     roleBuyer,
+		FullName: "Владелец автомобиля " + record.Title,
+	}
+	if record.Contacts.Phone != "" {
+		customer.Contacts = append(customer.Contacts, Contact{Type: contactPhone, Value: record.Contacts.Phone})
+	}
+	if record.Contacts.Email != "" {
+		customer.Contacts = append(customer.Contacts, Contact{Type: contactEmail, Value: record.Contacts.Email})
+	}
+	return customer
+}
+
+func seller(owner Counterparty) Counterparty {
+	owner.Role = roleSeller
+	return owner
+}
+
+// product позиция номенклатуры по строке наряда: название и ставка НДС
+// берутся из строки, как они были на момент оказания услуги
+func product(line db.OrderLine) Product {
+	group, kind := groupParts, nomenclatureGoods
+	if line.Kind == db.CatalogService {
+		group, kind = groupServices, nomenclatureService
+	}
+
+	return Product{
+		ID:       line.Code,
+		Article:  line.Code,
+		Name:     line.Name,
+		Unit:     unit(line.Unit),
+		Groups:   GroupIDs{group},
+		TaxRates: taxRates(line.VATRate),
+		Requisites: Requisites{
+			{Name: requisiteKind, Value: kind},
+			{Name: requisiteType, Value: kind},
+		},
+	}
+}
+
+func unit(name string) Unit {
+	okei := unitCodes[name]
+	return Unit{Code: okei.code, FullName: okei.name, Name: name}
+}
+
+func taxRates(rate int) TaxRates {
+	if rate <= 0 {
+		return nil
+	}
+	return TaxRates{{Name: taxVAT, Rate: rate}}
+}
+
+func taxes(vat int64) Taxes {
+	if vat <= 0 {
+		return nil
+	}
+	return Taxes{{Name: taxVAT, Included: true, Amount: Amount(vat)}}
+}
+
+// saleDocument реализация работ и материалов по наряду на дату фиксации итога
+func saleDocument(order db.ClosedWorkOrder, owner Counterparty) Document {
+	finalized := order.FinalizedAt.Local()
+
+	doc := Document{
+		ID:             documentSalePrefix + fmt.Sprint(order.ID),
+		Number:         fmt.Sprint(order.ID),
+		Date:           finalized.Format("2006-01-02"),
+		Operation:      operationSale,
+		Role:           roleSeller,
+		Currency:       currency,
+		Rate:           1,
+		Amount:         Amount(order.Total),
+		Counterparties: []Counterparty{seller(owner), customerCounterparty(order.Record)},
+		Time:           finalized.Format("15:04:05"),
+		Comment:        fmt.Sprintf("Заказ-наряд %d по записи %d, автомобиль %s", order.ID, order.RecordID, order.Record.Title),
+		Taxes:          taxes(order.VAT),
+		Requisites: Requisites{
+			{Name: requisiteRecord, Value: fmt.Sprint(order.RecordID)},
+			{Name: requisitePlate, Value: order.Record.Title},
+			{Name: requisitePaid, Value: fmt.Sprint(order.PaidAt != nil)},
+		},
+	}
+	if order.PaidAt != nil {
+		doc.Requisites = append(doc.Requisites,
+			Requisite{Name: requisitePaidAt, Value: order.PaidAt.Local().Format("2006-01-02T15:04:05")},
+			Requisite{Name: requisitePayment, Value: db.PaymentMethods[order.Payment]})
+	}
+
+	for _, line := range order.Lines {
+		p := product(line)
+		item := Item{
+			ID:         p.ID,
+			Article:    p.Article,
+			Name:       p.Name,
+			Unit:       p.Unit,
+			Price:      Amount(line.Price),
+			Quantity:   line.Quantity,
+			Amount:     Amount(line.Amount),
+			Taxes:      taxes(line.VAT),
+			TaxRates:   p.TaxRates,
+			Requisites: p.Requisites,
+		}
+		if line.Discount > 0 {
+			item.Discounts = Discounts{{Amount: Amount(line.Discount), Included: true}}
+		}
+		doc.Items = append(doc.Items, item)
+	}
+
+	return doc
+}
+
+// paymentDocument поступление оплаты по наряду от клиента
+func paymentDocument(order db.ClosedWorkOrder, owner Counterparty) Document {
+	paid := order.PaidAt.Local()
+
+	operation := operationBankPayment
+	if order.Payment == "cash" {
+		operation = operationCashPayment
+	}
+
+	return Document{
+		ID:             documentPaymentPrefix + fmt.Sprint(order.ID),
+		Number:         fmt.Sprint(order.ID),
+		Date:           paid.Format("2006-01-02"),
+		Operation:      operation,
+		Role:           roleSeller,
+		Currency:       currency,
+		Rate:           1,
+		Amount:         Amount(order.Total),
+		Counterparties: []Counterparty{seller(owner), customerCounterparty(order.Record)},
+		Time:           paid.Format("15:04:05"),
+		Comment:        fmt.Sprintf("Оплата заказ-наряда %d, автомобиль %s", order.ID, order.Record.Title),
+		Taxes:          taxes(order.VAT),
+		Requisites: Requisites{
+			{Name: requisiteBasis, Value: documentSalePrefix + fmt.Sprint(order.ID)},
+			{Name: requisitePayment, Value: db.PaymentMethods[order.Payment]},
+		},
+	}
+}
+
+func inPeriod(t *time.Time, from, to time.Time) bool {
+	return t != nil && !t.Before(from) && t.Before(to)
+}
@@ -0,0 +1,114 @@
+package commerceml
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+)
+
+// DropDir каталог, куда ежедневно кладется выгрузка за прошедший день.
+// Пустой - выгрузка по расписанию выключена
+var DropDir string
+
+// DropTime время суток, после которого выгружается прошедший день
+var DropTime = 3 * time.Hour
+
+// dropMaxDays сколько пропущенных дней догоняется после простоя сервиса
+const dropMaxDays = 31
+
+const (
+	dropPrefix = "1c-"
+	dropSuffix = ".xml"
+)
+
+// SetConfig читает настройки выгрузки в 1С из окружения:
+// TODO_1C_DIR - каталог обмена, TODO_1C_TIME - время выгрузки ЧЧ:ММ
+func SetConfig(logger *log.Logger) {
+	DropDir = os.Getenv("TODO_1C_DIR")
+
+	if value := os.Getenv("TODO_1C_TIME"); value != "" {
+		t, err := time.Parse("15:04", value)
+		if err != nil {
+			logger.Printf("WARN: invalid 1C export time %s, is using %02d:00\n", value, int(DropTime.Hours()))
+		} else {
+			DropTime = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		}
+	}
+}
+
+// Drop кладет в DropDir файлы 1c-ГГГГ-ММ-ДД.xml за прошедшие дни. Выгруженные дни
+// запоминаются в базе: 1С забирает файлы из каталога, и их отсутствие не значит,
+// что день не выгружен. После простоя догоняются дни с последней выгрузки, но не
+// больше dropMaxDays. Файл сначала пишется во временный и затем переименовывается,
+// чтобы 1С не забрала его недописанным
+func Drop(now time.Time, logger *log.Logger) error {
+	if DropDir == "" {
+		return nil
+	}
+
+	now = now.Local()
+	// until начало первого дня, который еще не выгружается
+	until := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if now.Sub(until) < DropTime {
+		until = until.AddDate(0, 0, -1)
+	}
+
+	first := until.AddDate(0, 0, -1)
+	last, err := db.LastCommerceMLDrop()
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		first = last.AddDate(0, 0, 1)
+		if limit := until.AddDate(0, 0, -dropMaxDays); first.Before(limit) {
+			first = limit
+		}
+	}
+	if !first.Before(until) {
+		return nil
+	}
+
+	if err := os.MkdirAll(DropDir, 0o755); err != nil {
+		return fmt.Errorf("ошибка создания каталога выгрузки в 1С: %w", err)
+	}
+
+	for day := first; day.Before(until); day = day.AddDate(0, 0, 1) {
+		name := filepath.Join(DropDir, dropPrefix+day.Format("2006-01-02")+dropSuffix)
+		if err := dropFile(name, day, day.AddDate(0, 0, 1), now); err != nil {
+			return err
+		}
+		if err := db.SaveCommerceMLDrop(day, name, now); err != nil {
+			return err
+		}
+		logger.Printf("INFO: 1C export for %s written to %s", day.Format("2006-01-02"), name)
+	}
+
+	return nil
+}
+
+func dropFile(name string, from, to, now time.Time) error {
+	tmp, err := os.CreateTemp(DropDir, ".1c-*.tmp")
+	if err != nil {
+		return fmt.Errorf("ошибка создания файла выгрузки в 1С: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// Временный файл создается с правами 0600, а 1С может работать под другим пользователем
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("ошибка создания файла выгрузки в 1С: %w", err)
+	}
+
+	if err := Export(tmp, from, to, now); err != nil {
+		tmp.Close()
+		return fmt.Errorf("ошибка выгрузки в 1С за %s: %w", from.Format("2006-01-02"), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("ошибка записи файла выгрузки в 1С: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
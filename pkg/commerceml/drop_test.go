@@ -0,0 +1,93 @@
+package commerceml
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+)
+
+// dropFiles имена файлов выгрузки в каталоге обмена
+func dropFiles(t *testing.T) []string {
+	t.Helper()
+
+	matches, err := filepath.Glob(filepath.Join(DropDir, dropPrefix+"*"+dropSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(matches))
+	for i, match := range matches {
+		names[i] = filepath.Base(match)
+	}
+	return names
+}
+
+// takeFiles забирает файлы из каталога обмена, как это делает 1С
+func takeFiles(t *testing.T) {
+	t.Helper()
+
+	for _, name := range dropFiles(t) {
+		if err := os.Remove(filepath.Join(DropDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDrop(t *testing.T) {
+	if err := db.Init(filepath.Join(t.TempDir(), "test.db"), log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.CloseDatabase)
+
+	savedDir, savedTime, savedLocal := DropDir, DropTime, time.Local
+	t.Cleanup(func() { DropDir, DropTime, time.Local = savedDir, savedTime, savedLocal })
+	DropDir, DropTime, time.Local = filepath.Join(t.TempDir(), "1c"), 3*time.Hour, time.UTC
+
+	quiet := log.New(io.Discard, "", 0)
+	drop := func(at time.Time) []string {
+		t.Helper()
+		if err := Drop(at, quiet); err != nil {
+			t.Fatal(err)
+		}
+		return dropFiles(t)
+	}
+	day := func(d, hour int) time.Time { return time.Date(2026, 3, d, hour, 0, 0, 0, time.UTC) }
+
+	if got, want := drop(day(14, 3)), []string{"1c-2026-03-13.xml"}; !slices.Equal(got, want) {
+		t.Fatalf("first drop: %v, want %v", got, want)
+	}
+
+	// 1С забрала файл: день не выгружается повторно
+	takeFiles(t)
+	if got := drop(day(14, 4)); len(got) != 0 {
+		t.Fatalf("files after 1C took the export: %v", got)
+	}
+
+	// До времени выгрузки прошедший день еще не выгружается
+	if got := drop(day(15, 2)); len(got) != 0 {
+		t.Fatalf("files before the drop time: %v", got)
+	}
+
+	// После простоя догоняются дни с последней выгрузки
+	if got, want := drop(day(17, 5)), []string{"1c-2026-03-14.xml", "1c-2026-03-15.xml", "1c-2026-03-16.xml"}; !slices.Equal(got, want) {
+		t.Fatalf("catch-up: %v, want %v", got, want)
+	}
+	takeFiles(t)
+
+	// Но не больше dropMaxDays
+	got := drop(day(17, 5).AddDate(0, 0, dropMaxDays+10))
+	if len(got) != dropMaxDays {
+		t.Fatalf("long downtime: %d files, want %d", len(got), dropMaxDays)
+	}
+	last, err := db.LastCommerceMLDrop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := day(17, 0).AddDate(0, 0, dropMaxDays+9); last == nil || !last.Equal(want) {
+		t.Errorf("last drop day %v, want %s", last, want)
+	}
+}
@@ -0,0 +1,403 @@
+// Package csvimport переносит записи из таблицы CSV (старый учет в Excel,
+// выгрузка /records/export) в базу. Колонки сопоставляются с полями записи
+// по заголовку, номера приводятся к единому виду, каждая строка проверяется,
+// а отчет содержит ошибки по строкам. Импорт идет одной транзакцией
+package csvimport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+)
+
+var (
+	ErrEmptyFile    = errors.New("файл импорта пуст")
+	ErrNoPlate      = errors.New("нет колонки с номером автомобиля")
+	ErrUnknownField = errors.New("неизвестное поле сопоставления")
+	ErrNoColumn     = errors.New("колонка не найдена в заголовке")
+	ErrInvalidCSV   = errors.New("некорректный CSV")
+)
+
+// Поля записи, которым сопоставляются колонки
+const (
+	FieldPlate    = "plate"
+	FieldRecord   = "record"  // дата и время записи одной колонкой
+	FieldDate     = "date"    // дата записи, если время в отдельной колонке
+	FieldTime     = "time"    // время записи
+	FieldCreated  = "created" // когда запись была создана
+	FieldComment  = "comment"
+	FieldStatus   = "status"
+	FieldService  = "service"
+	FieldPhone    = "phone"
+	FieldEmail    = "email"
+	FieldTelegram = "telegram"
+	FieldLanguage = "lang"
+)
+
+// headerAliases заголовки колонок, которые узнаются без явного сопоставления,
+// в нижнем регистре. Включают заголовки выгрузки записей
+var headerAliases = map[string][]string{
+	FieldPlate:    {"plate", "title", "госномер", "гос. номер", "номер", "номер автомобиля", "автомобиль"},
+	FieldRecord:   {"record", "время записи", "дата и время", "запись"},
+	FieldDate:     {"date", "дата", "дата записи"},
+	FieldTime:     {"time", "время"},
+	FieldCreated:  {"created", "создана", "дата создания"},
+	FieldComment:  {"comment", "комментарий", "примечание"},
+	FieldStatus:   {"status", "статус"},
+	FieldService:  {"service", "вид работ", "услуга"},
+	FieldPhone:    {"phone", "телефон"},
+	FieldEmail:    {"email", "e-mail", "почта"},
+	FieldTelegram: {"telegram", "телеграм"},
+	FieldLanguage: {"lang", "язык"},
+}
+
+// timeLayouts форматы даты и времени. Время без зоны считается местным
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"02.01.06 15:04",
+}
+
+var dateLayouts = []string{"2006-01-02", "02.01.2006", "02.01.06"}
+
+var clockLayouts = []string{"15:04", "15:04:05", "15.04"}
+
+// Options настройки импорта
+type Options struct {
+	db.ImportOptions
+	// Mapping явное сопоставление поля и заголовка колонки: plate -> "Гос номер".
+	// Остальные поля ищутся по известным заголовкам
+	Mapping map[string]string
+}
+
+// RowResult итог строки файла
+type RowResult struct {
+	Line     int
+	Plate    string
+	RecordID int64 // 0, если импорт не зафиксирован
+	Errors   []error
+}
+
+// Report отчет об импорте
+type Report struct {
+	DryRun    bool
+	Committed bool
+	Columns   map[string]string // поле -> заголовок колонки
+	Rows      []RowResult
+	Failed    int // строк с ошибками
+}
+
+// Import разбирает CSV и добавляет записи одной транзакцией. Строки с
+// ошибками попадают в отчет, при любой ошибке в строках не добавляется
+// ничего. Ошибка возвращается, если файл нельзя разобрать целиком
+func Import(r io.Reader, options Options, now time.Time) (*Report, error) {
+	rows, report, err := parse(r, options.Mapping)
+	if err != nil {
+		return nil, err
+	}
+	report.DryRun = options.DryRun
+
+	// Строки с ошибками разбора в базу не передаются, но остальные проверяются,
+	// чтобы отчет был полным
+	var valid []db.ImportRow
+	for i, row := range rows {
+		if len(report.Rows[i].Errors) == 0 {
+			valid = append(valid, row)
+		}
+	}
+
+	if report.Failed > 0 {
+		// Откат гарантирован, проверяем остальные строки без фиксации
+		options.DryRun = true
+	}
+
+	result, err := db.ImportRecords(valid, options.ImportOptions, now)
+	if err != nil {
+		return nil, err
+	}
+
+	byLine := make(map[int]*RowResult, len(report.Rows))
+	for i := range report.Rows {
+		byLine[report.Rows[i].Line] = &report.Rows[i]
+	}
+	for _, rowErr := range result.Errors {
+		row := byLine[rowErr.Line]
+		row.Errors = append(row.Errors, rowErr.Err)
+		report.Failed++
+	}
+	for line, id := range result.IDs {
+		byLine[line].RecordID = id
+	}
+	report.Committed = result.Committed
+
+	return report, nil
+}
+
+// parse читает файл и сопоставляет колонки. Для каждой строки файла в отчете
+// есть RowResult с ошибками разбора, rows[i] соответствует report.Rows[i]
+func parse(r io.Reader, mapping map[string]string) ([]db.ImportRow, *Report, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Метка порядка байт из Excel
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil, ErrEmptyFile
+	}
+
+	csvReader := csv.NewReader(bytes.NewReader(data))
+	csvReader.Comma = detectDelimiter(data)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return nil, nil, ErrEmptyFile
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+	}
+
+	columns, names, err := mapColumns(header, mapping)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &Report{Columns: names}
+	var rows []db.ImportRow
+	for {
+		fields, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+		}
+
+		line, _ := csvReader.FieldPos(0)
+		if isBlank(fields) {
+			continue
+		}
+
+		value := func(field string) string {
+			index, ok := columns[field]
+			if !ok || index >= len(fields) {
+				return ""
+			}
+			return strings.TrimSpace(fields[index])
+		}
+
+		row, errs := parseRow(value)
+		row.Line = line
+		rows = append(rows, row)
+		report.Rows = append(report.Rows, RowResult{Line: line, Plate: db.NormalizePlate(row.Record.Title), Errors: errs})
+		if len(errs) > 0 {
+			report.Failed++
+		}
+	}
+
+	return rows, report, nil
+}
+
+// parseRow переводит значения колонок в запись
+func parseRow(value func(field string) string) (db.ImportRow, []error) {
+	var row db.ImportRow
+	var errs []error
+
+	row.Record.Title = value(FieldPlate)
+	row.Record.Comment = value(FieldComment)
+	row.Record.Contacts = db.Contacts{
+		Phone:    value(FieldPhone),
+		Email:    value(FieldEmail),
+		Telegram: value(FieldTelegram),
+		Language: strings.ToLower(value(FieldLanguage)),
+	}
+
+	if status := value(FieldStatus); status != "" {
+		row.Record.Status = statusCode(status)
+	}
+	if service := value(FieldService); service != "" {
+		row.Record.Service = serviceCode(service)
+	}
+
+	if text := value(FieldRecord); text != "" {
+		t, err := parseTime(text)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		row.Record.Record = t
+	} else if date := value(FieldDate); date != "" {
+		t, err := parseDateTime(date, value(FieldTime))
+		if err != nil {
+			errs = append(errs, err)
+		}
+		row.Record.Record = t
+	}
+
+	if text := value(FieldCreated); text != "" {
+		t, err := parseTime(text)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		row.Created = t
+	}
+
+	return row, errs
+}
+
+// mapColumns находит индексы колонок полей. Явное сопоставление важнее
+// известных заголовков
+func mapColumns(header []string, mapping map[string]string) (map[string]int, map[string]string, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if _, ok := index[key]; !ok {
+			index[key] = i
+		}
+	}
+
+	columns := make(map[string]int)
+	names := make(map[string]string)
+
+	for field, name := range mapping {
+		if _, ok := headerAliases[field]; !ok {
+			return nil, nil, fmt.Errorf("%w: %s", ErrUnknownField, field)
+		}
+		i, ok := index[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %s", ErrNoColumn, name)
+		}
+		columns[field] = i
+		names[field] = header[i]
+	}
+
+	fields := make([]string, 0, len(headerAliases))
+	for field := range headerAliases {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		if _, ok := columns[field]; ok {
+			continue
+		}
+		for _, alias := range headerAliases[field] {
+			if i, ok := index[alias]; ok {
+				columns[field] = i
+				names[field] = header[i]
+				break
+			}
+		}
+	}
+
+	if _, ok := columns[FieldPlate]; !ok {
+		return nil, nil, ErrNoPlate
+	}
+	return columns, names, nil
+}
+
+// detectDelimiter выбирает разделитель по первой строке: русский Excel
+// сохраняет CSV через точку с запятой
+func detectDelimiter(data []byte) rune {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+
+	best, count := ',', bytes.Count(line, []byte(","))
+	for _, candidate := range []rune{';', '\t'} {
+		if n := bytes.Count(line, []byte(string(candidate))); n > count {
+			best, count = candidate, n
+		}
+	}
+	return best
+}
+
+func isBlank(fields []string) bool {
+	for _, field := range fields {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// statusCode принимает код статуса или его название из админки и выгрузки
+func statusCode(value string) string {
+	lower := strings.ToLower(value)
+	for code, label := range db.StatusLabels {
+		if lower == code || lower == strings.ToLower(label) {
+			return code
+		}
+	}
+	return value
+}
+
+// serviceCode принимает код вида работ или его название из справочника
+func serviceCode(value string) string {
+	if db.IsValidService(value) {
+		return value
+	}
+	for code := range db.ServiceTypes {
+		if item, err := db.GetCatalogItem(code); err == nil && strings.EqualFold(item.Name, value) {
+			return code
+		}
+	}
+	return value
+}
+
+// parseTime разбирает дату и время одной строкой
+func parseTime(value string) (*time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", db.ErrInvalidTime, value)
+}
+
+// parseDateTime разбирает дату и время из отдельных колонок. Дата без
+// времени - ошибка: непонятно, на какой час записан клиент
+func parseDateTime(date, clock string) (*time.Time, error) {
+	if clock == "" {
+		return parseTime(date)
+	}
+
+	for _, dateLayout := range dateLayouts {
+		for _, clockLayout := range clockLayouts {
+			t, err := time.ParseInLocation(dateLayout+" "+clockLayout, date+" "+clock, time.Local)
+			if err == nil {
+				return &t, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s %s", db.ErrInvalidTime, date, clock)
+}
+
+// ParseMapping разбирает сопоставления вида "поле:Заголовок колонки". Значение
+// может содержать несколько сопоставлений через запятую
+func ParseMapping(values []string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, value := range values {
+		for _, pair := range strings.Split(value, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			field, column, ok := strings.Cut(pair, ":")
+			field = strings.ToLower(strings.TrimSpace(field))
+			if !ok || field == "" || strings.TrimSpace(column) == "" {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownField, pair)
+			}
+			mapping[field] = strings.TrimSpace(column)
+		}
+	}
+	return mapping, nil
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ClosedWorkOrder закрытый заказ-наряд вместе с записью для выгрузки в бухгалтерию
+type ClosedWorkOrder struct {
+	WorkOrder
+	Record Record
+}
+
+// closedInPeriod условие на заказ-наряды, закрытые или оплаченные в периоде [from, to)
+const closedInPeriod = `status != ? AND ((finalized_at >= ? AND finalized_at < ?) OR (paid_at >= ? AND paid_at < ?))`
+
+// ListClosedWorkOrders возвращает заказ-наряды, итог которых зафиксирован или
+// оплата получена в периоде [from, to), в порядке закрытия. Наряды, их строки и
+// записи читаются тремя запросами за весь период в одной транзакции
+func ListClosedWorkOrders(from, to time.Time) ([]ClosedWorkOrder, error) {
+	args := []any{WorkOrderDraft, from, to, from, to}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT `+workOrderColumns+` FROM work_orders WHERE `+closedInPeriod+
+		` ORDER BY finalized_at, id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	var orders []ClosedWorkOrder
+	byID := make(map[int64]int)
+	for rows.Next() {
+		order, err := scanWorkOrder(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка сканирования заказ-наряда: %w", err)
+		}
+		byID[order.ID] = len(orders)
+		orders = append(orders, ClosedWorkOrder{WorkOrder: order})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по заказ-нарядам: %w", err)
+	}
+	if len(orders) == 0 {
+		return []ClosedWorkOrder{}, nil
+	}
+
+	rows, err = tx.Query(`
+        SELECT order_id, `+orderLineColumns+`
+        FROM work_order_lines
+        WHERE order_id IN (SELECT id FROM work_orders WHERE `+closedInPeriod+`)
+        ORDER BY order_id, id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	for rows.Next() {
+		var orderID int64
+		var line OrderLine
+		err := rows.Scan(&orderID, &line.ID, &line.Code, &line.Kind, &line.Name, &line.Unit,
+			&line.Quantity, &line.Price, &line.Discount, &line.VATRate)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка сканирования строки заказ-наряда: %w", err)
+		}
+		order := &orders[byID[orderID]]
+		order.Lines = append(order.Lines, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по строкам заказ-нарядов: %w", err)
+	}
+
+	rows, err = tx.Query(`
+        SELECT `+recordColumns+`
+        FROM tire_service
+        WHERE id IN (SELECT record_id FROM work_orders WHERE `+closedInPeriod+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	records, err := scanRecords(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	byRecord := make(map[int64]Record, len(records))
+	for _, record := range records {
+		byRecord[record.ID] = record
+	}
+
+	// Итоги считаются так же, как в GetWorkOrder, чтобы суммы совпадали с нарядом в админке
+	for i := range orders {
+		orders[i].computeTotals()
+		record, ok := byRecord[orders[i].RecordID]
+		if !ok {
+			return nil, fmt.Errorf("%w: ID %d", ErrRecordNotFound, orders[i].RecordID)
+		}
+		orders[i].Record = record
+	}
+
+	return orders, nil
+}
+
+// LastCommerceMLDrop последний день, выгруженный в 1С по расписанию, в местном
+// времени. nil, если выгрузок еще не было
+func LastCommerceMLDrop() (*time.Time, error) {
+	var value sql.NullString
+	if err := db.QueryRow(`SELECT MAX(day) FROM commerceml_drops`).Scan(&value); err != nil {
+		return nil, fmt.Errorf("ошибка получения последней выгрузки в 1С: %w", err)
+	}
+	if !value.Valid {
+		return nil, nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", value.String, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения последней выгрузки в 1С: %w", err)
+	}
+	return &day, nil
+}
+
+// SaveCommerceMLDrop отмечает, что день выгружен в 1С в файл file
+func SaveCommerceMLDrop(day time.Time, file string, now time.Time) error {
+	_, err := db.Exec(`
+        INSERT INTO commerceml_drops (day, file, created_at) VALUES (?, ?, ?)
+        ON CONFLICT (day) DO UPDATE SET file = excluded.file, created_at = excluded.created_at`,
+		day.Format("2006-01-02"), file, now)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения выгрузки в 1С: %w", err)
+	}
+	return nil
+}
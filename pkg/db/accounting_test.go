@@ -0,0 +1,85 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListClosedWorkOrders(t *testing.T) {
+	setupDB(t)
+
+	day := time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC)
+	ids := importRecords(t, day.Add(-48*time.Hour),
+		Record{Title: "А001АА77", Status: "done"},
+		Record{Title: "А002АА77", Service: "puncture", Status: "done"},
+		Record{Title: "А003АА77", Status: "done"},
+		Record{Title: "А004АА77", Status: "done"},
+		Record{Title: "А005АА77", Status: "done"},
+	)
+
+	for i, id := range ids {
+		if _, _, err := CreateWorkOrder(id, day.Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		quantity, discount := i+1, int64(1000*i)
+		if _, err := AddOrderLine(id, OrderLineInput{Code: "valve", Quantity: &quantity, Discount: &discount}, day); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	finalize := func(id int64, at time.Time) {
+		t.Helper()
+		if _, err := FinalizeWorkOrder(id, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	finalize(ids[0], day.Add(12*time.Hour))
+	finalize(ids[1], day.Add(10*time.Hour))
+	// Закрыт накануне, оплачен в периоде
+	finalize(ids[2], day.Add(-2*time.Hour))
+	if _, err := LockWorkOrder(ids[2], "card", day.Add(11*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	// Закрыт на следующий день, ids[4] остается черновиком
+	finalize(ids[3], day.Add(24*time.Hour))
+
+	orders, err := ListClosedWorkOrders(day, day.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int64{ids[2], ids[1], ids[0]}
+	if len(orders) != len(want) {
+		t.Fatalf("got %d orders, want %d", len(orders), len(want))
+	}
+	for i, order := range orders {
+		if order.RecordID != want[i] || order.Record.ID != want[i] {
+			t.Errorf("order %d: record %d (%d), want %d", i, order.RecordID, order.Record.ID, want[i])
+		}
+
+		// Строки и итоги совпадают с нарядом в админке
+		single, err := GetWorkOrder(order.RecordID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(order.WorkOrder, *single) {
+			t.Errorf("order %d:\ngot  %+v\nwant %+v", i, order.WorkOrder, *single)
+		}
+		record, err := GetRecordByID(order.RecordID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(order.Record, *record) {
+			t.Errorf("order %d record:\ngot  %+v\nwant %+v", i, order.Record, *record)
+		}
+	}
+
+	empty, err := ListClosedWorkOrders(day.Add(48*time.Hour), day.Add(72*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty == nil || len(empty) != 0 {
+		t.Errorf("empty period: %v", empty)
+	}
+}
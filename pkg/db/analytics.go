@@ -0,0 +1,90 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// AnalyticsRecord запись для расчета показателей работы
+type AnalyticsRecord struct {
+	Record
+	WelcomedAt *time.Time // первый переход в "welcome" - клиент приехал
+}
+
+// PaidOrder оплаченный заказ-наряд для расчета выручки. Суммы в копейках
+type PaidOrder struct {
+	RecordID int64
+	Payment  string
+	PaidAt   time.Time
+	Total    int64
+	VAT      int64
+}
+
+// ListAnalyticsRecords возвращает записи со временем записи (для живой
+// очереди - временем создания) в периоде [from, to)
+func ListAnalyticsRecords(from, to time.Time) ([]AnalyticsRecord, error) {
+	query := `
+        SELECT ` + recordColumns + `,
+            (SELECT h.changed_at FROM status_history h WHERE h.record_id = tire_service.id AND h.status = 'welcome'
+             ORDER BY h.changed_at ASC, h.id ASC LIMIT 1)
+        FROM tire_service
+        WHERE COALESCE(record, date) >= ? AND COALESCE(record, date) < ?
+        ORDER BY COALESCE(record, date), id`
+
+	rows, err := db.Query(query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var records []AnalyticsRecord
+	for rows.Next() {
+		var welcomed sql.NullTime
+		record, err := scanRecord(extraColumnsScanner{rows, []any{&welcomed}})
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования записи: %w", err)
+		}
+		records = append(records, AnalyticsRecord{Record: record, WelcomedAt: nullTime(welcomed)})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по записям: %w", err)
+	}
+
+	return records, nil
+}
+
+// ListPaidOrders возвращает заказ-наряды, оплаченные в периоде [from, to)
+func ListPaidOrders(from, to time.Time) ([]PaidOrder, error) {
+	query := `
+        SELECT o.record_id, o.payment, o.paid_at,
+            COALESCE(SUM(l.quantity * l.price - l.discount), 0),
+            COALESCE(SUM(` + orderLineVAT + `), 0)
+        FROM work_orders o
+        LEFT JOIN work_order_lines l ON l.order_id = o.id
+        WHERE o.status = ? AND o.paid_at >= ? AND o.paid_at < ?
+        GROUP BY o.id
+        ORDER BY o.paid_at, o.id`
+
+	rows, err := db.Query(query, WorkOrderPaid, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []PaidOrder
+	for rows.Next() {
+		var order PaidOrder
+		if err := rows.Scan(&order.RecordID, &order.Payment, &order.PaidAt, &order.Total, &order.VAT); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования заказ-наряда: %w", err)
+		}
+		orders = append(orders, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по заказ-нарядам: %w", err)
+	}
+
+	return orders, nil
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	ErrInvalidRange     = errors.New("некорректный период")
+	ErrNoAvailableSlot  = errors.New("нет свободного времени")
+	ErrInvalidTimeRange = errors.New("некорректный интервал времени суток")
+)
+
+// MaxCalendarDays максимальная длина периода календаря и горизонт поиска свободного времени
+const MaxCalendarDays = 60
+
+// DayAvailability свободное время на день
+type DayAvailability struct {
+	Date  time.Time   // начало дня
+	Total int         // всего слотов в рабочем дне
+	Slots []time.Time // свободные слоты
+}
+
+// DayRange интервал времени суток, например 09:00-12:00
+type DayRange struct {
+	From time.Duration // смещение от начала суток
+	To   time.Duration // не включая
+}
+
+// Contains проверяет, попадает ли время суток t в интервал
+func (r DayRange) Contains(t time.Time) bool {
+	offset := timeOfDay(t)
+	return offset >= r.From && offset < r.To
+}
+
+// ParseDayRange разбирает интервал вида "09:00-12:00"
+func ParseDayRange(value string) (DayRange, error) {
+	var fromH, fromM, toH, toM int
+	if _, err := fmt.Sscanf(value, "%d:%d-%d:%d", &fromH, &fromM, &toH, &toM); err != nil {
+		return DayRange{}, ErrInvalidTimeRange
+	}
+
+	r := DayRange{
+		From: time.Duration(fromH)*time.Hour + time.Duration(fromM)*time.Minute,
+		To:   time.Duration(toH)*time.Hour + time.Duration(toM)*time.Minute,
+	}
+	if fromM > 59 || toM > 59 || r.From < 0 || r.To > 24*time.Hour || r.From >= r.To {
+		return DayRange{}, ErrInvalidTimeRange
+	}
+	return r, nil
+}
+
+// startOfDay возвращает начало суток в зоне t
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// busyTimes одним запросом выбирает занятое время в периоде: ожидающие записи
+// и действующие удержания
+func busyTimes(from, to time.Time) ([]time.Time, error) {
+	query := `
+        SELECT record FROM tire_service
+        WHERE status = 'wait' AND record >= ? AND record < ?
+        UNION ALL
+        SELECT slot FROM slot_holds
+        WHERE expires_at > ? AND slot >= ? AND slot < ?`
+
+	rows, err := db.Query(query, from, to, time.Now(), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var busy []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования времени: %w", err)
+		}
+		busy = append(busy, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по времени: %w", err)
+	}
+
+	sort.Slice(busy, func(i, j int) bool { return busy[i].Before(busy[j]) })
+	return busy, nil
+}
+
+// GetAvailability возвращает свободные слоты по дням с from по to включительно
+func GetAvailability(from, to time.Time) ([]DayAvailability, error) {
+	from, to = startOfDay(from), startOfDay(to)
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: конец раньше начала", ErrInvalidRange)
+	}
+
+	days := int(to.Sub(from).Hours()/24) + 1
+	if days > MaxCalendarDays {
+		return nil, fmt.Errorf("%w: не более %d дней", ErrInvalidRange, MaxCalendarDays)
+	}
+
+	end := to.AddDate(0, 0, 1)
+	busy, err := busyTimes(from, end)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := time.Duration(Interval) * time.Minute
+	earliest := time.Now().Add(MinLeadTime)
+
+	availability := make([]DayAvailability, 0, days)
+	next := 0 // индекс первого занятого времени, еще не оставшегося позади
+
+	for date := from; date.Before(end); date = date.AddDate(0, 0, 1) {
+		day := DayAvailability{Date: date}
+
+		slot := date.Add(timeOfDay(StartTime))
+		dayEnd := date.Add(timeOfDay(FinishTime))
+
+		for ; slot.Before(dayEnd); slot = slot.Add(interval) {
+			day.Total++
+
+			for next < len(busy) && busy[next].Before(slot) {
+				next++
+			}
+			// Слот занят, если на него приходится запись: [slot, slot+interval)
+			taken := next < len(busy) && busy[next].Before(slot.Add(interval))
+
+			if !taken && slot.After(earliest) {
+				day.Slots = append(day.Slots, slot)
+			}
+		}
+
+		availability = append(availability, day)
+	}
+
+	return availability, nil
+}
+
+// FindNextAvailable ищет ближайшее время не раньше after, когда подряд свободно
+// достаточно слотов для работы длительностью duration. Если заданы ranges,
+// начало работы должно попадать в один из интервалов времени суток
+func FindNextAvailable(after time.Time, duration time.Duration, ranges []DayRange) (*time.Time, error) {
+	interval := time.Duration(Interval) * time.Minute
+	needed := int((duration + interval - 1) / interval)
+	if needed < 1 {
+		needed = 1
+	}
+
+	from := startOfDay(after)
+	availability, err := GetAvailability(from, from.AddDate(0, 0, MaxCalendarDays-1))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, day := range availability {
+		for i, slot := range day.Slots {
+			if slot.Before(after) || !inRanges(slot, ranges) {
+				continue
+			}
+
+			// Нужные слоты должны идти подряд без занятых между ними
+			if i+needed > len(day.Slots) {
+				break
+			}
+			if day.Slots[i+needed-1].Sub(slot) == time.Duration(needed-1)*interval {
+				return &slot, nil
+			}
+		}
+	}
+
+	return nil, ErrNoAvailableSlot
+}
+
+func inRanges(t time.Time, ranges []DayRange) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	for _, r := range ranges {
+		if r.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
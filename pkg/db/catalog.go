@@ -0,0 +1,119 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrCatalogItemNotFound = errors.New("позиция справочника не найдена")
+	ErrInvalidCatalogItem  = errors.New("некорректная позиция справочника")
+)
+
+// Виды позиций справочника
+const (
+	CatalogService = "service" // работа
+	CatalogPart    = "part"    // расходный материал
+)
+
+// CatalogItem позиция справочника услуг и материалов. Цена в копейках с НДС
+type CatalogItem struct {
+	Code    string
+	Kind    string
+	Name    string
+	Unit    string
+	Price   int64
+	VATRate int // ставка НДС в процентах
+	Active  bool
+}
+
+const catalogColumns = `code, kind, name, unit, price, vat_rate, active`
+
+func scanCatalogItem(row rowScanner) (CatalogItem, error) {
+	var item CatalogItem
+	err := row.Scan(&item.Code, &item.Kind, &item.Name, &item.Unit, &item.Price, &item.VATRate, &item.Active)
+	return item, err
+}
+
+// GetCatalog возвращает справочник: сначала работы, затем материалы.
+// includeInactive добавляет снятые с продажи позиции
+func GetCatalog(includeInactive bool) ([]CatalogItem, error) {
+	query := `
+        SELECT ` + catalogColumns + `
+        FROM catalog
+        WHERE (? OR active)
+        ORDER BY kind = 'part', name`
+
+	rows, err := db.Query(query, includeInactive)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var items []CatalogItem
+	for rows.Next() {
+		item, err := scanCatalogItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования справочника: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по справочнику: %w", err)
+	}
+
+	return items, nil
+}
+
+// GetCatalogItem возвращает позицию справочника по коду
+func GetCatalogItem(code string) (*CatalogItem, error) {
+	item, err := scanCatalogItem(db.QueryRow(`SELECT `+catalogColumns+` FROM catalog WHERE code = ?`, code))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrCatalogItemNotFound, code)
+		}
+		return nil, fmt.Errorf("ошибка получения позиции справочника: %w", err)
+	}
+
+	return &item, nil
+}
+
+// SaveCatalogItem добавляет позицию справочника или обновляет существующую.
+// Новая цена не меняет строки уже созданных заказ-нарядов
+func SaveCatalogItem(item CatalogItem) (*CatalogItem, error) {
+	item.Code = strings.TrimSpace(item.Code)
+	item.Name = strings.TrimSpace(item.Name)
+	if item.Unit == "" {
+		item.Unit = "шт"
+	}
+
+	switch {
+	case item.Code == "" || item.Name == "":
+		return nil, fmt.Errorf("%w: не указан код или название", ErrInvalidCatalogItem)
+	case item.Kind != CatalogService && item.Kind != CatalogPart:
+		return nil, fmt.Errorf("%w: вид %q", ErrInvalidCatalogItem, item.Kind)
+	case item.Price < 0:
+		return nil, fmt.Errorf("%w: отрицательная цена", ErrInvalidCatalogItem)
+	case item.VATRate < 0 || item.VATRate > 100:
+		return nil, fmt.Errorf("%w: ставка НДС %d", ErrInvalidCatalogItem, item.VATRate)
+	}
+
+	query := `
+        INSERT INTO catalog (code, kind, name, unit, price, vat_rate, active)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT (code) DO UPDATE
+        SET kind = excluded.kind, name = excluded.name, unit = excluded.unit,
+            price = excluded.price, vat_rate = excluded.vat_rate, active = excluded.active
+        RETURNING ` + catalogColumns
+
+	saved, err := scanCatalogItem(db.QueryRow(query, item.Code, item.Kind, item.Name, item.Unit,
+		item.Price, item.VATRate, item.Active))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сохранения позиции справочника: %w", err)
+	}
+
+	return &saved, nil
+}
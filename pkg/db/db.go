@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
 	"time"
@@ -19,6 +20,370 @@ CREATE TABLE tire_service (
 	status VARCHAR(32)
 );`
 
+// migrations изменения схемы, применяемые по порядку после основной схемы.
+// Номер последней примененной миграции хранится в PRAGMA user_version
+var migrations = []string{
+	// 1: посты обслуживания и полнотекстовый поиск по номеру и комментарию
+	`
+ALTER TABLE tire_service ADD COLUMN bay INTEGER;
+
+CREATE VIRTUAL TABLE tire_service_fts USING fts5(
+	title, comment,
+	content='tire_service', content_rowid='id',
+	tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER tire_service_fts_insert AFTER INSERT ON tire_service BEGIN
+	INSERT INTO tire_service_fts(rowid, title, comment) VALUES (new.id, new.title, new.comment);
+END;
+
+CREATE TRIGGER tire_service_fts_delete AFTER DELETE ON tire_service BEGIN
+	INSERT INTO tire_service_fts(tire_service_fts, rowid, title, comment) VALUES ('delete', old.id, old.title, old.comment);
+END;
+
+CREATE TRIGGER tire_service_fts_update AFTER UPDATE OF title, comment ON tire_service BEGIN
+	INSERT INTO tire_service_fts(tire_service_fts, rowid, title, comment) VALUES ('delete', old.id, old.title, old.comment);
+	INSERT INTO tire_service_fts(rowid, title, comment) VALUES (new.id, new.title, new.comment);
+END;
+
+INSERT INTO tire_service_fts(tire_service_fts) VALUES ('rebuild');`,
+
+	// 2: сохраненные ответы для повторных запросов с Idempotency-Key
+	`
+CREATE TABLE idempotency_keys (
+	key VARCHAR(255) PRIMARY KEY,
+	request_hash VARCHAR(64) NOT NULL,
+	status INTEGER NOT NULL,
+	body BLOB,
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX idempotency_keys_created_at ON idempotency_keys (created_at);`,
+
+	// 3: версия записи для оптимистичной блокировки
+	`
+ALTER TABLE tire_service ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE tire_service ADD COLUMN updated_at DATETIME;
+UPDATE tire_service SET updated_at = date;`,
+
+	// 4: секретный токен записи для самообслуживания клиента
+	`
+ALTER TABLE tire_service ADD COLUMN access_token VARCHAR(64);
+UPDATE tire_service SET access_token = lower(hex(randomblob(24)));
+CREATE UNIQUE INDEX tire_service_access_token ON tire_service (access_token);`,
+
+	// 5: вид работ и история смены статусов для расчета времени ожидания
+	`
+ALTER TABLE tire_service ADD COLUMN service VARCHAR(32) NOT NULL DEFAULT 'tire_change';
+
+CREATE TABLE status_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	record_id INTEGER NOT NULL,
+	status VARCHAR(32) NOT NULL,
+	changed_at DATETIME NOT NULL
+);
+
+CREATE INDEX status_history_record ON status_history (record_id, status);
+CREATE INDEX status_history_status ON status_history (status, changed_at);
+
+INSERT INTO status_history (record_id, status, changed_at)
+SELECT id, status, COALESCE(updated_at, date) FROM tire_service;
+
+CREATE TRIGGER status_history_insert AFTER INSERT ON tire_service BEGIN
+	INSERT INTO status_history (record_id, status, changed_at)
+	VALUES (new.id, new.status, COALESCE(new.updated_at, new.date));
+END;
+
+CREATE TRIGGER status_history_update AFTER UPDATE OF status ON tire_service
+WHEN old.status IS NOT new.status BEGIN
+	INSERT INTO status_history (record_id, status, changed_at)
+	VALUES (new.id, new.status, COALESCE(new.updated_at, CURRENT_TIMESTAMP));
+END;`,
+
+	// 6: учет неявок клиентов по госномеру
+	`
+CREATE TABLE customers (
+	plate VARCHAR(32) PRIMARY KEY,
+	no_shows INTEGER NOT NULL DEFAULT 0,
+	last_no_show_at DATETIME
+);`,
+
+	// 7: лист ожидания на занятые дни
+	`
+CREATE TABLE waitlist (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title VARCHAR NOT NULL,
+	comment VARCHAR(128) NOT NULL DEFAULT '',
+	service VARCHAR(32) NOT NULL DEFAULT 'tire_change',
+	window_start DATETIME NOT NULL,
+	window_end DATETIME NOT NULL,
+	status VARCHAR(16) NOT NULL DEFAULT 'waiting',
+	offer_slot DATETIME,
+	offer_expires_at DATETIME,
+	record_id INTEGER,
+	access_token VARCHAR(64) NOT NULL,
+	created_at DATETIME NOT NULL
+);
+
+CREATE UNIQUE INDEX waitlist_access_token ON waitlist(access_token);
+CREATE INDEX waitlist_status ON waitlist(status, window_start);`,
+
+	// 8: временное удержание времени на время оформления записи
+	`
+CREATE TABLE slot_holds (
+	token VARCHAR(64) PRIMARY KEY,
+	slot DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX slot_holds_slot ON slot_holds(slot);
+
+ALTER TABLE waitlist ADD COLUMN hold_token VARCHAR(64);`,
+
+	// 9: мастера, назначение записей и фактическое время работ
+	`
+CREATE TABLE staff (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(64) NOT NULL,
+	bay INTEGER,
+	active BOOLEAN NOT NULL DEFAULT 1,
+	created_at DATETIME NOT NULL
+);
+
+ALTER TABLE tire_service ADD COLUMN mechanic_id INTEGER REFERENCES staff(id);
+ALTER TABLE tire_service ADD COLUMN started_at DATETIME;
+ALTER TABLE tire_service ADD COLUMN finished_at DATETIME;
+
+CREATE INDEX tire_service_mechanic ON tire_service(mechanic_id, status);
+
+UPDATE tire_service SET started_at = (
+	SELECT MAX(changed_at) FROM status_history h
+	WHERE h.record_id = tire_service.id AND h.status = 'in work'
+) WHERE status IN ('in work', 'done');
+
+UPDATE tire_service SET finished_at = (
+	SELECT MAX(changed_at) FROM status_history h
+	WHERE h.record_id = tire_service.id AND h.status = 'done'
+) WHERE status = 'done';`,
+
+	// 10: справочник услуг и материалов, заказ-наряды. Цены в копейках с НДС,
+	// черновик наряда удаляется вместе с записью
+	`
+CREATE TABLE catalog (
+	code VARCHAR(32) PRIMARY KEY,
+	kind VARCHAR(16) NOT NULL,
+	name VARCHAR(128) NOT NULL,
+	unit VARCHAR(16) NOT NULL DEFAULT 'шт',
+	price INTEGER NOT NULL,
+	vat_rate INTEGER NOT NULL DEFAULT 22,
+	active BOOLEAN NOT NULL DEFAULT 1
+);
+
+INSERT INTO catalog (code, kind, name, unit, price) VALUES
+	('tire_change', 'service', 'Сезонная замена колес', 'компл', 200000),
+	('tire_mount', 'service', 'Перемонтаж шин с балансировкой', 'компл', 320000),
+	('balancing', 'service', 'Балансировка колеса', 'шт', 30000),
+	('puncture', 'service', 'Ремонт прокола', 'шт', 60000),
+	('valve', 'part', 'Вентиль бескамерный', 'шт', 15000),
+	('weight', 'part', 'Грузик балансировочный', 'г', 300),
+	('patch', 'part', 'Латка', 'шт', 25000),
+	('plug', 'part', 'Жгут ремонтный', 'шт', 10000);
+
+CREATE TABLE work_orders (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	record_id INTEGER NOT NULL UNIQUE,
+	status VARCHAR(16) NOT NULL DEFAULT 'draft',
+	payment VARCHAR(16) NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	finalized_at DATETIME,
+	paid_at DATETIME
+);
+
+CREATE TABLE work_order_lines (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	order_id INTEGER NOT NULL REFERENCES work_orders(id),
+	code VARCHAR(32) NOT NULL,
+	kind VARCHAR(16) NOT NULL,
+	name VARCHAR(128) NOT NULL,
+	unit VARCHAR(16) NOT NULL,
+	quantity INTEGER NOT NULL,
+	price INTEGER NOT NULL,
+	discount INTEGER NOT NULL DEFAULT 0,
+	vat_rate INTEGER NOT NULL
+);
+
+CREATE INDEX work_order_lines_order ON work_order_lines (order_id, id);
+
+CREATE TRIGGER work_order_delete AFTER DELETE ON tire_service BEGIN
+	DELETE FROM work_order_lines WHERE order_id IN (SELECT id FROM work_orders WHERE record_id = OLD.id);
+	DELETE FROM work_orders WHERE record_id = OLD.id;
+END;`,
+
+	// 11: контакты клиента для уведомлений и исходящие уведомления с повторными попытками
+	`
+ALTER TABLE tire_service ADD COLUMN phone VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE tire_service ADD COLUMN email VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE tire_service ADD COLUMN telegram VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE tire_service ADD COLUMN lang VARCHAR(8) NOT NULL DEFAULT 'ru';
+
+CREATE TABLE notifications (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	record_id INTEGER NOT NULL,
+	event VARCHAR(32) NOT NULL,
+	channel VARCHAR(16) NOT NULL,
+	recipient VARCHAR(255) NOT NULL,
+	subject TEXT NOT NULL DEFAULT '',
+	body TEXT NOT NULL,
+	status VARCHAR(16) NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL,
+	sent_at DATETIME
+);
+
+CREATE INDEX notifications_due ON notifications(status, next_attempt_at);
+CREATE INDEX notifications_record ON notifications(record_id);`,
+
+	// 12: напоминания о предварительной записи, по строке на запись и интервал
+	`
+CREATE TABLE reminders (
+	record_id INTEGER NOT NULL,
+	offset_minutes INTEGER NOT NULL,
+	record_at DATETIME NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (record_id, offset_minutes)
+);
+
+CREATE TRIGGER reminders_delete AFTER DELETE ON tire_service BEGIN
+	DELETE FROM reminders WHERE record_id = OLD.id;
+END;`,
+
+	// 13: исходящие вебхуки, очередь доставок и журнал попыток
+	`
+CREATE TABLE webhooks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url TEXT NOT NULL,
+	events TEXT NOT NULL,
+	secret VARCHAR(128) NOT NULL,
+	active BOOLEAN NOT NULL DEFAULT 1,
+	created_at DATETIME NOT NULL
+);
+
+CREATE TABLE webhook_deliveries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	webhook_id INTEGER NOT NULL REFERENCES webhooks(id),
+	event VARCHAR(64) NOT NULL,
+	payload TEXT NOT NULL,
+	status VARCHAR(16) NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL,
+	delivered_at DATETIME
+);
+
+CREATE INDEX webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+CREATE INDEX webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+
+CREATE TABLE webhook_attempts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	delivery_id INTEGER NOT NULL REFERENCES webhook_deliveries(id),
+	attempted_at DATETIME NOT NULL,
+	status_code INTEGER NOT NULL DEFAULT 0,
+	error TEXT NOT NULL DEFAULT '',
+	duration_ms INTEGER NOT NULL
+);
+
+CREATE INDEX webhook_attempts_delivery ON webhook_attempts(delivery_id, id);
+
+CREATE TRIGGER webhook_delete AFTER DELETE ON webhooks BEGIN
+	DELETE FROM webhook_attempts WHERE delivery_id IN (SELECT id FROM webhook_deliveries WHERE webhook_id = OLD.id);
+	DELETE FROM webhook_deliveries WHERE webhook_id = OLD.id;
+END;`,
+
+	// 14: подписки на календарь записей с секретной ссылкой
+	`
+CREATE TABLE calendar_feeds (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	token VARCHAR(64) NOT NULL UNIQUE,
+	name VARCHAR(128) NOT NULL,
+	staff_id INTEGER REFERENCES staff(id),
+	created_at DATETIME NOT NULL
+);`,
+
+	// 15: время во всех таблицах в UTC в едином формате. До _time_format=sqlite
+	// драйвер писал time.Time.String() в местной зоне, значения по умолчанию и
+	// триггеры - CURRENT_TIMESTAMP без смещения, и такие строки не сравнивались
+	// с новыми как текст
+	`
+UPDATE tire_service SET date = utc_time(date), record = utc_time(record), updated_at = utc_time(updated_at),
+	started_at = utc_time(started_at), finished_at = utc_time(finished_at);
+UPDATE idempotency_keys SET created_at = utc_time(created_at);
+UPDATE status_history SET changed_at = utc_time(changed_at);
+UPDATE customers SET last_no_show_at = utc_time(last_no_show_at);
+UPDATE waitlist SET window_start = utc_time(window_start), window_end = utc_time(window_end),
+	offer_slot = utc_time(offer_slot), offer_expires_at = utc_time(offer_expires_at), created_at = utc_time(created_at);
+UPDATE slot_holds SET slot = utc_time(slot), expires_at = utc_time(expires_at), created_at = utc_time(created_at);
+UPDATE staff SET created_at = utc_time(created_at);
+UPDATE work_orders SET created_at = utc_time(created_at), updated_at = utc_time(updated_at),
+	finalized_at = utc_time(finalized_at), paid_at = utc_time(paid_at);
+UPDATE notifications SET next_attempt_at = utc_time(next_attempt_at), created_at = utc_time(created_at),
+	sent_at = utc_time(sent_at);
+UPDATE reminders SET record_at = utc_time(record_at), created_at = utc_time(created_at);
+UPDATE webhooks SET created_at = utc_time(created_at);
+UPDATE webhook_deliveries SET next_attempt_at = utc_time(next_attempt_at), created_at = utc_time(created_at),
+	delivered_at = utc_time(delivered_at);
+UPDATE webhook_attempts SET attempted_at = utc_time(attempted_at);
+UPDATE calendar_feeds SET created_at = utc_time(created_at);
+
+DROP TRIGGER status_history_update;
+CREATE TRIGGER status_history_update AFTER UPDATE OF status ON tire_service
+WHEN old.status IS NOT new.status BEGIN
+	INSERT INTO status_history (record_id, status, changed_at)
+	VALUES (new.id, new.status, COALESCE(new.updated_at, strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')));
+END;`,
+
+	// 16: заголовки сохраненных ответов по ключу идемпотентности. Строка со
+	// статусом 0 занимает ключ на время обработки запроса
+	`
+ALTER TABLE idempotency_keys ADD COLUMN headers TEXT NOT NULL DEFAULT '{}';`,
+
+	// 17: время перевода опоздавшей записи в живую очередь. Время записи и
+	// создания при этом сохраняются
+	`
+ALTER TABLE tire_service ADD COLUMN converted_at DATETIME;`,
+
+	// 18: контакты клиента в листе ожидания для уведомления о предложенном времени.
+	// Уведомление по заявке не относится к записи: record_id = 0
+	`
+ALTER TABLE waitlist ADD COLUMN phone VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE waitlist ADD COLUMN email VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE waitlist ADD COLUMN telegram VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE waitlist ADD COLUMN lang VARCHAR(8) NOT NULL DEFAULT 'ru';
+
+ALTER TABLE notifications ADD COLUMN waitlist_id INTEGER;`,
+
+	// 19: клиент, удержавший время, для ограничения числа удержаний с одного адреса.
+	// Пустая строка - удержание сервиса для предложения из листа ожидания
+	`
+ALTER TABLE slot_holds ADD COLUMN client VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX slot_holds_client ON slot_holds(client);`,
+
+	// 20: дни, выгруженные в 1С по расписанию. Файлы из каталога обмена
+	// забирает 1С, поэтому пропущенные дни считаются по этой таблице
+	`
+CREATE TABLE commerceml_drops (
+	day VARCHAR(10) PRIMARY KEY,
+	file VARCHAR(255) NOT NULL,
+	created_at DATETIME NOT NULL
+);`,
+}
+
 var db *sql.DB
 
 var (
@@ -26,6 +391,7 @@ var (
 	FinishTime  = time.Date(0, 1, 1, 18, 0, 0, 0, time.UTC) // 18:00
 	Interval    = 30                                        // интервал в минутах
 	MinLeadTime = time.Duration(Interval) * time.Minute     // минимальное время для записи от текущего момента
+	Bays        = 3                                         // количество постов обслуживания
 )
 
 type Record struct {
@@ -35,6 +401,27 @@ type Record struct {
 	Record  *time.Time // может быть nil (текущая очередь)
 	Comment string
 	Status  string
+	Service string // вид работ, см. ServiceTypes
+	Bay     *int   // пост обслуживания, nil если не назначен
+
+	MechanicID *int64     // назначенный мастер, nil если не назначен
+	StartedAt  *time.Time // начало работ (переход в "in work")
+	FinishedAt *time.Time // окончание работ (переход в "done")
+
+	ConvertedAt *time.Time // перевод опоздавшей записи в живую очередь, см. ConvertToWalkIn
+
+	Version   int64     // увеличивается при каждом изменении записи
+	UpdatedAt time.Time // время последнего изменения
+
+	AccessToken string `json:"-"` // секрет ссылки самообслуживания клиента
+
+	Contacts Contacts `json:"-"` // контакты для уведомлений, не показываются в публичных списках
+}
+
+// WalkIn проверяет, что запись стоит в живой очереди: создана без времени
+// или переведена туда после опоздания
+func (r Record) WalkIn() bool {
+	return r.Record == nil || r.ConvertedAt != nil
 }
 
 func CloseDatabase() {
@@ -42,12 +429,13 @@ func CloseDatabase() {
 }
 
 func Init(dbFile string, logger *log.Logger) error {
-
-	var err error
-	db, err = sql.Open("sqlite", dbFile)
-	if err != nil {
-		return err
-	}
+	// Ждем освобождения блокировки при конкурентной записи и храним время
+	// в UTC в формате, понятном функциям даты SQLite
+	// Транзакции сразу берут блокировку записи (BEGIN IMMEDIATE): проверка
+	// свободного времени и запись на него не разрываются чужой записью
+	db = sql.OpenDB(utcConnector{
+		name: "file:" + dbFile + "?_pragma=busy_timeout(5000)&_time_format=sqlite&_txlock=immediate",
+	})
 
 	var install bool
 	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
@@ -68,6 +456,43 @@ func Init(dbFile string, logger *log.Logger) error {
 		}
 	}
 
+	if err := migrate(logger); err != nil {
+		return err
+	}
+
 	logger.Printf("INFO: the %s database is ready for use\n", dbFile)
 	return nil
 }
+
+// migrate применяет миграции, которые еще не были применены к базе
+func migrate(logger *log.Logger) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("ошибка чтения версии схемы: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("ошибка миграции %d: %w", i+1, err)
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("ошибка миграции %d: %w", i+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("ошибка миграции %d: %w", i+1, err)
+		}
+
+		logger.Printf("INFO: database migration %d applied\n", i+1)
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ExportRow строка выгрузки: запись, время переходов по статусам и итоги заказ-наряда
+type ExportRow struct {
+	Record
+
+	ServiceName  string // название вида работ из справочника
+	MechanicName string
+
+	// Время последнего перехода в статус, nil если записи в нем не было
+	WelcomedAt  *time.Time
+	InWorkAt    *time.Time
+	DoneAt      *time.Time
+	CancelledAt *time.Time
+	NoShowAt    *time.Time
+
+	// Заказ-наряд, OrderStatus пустой если наряда нет. Суммы в копейках
+	OrderStatus   string
+	Payment       string
+	OrderSubtotal int64
+	OrderDiscount int64
+	OrderTotal    int64
+	OrderVAT      int64
+}
+
+// exportColumns дополнительные колонки выгрузки после recordColumns. Имена
+// колонок orders не совпадают с колонками записи, чтобы условия RecordFilter
+// оставались однозначными
+const exportColumns = `
+        (SELECT name FROM catalog WHERE code = tire_service.service),
+        (SELECT name FROM staff WHERE staff.id = tire_service.mechanic_id),
+        ` + lastChangeColumn + `'welcome' ` + lastChangeEnd + `,
+        ` + lastChangeColumn + `'in work' ` + lastChangeEnd + `,
+        ` + lastChangeColumn + `'done' ` + lastChangeEnd + `,
+        ` + lastChangeColumn + `'cancel' ` + lastChangeEnd + `,
+        ` + lastChangeColumn + `'no_show' ` + lastChangeEnd + `,
+        order_status, order_payment, order_subtotal, order_discount, order_total, order_vat`
+
+// lastChangeColumn время последнего перехода в статус. ORDER BY вместо MAX
+// сохраняет тип колонки, и драйвер возвращает время, а не строку
+const (
+	lastChangeColumn = `(SELECT h.changed_at FROM status_history h WHERE h.record_id = tire_service.id AND h.status = `
+	lastChangeEnd    = `ORDER BY h.changed_at DESC, h.id DESC LIMIT 1)`
+)
+
+// orderLineVAT НДС строки заказ-наряда l, считается как в vatIncluded
+const orderLineVAT = `CASE WHEN l.vat_rate > 0 AND l.quantity * l.price - l.discount > 0
+                    THEN ((l.quantity * l.price - l.discount) * l.vat_rate * 2 + 100 + l.vat_rate) / (2 * (100 + l.vat_rate))
+                    ELSE 0 END`
+
+// exportOrders итоги заказ-нарядов
+const exportOrders = `
+        LEFT JOIN (
+            SELECT o.record_id AS order_record_id, o.status AS order_status, o.payment AS order_payment,
+                SUM(l.quantity * l.price) AS order_subtotal,
+                SUM(l.discount) AS order_discount,
+                SUM(l.quantity * l.price - l.discount) AS order_total,
+                SUM(` + orderLineVAT + `) AS order_vat
+            FROM work_orders o
+            LEFT JOIN work_order_lines l ON l.order_id = o.id
+            GROUP BY o.id
+        ) ON order_record_id = tire_service.id`
+
+// ExportBatch число записей, читаемых одним запросом выгрузки
+const ExportBatch = 500
+
+// ExportRecords передает fn записи по фильтру в порядке времени записи.
+// Записи читаются пачками по ключу (время, ID): в памяти только одна пачка,
+// а запрос не держит блокировку базы, пока fn пишет медленному клиенту.
+// Сортировка, лимит и курсор фильтра не используются
+func ExportRecords(filter RecordFilter, fn func(ExportRow) error) error {
+	where, args := filter.where()
+	if where == "" {
+		where = "WHERE "
+	} else {
+		where += " AND "
+	}
+
+	query := fmt.Sprintf(`
+        SELECT %s, %s, COALESCE(record, date)
+        FROM tire_service %s
+        %s(COALESCE(record, date) > ? OR (COALESCE(record, date) = ? AND id > ?))
+        ORDER BY COALESCE(record, date) ASC, id ASC
+        LIMIT ?`, recordColumns, exportColumns, exportOrders, where)
+
+	var lastKey any = ""
+	var lastID int64
+	for {
+		batch, key, err := exportPage(query, append(args, lastKey, lastKey, lastID, ExportBatch))
+		if err != nil {
+			return err
+		}
+
+		for _, row := range batch {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < ExportBatch {
+			return nil
+		}
+		lastKey, lastID = key, batch[len(batch)-1].ID
+	}
+}
+
+// exportPage читает одну пачку выгрузки и ключ сортировки последней записи
+func exportPage(query string, args []any) ([]ExportRow, any, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var batch []ExportRow
+	var key any
+	for rows.Next() {
+		row, err := scanExportRow(rows, &key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ошибка сканирования записи: %w", err)
+		}
+		batch = append(batch, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("ошибка при итерации по записям: %w", err)
+	}
+
+	return batch, key, nil
+}
+
+// scanExportRow читает строку, выбранную с колонками recordColumns, exportColumns
+// и ключом сортировки
+func scanExportRow(rows *sql.Rows, key *any) (ExportRow, error) {
+	var row ExportRow
+	var serviceName, mechanicName, orderStatus, payment sql.NullString
+	var welcomed, inWork, done, cancelled, noShow sql.NullTime
+	var subtotal, discount, total, vat sql.NullInt64
+
+	scanner := extraColumnsScanner{rows, []any{&serviceName, &mechanicName,
+		&welcomed, &inWork, &done, &cancelled, &noShow,
+		&orderStatus, &payment, &subtotal, &discount, &total, &vat, key}}
+
+	record, err := scanRecord(scanner)
+	if err != nil {
+		return row, err
+	}
+
+	row.Record = record
+	row.ServiceName = serviceName.String
+	row.MechanicName = mechanicName.String
+	row.WelcomedAt = nullTime(welcomed)
+	row.InWorkAt = nullTime(inWork)
+	row.DoneAt = nullTime(done)
+	row.CancelledAt = nullTime(cancelled)
+	row.NoShowAt = nullTime(noShow)
+	row.OrderStatus = orderStatus.String
+	row.Payment = payment.String
+	row.OrderSubtotal = subtotal.Int64
+	row.OrderDiscount = discount.Int64
+	row.OrderTotal = total.Int64
+	row.OrderVAT = vat.Int64
+
+	return row, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// extraColumnsScanner дочитывает дополнительные колонки после колонок записи
+type extraColumnsScanner struct {
+	rows  *sql.Rows
+	extra []any
+}
+
+func (s extraColumnsScanner) Scan(dest ...any) error {
+	return s.rows.Scan(append(dest, s.extra...)...)
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrFeedNotFound = errors.New("подписка на календарь не найдена")
+
+// CalendarFeed подписка на календарь записей. Календарь телефона не передает
+// cookie, поэтому подписка открывается по секретной ссылке с токеном
+type CalendarFeed struct {
+	ID        int64
+	Token     string
+	Name      string // для кого ссылка: "Телефон управляющего"
+	StaffID   *int64 // только записи мастера, nil - все записи
+	CreatedAt time.Time
+}
+
+const feedColumns = `id, token, name, staff_id, created_at`
+
+func scanFeed(row rowScanner) (CalendarFeed, error) {
+	var feed CalendarFeed
+	var staffID sql.NullInt64
+
+	if err := row.Scan(&feed.ID, &feed.Token, &feed.Name, &staffID, &feed.CreatedAt); err != nil {
+		return feed, err
+	}
+	if staffID.Valid {
+		feed.StaffID = &staffID.Int64
+	}
+	return feed, nil
+}
+
+// AddCalendarFeed создает подписку с новым токеном
+func AddCalendarFeed(name string, staffID *int64, now time.Time) (*CalendarFeed, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Записи"
+	}
+
+	if staffID != nil {
+		if _, err := GetStaff(*staffID); err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := newAccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	feed, err := scanFeed(db.QueryRow(`
+        INSERT INTO calendar_feeds (token, name, staff_id, created_at)
+        VALUES (?, ?, ?, ?)
+        RETURNING `+feedColumns, token, name, staffID, now))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка добавления подписки на календарь: %w", err)
+	}
+	return &feed, nil
+}
+
+// GetCalendarFeedByToken возвращает подписку по токену из ссылки
+func GetCalendarFeedByToken(token string) (*CalendarFeed, error) {
+	if token == "" {
+		return nil, ErrFeedNotFound
+	}
+
+	feed, err := scanFeed(db.QueryRow(`SELECT `+feedColumns+` FROM calendar_feeds WHERE token = ?`, token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrFeedNotFound
+		}
+		return nil, fmt.Errorf("ошибка получения подписки на календарь: %w", err)
+	}
+	return &feed, nil
+}
+
+// ListCalendarFeeds возвращает все подписки
+func ListCalendarFeeds() ([]CalendarFeed, error) {
+	rows, err := db.Query(`SELECT ` + feedColumns + ` FROM calendar_feeds ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	feeds := []CalendarFeed{}
+	for rows.Next() {
+		feed, err := scanFeed(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования подписки на календарь: %w", err)
+		}
+		feeds = append(feeds, feed)
+	}
+	return feeds, rows.Err()
+}
+
+// DeleteCalendarFeed отзывает подписку: ссылка перестает работать
+func DeleteCalendarFeed(id int64) error {
+	result, err := db.Exec(`DELETE FROM calendar_feeds WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления подписки на календарь: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("%w: ID %d", ErrFeedNotFound, id)
+	}
+	return nil
+}
+
+// GetBookings возвращает предварительные записи в периоде [from, to), включая
+// отмененные - календарь должен узнать об отмене. staffID != nil - только записи мастера
+func GetBookings(from, to time.Time, staffID *int64) ([]Record, error) {
+	query := `
+        SELECT ` + recordColumns + `
+        FROM tire_service
+        WHERE record IS NOT NULL AND record >= ? AND record < ?`
+	args := []any{from, to}
+	if staffID != nil {
+		query += ` AND mechanic_id = ?`
+		args = append(args, *staffID)
+	}
+	query += ` ORDER BY record, id`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRecords(rows)
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// StatusChange запись истории смены статуса
+type StatusChange struct {
+	RecordID  int64
+	Status    string
+	ChangedAt time.Time
+}
+
+// minDurationSamples минимальное число завершенных работ для доверия к средней длительности
+const minDurationSamples = 3
+
+// GetStatusHistory возвращает историю статусов записи в хронологическом порядке
+func GetStatusHistory(recordID int64) ([]StatusChange, error) {
+	query := `
+        SELECT record_id, status, changed_at
+        FROM status_history
+        WHERE record_id = ?
+        ORDER BY changed_at ASC, id ASC`
+
+	rows, err := db.Query(query, recordID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var history []StatusChange
+	for rows.Next() {
+		var change StatusChange
+		if err := rows.Scan(&change.RecordID, &change.Status, &change.ChangedAt); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования истории: %w", err)
+		}
+		history = append(history, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по истории: %w", err)
+	}
+
+	return history, nil
+}
+
+// AverageServiceDurations возвращает среднюю фактическую длительность работ
+// ("in work" -> "done") по видам работ, завершенных после since. Виды работ
+// с недостаточной статистикой получают нормативную длительность
+func AverageServiceDurations(since time.Time) (map[string]time.Duration, error) {
+	query := `
+        SELECT t.service, AVG((julianday(d.finished) - julianday(w.started)) * 1440), COUNT(*)
+        FROM tire_service t
+        JOIN (SELECT record_id, MAX(changed_at) AS started FROM status_history
+              WHERE status = 'in work' GROUP BY record_id) w ON w.record_id = t.id
+        JOIN (SELECT record_id, MAX(changed_at) AS finished FROM status_history
+              WHERE status = 'done' GROUP BY record_id) d ON d.record_id = t.id
+        WHERE d.finished >= ?
+        AND julianday(d.finished) > julianday(w.started)
+        GROUP BY t.service`
+
+	durations := make(map[string]time.Duration, len(ServiceTypes))
+	for service, duration := range ServiceTypes {
+		durations[service] = duration
+	}
+
+	rows, err := db.Query(query, since)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var service string
+		var minutes sql.NullFloat64
+		var samples int
+
+		if err := rows.Scan(&service, &minutes, &samples); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования статистики: %w", err)
+		}
+
+		if minutes.Valid && samples >= minDurationSamples {
+			durations[service] = time.Duration(minutes.Float64 * float64(time.Minute)).Round(time.Minute)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по статистике: %w", err)
+	}
+
+	return durations, nil
+}
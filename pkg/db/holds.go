@@ -0,0 +1,217 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrHoldNotFound = errors.New("удержание времени не найдено")
+	ErrHoldExpired  = errors.New("срок удержания времени истек")
+	ErrHoldMismatch = errors.New("удержание относится к другому времени")
+	ErrHoldLimit    = errors.New("слишком много удержаний времени")
+)
+
+var (
+	SlotHoldTTL        = 5 * time.Minute // на сколько удерживается выбранное время, пока клиент оформляет запись
+	SlotHoldsPerClient = 1               // сколько времени одновременно удерживает один клиент
+	SlotHoldLimit      = 100             // сколько времени одновременно удерживают все клиенты
+)
+
+// SlotHold удержание времени
+type SlotHold struct {
+	Token     string
+	Slot      time.Time
+	ExpiresAt time.Time
+}
+
+// SetSlotHoldPolicy читает срок удержания из TODO_SLOT_HOLD_TTL (например 10m),
+// число удержаний одного клиента из TODO_SLOT_HOLDS_PER_CLIENT и всех клиентов
+// из TODO_SLOT_HOLD_LIMIT
+func SetSlotHoldPolicy(logger *log.Logger) {
+	if value := os.Getenv("TODO_SLOT_HOLD_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			logger.Printf("WARN: invalid slot hold TTL %s, is using %s\n", value, SlotHoldTTL)
+		} else {
+			SlotHoldTTL = ttl
+		}
+	}
+
+	if value := os.Getenv("TODO_SLOT_HOLDS_PER_CLIENT"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			logger.Printf("WARN: invalid slot holds per client %s, is using %d\n", value, SlotHoldsPerClient)
+		} else {
+			SlotHoldsPerClient = limit
+		}
+	}
+
+	if value := os.Getenv("TODO_SLOT_HOLD_LIMIT"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			logger.Printf("WARN: invalid slot hold limit %s, is using %d\n", value, SlotHoldLimit)
+		} else {
+			SlotHoldLimit = limit
+		}
+	}
+}
+
+// holdSlotTime приводит время к виду, в котором оно сравнивается при проверке занятости
+func holdSlotTime(slot time.Time) time.Time {
+	return slot.Local().Truncate(time.Minute)
+}
+
+// HoldSlot удерживает свободное время на ttl. Время проверяется так же, как при
+// записи, в одной транзакции с удержанием, чтобы его не заняли между проверкой и вставкой.
+//
+// client - адрес клиента. Новое удержание снимает его самые старые удержания сверх
+// SlotHoldsPerClient, а всего клиенты удерживают не больше SlotHoldLimit. Пустой
+// client - удержание самого сервиса (предложение из листа ожидания), оно не ограничивается
+func HoldSlot(slot time.Time, ttl time.Duration, client string) (*SlotHold, error) {
+	slot = holdSlotTime(slot)
+
+	token, err := newAccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	// Предыдущее удержание снимается до проверки: клиент может удержать то же время заново
+	if client != "" {
+		if err := limitSlotHolds(tx, client, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkRecordTimeIn(tx, slot, 0, ""); err != nil {
+		return nil, err
+	}
+
+	hold := &SlotHold{Token: token, Slot: slot, ExpiresAt: now.Add(ttl)}
+
+	_, err = tx.Exec(`INSERT INTO slot_holds (token, slot, expires_at, created_at, client) VALUES (?, ?, ?, ?, ?)`,
+		hold.Token, hold.Slot, hold.ExpiresAt, now, client)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка удержания времени: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка удержания времени: %w", err)
+	}
+
+	return hold, nil
+}
+
+// limitSlotHolds освобождает место для нового удержания клиента: снимает его
+// удержания, кроме SlotHoldsPerClient-1 последних, и проверяет общее число удержаний
+func limitSlotHolds(tx *sql.Tx, client string, now time.Time) error {
+	_, err := tx.Exec(`
+        DELETE FROM slot_holds
+        WHERE client = ? AND token NOT IN (
+            SELECT token FROM slot_holds
+            WHERE client = ? AND expires_at > ?
+            ORDER BY created_at DESC, rowid DESC
+            LIMIT ?
+        )`, client, client, now, SlotHoldsPerClient-1)
+	if err != nil {
+		return fmt.Errorf("ошибка снятия предыдущих удержаний: %w", err)
+	}
+
+	var active int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM slot_holds WHERE client != '' AND expires_at > ?`, now).Scan(&active)
+	if err != nil {
+		return fmt.Errorf("ошибка подсчета удержаний: %w", err)
+	}
+	if active >= SlotHoldLimit {
+		return ErrHoldLimit
+	}
+	return nil
+}
+
+// GetSlotHold возвращает удержание по токену
+func GetSlotHold(token string) (*SlotHold, error) {
+	return getSlotHold(db, token)
+}
+
+func getSlotHold(q queryRower, token string) (*SlotHold, error) {
+	hold := &SlotHold{Token: token}
+
+	err := q.QueryRow(`SELECT slot, expires_at FROM slot_holds WHERE token = ?`, token).
+		Scan(&hold.Slot, &hold.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrHoldNotFound
+		}
+		return nil, fmt.Errorf("ошибка получения удержания: %w", err)
+	}
+
+	return hold, nil
+}
+
+// ReleaseSlotHold снимает удержание, время снова становится свободным
+func ReleaseSlotHold(token string) error {
+	result, err := db.Exec(`DELETE FROM slot_holds WHERE token = ?`, token)
+	if err != nil {
+		return fmt.Errorf("ошибка снятия удержания: %w", err)
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrHoldNotFound
+	}
+	return nil
+}
+
+// CleanupSlotHolds удаляет просроченные удержания и возвращает их количество
+func CleanupSlotHolds(now time.Time) (int64, error) {
+	result, err := db.Exec(`DELETE FROM slot_holds WHERE expires_at < ?`, now)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка очистки удержаний: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// checkSlotHold проверяет, что удержание действует и относится ко времени записи
+func checkSlotHold(q queryRower, token string, recordTime time.Time) error {
+	hold, err := getSlotHold(q, token)
+	if err != nil {
+		return err
+	}
+
+	if hold.ExpiresAt.Before(time.Now()) {
+		return ErrHoldExpired
+	}
+	if !hold.Slot.Equal(holdSlotTime(recordTime)) {
+		return ErrHoldMismatch
+	}
+	return nil
+}
+
+// isSlotHeld проверяет, удерживает ли время кто-то, кроме владельца holdToken
+func isSlotHeld(q queryRower, recordTime time.Time, holdToken string) (bool, error) {
+	slot := holdSlotTime(recordTime)
+
+	var count int
+	err := q.QueryRow(`
+        SELECT COUNT(*) FROM slot_holds
+        WHERE slot >= ? AND slot < ? AND expires_at > ? AND token != ?`,
+		slot, slot.Add(time.Duration(Interval)*time.Minute), time.Now(), holdToken).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// freeSlots n ближайших свободных слотов подряд
+func freeSlots(t *testing.T, n int) []time.Time {
+	t.Helper()
+
+	interval := time.Duration(Interval) * time.Minute
+	after := time.Now().Add(MinLeadTime + time.Hour)
+	slots := make([]time.Time, n)
+	for i := range slots {
+		slot, err := FindNextAvailable(after, interval, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slots[i] = *slot
+		after = slot.Add(interval)
+	}
+	return slots
+}
+
+// setHoldLimits задает ограничения удержаний на время теста
+func setHoldLimits(t *testing.T, perClient, total int) {
+	t.Helper()
+
+	savedPerClient, savedTotal := SlotHoldsPerClient, SlotHoldLimit
+	t.Cleanup(func() { SlotHoldsPerClient, SlotHoldLimit = savedPerClient, savedTotal })
+	SlotHoldsPerClient, SlotHoldLimit = perClient, total
+}
+
+func hold(t *testing.T, slot time.Time, client string) *SlotHold {
+	t.Helper()
+
+	h, err := HoldSlot(slot, time.Minute, client)
+	if err != nil {
+		t.Fatalf("holding %s for %q: %v", slot, client, err)
+	}
+	return h
+}
+
+func TestHoldSlotReleasesPreviousHold(t *testing.T) {
+	setupDB(t)
+	setHoldLimits(t, 1, 100)
+	slots := freeSlots(t, 3)
+
+	first := hold(t, slots[0], "10.0.0.1")
+	second := hold(t, slots[1], "10.0.0.1")
+
+	// Выбрав другое время, клиент отпускает прежнее: его может удержать другой
+	if _, err := GetSlotHold(first.Token); !errors.Is(err, ErrHoldNotFound) {
+		t.Errorf("previous hold: %v, want %v", err, ErrHoldNotFound)
+	}
+	hold(t, slots[0], "10.0.0.2")
+
+	// Чужое удержание действует
+	if _, err := HoldSlot(slots[1], time.Minute, "10.0.0.2"); !errors.Is(err, ErrTimeSlotTaken) {
+		t.Errorf("holding a slot held by another client: %v, want %v", err, ErrTimeSlotTaken)
+	}
+
+	// Свое время можно удержать заново
+	again := hold(t, slots[1], "10.0.0.1")
+	if _, err := GetSlotHold(second.Token); !errors.Is(err, ErrHoldNotFound) {
+		t.Errorf("replaced hold: %v, want %v", err, ErrHoldNotFound)
+	}
+
+	// Удержания сервиса для листа ожидания не снимаются удержаниями клиентов
+	service := hold(t, slots[2], "")
+	hold(t, slots[1], "10.0.0.1")
+	if _, err := GetSlotHold(service.Token); err != nil {
+		t.Errorf("service hold: %v", err)
+	}
+	if _, err := GetSlotHold(again.Token); !errors.Is(err, ErrHoldNotFound) {
+		t.Errorf("replaced hold: %v, want %v", err, ErrHoldNotFound)
+	}
+}
+
+func TestHoldSlotPerClientLimit(t *testing.T) {
+	setupDB(t)
+	setHoldLimits(t, 2, 100)
+	slots := freeSlots(t, 3)
+
+	holds := make([]*SlotHold, len(slots))
+	for i, slot := range slots {
+		holds[i] = hold(t, slot, "10.0.0.1")
+	}
+
+	// Третье удержание снимает самое старое
+	for i, want := range []error{ErrHoldNotFound, nil, nil} {
+		if _, err := GetSlotHold(holds[i].Token); !errors.Is(err, want) {
+			t.Errorf("hold %d: %v, want %v", i, err, want)
+		}
+	}
+}
+
+func TestHoldSlotTotalLimit(t *testing.T) {
+	setupDB(t)
+	setHoldLimits(t, 1, 2)
+	slots := freeSlots(t, 4)
+
+	hold(t, slots[0], "10.0.0.1")
+	second := hold(t, slots[1], "10.0.0.2")
+
+	if _, err := HoldSlot(slots[2], time.Minute, "10.0.0.3"); !errors.Is(err, ErrHoldLimit) {
+		t.Fatalf("hold over the limit: %v, want %v", err, ErrHoldLimit)
+	}
+
+	// Замена своего удержания не увеличивает их число
+	hold(t, slots[2], "10.0.0.1")
+
+	// Предложение из листа ожидания не ограничивается
+	hold(t, slots[3], "")
+
+	if err := ReleaseSlotHold(second.Token); err != nil {
+		t.Fatal(err)
+	}
+	hold(t, slots[1], "10.0.0.3")
+
+	// Истекшие удержания не считаются
+	if _, err := db.Exec(`UPDATE slot_holds SET expires_at = ?`, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	hold(t, slots[0], "10.0.0.4")
+	hold(t, slots[1], "10.0.0.5")
+}
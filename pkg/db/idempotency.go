@@ -0,0 +1,114 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// IdempotencyTTL время хранения ответов на запросы с Idempotency-Key
+const IdempotencyTTL = 24 * time.Hour
+
+// IdempotencyLease через сколько незавершенный запрос считается прерванным
+// (например, сервис перезапустился во время обработки) и ключ можно занять заново
+const IdempotencyLease = time.Minute
+
+// IdempotentResponse сохраненный ответ на запрос с ключом идемпотентности.
+// Status 0 - запрос с этим ключом еще обрабатывается
+type IdempotentResponse struct {
+	Key         string
+	RequestHash string
+	Status      int
+	Header      map[string]string // заголовки ответа, которые повторяются вместе с телом
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+// InProgress проверяет, что ответ на запрос еще не сохранен
+func (r *IdempotentResponse) InProgress() bool {
+	return r.Status == 0
+}
+
+// ClaimIdempotencyKey занимает ключ за запросом с хешем requestHash. Возвращает
+// nil, если ключ занят этим вызовом: запрос нужно выполнить и сохранить ответ
+// SaveIdempotentResponse или освободить ключ ReleaseIdempotencyKey. Иначе
+// возвращает сохраненный ответ или отметку, что запрос еще обрабатывается.
+// Устаревшие ключи и ключи прерванных запросов занимаются заново
+func ClaimIdempotencyKey(key, requestHash string, now time.Time) (*IdempotentResponse, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM idempotency_keys WHERE created_at < ?`, now.Add(-IdempotencyTTL))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка удаления устаревших ключей идемпотентности: %w", err)
+	}
+
+	result, err := tx.Exec(`
+        INSERT INTO idempotency_keys (key, request_hash, status, headers, body, created_at)
+        VALUES (?, ?, 0, '{}', NULL, ?)
+        ON CONFLICT (key) DO UPDATE
+        SET request_hash = excluded.request_hash, status = 0, headers = '{}', body = NULL,
+            created_at = excluded.created_at
+        WHERE idempotency_keys.status = 0 AND idempotency_keys.created_at < ?`,
+		key, requestHash, now, now.Add(-IdempotencyLease))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сохранения ключа идемпотентности: %w", err)
+	}
+
+	if claimed, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if claimed > 0 {
+		return nil, tx.Commit()
+	}
+
+	var response IdempotentResponse
+	var header string
+	err = tx.QueryRow(`
+        SELECT key, request_hash, status, headers, body, created_at
+        FROM idempotency_keys
+        WHERE key = ?`, key).Scan(
+		&response.Key, &response.RequestHash, &response.Status, &header, &response.Body, &response.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения ответа по ключу идемпотентности: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(header), &response.Header); err != nil {
+		return nil, fmt.Errorf("ошибка чтения заголовков ответа по ключу идемпотентности: %w", err)
+	}
+
+	return &response, tx.Commit()
+}
+
+// SaveIdempotentResponse сохраняет ответ на запрос, занявший ключ
+func SaveIdempotentResponse(response IdempotentResponse) error {
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        UPDATE idempotency_keys
+        SET status = ?, headers = ?, body = ?
+        WHERE key = ? AND request_hash = ? AND status = 0`
+
+	_, err = db.Exec(query, response.Status, string(header), response.Body, response.Key, response.RequestHash)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения ответа по ключу идемпотентности: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey освобождает ключ, если ответ на запрос не сохраняется,
+// чтобы повтор выполнил запрос заново
+func ReleaseIdempotencyKey(key, requestHash string) error {
+	_, err := db.Exec(`DELETE FROM idempotency_keys WHERE key = ? AND request_hash = ? AND status = 0`,
+		key, requestHash)
+	if err != nil {
+		return fmt.Errorf("ошибка освобождения ключа идемпотентности: %w", err)
+	}
+	return nil
+}
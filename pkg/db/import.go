@@ -0,0 +1,170 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrPlateRequired = errors.New("не указан номер автомобиля")
+
+// ImportRow строка импорта записей из старой таблицы
+type ImportRow struct {
+	Line    int        // номер строки файла для отчета
+	Record  Record     // Title, Record, Comment, Status, Service и Contacts
+	Created *time.Time // время создания записи, nil - время импорта
+}
+
+// ImportOptions режим импорта
+type ImportOptions struct {
+	DryRun bool // проверить все строки и откатить транзакцию
+	// SkipTimeChecks не проверять для ожидающих записей правила времени
+	// ValidateRecordTime и ограничение по неявкам. Занятость времени
+	// проверяется всегда
+	SkipTimeChecks bool
+}
+
+// ImportRowError ошибка строки импорта
+type ImportRowError struct {
+	Line int
+	Err  error
+}
+
+// ImportResult итог импорта. IDs заполнен только после фиксации транзакции
+type ImportResult struct {
+	Committed bool
+	IDs       map[int]int64 // номер строки -> ID созданной записи
+	Errors    []ImportRowError
+}
+
+// ImportRecords проверяет и добавляет записи одной транзакцией: если хоть одна
+// строка с ошибкой или включен DryRun, не добавляется ничего. Проверка времени
+// идет внутри транзакции, поэтому строки файла не могут занять одно время.
+// События по записям не публикуются: перенос истории не должен рассылать
+// клиентам уведомления
+func ImportRecords(rows []ImportRow, options ImportOptions, now time.Time) (*ImportResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &ImportResult{IDs: make(map[int]int64, len(rows))}
+	for _, row := range rows {
+		record, err := checkImportRow(tx, row.Record, options, now)
+		if err != nil {
+			result.Errors = append(result.Errors, ImportRowError{Line: row.Line, Err: err})
+			continue
+		}
+
+		accessToken, err := newAccessToken()
+		if err != nil {
+			return nil, err
+		}
+
+		created := now
+		if row.Created != nil {
+			created = *row.Created
+		}
+
+		// Триггер status_history_insert пишет одну строку истории со временем
+		// updated_at, поэтому оно равно времени перехода в статус, а не импорта
+		changed := importStatusTime(record, created, now)
+		var startedAt, finishedAt *time.Time
+		switch record.Status {
+		case "in work":
+			startedAt = &changed
+		case "done":
+			startedAt, finishedAt = &changed, &changed
+		}
+
+		var id int64
+		err = tx.QueryRow(`
+            INSERT INTO tire_service (date, title, record, comment, status, updated_at, started_at, finished_at,
+                access_token, service, phone, email, telegram, lang)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+            RETURNING id`,
+			created, record.Title, record.Record, record.Comment, record.Status, changed, startedAt, finishedAt,
+			accessToken, record.Service,
+			record.Contacts.Phone, record.Contacts.Email, record.Contacts.Telegram, record.Contacts.Language).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка добавления записи из строки %d: %w", row.Line, err)
+		}
+		result.IDs[row.Line] = id
+	}
+
+	if len(result.Errors) > 0 || options.DryRun {
+		result.IDs = nil
+		return result, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка фиксации импорта: %w", err)
+	}
+	result.Committed = true
+
+	return result, nil
+}
+
+// importStatusTime время, с которого импортированная запись находится в своем
+// статусе. Клиент, дошедший до визита, оказался в статусе ко времени записи,
+// если оно уже прошло и не раньше создания, остальные - при создании
+func importStatusTime(record Record, created, now time.Time) time.Time {
+	switch record.Status {
+	case "welcome", "in work", "done", "no_show":
+		if record.Record != nil && record.Record.After(created) && !record.Record.After(now) {
+			return *record.Record
+		}
+	}
+	return created
+}
+
+// checkImportRow приводит строку импорта к виду записи и проверяет ее
+func checkImportRow(q queryRower, record Record, options ImportOptions, now time.Time) (Record, error) {
+	record.Title = NormalizePlate(record.Title)
+	if record.Title == "" {
+		return record, ErrPlateRequired
+	}
+
+	if record.Status == "" {
+		record.Status = "wait"
+	}
+	if !IsValidStatus(record.Status) {
+		return record, fmt.Errorf("%w: %s", ErrInvalidStatus, record.Status)
+	}
+
+	if record.Service == "" {
+		record.Service = DefaultServiceType
+	}
+	if !IsValidService(record.Service) {
+		return record, fmt.Errorf("%w: %s", ErrInvalidService, record.Service)
+	}
+
+	contacts, err := record.Contacts.normalize()
+	if err != nil {
+		return record, err
+	}
+	record.Contacts = contacts
+
+	// Время проверяется только у ожидающих записей: завершенные и отмененные
+	// переносятся как история и время не занимают
+	if record.Record == nil || record.Status != "wait" {
+		return record, nil
+	}
+
+	if options.SkipTimeChecks {
+		taken, err := isTimeSlotTaken(q, *record.Record, 0, "")
+		if err != nil {
+			return record, fmt.Errorf("ошибка проверки занятости времени: %w", err)
+		}
+		if taken {
+			return record, ErrTimeSlotTaken
+		}
+		return record, nil
+	}
+
+	if err := checkRecordTimeIn(q, *record.Record, 0, ""); err != nil {
+		return record, err
+	}
+	return record, checkBookingAllowed(record.Title, now)
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setupDB открывает пустую базу во временном каталоге
+func setupDB(t *testing.T) {
+	t.Helper()
+
+	if err := Init(filepath.Join(t.TempDir(), "test.db"), log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(CloseDatabase)
+}
+
+// historyEntry строка status_history
+type historyEntry struct {
+	status    string
+	changedAt time.Time
+}
+
+func statusHistory(t *testing.T, recordID int64) []historyEntry {
+	t.Helper()
+
+	rows, err := db.Query(`SELECT status, changed_at FROM status_history WHERE record_id = ? ORDER BY id`, recordID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var history []historyEntry
+	for rows.Next() {
+		var h historyEntry
+		if err := rows.Scan(&h.status, &h.changedAt); err != nil {
+			t.Fatal(err)
+		}
+		history = append(history, h)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return history
+}
+
+func TestImportStatusHistory(t *testing.T) {
+	setupDB(t)
+
+	now := time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC)
+	at := func(day, hour int) *time.Time {
+		t := time.Date(2026, 3, day, hour, 0, 0, 0, time.UTC)
+		return &t
+	}
+	future := time.Now().UTC().Add(72 * time.Hour).Truncate(time.Hour)
+
+	for _, tt := range []struct {
+		name     string
+		row      ImportRow
+		changed  time.Time
+		started  *time.Time
+		finished *time.Time
+	}{
+		{"done booking", ImportRow{Record: Record{Title: "А001АА77", Record: at(10, 9), Status: "done"}, Created: at(1, 8)},
+			*at(10, 9), at(10, 9), at(10, 9)},
+		{"done walk-in", ImportRow{Record: Record{Title: "А002АА77", Status: "done"}, Created: at(11, 10)},
+			*at(11, 10), at(11, 10), at(11, 10)},
+		{"in work", ImportRow{Record: Record{Title: "А003АА77", Record: at(20, 11), Status: "in work"}, Created: at(19, 8)},
+			*at(20, 11), at(20, 11), nil},
+		{"no show", ImportRow{Record: Record{Title: "А004АА77", Record: at(12, 9), Status: "no_show"}, Created: at(2, 8)},
+			*at(12, 9), nil, nil},
+		// Отмена и ожидание - с момента создания, время записи не важно
+		{"cancelled", ImportRow{Record: Record{Title: "А005АА77", Record: at(13, 9), Status: "cancel"}, Created: at(3, 8)},
+			*at(3, 8), nil, nil},
+		{"waiting", ImportRow{Record: Record{Title: "А006АА77", Record: &future}, Created: at(4, 8)},
+			*at(4, 8), nil, nil},
+		{"waiting without created", ImportRow{Record: Record{Title: "А007АА77"}},
+			now, nil, nil},
+		// Время записи раньше создания - ошибка в старой таблице, берется создание
+		{"record before created", ImportRow{Record: Record{Title: "А008АА77", Record: at(5, 9), Status: "done"}, Created: at(6, 8)},
+			*at(6, 8), at(6, 8), at(6, 8)},
+		// Будущее время записи не может быть временем визита
+		{"done in future", ImportRow{Record: Record{Title: "А009АА77", Record: &future, Status: "done"}, Created: at(7, 8)},
+			*at(7, 8), at(7, 8), at(7, 8)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.row.Line = 1
+			result, err := ImportRecords([]ImportRow{tt.row}, ImportOptions{SkipTimeChecks: true}, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Committed {
+				t.Fatalf("import not committed: %+v", result.Errors)
+			}
+			id := result.IDs[1]
+
+			history := statusHistory(t, id)
+			if len(history) != 1 {
+				t.Fatalf("got %d history entries, want 1: %+v", len(history), history)
+			}
+			status := tt.row.Record.Status
+			if status == "" {
+				status = "wait"
+			}
+			if history[0].status != status || !history[0].changedAt.Equal(tt.changed) {
+				t.Errorf("history %s at %s, want %s at %s", history[0].status, history[0].changedAt, status, tt.changed)
+			}
+
+			record, err := GetRecordByID(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameTime(record.StartedAt, tt.started) || !sameTime(record.FinishedAt, tt.finished) {
+				t.Errorf("started %v, finished %v; want %v, %v", record.StartedAt, record.FinishedAt, tt.started, tt.finished)
+			}
+
+			created := now
+			if tt.row.Created != nil {
+				created = *tt.row.Created
+			}
+			if !record.Date.Equal(created) {
+				t.Errorf("created at %s, want %s", record.Date, created)
+			}
+		})
+	}
+}
+
+func TestImportDryRunWritesNothing(t *testing.T) {
+	setupDB(t)
+
+	result, err := ImportRecords([]ImportRow{{Line: 1, Record: Record{Title: "А001АА77", Status: "done"}}},
+		ImportOptions{DryRun: true}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Committed || result.IDs != nil {
+		t.Fatalf("dry run result %+v", result)
+	}
+
+	var records, history int
+	if err := db.QueryRow(`SELECT (SELECT COUNT(*) FROM tire_service), (SELECT COUNT(*) FROM status_history)`).
+		Scan(&records, &history); err != nil {
+		t.Fatal(err)
+	}
+	if records != 0 || history != 0 {
+		t.Errorf("dry run left %d records and %d history entries", records, history)
+	}
+}
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+	"tire-pepair-record-service/pkg/events"
+)
+
+var ErrBookingRestricted = errors.New("предварительная запись недоступна из-за неявок")
+
+// Политика неявок, настраивается переменными окружения в SetNoShowPolicy
+var (
+	NoShowGrace       = 30 * time.Minute    // через сколько после времени записи клиент считается неявившимся
+	NoShowLimit       = 3                   // число неявок, после которого закрывается предварительная запись, 0 - без ограничений
+	NoShowWindow      = 90 * 24 * time.Hour // ограничение действует, пока последняя неявка моложе этого срока
+	LateArrivalWalkIn = true                // опоздавших можно перевести в живую очередь
+)
+
+// Customer статистика клиента по госномеру
+type Customer struct {
+	Plate        string
+	NoShows      int
+	LastNoShowAt *time.Time
+}
+
+// Restricted сообщает, закрыта ли клиенту предварительная запись на момент now
+func (c Customer) Restricted(now time.Time) bool {
+	return NoShowLimit > 0 && c.NoShows >= NoShowLimit &&
+		c.LastNoShowAt != nil && now.Sub(*c.LastNoShowAt) < NoShowWindow
+}
+
+// SetNoShowPolicy читает политику неявок из окружения:
+// TODO_NOSHOW_GRACE (длительность, например 45m), TODO_NOSHOW_LIMIT (число)
+// и TODO_NOSHOW_WALKIN (true/false)
+func SetNoShowPolicy(logger *log.Logger) {
+	if value := os.Getenv("TODO_NOSHOW_GRACE"); value != "" {
+		grace, err := time.ParseDuration(value)
+		if err != nil || grace <= 0 {
+			logger.Printf("WARN: invalid no-show grace %s, is using %s\n", value, NoShowGrace)
+		} else {
+			NoShowGrace = grace
+		}
+	}
+
+	if value := os.Getenv("TODO_NOSHOW_LIMIT"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			logger.Printf("WARN: invalid no-show limit %s, is using %d\n", value, NoShowLimit)
+		} else {
+			NoShowLimit = limit
+		}
+	}
+
+	if value := os.Getenv("TODO_NOSHOW_WALKIN"); value != "" {
+		walkIn, err := strconv.ParseBool(value)
+		if err != nil {
+			logger.Printf("WARN: invalid no-show walk-in flag %s, is using %t\n", value, LateArrivalWalkIn)
+		} else {
+			LateArrivalWalkIn = walkIn
+		}
+	}
+}
+
+// GetCustomer возвращает статистику клиента по госномеру в любом написании
+func GetCustomer(plate string) (*Customer, error) {
+	customer := &Customer{Plate: NormalizePlate(plate)}
+
+	var lastNoShowAt sql.NullTime
+	err := db.QueryRow(`SELECT no_shows, last_no_show_at FROM customers WHERE plate = ?`, customer.Plate).
+		Scan(&customer.NoShows, &lastNoShowAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("ошибка получения клиента: %w", err)
+	}
+	if lastNoShowAt.Valid {
+		customer.LastNoShowAt = &lastNoShowAt.Time
+	}
+
+	return customer, nil
+}
+
+// checkBookingAllowed проверяет, что клиенту доступна предварительная запись
+func checkBookingAllowed(plate string, now time.Time) error {
+	if NoShowLimit == 0 {
+		return nil
+	}
+
+	customer, err := GetCustomer(plate)
+	if err != nil {
+		return err
+	}
+	if customer.Restricted(now) {
+		return ErrBookingRestricted
+	}
+	return nil
+}
+
+// MarkNoShows переводит в no_show ожидающие записи, время которых прошло больше
+// чем на NoShowGrace, и увеличивает счетчики неявок клиентов
+func MarkNoShows(now time.Time) ([]Record, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        UPDATE tire_service
+        SET status = 'no_show', version = version + 1, updated_at = ?
+        WHERE status = 'wait' AND record IS NOT NULL AND record < ? AND converted_at IS NULL
+        RETURNING ` + recordColumns
+
+	rows, err := tx.Query(query, now, now.Add(-NoShowGrace))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка отметки неявок: %w", err)
+	}
+	records, err := scanRecords(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var evs []events.Event
+	for _, record := range records {
+		_, err := tx.Exec(`
+            INSERT INTO customers (plate, no_shows, last_no_show_at)
+            VALUES (normalize_plate(?), 1, ?)
+            ON CONFLICT (plate) DO UPDATE
+            SET no_shows = no_shows + 1, last_no_show_at = excluded.last_no_show_at`,
+			record.Title, now)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка учета неявки: %w", err)
+		}
+
+		previous := record
+		previous.Status = "wait"
+		changed, err := recordChange(tx, &previous, record, now)
+		if err != nil {
+			return nil, err
+		}
+		evs = append(evs, changed...)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	publish(evs)
+
+	return records, nil
+}
+
+// ConvertToWalkIn ставит опоздавшего клиента в конец живой очереди. Подходят
+// записи в статусе no_show и ожидающие записи, время которых уже прошло.
+// Время записи и создания сохраняются, место в очереди определяет converted_at.
+// Неявка, засчитанная ранее, снимается
+func ConvertToWalkIn(recordID int64, expectedVersion int64, now time.Time) (*Record, error) {
+	if !LateArrivalWalkIn {
+		return nil, ErrNotModifiable
+	}
+
+	record, err := GetRecordByID(recordID)
+	if err != nil {
+		return nil, err
+	}
+
+	if expectedVersion != 0 && record.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+
+	late := record.Status == "wait" && !record.WalkIn() && record.Record.Before(now)
+	if record.Status != "no_show" && !late {
+		return nil, ErrNotModifiable
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        UPDATE tire_service
+        SET status = 'wait', bay = NULL, converted_at = ?,
+            version = version + 1, updated_at = ?
+        WHERE id = ? AND version = ?
+        RETURNING ` + recordColumns
+
+	updated, err := scanRecord(tx.QueryRow(query, now, now, recordID, record.Version))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrVersionConflict
+		}
+		return nil, fmt.Errorf("ошибка перевода в живую очередь: %w", err)
+	}
+
+	if record.Status == "no_show" {
+		_, err := tx.Exec(`
+            UPDATE customers SET no_shows = MAX(no_shows - 1, 0)
+            WHERE plate = normalize_plate(?)`, record.Title)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка учета неявки: %w", err)
+		}
+	}
+
+	evs, err := recordChange(tx, record, updated, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	publish(evs)
+	return &updated, nil
+}
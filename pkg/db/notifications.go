@@ -0,0 +1,305 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"tire-pepair-record-service/pkg/events"
+)
+
+var (
+	ErrInvalidPhone        = errors.New("некорректный номер телефона")
+	ErrInvalidEmail        = errors.New("некорректный адрес электронной почты")
+	ErrInvalidTelegram     = errors.New("некорректный идентификатор чата Telegram")
+	ErrInvalidLanguage     = errors.New("неподдерживаемый язык уведомлений")
+	ErrNotificationMissing = errors.New("уведомление не найдено")
+)
+
+// Языки уведомлений
+var NotificationLanguages = map[string]bool{"ru": true, "en": true}
+
+// Contacts контакты клиента для уведомлений. Пустое поле - канал не используется
+type Contacts struct {
+	Phone    string // +79991234567
+	Email    string
+	Telegram string // идентификатор чата с ботом
+	Language string // ru или en
+}
+
+// normalize проверяет контакты и приводит их к единому виду
+func (c Contacts) normalize() (Contacts, error) {
+	c.Phone = strings.TrimSpace(c.Phone)
+	if c.Phone != "" {
+		var digits strings.Builder
+		for _, r := range c.Phone {
+			switch {
+			case r >= '0' && r <= '9':
+				digits.WriteRune(r)
+			case r == '+' && digits.Len() == 0, r == ' ', r == '-', r == '(', r == ')':
+			default:
+				return c, fmt.Errorf("%w: %s", ErrInvalidPhone, c.Phone)
+			}
+		}
+		phone := digits.String()
+		// Российский номер с 8 в начале приводится к международному виду
+		if len(phone) == 11 && phone[0] == '8' {
+			phone = "7" + phone[1:]
+		}
+		if len(phone) < 10 || len(phone) > 15 {
+			return c, fmt.Errorf("%w: %s", ErrInvalidPhone, c.Phone)
+		}
+		c.Phone = "+" + phone
+	}
+
+	c.Email = strings.TrimSpace(c.Email)
+	if c.Email != "" {
+		address, err := mail.ParseAddress(c.Email)
+		if err != nil || address.Name != "" {
+			return c, fmt.Errorf("%w: %s", ErrInvalidEmail, c.Email)
+		}
+		c.Email = address.Address
+	}
+
+	c.Telegram = strings.TrimSpace(c.Telegram)
+	if c.Telegram != "" {
+		for i, r := range c.Telegram {
+			if !(r >= '0' && r <= '9' || r == '-' && i == 0) {
+				return c, fmt.Errorf("%w: %s", ErrInvalidTelegram, c.Telegram)
+			}
+		}
+	}
+
+	if c.Language == "" {
+		c.Language = "ru"
+	}
+	if !NotificationLanguages[c.Language] {
+		return c, fmt.Errorf("%w: %s", ErrInvalidLanguage, c.Language)
+	}
+
+	return c, nil
+}
+
+// Статусы уведомлений
+const (
+	NotificationPending = "pending" // ожидает отправки или повторной попытки
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed" // попытки исчерпаны
+)
+
+// Notification исходящее уведомление клиенту
+type Notification struct {
+	ID            int64
+	RecordID      int64 // 0 - уведомление по заявке листа ожидания
+	WaitlistID    int64 // заявка листа ожидания, 0 - уведомление по записи
+	Event         string
+	Channel       string
+	Recipient     string
+	Subject       string
+	Body          string
+	Status        string
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	SentAt        *time.Time
+}
+
+const notificationColumns = `id, record_id, IFNULL(waitlist_id, 0), event, channel, recipient, subject, body, status,
+        attempts, last_error, next_attempt_at, created_at, sent_at`
+
+func scanNotification(row rowScanner) (Notification, error) {
+	var n Notification
+	var sentAt sql.NullTime
+
+	err := row.Scan(&n.ID, &n.RecordID, &n.WaitlistID, &n.Event, &n.Channel, &n.Recipient, &n.Subject, &n.Body, &n.Status,
+		&n.Attempts, &n.LastError, &n.NextAttemptAt, &n.CreatedAt, &sentAt)
+	if err != nil {
+		return n, err
+	}
+
+	if sentAt.Valid {
+		n.SentAt = &sentAt.Time
+	}
+	return n, nil
+}
+
+func scanNotifications(rows *sql.Rows) ([]Notification, error) {
+	notifications := []Notification{}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования уведомления: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// EnqueueNotification помещает уведомление в очередь отправки
+func EnqueueNotification(n Notification, now time.Time) (*Notification, error) {
+	return insertNotification(db, n, now)
+}
+
+// NotificationMessages готовит уведомления клиенту о событии записи. Задается
+// пакетом notify; пока не задан, изменения записей уведомлений не создают
+var NotificationMessages func(e events.Event, record Record) ([]Notification, error)
+
+// WaitlistOfferMessages готовит уведомления о предложенном заявке времени, см. NotificationMessages
+var WaitlistOfferMessages func(entry WaitlistEntry) ([]Notification, error)
+
+// enqueueNotifications ставит уведомления о событиях в очередь отправки в
+// транзакции изменения записи: уведомление создается тогда и только тогда,
+// когда изменение сохранено
+func enqueueNotifications(tx *sql.Tx, evs []events.Event, record Record, now time.Time) error {
+	if NotificationMessages == nil {
+		return nil
+	}
+
+	for _, e := range evs {
+		messages, err := NotificationMessages(e, record)
+		if err != nil {
+			return fmt.Errorf("ошибка формирования уведомления: %w", err)
+		}
+		for _, n := range messages {
+			if _, err := insertNotification(tx, n, now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// enqueueWaitlistOffer ставит уведомления о предложении в очередь в транзакции предложения
+func enqueueWaitlistOffer(tx *sql.Tx, entry WaitlistEntry, now time.Time) error {
+	if WaitlistOfferMessages == nil {
+		return nil
+	}
+
+	messages, err := WaitlistOfferMessages(entry)
+	if err != nil {
+		return fmt.Errorf("ошибка формирования уведомления: %w", err)
+	}
+	for _, n := range messages {
+		if _, err := insertNotification(tx, n, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryRower общий интерфейс *sql.DB и *sql.Tx для запросов с одной строкой результата
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func insertNotification(q queryRower, n Notification, now time.Time) (*Notification, error) {
+	created, err := scanNotification(q.QueryRow(`
+        INSERT INTO notifications (record_id, waitlist_id, event, channel, recipient, subject, body,
+            next_attempt_at, created_at)
+        VALUES (?, NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?)
+        RETURNING `+notificationColumns,
+		n.RecordID, n.WaitlistID, n.Event, n.Channel, n.Recipient, n.Subject, n.Body, now, now))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка добавления уведомления: %w", err)
+	}
+	return &created, nil
+}
+
+// DueNotifications возвращает уведомления, время отправки которых наступило
+func DueNotifications(now time.Time, limit int) ([]Notification, error) {
+	rows, err := db.Query(`
+        SELECT `+notificationColumns+`
+        FROM notifications
+        WHERE status = ? AND next_attempt_at <= ?
+        ORDER BY next_attempt_at, id
+        LIMIT ?`, NotificationPending, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения уведомлений: %w", err)
+	}
+	defer rows.Close()
+
+	return scanNotifications(rows)
+}
+
+// MarkNotificationSent отмечает успешную доставку
+func MarkNotificationSent(id int64, now time.Time) error {
+	_, err := db.Exec(`
+        UPDATE notifications SET status = ?, attempts = attempts + 1, last_error = '', sent_at = ?
+        WHERE id = ?`, NotificationSent, now, id)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления уведомления: %w", err)
+	}
+	return nil
+}
+
+// MarkNotificationFailed записывает неудачную попытку. Если next = nil,
+// попытки исчерпаны и уведомление больше не отправляется
+func MarkNotificationFailed(id int64, sendErr error, next *time.Time) error {
+	status, nextAttempt := NotificationFailed, time.Now()
+	if next != nil {
+		status, nextAttempt = NotificationPending, *next
+	}
+
+	_, err := db.Exec(`
+        UPDATE notifications SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ?
+        WHERE id = ?`, status, sendErr.Error(), nextAttempt, id)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления уведомления: %w", err)
+	}
+	return nil
+}
+
+// RetryNotification возвращает неотправленное уведомление в очередь с новым счетчиком попыток
+func RetryNotification(id int64, now time.Time) (*Notification, error) {
+	n, err := scanNotification(db.QueryRow(`
+        UPDATE notifications SET status = ?, attempts = 0, next_attempt_at = ?
+        WHERE id = ? AND status != ?
+        RETURNING `+notificationColumns, NotificationPending, now, id, NotificationSent))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: ID %d", ErrNotificationMissing, id)
+		}
+		return nil, fmt.Errorf("ошибка обновления уведомления: %w", err)
+	}
+	return &n, nil
+}
+
+// GetNotification возвращает уведомление по ID
+func GetNotification(id int64) (*Notification, error) {
+	n, err := scanNotification(db.QueryRow(`SELECT `+notificationColumns+` FROM notifications WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: ID %d", ErrNotificationMissing, id)
+		}
+		return nil, fmt.Errorf("ошибка получения уведомления: %w", err)
+	}
+	return &n, nil
+}
+
+// ListNotifications возвращает уведомления по записи (recordID != 0) и/или
+// статусу, новые первыми
+func ListNotifications(recordID int64, status string, limit int) ([]Notification, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notifications WHERE 1 = 1`
+	var args []any
+	if recordID != 0 {
+		query += ` AND record_id = ?`
+		args = append(args, recordID)
+	}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения уведомлений: %w", err)
+	}
+	defer rows.Close()
+
+	return scanNotifications(rows)
+}
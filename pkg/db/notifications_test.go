@@ -0,0 +1,54 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestContactsNormalize(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		in   Contacts
+		want Contacts
+		err  error
+	}{
+		{"empty", Contacts{}, Contacts{Language: "ru"}, nil},
+		{"phone with 8", Contacts{Phone: "8 (999) 123-45-67"}, Contacts{Phone: "+79991234567", Language: "ru"}, nil},
+		{"phone with +7", Contacts{Phone: "+7 999 123 45 67"}, Contacts{Phone: "+79991234567", Language: "ru"}, nil},
+		{"phone without +", Contacts{Phone: " 79991234567 "}, Contacts{Phone: "+79991234567", Language: "ru"}, nil},
+		{"foreign phone", Contacts{Phone: "+44 20 7946 0958"}, Contacts{Phone: "+442079460958", Language: "ru"}, nil},
+		// 8 заменяется на 7 только в 11-значном номере
+		{"short phone with 8", Contacts{Phone: "8999123456"}, Contacts{Phone: "+8999123456", Language: "ru"}, nil},
+		{"phone too short", Contacts{Phone: "123-45-67"}, Contacts{}, ErrInvalidPhone},
+		{"phone too long", Contacts{Phone: "+7999123456789012"}, Contacts{}, ErrInvalidPhone},
+		{"phone with letters", Contacts{Phone: "+7 999 CALL-ME"}, Contacts{}, ErrInvalidPhone},
+		{"plus inside phone", Contacts{Phone: "7+9991234567"}, Contacts{}, ErrInvalidPhone},
+		{"email", Contacts{Email: " Ivan@Example.ru "}, Contacts{Email: "Ivan@Example.ru", Language: "ru"}, nil},
+		{"email with name", Contacts{Email: "Иван <ivan@example.ru>"}, Contacts{}, ErrInvalidEmail},
+		{"not email", Contacts{Email: "ivan.example.ru"}, Contacts{}, ErrInvalidEmail},
+		{"telegram", Contacts{Telegram: " 123456789 "}, Contacts{Telegram: "123456789", Language: "ru"}, nil},
+		{"telegram group", Contacts{Telegram: "-100123456"}, Contacts{Telegram: "-100123456", Language: "ru"}, nil},
+		{"telegram username", Contacts{Telegram: "@ivan"}, Contacts{}, ErrInvalidTelegram},
+		{"telegram minus inside", Contacts{Telegram: "100-123"}, Contacts{}, ErrInvalidTelegram},
+		{"english", Contacts{Language: "en"}, Contacts{Language: "en"}, nil},
+		{"unknown language", Contacts{Language: "de"}, Contacts{}, ErrInvalidLanguage},
+		{"all", Contacts{Phone: "89991234567", Email: "a@b.ru", Telegram: "42", Language: "en"},
+			Contacts{Phone: "+79991234567", Email: "a@b.ru", Telegram: "42", Language: "en"}, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.in.normalize()
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
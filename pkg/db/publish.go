@@ -0,0 +1,70 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+	"tire-pepair-record-service/pkg/events"
+)
+
+// recordChange ставит события об изменении записи в очередь вебхуков и уведомления
+// клиенту в очередь отправки в транзакции изменения и возвращает события для
+// публикации после фиксации. before = nil для новой записи
+func recordChange(tx *sql.Tx, before *Record, after Record, now time.Time) ([]events.Event, error) {
+	var evs []events.Event
+	if before == nil {
+		evs = append(evs, events.Event{
+			Name:     events.RecordCreated,
+			RecordID: after.ID,
+			Status:   after.Status,
+			Record:   after.Record,
+			At:       now,
+		})
+	} else {
+		event := events.Event{
+			Name:           events.RecordUpdated,
+			RecordID:       after.ID,
+			Status:         after.Status,
+			PreviousStatus: before.Status,
+			Record:         after.Record,
+			PreviousRecord: before.Record,
+			At:             now,
+		}
+		evs = append(evs, event)
+
+		if before.Status != after.Status {
+			event.Name = events.RecordStatusChanged
+			evs = append(evs, event)
+		}
+	}
+
+	if err := enqueueWebhooks(tx, evs, &after); err != nil {
+		return nil, err
+	}
+	if err := enqueueNotifications(tx, evs, after, now); err != nil {
+		return nil, err
+	}
+	return evs, nil
+}
+
+// recordDeleted ставит событие об удалении записи в очередь вебхуков в транзакции удаления
+func recordDeleted(tx *sql.Tx, deleted Record, now time.Time) ([]events.Event, error) {
+	evs := []events.Event{{
+		Name:           events.RecordDeleted,
+		RecordID:       deleted.ID,
+		PreviousStatus: deleted.Status,
+		PreviousRecord: deleted.Record,
+		At:             now,
+	}}
+
+	if err := enqueueWebhooks(tx, evs, nil); err != nil {
+		return nil, err
+	}
+	return evs, nil
+}
+
+// publish передает события подписчикам после фиксации изменения
+func publish(evs []events.Event) {
+	for _, e := range evs {
+		events.Publish(e)
+	}
+}
@@ -4,129 +4,428 @@ import (
 	"database/sql"
 	"fmt"
 	"time"
+	"tire-pepair-record-service/pkg/events"
 )
 
 // GetAvailableSlots возвращает доступные временные слоты на указанную дату
 func GetAvailableSlots(date time.Time) ([]time.Time, error) {
-	// Нормализуем дату (начало дня)
-	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
-
-	var availableSlots []time.Time
-
-	// Генерируем все возможные слоты на день
-	currentSlot := date.Add(StartTime.Sub(time.Time{}))
-	endTime := date.Add(FinishTime.Sub(time.Time{}))
-
-	for currentSlot.Before(endTime) {
-		// Проверяем, не прошло ли время
-		if currentSlot.After(time.Now().Add(MinLeadTime)) {
-			// Проверяем, свободен ли слот
-			isTaken, err := IsTimeSlotTaken(currentSlot)
-			if err != nil {
-				return nil, err
-			}
+	availability, err := GetAvailability(date, date)
+	if err != nil {
+		return nil, err
+	}
 
-			if !isTaken {
-				availableSlots = append(availableSlots, currentSlot)
-			}
+	return availability[0].Slots, nil
+}
+
+// timeOfDay возвращает смещение времени t от начала суток
+func timeOfDay(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+// AddRecord добавляет новую запись и возвращает ее в том виде, в каком она сохранена
+func AddRecord(record Record) (*Record, error) {
+	return AddRecordWithHold(record, "")
+}
+
+// AddRecordWithHold добавляет запись на время, удержанное токеном holdToken
+// (см. HoldSlot), и снимает удержание. Пустой токен - запись без удержания
+func AddRecordWithHold(record Record, holdToken string) (*Record, error) {
+	record, err := prepareRecord(record, holdToken)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created, evs, err := insertRecord(tx, record, holdToken, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка добавления записи: %w", err)
+	}
+
+	publish(evs)
+	return &created, nil
+}
+
+// prepareRecord проверяет новую запись до транзакции: доступность предварительной
+// записи клиенту, вид работ и контакты. Заполняет вид работ по умолчанию,
+// нормализованные контакты и токен самообслуживания
+func prepareRecord(record Record, holdToken string) (Record, error) {
+	if holdToken != "" && record.Record == nil {
+		return record, ErrHoldMismatch
+	}
+
+	// Клиентам с частыми неявками предварительная запись закрыта, живая очередь доступна
+	if record.Record != nil {
+		if err := checkBookingAllowed(record.Title, time.Now()); err != nil {
+			return record, err
 		}
+	}
+
+	if record.Service == "" {
+		record.Service = DefaultServiceType
+	}
+	if !IsValidService(record.Service) {
+		return record, fmt.Errorf("%w: %s", ErrInvalidService, record.Service)
+	}
 
-		currentSlot = currentSlot.Add(time.Duration(Interval) * time.Minute)
+	contacts, err := record.Contacts.normalize()
+	if err != nil {
+		return record, err
 	}
+	record.Contacts = contacts
 
-	return availableSlots, nil
+	record.AccessToken, err = newAccessToken()
+	if err != nil {
+		return record, err
+	}
+	return record, nil
 }
 
-// AddRecord обработчик добавления новой записи
-func AddRecord(record Record) error {
-	// Если указано предварительное время, проверяем его
+// insertRecord добавляет подготовленную prepareRecord запись в транзакции tx и
+// возвращает события для публикации после фиксации
+func insertRecord(tx *sql.Tx, record Record, holdToken string, now time.Time) (Record, []events.Event, error) {
+	// Удержание и занятость времени проверяются в транзакции со вставкой:
+	// никто не займет время между проверкой и записью
+	if holdToken != "" {
+		if err := checkSlotHold(tx, holdToken, *record.Record); err != nil {
+			return Record{}, nil, err
+		}
+	}
 	if record.Record != nil {
-		err := ValidateRecordTime(*record.Record)
-		if err != nil {
-			return fmt.Errorf("невалидное время записи: %w", err)
+		if err := checkRecordTimeIn(tx, *record.Record, 0, holdToken); err != nil {
+			return Record{}, nil, fmt.Errorf("невалидное время записи: %w", err)
 		}
 	}
 
 	// Вставляем запись в базу
 	query := `
-        INSERT INTO tire_service (title, record, comment, status) 
-        VALUES (?, ?, ?, ?)`
+        INSERT INTO tire_service (date, title, record, comment, status, updated_at, access_token, service,
+            phone, email, telegram, lang) 
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        RETURNING ` + recordColumns
+
+	contacts := record.Contacts
+	created, err := scanRecord(tx.QueryRow(query, now, record.Title, record.Record, record.Comment, "wait",
+		now, record.AccessToken, record.Service, contacts.Phone, contacts.Email, contacts.Telegram, contacts.Language))
+	if err != nil {
+		return Record{}, nil, fmt.Errorf("ошибка добавления записи: %w", err)
+	}
+
+	// Удержание использовано вместе с созданием записи
+	if holdToken != "" {
+		if _, err := tx.Exec(`DELETE FROM slot_holds WHERE token = ?`, holdToken); err != nil {
+			return Record{}, nil, fmt.Errorf("ошибка снятия удержания: %w", err)
+		}
+	}
 
-	_, err := db.Exec(query, record.Title, record.Record, record.Comment, "wait")
-	return err
+	evs, err := recordChange(tx, nil, created, now)
+	if err != nil {
+		return Record{}, nil, err
+	}
+	return created, evs, nil
 }
 
-// UpdateRecord обработчик обновления записи
-func UpdateRecord(recordID int64, updatedRecord Record) error {
+// UpdateRecord обработчик обновления записи. Если expectedVersion не 0,
+// запись обновляется только при совпадении версии, иначе ErrVersionConflict
+func UpdateRecord(recordID int64, updatedRecord Record, expectedVersion int64) error {
+	if !IsValidStatus(updatedRecord.Status) {
+		return fmt.Errorf("%w: %s", ErrInvalidStatus, updatedRecord.Status)
+	}
+
+	before, err := GetRecordByID(recordID)
+	if err != nil {
+		return err
+	}
+	if expectedVersion != 0 && before.Version != expectedVersion {
+		return fmt.Errorf("%w: ID %d", ErrVersionConflict, recordID)
+	}
+
+	now := time.Now()
+	startedAt, finishedAt := workTimes(*before, updatedRecord.Status, now)
+
+	// Новое время записи снова делает ее предварительной
+	convertedAt := before.ConvertedAt
+	if !sameTime(before.Record, updatedRecord.Record) {
+		convertedAt = nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Время проверяется в транзакции с изменением, чтобы его не заняли в промежутке
 	if updatedRecord.Record != nil {
-		err := ValidateRecordTime(*updatedRecord.Record)
-		if err != nil {
+		if err := checkRecordTimeIn(tx, *updatedRecord.Record, recordID, ""); err != nil {
 			return fmt.Errorf("невалидное время записи: %w", err)
 		}
 	}
 
 	query := `
         UPDATE tire_service 
-        SET title = ?, record = ?, comment = ?, status = ?
-        WHERE id = ?`
+        SET title = ?, record = ?, comment = ?, status = ?, started_at = ?, finished_at = ?, converted_at = ?,
+            version = version + 1, updated_at = ?
+        WHERE id = ? AND version = ?
+        RETURNING ` + recordColumns
+
+	updated, err := scanRecord(tx.QueryRow(query, updatedRecord.Title, updatedRecord.Record,
+		updatedRecord.Comment, updatedRecord.Status, startedAt, finishedAt, convertedAt, now, recordID, before.Version))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return notFoundOrConflict(recordID)
+		}
+		return fmt.Errorf("ошибка обновления записи: %w", err)
+	}
+
+	evs, err := recordChange(tx, before, updated, now)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка обновления записи: %w", err)
+	}
+
+	publish(evs)
+	return nil
+}
+
+// RecordPatch описывает частичное обновление записи: nil-поля не изменяются
+type RecordPatch struct {
+	Title       *string
+	Record      *time.Time
+	ClearRecord bool // перевести запись в текущую очередь (record = NULL)
+	Comment     *string
+	Status      *string
+	Service     *string
+	Bay         *int
+	ClearBay    bool // снять назначение поста
+
+	MechanicID    *int64
+	ClearMechanic bool // снять назначение мастера
+
+	Contacts *Contacts // заменить контакты клиента
+}
+
+// PatchRecord применяет частичное обновление к записи и возвращает её новое состояние.
+// Если expectedVersion не 0, изменение применяется только к этой версии записи
+func PatchRecord(recordID int64, patch RecordPatch, expectedVersion int64) (*Record, error) {
+	record, err := GetRecordByID(recordID)
+	if err != nil {
+		return nil, err
+	}
+
+	if expectedVersion != 0 && record.Version != expectedVersion {
+		return nil, fmt.Errorf("%w: ID %d", ErrVersionConflict, recordID)
+	}
+	previous := *record
+
+	if patch.Title != nil {
+		record.Title = *patch.Title
+	}
+	if patch.Comment != nil {
+		record.Comment = *patch.Comment
+	}
+	if patch.Status != nil {
+		if !IsValidStatus(*patch.Status) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidStatus, *patch.Status)
+		}
+		record.Status = *patch.Status
+	}
+	if patch.Service != nil {
+		if !IsValidService(*patch.Service) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidService, *patch.Service)
+		}
+		record.Service = *patch.Service
+	}
+
+	switch {
+	case patch.ClearBay:
+		record.Bay = nil
+	case patch.Bay != nil:
+		record.Bay = patch.Bay
+	}
+
+	switch {
+	case patch.ClearMechanic:
+		record.MechanicID = nil
+	case patch.MechanicID != nil:
+		if err := checkMechanic(*patch.MechanicID); err != nil {
+			return nil, err
+		}
+		record.MechanicID = patch.MechanicID
+	}
 
-	_, err := db.Exec(query, updatedRecord.Title, updatedRecord.Record,
-		updatedRecord.Comment, updatedRecord.Status, recordID)
-	return err
+	if patch.Contacts != nil {
+		// Язык не указан - остается прежним
+		if patch.Contacts.Language == "" {
+			patch.Contacts.Language = record.Contacts.Language
+		}
+		contacts, err := patch.Contacts.normalize()
+		if err != nil {
+			return nil, err
+		}
+		record.Contacts = contacts
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	switch {
+	case patch.ClearRecord:
+		record.Record = nil
+		record.ConvertedAt = nil
+	case patch.Record != nil:
+		// Проверяем время только если оно действительно меняется, в транзакции
+		// с изменением. Новое время снова делает запись предварительной
+		if !sameTime(record.Record, patch.Record) {
+			if err := checkRecordTimeIn(tx, *patch.Record, recordID, ""); err != nil {
+				return nil, fmt.Errorf("невалидное время записи: %w", err)
+			}
+			record.ConvertedAt = nil
+		}
+		record.Record = patch.Record
+	}
+
+	now := time.Now()
+	record.StartedAt, record.FinishedAt = workTimes(previous, record.Status, now)
+
+	query := `
+        UPDATE tire_service 
+        SET title = ?, record = ?, comment = ?, status = ?, bay = ?, service = ?,
+            mechanic_id = ?, started_at = ?, finished_at = ?, converted_at = ?,
+            phone = ?, email = ?, telegram = ?, lang = ?,
+            version = version + 1, updated_at = ?
+        WHERE id = ? AND version = ?
+        RETURNING ` + recordColumns
+
+	// Версия прочитанной записи защищает от изменений между чтением и записью
+	updated, err := scanRecord(tx.QueryRow(query, record.Title, record.Record, record.Comment,
+		record.Status, record.Bay, record.Service, record.MechanicID, record.StartedAt, record.FinishedAt,
+		record.ConvertedAt, record.Contacts.Phone, record.Contacts.Email, record.Contacts.Telegram, record.Contacts.Language,
+		now, recordID, record.Version))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFoundOrConflict(recordID)
+		}
+		return nil, fmt.Errorf("ошибка обновления записи: %w", err)
+	}
+
+	evs, err := recordChange(tx, &previous, updated, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка обновления записи: %w", err)
+	}
+
+	publish(evs)
+	return &updated, nil
 }
 
-// DeleteRecord удаляет запись по ID
-func DeleteRecord(recordID int64) error {
-	query := `DELETE FROM tire_service WHERE id = ?`
+// DeleteRecord удаляет запись по ID. Если expectedVersion не 0, запись
+// удаляется только при совпадении версии, иначе ErrVersionConflict
+func DeleteRecord(recordID int64, expectedVersion int64) error {
+	// Закрытый заказ-наряд - финансовый документ, запись с ним не удаляется
+	closed, err := hasClosedWorkOrder(recordID)
+	if err != nil {
+		return err
+	}
+	if closed {
+		return fmt.Errorf("%w: запись %d", ErrWorkOrderClosed, recordID)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM tire_service WHERE id = ? AND (? = 0 OR version = ?) RETURNING ` + recordColumns
 
-	result, err := db.Exec(query, recordID)
+	deleted, err := scanRecord(tx.QueryRow(query, recordID, expectedVersion, expectedVersion))
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return notFoundOrConflict(recordID)
+		}
 		return fmt.Errorf("ошибка удаления записи: %w", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	evs, err := recordDeleted(tx, deleted, time.Now())
 	if err != nil {
-		return fmt.Errorf("ошибка получения количества удаленных строк: %w", err)
+		return err
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("запись с ID %d не найдена", recordID)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка удаления записи: %w", err)
 	}
 
+	publish(evs)
 	return nil
 }
 
-// UpdateRecordStatus обновляет статус записи по ID
-func UpdateRecordStatus(recordID int64, newStatus string) error {
+// UpdateRecordStatus обновляет статус записи по ID. Если expectedVersion не 0,
+// статус меняется только при совпадении версии, иначе ErrVersionConflict
+func UpdateRecordStatus(recordID int64, newStatus string, expectedVersion int64) error {
 	// Проверяем валидность статуса
-	validStatuses := map[string]bool{
-		"wait":    true,
-		"welcome": true,
-		"in work": true,
-		"done":    true,
-		"cancel":  true,
+	if !IsValidStatus(newStatus) {
+		return fmt.Errorf("%w: %s", ErrInvalidStatus, newStatus)
 	}
 
-	if !validStatuses[newStatus] {
-		return fmt.Errorf("невалидный статус: %s", newStatus)
+	before, err := GetRecordByID(recordID)
+	if err != nil {
+		return err
+	}
+	if expectedVersion != 0 && before.Version != expectedVersion {
+		return fmt.Errorf("%w: ID %d", ErrVersionConflict, recordID)
 	}
 
-	query := `UPDATE tire_service SET status = ? WHERE id = ?`
+	now := time.Now()
+	startedAt, finishedAt := workTimes(*before, newStatus, now)
 
-	result, err := db.Exec(query, newStatus, recordID)
+	tx, err := db.Begin()
 	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        UPDATE tire_service
+        SET status = ?, started_at = ?, finished_at = ?, version = version + 1, updated_at = ?
+        WHERE id = ? AND version = ?
+        RETURNING ` + recordColumns
+
+	updated, err := scanRecord(tx.QueryRow(query, newStatus, startedAt, finishedAt, now, recordID, before.Version))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return notFoundOrConflict(recordID)
+		}
 		return fmt.Errorf("ошибка обновления статуса: %w", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	evs, err := recordChange(tx, before, updated, now)
 	if err != nil {
-		return fmt.Errorf("ошибка получения количества обновленных строк: %w", err)
+		return err
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("запись с ID %d не найдена", recordID)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка обновления статуса: %w", err)
 	}
 
+	publish(evs)
 	return nil
 }
 
@@ -137,7 +436,7 @@ func GetRecordsByDate(date time.Time) ([]Record, error) {
 	endOfDay := startOfDay.Add(24 * time.Hour)
 
 	query := `
-        SELECT id, date, title, record, comment, status 
+        SELECT ` + recordColumns + ` 
         FROM tire_service 
         WHERE record BETWEEN ? AND ? 
         AND status != 'cancel'
@@ -149,28 +448,7 @@ func GetRecordsByDate(date time.Time) ([]Record, error) {
 	}
 	defer rows.Close()
 
-	var records []Record
-	for rows.Next() {
-		var record Record
-		var recordTime sql.NullTime
-
-		err := rows.Scan(&record.ID, &record.Date, &record.Title, &recordTime, &record.Comment, &record.Status)
-		if err != nil {
-			return nil, fmt.Errorf("ошибка сканирования записи: %w", err)
-		}
-
-		if recordTime.Valid {
-			record.Record = &recordTime.Time
-		}
-
-		records = append(records, record)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при итерации по записям: %w", err)
-	}
-
-	return records, nil
+	return scanRecords(rows)
 }
 
 // GetTodayRecords возвращает все записи на сегодня с возможностью фильтрации по статусу
@@ -186,26 +464,22 @@ func GetTodayRecords(statusFilter string) ([]Record, error) {
 		// Без фильтра по статусу - все записи кроме отмененных
 		// ВКЛЮЧАЕМ записи с record = NULL (текущая очередь) И записи на сегодня
 		query = `
-            SELECT id, date, title, record, comment, status 
+            SELECT ` + recordColumns + ` 
             FROM tire_service 
-            WHERE (record IS NULL OR record BETWEEN ? AND ?)
+            WHERE (record IS NULL OR record BETWEEN ? AND ? OR converted_at BETWEEN ? AND ?)
             AND status != 'cancel'
             AND status IN ('wait', 'welcome', 'in work')
-            ORDER BY 
-                CASE WHEN record IS NULL THEN 0 ELSE 1 END, -- Сначала записи без времени (текущая очередь)
-                record ASC`
-		args = []interface{}{startOfDay, endOfDay}
+            ORDER BY COALESCE(converted_at, record, date) ASC, id ASC -- порядок вызова определяет пакет queue`
+		args = []interface{}{startOfDay, endOfDay, startOfDay, endOfDay}
 	} else {
 		// С фильтром по конкретному статусу
 		query = `
-            SELECT id, date, title, record, comment, status 
+            SELECT ` + recordColumns + ` 
             FROM tire_service 
-            WHERE (record IS NULL OR record BETWEEN ? AND ?)
+            WHERE (record IS NULL OR record BETWEEN ? AND ? OR converted_at BETWEEN ? AND ?)
             AND status = ?
-            ORDER BY 
-                CASE WHEN record IS NULL THEN 0 ELSE 1 END,
-                record ASC`
-		args = []interface{}{startOfDay, endOfDay, statusFilter}
+            ORDER BY COALESCE(converted_at, record, date) ASC, id ASC`
+		args = []interface{}{startOfDay, endOfDay, startOfDay, endOfDay, statusFilter}
 	}
 
 	rows, err := db.Query(query, args...)
@@ -214,61 +488,31 @@ func GetTodayRecords(statusFilter string) ([]Record, error) {
 	}
 	defer rows.Close()
 
-	var records []Record
-	for rows.Next() {
-		var record Record
-		var recordTime sql.NullTime
-
-		err := rows.Scan(&record.ID, &record.Date, &record.Title, &recordTime, &record.Comment, &record.Status)
-		if err != nil {
-			return nil, fmt.Errorf("ошибка сканирования записи: %w", err)
-		}
-
-		if recordTime.Valid {
-			record.Record = &recordTime.Time
-		}
-
-		records = append(records, record)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при итерации по записям: %w", err)
-	}
-
-	return records, nil
+	return scanRecords(rows)
 }
 
 // GetRecordByID возвращает запись по ID
 func GetRecordByID(recordID int64) (*Record, error) {
 	query := `
-        SELECT id, date, title, record, comment, status 
+        SELECT ` + recordColumns + ` 
         FROM tire_service 
         WHERE id = ?`
 
-	var record Record
-	var recordTime sql.NullTime
-
-	err := db.QueryRow(query, recordID).Scan(
-		&record.ID, &record.Date, &record.Title, &recordTime, &record.Comment, &record.Status)
-
+	record, err := scanRecord(db.QueryRow(query, recordID))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("запись с ID %d не найдена", recordID)
+			return nil, fmt.Errorf("%w: ID %d", ErrRecordNotFound, recordID)
 		}
 		return nil, fmt.Errorf("ошибка получения записи: %w", err)
 	}
 
-	if recordTime.Valid {
-		record.Record = &recordTime.Time
-	}
-
 	return &record, nil
 }
 
 // GetAllRecords возвращает все записи (для администрирования)
 func GetAllRecords(limit, offset int) ([]Record, error) {
 	query := `
-        SELECT id, date, title, record, comment, status 
+        SELECT ` + recordColumns + ` 
         FROM tire_service 
         ORDER BY date DESC 
         LIMIT ? OFFSET ?`
@@ -279,34 +523,13 @@ func GetAllRecords(limit, offset int) ([]Record, error) {
 	}
 	defer rows.Close()
 
-	var records []Record
-	for rows.Next() {
-		var record Record
-		var recordTime sql.NullTime
-
-		err := rows.Scan(&record.ID, &record.Date, &record.Title, &recordTime, &record.Comment, &record.Status)
-		if err != nil {
-			return nil, fmt.Errorf("ошибка сканирования записи: %w", err)
-		}
-
-		if recordTime.Valid {
-			record.Record = &recordTime.Time
-		}
-
-		records = append(records, record)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при итерации по записям: %w", err)
-	}
-
-	return records, nil
+	return scanRecords(rows)
 }
 
 // GetRecordsByStatus возвращает записи по статусу
 func GetRecordsByStatus(status string) ([]Record, error) {
 	query := `
-        SELECT id, date, title, record, comment, status 
+        SELECT ` + recordColumns + ` 
         FROM tire_service 
         WHERE status = ?
         ORDER BY record ASC, date ASC`
@@ -317,28 +540,7 @@ func GetRecordsByStatus(status string) ([]Record, error) {
 	}
 	defer rows.Close()
 
-	var records []Record
-	for rows.Next() {
-		var record Record
-		var recordTime sql.NullTime
-
-		err := rows.Scan(&record.ID, &record.Date, &record.Title, &recordTime, &record.Comment, &record.Status)
-		if err != nil {
-			return nil, fmt.Errorf("ошибка сканирования записи: %w", err)
-		}
-
-		if recordTime.Valid {
-			record.Record = &recordTime.Time
-		}
-
-		records = append(records, record)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при итерации по записям: %w", err)
-	}
-
-	return records, nil
+	return scanRecords(rows)
 }
 
 // GetPendingRecords возвращает записи в статусе ожидания
@@ -349,7 +551,7 @@ func GetPendingRecords() ([]Record, error) {
 // GetActiveRecords возвращает активные записи (не завершенные и не отмененные)
 func GetActiveRecords() ([]Record, error) {
 	query := `
-        SELECT id, date, title, record, comment, status 
+        SELECT ` + recordColumns + ` 
         FROM tire_service 
         WHERE status IN ('wait', 'welcome', 'in work')
         AND (record IS NULL OR record >= datetime('now', 'start of day'))
@@ -363,24 +565,99 @@ func GetActiveRecords() ([]Record, error) {
 	}
 	defer rows.Close()
 
+	return scanRecords(rows)
+}
+
+// sameTime сравнивает необязательные времена: оба nil или один и тот же момент
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// notFoundOrConflict определяет причину, по которой условное обновление не затронуло строк
+func notFoundOrConflict(recordID int64) error {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM tire_service WHERE id = ?`, recordID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("ошибка получения записи: %w", err)
+	}
+
+	if count == 0 {
+		return fmt.Errorf("%w: ID %d", ErrRecordNotFound, recordID)
+	}
+	return fmt.Errorf("%w: ID %d", ErrVersionConflict, recordID)
+}
+
+// recordColumns список колонок, читаемых scanRecord
+const recordColumns = `id, date, title, record, comment, status, bay, version, updated_at, access_token, service,
+        mechanic_id, started_at, finished_at, phone, email, telegram, lang, converted_at`
+
+// rowScanner общий интерфейс *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanRecord читает запись из строки результата, выбранной с колонками recordColumns
+func scanRecord(row rowScanner) (Record, error) {
+	var record Record
+	var recordTime sql.NullTime
+	var bay sql.NullInt64
+	var updatedAt sql.NullTime
+	var accessToken sql.NullString
+	var mechanicID sql.NullInt64
+	var startedAt, finishedAt, convertedAt sql.NullTime
+
+	err := row.Scan(&record.ID, &record.Date, &record.Title, &recordTime, &record.Comment, &record.Status, &bay,
+		&record.Version, &updatedAt, &accessToken, &record.Service, &mechanicID, &startedAt, &finishedAt,
+		&record.Contacts.Phone, &record.Contacts.Email, &record.Contacts.Telegram, &record.Contacts.Language,
+		&convertedAt)
+	if err != nil {
+		return record, err
+	}
+
+	if recordTime.Valid {
+		record.Record = &recordTime.Time
+	}
+	if bay.Valid {
+		value := int(bay.Int64)
+		record.Bay = &value
+	}
+	record.UpdatedAt = record.Date
+	if updatedAt.Valid {
+		record.UpdatedAt = updatedAt.Time
+	}
+	record.AccessToken = accessToken.String
+	if mechanicID.Valid {
+		record.MechanicID = &mechanicID.Int64
+	}
+	if startedAt.Valid {
+		record.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		record.FinishedAt = &finishedAt.Time
+	}
+	if convertedAt.Valid {
+		record.ConvertedAt = &convertedAt.Time
+	}
+
+	return record, nil
+}
+
+// scanRecords читает все записи из результата запроса
+func scanRecords(rows *sql.Rows) ([]Record, error) {
 	var records []Record
 	for rows.Next() {
-		var record Record
-		var recordTime sql.NullTime
-
-		err := rows.Scan(&record.ID, &record.Date, &record.Title, &recordTime, &record.Comment, &record.Status)
+		record, err := scanRecord(rows)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка сканирования записи: %w", err)
 		}
 
-		if recordTime.Valid {
-			record.Record = &recordTime.Time
-		}
-
 		records = append(records, record)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("ошибка при итерации по записям: %w", err)
 	}
 
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Состояния напоминаний
+const (
+	ReminderSent    = "sent"
+	ReminderSkipped = "skipped" // не отправлено: запись сделана позже или уже ушло более близкое напоминание
+)
+
+// Reminder напоминание о предварительной записи за Offset до ее начала
+type Reminder struct {
+	RecordID  int64
+	Offset    time.Duration
+	RecordAt  time.Time // время записи, о котором напомнили; при переносе напоминания начинаются заново
+	Status    string
+	CreatedAt time.Time
+}
+
+// ReminderCandidates возвращает ожидающие предварительные записи, которые начнутся
+// в ближайшие horizon. Пришедшие клиенты переведены в живую очередь и сюда не попадают
+func ReminderCandidates(now time.Time, horizon time.Duration) ([]Record, error) {
+	rows, err := db.Query(`
+        SELECT `+recordColumns+`
+        FROM tire_service
+        WHERE status = 'wait' AND record IS NOT NULL AND record > ? AND record <= ?
+        ORDER BY record`,
+		now, now.Add(horizon))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения записей для напоминаний: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRecords(rows)
+}
+
+// ClaimReminder отмечает напоминание offset о записи отправленным, а более ранние
+// напоминания skipped - пропущенными, и ставит уведомления в очередь. Все в одной
+// транзакции, поэтому после перезапуска напоминание не уходит повторно.
+// Возвращает false, если напоминание об этом времени записи уже было
+func ClaimReminder(record Record, offset time.Duration, skipped []time.Duration,
+	notifications []Notification, now time.Time) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	claimed, err := saveReminder(tx, record, offset, ReminderSent, now)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	for _, skip := range skipped {
+		if _, err := saveReminder(tx, record, skip, ReminderSkipped, now); err != nil {
+			return false, err
+		}
+	}
+
+	for _, n := range notifications {
+		if _, err := insertNotification(tx, n, now); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// saveReminder сохраняет состояние напоминания. Строка о прежнем времени
+// записи (запись перенесли) перезаписывается, о текущем - остается как есть
+func saveReminder(tx *sql.Tx, record Record, offset time.Duration, status string, now time.Time) (bool, error) {
+	result, err := tx.Exec(`
+        INSERT INTO reminders (record_id, offset_minutes, record_at, status, created_at)
+        VALUES (?, ?, ?, ?, ?)
+        ON CONFLICT (record_id, offset_minutes) DO UPDATE
+        SET record_at = excluded.record_at, status = excluded.status, created_at = excluded.created_at
+        WHERE reminders.record_at != excluded.record_at`,
+		record.ID, int(offset/time.Minute), record.Record.UTC(), status, now)
+	if err != nil {
+		return false, fmt.Errorf("ошибка сохранения напоминания: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// GetReminders возвращает напоминания по записи, ближайшие к ее началу первыми
+func GetReminders(recordID int64) ([]Reminder, error) {
+	rows, err := db.Query(`
+        SELECT record_id, offset_minutes, record_at, status, created_at
+        FROM reminders
+        WHERE record_id = ?
+        ORDER BY offset_minutes`, recordID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения напоминаний: %w", err)
+	}
+	defer rows.Close()
+
+	reminders := []Reminder{}
+	for rows.Next() {
+		var r Reminder
+		var minutes int
+		if err := rows.Scan(&r.RecordID, &minutes, &r.RecordAt, &r.Status, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования напоминания: %w", err)
+		}
+		r.Offset = time.Duration(minutes) * time.Minute
+		reminders = append(reminders, r)
+	}
+	return reminders, rows.Err()
+}
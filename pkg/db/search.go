@@ -0,0 +1,263 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	ErrInvalidSort   = errors.New("недопустимое поле сортировки")
+	ErrInvalidCursor = errors.New("некорректный курсор")
+)
+
+// Типы записей для фильтра RecordFilter.Kind
+const (
+	KindBooked = "booked" // предварительная запись на время
+	KindWalkIn = "walkin" // живая очередь
+)
+
+// sortExpressions поля, по которым разрешена сортировка. Выражения без NULL,
+// чтобы курсор мог сравнивать значения напрямую; при равных значениях порядок
+// задает id
+var sortExpressions = map[string]string{
+	"id":          "id",
+	"date":        "IFNULL(date, '')",
+	"title":       "IFNULL(title, '')",
+	"record":      "IFNULL(record, '')",
+	"comment":     "IFNULL(comment, '')",
+	"status":      "IFNULL(status, '')",
+	"bay":         "IFNULL(bay, 0)",
+	"service":     "IFNULL(service, '')",
+	"updated_at":  "IFNULL(updated_at, '')",
+	"mechanic_id": "IFNULL(mechanic_id, 0)",
+	"started_at":  "IFNULL(started_at, '')",
+	"finished_at": "IFNULL(finished_at, '')",
+}
+
+// walkInCondition условие Record.WalkIn: запись без времени или переведенная в живую очередь
+const walkInCondition = "(record IS NULL OR converted_at IS NOT NULL)"
+
+// RecordFilter комбинированный фильтр поиска записей
+type RecordFilter struct {
+	Plate    string     // подстрока госномера
+	Text     string     // полнотекстовый поиск по комментарию и номеру
+	Statuses []string   // набор статусов
+	From     *time.Time // начало периода (время записи, для очереди - время создания)
+	To       *time.Time // конец периода, не включая
+	Kind     string     // KindBooked, KindWalkIn или пусто
+	Bay      *int
+
+	Sort   string // поле сортировки, по умолчанию date
+	Desc   bool
+	Limit  int
+	Cursor string // непрозрачный курсор из SearchResult.NextCursor
+}
+
+// SearchResult страница результатов поиска
+type SearchResult struct {
+	Records    []Record
+	Total      int    // общее количество записей по фильтру без учета курсора
+	NextCursor string // пусто, если страниц больше нет
+}
+
+// searchCursor позиция последней выданной записи
+type searchCursor struct {
+	Value any   `json:"v"`
+	ID    int64 `json:"id"`
+}
+
+// ftsQuery превращает пользовательский текст в запрос FTS5 с поиском по префиксам слов
+func ftsQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = `"` + word + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+func encodeCursor(c searchCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (searchCursor, error) {
+	var c searchCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&c); err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	// Числовые ключи сортировки сравниваем как целые
+	if number, ok := c.Value.(json.Number); ok {
+		n, err := number.Int64()
+		if err != nil {
+			return c, ErrInvalidCursor
+		}
+		c.Value = n
+	}
+
+	return c, nil
+}
+
+// SearchRecords ищет записи по комбинированному фильтру с курсорной пагинацией
+func SearchRecords(filter RecordFilter) (*SearchResult, error) {
+	if filter.Sort == "" {
+		filter.Sort = "date"
+	}
+	sortExpr, ok := sortExpressions[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSort, filter.Sort)
+	}
+
+	where, args := filter.where()
+
+	result := &SearchResult{}
+
+	err := db.QueryRow(`SELECT COUNT(*) FROM tire_service `+where, args...).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета записей: %w", err)
+	}
+
+	order, compare := "ASC", ">"
+	if filter.Desc {
+		order, compare = "DESC", "<"
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		keyset := fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", sortExpr, compare)
+		if where == "" {
+			where = "WHERE " + keyset
+		} else {
+			where += " AND " + keyset
+		}
+		args = append(args, cursor.Value, cursor.Value, cursor.ID)
+	}
+
+	if filter.Limit <= 0 || filter.Limit > 100 {
+		filter.Limit = 50
+	}
+
+	// Запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	query := fmt.Sprintf(`
+        SELECT %s, %s
+        FROM tire_service
+        %s
+        ORDER BY %s %s, id %s
+        LIMIT ?`, recordColumns, sortExpr, where, sortExpr, order, order)
+	args = append(args, filter.Limit+1)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var lastKey any
+	for rows.Next() {
+		if len(result.Records) == filter.Limit {
+			result.NextCursor = encodeCursor(searchCursor{Value: lastKey, ID: result.Records[len(result.Records)-1].ID})
+			break
+		}
+
+		var sortKey any
+		record, err := scanRecord(sortKeyScanner{rows, &sortKey})
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования записи: %w", err)
+		}
+
+		result.Records = append(result.Records, record)
+		lastKey = sortKey
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по записям: %w", err)
+	}
+
+	return result, nil
+}
+
+// where строит условие WHERE по полям фильтра без учета курсора
+func (filter RecordFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+
+	if plate := NormalizePlate(filter.Plate); plate != "" {
+		conditions = append(conditions, "normalize_plate(title) LIKE ?")
+		args = append(args, "%"+plate+"%")
+	}
+
+	if match := ftsQuery(filter.Text); match != "" {
+		conditions = append(conditions, "id IN (SELECT rowid FROM tire_service_fts WHERE tire_service_fts MATCH ?)")
+		args = append(args, match)
+	}
+
+	if len(filter.Statuses) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(filter.Statuses)), ", ")
+		conditions = append(conditions, "status IN ("+placeholders+")")
+		for _, status := range filter.Statuses {
+			args = append(args, status)
+		}
+	}
+
+	if filter.From != nil {
+		conditions = append(conditions, "COALESCE(record, date) >= ?")
+		args = append(args, *filter.From)
+	}
+
+	if filter.To != nil {
+		conditions = append(conditions, "COALESCE(record, date) < ?")
+		args = append(args, *filter.To)
+	}
+
+	switch filter.Kind {
+	case KindBooked:
+		conditions = append(conditions, "NOT "+walkInCondition)
+	case KindWalkIn:
+		conditions = append(conditions, walkInCondition)
+	}
+
+	if filter.Bay != nil {
+		conditions = append(conditions, "bay = ?")
+		args = append(args, *filter.Bay)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	return where, args
+}
+
+// sortKeyScanner дочитывает дополнительную колонку с ключом сортировки после колонок записи
+type sortKeyScanner struct {
+	rows *sql.Rows
+	key  *any
+}
+
+func (s sortKeyScanner) Scan(dest ...any) error {
+	return s.rows.Scan(append(dest, s.key)...)
+}
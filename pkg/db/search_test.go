@@ -0,0 +1,122 @@
+package db
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// importRecords добавляет записи импортом, чтобы задать прошедшее время записи
+func importRecords(t *testing.T, now time.Time, records ...Record) []int64 {
+	t.Helper()
+
+	rows := make([]ImportRow, len(records))
+	for i, record := range records {
+		rows[i] = ImportRow{Line: i + 1, Record: record}
+	}
+	result, err := ImportRecords(rows, ImportOptions{SkipTimeChecks: true}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Committed {
+		t.Fatalf("import not committed: %+v", result.Errors)
+	}
+
+	ids := make([]int64, len(records))
+	for i := range records {
+		ids[i] = result.IDs[i+1]
+	}
+	return ids
+}
+
+func searchIDs(t *testing.T, filter RecordFilter) []int64 {
+	t.Helper()
+
+	var ids []int64
+	for {
+		result, err := SearchRecords(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range result.Records {
+			ids = append(ids, record.ID)
+		}
+		if result.NextCursor == "" {
+			return ids
+		}
+		filter.Cursor = result.NextCursor
+	}
+}
+
+func TestSearchKind(t *testing.T) {
+	setupDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	past, future := now.Add(-2*time.Hour), now.Add(48*time.Hour)
+	ids := importRecords(t, now,
+		Record{Title: "А001АА77"},
+		Record{Title: "А002АА77", Record: &past},
+		Record{Title: "А003АА77", Record: &future},
+	)
+	walkIn, late, booked := ids[0], ids[1], ids[2]
+
+	// Опоздавший клиент сохраняет время записи, но стоит в живой очереди
+	converted, err := ConvertToWalkIn(late, 0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !converted.WalkIn() || converted.Record == nil {
+		t.Fatalf("converted record %+v", converted)
+	}
+
+	for _, tt := range []struct {
+		kind string
+		want []int64
+	}{
+		{KindWalkIn, []int64{walkIn, late}},
+		{KindBooked, []int64{booked}},
+		{"", []int64{walkIn, late, booked}},
+	} {
+		got := searchIDs(t, RecordFilter{Kind: tt.kind, Sort: "id"})
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("kind %q: got %v, want %v", tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestSearchSort(t *testing.T) {
+	setupDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	ids := importRecords(t, now,
+		Record{Title: "А001АА77", Service: "puncture", Status: "done"},
+		Record{Title: "А002АА77", Service: "balancing", Status: "in work"},
+		Record{Title: "А003АА77"},
+		Record{Title: "А004АА77", Service: "balancing", Status: "done"},
+	)
+
+	for _, tt := range []struct {
+		sort string
+		desc bool
+		want []int64
+	}{
+		// Равные значения упорядочены по id, пустые идут первыми. Без вида работ
+		// запись получает tire_change
+		{"service", false, []int64{ids[1], ids[3], ids[0], ids[2]}},
+		{"service", true, []int64{ids[2], ids[0], ids[3], ids[1]}},
+		{"started_at", false, []int64{ids[2], ids[0], ids[1], ids[3]}},
+		{"finished_at", false, []int64{ids[1], ids[2], ids[0], ids[3]}},
+		{"mechanic_id", false, ids},
+		{"updated_at", true, []int64{ids[3], ids[2], ids[1], ids[0]}},
+	} {
+		// Страница из одной записи проверяет курсор на каждой границе
+		got := searchIDs(t, RecordFilter{Sort: tt.sort, Desc: tt.desc, Limit: 1})
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("sort %s desc %t: got %v, want %v", tt.sort, tt.desc, got, tt.want)
+		}
+	}
+
+	if _, err := SearchRecords(RecordFilter{Sort: "access_token"}); err == nil {
+		t.Error("sort on access_token accepted")
+	}
+}
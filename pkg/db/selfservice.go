@@ -0,0 +1,103 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SelfServiceCutoff минимальное время до записи, когда клиент еще может ее отменить или перенести
+var SelfServiceCutoff = time.Hour
+
+var (
+	ErrCutoffPassed  = errors.New("до записи осталось слишком мало времени для изменения")
+	ErrNotModifiable = errors.New("запись в текущем статусе нельзя изменить")
+	ErrWalkInRecord  = errors.New("запись в живую очередь нельзя перенести на время")
+)
+
+// newAccessToken генерирует неугадываемый токен для ссылки самообслуживания
+func newAccessToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("ошибка генерации токена: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// GetRecordByAccessToken возвращает запись по токену самообслуживания
+func GetRecordByAccessToken(token string) (*Record, error) {
+	if token == "" {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT ` + recordColumns + `
+        FROM tire_service
+        WHERE access_token = ?`
+
+	record, err := scanRecord(db.QueryRow(query, token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRecordNotFound
+		}
+		return nil, fmt.Errorf("ошибка получения записи: %w", err)
+	}
+
+	return &record, nil
+}
+
+// CheckCustomerChange проверяет, может ли клиент сам изменить запись:
+// только ожидающие записи и не позже SelfServiceCutoff до назначенного времени
+func CheckCustomerChange(record Record, now time.Time) error {
+	if record.Status != "wait" {
+		return ErrNotModifiable
+	}
+
+	if !record.WalkIn() && record.Record.Sub(now) < SelfServiceCutoff {
+		return ErrCutoffPassed
+	}
+
+	return nil
+}
+
+// CancelRecordByCustomer отменяет запись по токену самообслуживания
+func CancelRecordByCustomer(token string) (*Record, error) {
+	record, err := GetRecordByAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckCustomerChange(*record, time.Now()); err != nil {
+		return nil, err
+	}
+
+	status := "cancel"
+	return PatchRecord(record.ID, RecordPatch{Status: &status}, record.Version)
+}
+
+// RescheduleRecordByCustomer переносит запись по токену самообслуживания на новое время.
+// Переносится только предварительная запись и только если клиенту она не закрыта из-за неявок
+func RescheduleRecordByCustomer(token string, newTime time.Time) (*Record, error) {
+	record, err := GetRecordByAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if record.WalkIn() {
+		return nil, ErrWalkInRecord
+	}
+
+	now := time.Now()
+	if err := CheckCustomerChange(*record, now); err != nil {
+		return nil, err
+	}
+
+	if err := checkBookingAllowed(record.Title, now); err != nil {
+		return nil, err
+	}
+
+	return PatchRecord(record.ID, RecordPatch{Record: &newTime}, record.Version)
+}
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvalidService = errors.New("неизвестный вид работ")
+
+// DefaultServiceType вид работ для записей, где он не указан
+const DefaultServiceType = "tire_change"
+
+// ServiceTypes виды работ и их нормативная длительность. Норматив используется
+// для оценки ожидания, пока по виду работ не накоплена статистика
+var ServiceTypes = map[string]time.Duration{
+	"tire_change": 40 * time.Minute, // сезонная замена колес
+	"tire_mount":  60 * time.Minute, // перемонтаж шин с балансировкой
+	"balancing":   20 * time.Minute, // балансировка
+	"puncture":    30 * time.Minute, // ремонт прокола
+}
+
+// IsValidService проверяет, что вид работ есть в справочнике
+func IsValidService(service string) bool {
+	_, ok := ServiceTypes[service]
+	return ok
+}
+
+// ServiceDuration возвращает нормативную длительность вида работ
+func ServiceDuration(service string) time.Duration {
+	if duration, ok := ServiceTypes[service]; ok {
+		return duration
+	}
+	return ServiceTypes[DefaultServiceType]
+}
@@ -0,0 +1,293 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrStaffNotFound   = errors.New("мастер не найден")
+	ErrStaffInactive   = errors.New("мастер не работает")
+	ErrStaffNameNeeded = errors.New("не указано имя мастера")
+)
+
+// Staff мастер шиномонтажа. Уволенных мастеров не удаляют, а деактивируют,
+// чтобы сохранить историю выполненных работ
+type Staff struct {
+	ID        int64
+	Name      string
+	Bay       *int // пост по умолчанию
+	Active    bool
+	CreatedAt time.Time
+}
+
+// StaffPatch частичное обновление мастера: nil-поля не изменяются
+type StaffPatch struct {
+	Name     *string
+	Bay      *int
+	ClearBay bool
+	Active   *bool
+}
+
+// MechanicJobs личная очередь мастера
+type MechanicJobs struct {
+	Current []Record // принятые и находящиеся в работе
+	Next    []Record // назначенные и ожидающие
+}
+
+// Workload загрузка мастера за период
+type Workload struct {
+	Staff   Staff
+	Done    int           // завершено работ
+	InWork  int           // сейчас в работе
+	Total   time.Duration // суммарное время работ
+	Average time.Duration // среднее время одной работы
+}
+
+const staffColumns = `id, name, bay, active, created_at`
+
+func scanStaff(row rowScanner) (Staff, error) {
+	var staff Staff
+	var bay sql.NullInt64
+
+	if err := row.Scan(&staff.ID, &staff.Name, &bay, &staff.Active, &staff.CreatedAt); err != nil {
+		return staff, err
+	}
+
+	if bay.Valid {
+		value := int(bay.Int64)
+		staff.Bay = &value
+	}
+
+	return staff, nil
+}
+
+// CreateStaff добавляет мастера
+func CreateStaff(name string, bay *int) (*Staff, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrStaffNameNeeded
+	}
+
+	query := `
+        INSERT INTO staff (name, bay, active, created_at)
+        VALUES (?, ?, 1, ?)
+        RETURNING ` + staffColumns
+
+	staff, err := scanStaff(db.QueryRow(query, name, bay, time.Now()))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка добавления мастера: %w", err)
+	}
+
+	return &staff, nil
+}
+
+// GetStaff возвращает мастера по ID
+func GetStaff(id int64) (*Staff, error) {
+	staff, err := scanStaff(db.QueryRow(`SELECT `+staffColumns+` FROM staff WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: ID %d", ErrStaffNotFound, id)
+		}
+		return nil, fmt.Errorf("ошибка получения мастера: %w", err)
+	}
+
+	return &staff, nil
+}
+
+// ListStaff возвращает мастеров по имени. includeInactive добавляет уволенных
+func ListStaff(includeInactive bool) ([]Staff, error) {
+	query := `SELECT ` + staffColumns + ` FROM staff WHERE (? OR active) ORDER BY name, id`
+
+	rows, err := db.Query(query, includeInactive)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Staff
+	for rows.Next() {
+		staff, err := scanStaff(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования мастера: %w", err)
+		}
+		list = append(list, staff)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по мастерам: %w", err)
+	}
+
+	return list, nil
+}
+
+// UpdateStaff изменяет имя, пост по умолчанию или активность мастера
+func UpdateStaff(id int64, patch StaffPatch) (*Staff, error) {
+	staff, err := GetStaff(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.Name != nil {
+		staff.Name = strings.TrimSpace(*patch.Name)
+		if staff.Name == "" {
+			return nil, ErrStaffNameNeeded
+		}
+	}
+	switch {
+	case patch.ClearBay:
+		staff.Bay = nil
+	case patch.Bay != nil:
+		staff.Bay = patch.Bay
+	}
+	if patch.Active != nil {
+		staff.Active = *patch.Active
+	}
+
+	query := `
+        UPDATE staff SET name = ?, bay = ?, active = ?
+        WHERE id = ?
+        RETURNING ` + staffColumns
+
+	updated, err := scanStaff(db.QueryRow(query, staff.Name, staff.Bay, staff.Active, id))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка обновления мастера: %w", err)
+	}
+
+	return &updated, nil
+}
+
+// checkMechanic проверяет, что на мастера можно назначить запись
+func checkMechanic(id int64) error {
+	staff, err := GetStaff(id)
+	if err != nil {
+		return err
+	}
+	if !staff.Active {
+		return fmt.Errorf("%w: ID %d", ErrStaffInactive, id)
+	}
+	return nil
+}
+
+// workTimes возвращает время начала и окончания работ после перехода записи
+// в статус status. Повторный перевод в работу начинает отсчет заново, возврат
+// в ожидание сбрасывает оба времени
+func workTimes(before Record, status string, now time.Time) (startedAt, finishedAt *time.Time) {
+	startedAt, finishedAt = before.StartedAt, before.FinishedAt
+	if status == before.Status {
+		return startedAt, finishedAt
+	}
+
+	switch status {
+	case "in work":
+		startedAt, finishedAt = &now, nil
+	case "done":
+		finishedAt = &now
+	case "wait", "welcome":
+		startedAt, finishedAt = nil, nil
+	}
+
+	return startedAt, finishedAt
+}
+
+// GetMechanicJobs возвращает текущие работы мастера и назначенные ему записи
+// на сегодня и вперед, в порядке времени
+func GetMechanicJobs(mechanicID int64, now time.Time) (*MechanicJobs, error) {
+	if _, err := GetStaff(mechanicID); err != nil {
+		return nil, err
+	}
+
+	query := `
+        SELECT ` + recordColumns + `
+        FROM tire_service
+        WHERE mechanic_id = ?
+        AND (status IN ('welcome', 'in work') OR (status = 'wait' AND (record IS NULL OR record >= ?)))
+        ORDER BY COALESCE(started_at, record, date) ASC, id ASC`
+
+	rows, err := db.Query(query, mechanicID, startOfDay(now))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	records, err := scanRecords(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := &MechanicJobs{Current: []Record{}, Next: []Record{}}
+	for _, record := range records {
+		if record.Status == "wait" {
+			jobs.Next = append(jobs.Next, record)
+		} else {
+			jobs.Current = append(jobs.Current, record)
+		}
+	}
+
+	return jobs, nil
+}
+
+// GetWorkload возвращает загрузку мастеров: работы, завершенные в периоде
+// [from, to), и работы, которые сейчас в процессе. Учитываются и уволенные
+// мастера, если у них есть работы в периоде
+func GetWorkload(from, to time.Time) ([]Workload, error) {
+	query := `
+        SELECT s.id, s.name, s.bay, s.active, s.created_at,
+            COUNT(CASE WHEN t.status = 'done' AND t.finished_at >= ? AND t.finished_at < ? THEN 1 END),
+            COUNT(CASE WHEN t.status = 'in work' THEN 1 END),
+            SUM(CASE WHEN t.status = 'done' AND t.finished_at >= ? AND t.finished_at < ?
+                AND t.started_at IS NOT NULL
+                THEN (julianday(t.finished_at) - julianday(t.started_at)) * 1440 END),
+            COUNT(CASE WHEN t.status = 'done' AND t.finished_at >= ? AND t.finished_at < ?
+                AND t.started_at IS NOT NULL THEN 1 END)
+        FROM staff s
+        LEFT JOIN tire_service t ON t.mechanic_id = s.id
+        GROUP BY s.id
+        ORDER BY s.name, s.id`
+
+	rows, err := db.Query(query, from, to, from, to, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var workload []Workload
+	for rows.Next() {
+		var item Workload
+		var bay sql.NullInt64
+		var minutes sql.NullFloat64
+		var timed int
+
+		err := rows.Scan(&item.Staff.ID, &item.Staff.Name, &bay, &item.Staff.Active, &item.Staff.CreatedAt,
+			&item.Done, &item.InWork, &minutes, &timed)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования загрузки: %w", err)
+		}
+
+		if !item.Staff.Active && item.Done == 0 && item.InWork == 0 {
+			continue
+		}
+
+		if bay.Valid {
+			value := int(bay.Int64)
+			item.Staff.Bay = &value
+		}
+		if minutes.Valid {
+			item.Total = time.Duration(minutes.Float64 * float64(time.Minute)).Round(time.Minute)
+			if timed > 0 {
+				item.Average = (item.Total / time.Duration(timed)).Round(time.Minute)
+			}
+		}
+
+		workload = append(workload, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по загрузке: %w", err)
+	}
+
+	return workload, nil
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// timeFormat единый формат времени в базе: UTC с явным смещением +00:00.
+// Совпадает с форматом драйвера _time_format=sqlite, поэтому строки времени
+// можно сравнивать в запросах как текст
+const timeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// legacyTimeFormat формат time.Time.String(), в котором драйвер писал время
+// до включения _time_format=sqlite
+const legacyTimeFormat = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// sqliteTimeFormats форматы времени SQLite, без смещения время в UTC
+var sqliteTimeFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999Z",
+	"2006-01-02T15:04:05.999999999Z",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+}
+
+var sqliteDriver driver.Driver
+
+func init() {
+	// utc_time(value) приводит время, сохраненное в любом из прежних форматов, к timeFormat
+	sqlite.MustRegisterDeterministicScalarFunction("utc_time", 1,
+		func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			value, ok := args[0].(string)
+			if !ok {
+				return args[0], nil
+			}
+			if t, ok := parseStoredTime(value); ok {
+				return t.UTC().Format(timeFormat), nil
+			}
+			return value, nil
+		})
+
+	// Соединения открываются зарегистрированным драйвером, иначе в них не будет
+	// функций normalize_plate и utc_time
+	probe, err := sql.Open("sqlite", "")
+	if err != nil {
+		panic(err)
+	}
+	sqliteDriver = probe.Driver()
+	probe.Close()
+}
+
+// parseStoredTime разбирает время в формате time.Time.String() или SQLite
+func parseStoredTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if i := strings.Index(value, " m="); i > 0 {
+		value = value[:i] // показания монотонных часов из time.Now().String()
+	}
+
+	if t, err := time.Parse(legacyTimeFormat, value); err == nil {
+		return t, true
+	}
+	for _, format := range sqliteTimeFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// utcConnector открывает соединения, которые передают время в запросы в UTC.
+// Иначе время в местной зоне сохраняется со своим смещением и перестает
+// сравниваться как текст с временем в UTC
+type utcConnector struct {
+	name string
+}
+
+func (c utcConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := sqliteDriver.Open(c.name)
+	if err != nil {
+		return nil, err
+	}
+	return utcConn{conn.(sqliteConn)}, nil
+}
+
+func (c utcConnector) Driver() driver.Driver {
+	return sqliteDriver
+}
+
+// sqliteConn интерфейсы соединения драйвера, которые использует database/sql
+type sqliteConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+type utcConn struct {
+	sqliteConn
+}
+
+// CheckNamedValue приводит параметры запроса как database/sql по умолчанию и
+// переводит время в UTC
+func (utcConn) CheckNamedValue(nv *driver.NamedValue) error {
+	value, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	if t, ok := value.(time.Time); ok {
+		value = t.UTC()
+	}
+	nv.Value = value
+	return nil
+}
@@ -1,22 +1,94 @@
 package db
 
 import (
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
+	"unicode"
+
+	"modernc.org/sqlite"
 )
 
 var (
-	ErrTimeTooEarly   = errors.New("время записи раньше начала рабочего дня")
-	ErrTimeTooLate    = errors.New("время записи позже окончания рабочего дня")
-	ErrTimeNotAligned = errors.New("время записи не кратно интервалу")
-	ErrTimeTooClose   = errors.New("время записи слишком близко к текущему времени")
-	ErrTimeSlotTaken  = errors.New("время записи уже занято")
-	ErrInvalidTime    = errors.New("некорректное время записи")
+	ErrTimeTooEarly    = errors.New("время записи раньше начала рабочего дня")
+	ErrTimeTooLate     = errors.New("время записи позже окончания рабочего дня")
+	ErrTimeNotAligned  = errors.New("время записи не кратно интервалу")
+	ErrTimeTooClose    = errors.New("время записи слишком близко к текущему времени")
+	ErrTimeSlotTaken   = errors.New("время записи уже занято")
+	ErrInvalidTime     = errors.New("некорректное время записи")
+	ErrInvalidStatus   = errors.New("невалидный статус")
+	ErrRecordNotFound  = errors.New("запись не найдена")
+	ErrVersionConflict = errors.New("запись была изменена другим пользователем")
 )
 
+// validStatuses допустимые статусы записи
+var validStatuses = map[string]bool{
+	"wait":    true,
+	"welcome": true,
+	"in work": true,
+	"done":    true,
+	"cancel":  true,
+	"no_show": true,
+}
+
+// StatusLabels названия статусов для людей, как в админке
+var StatusLabels = map[string]string{
+	"wait":    "Ожидание",
+	"welcome": "Принят",
+	"in work": "В работе",
+	"done":    "Завершен",
+	"cancel":  "Отменен",
+	"no_show": "Не явился",
+}
+
+// IsValidStatus проверяет, что статус входит в список допустимых
+func IsValidStatus(status string) bool {
+	return validStatuses[status]
+}
+
+// plateLookalikes латинские буквы, совпадающие по начертанию с кириллицей в госномерах
+var plateLookalikes = map[rune]rune{
+	'A': 'А', 'B': 'В', 'E': 'Е', 'K': 'К', 'M': 'М', 'H': 'Н',
+	'O': 'О', 'P': 'Р', 'C': 'С', 'T': 'Т', 'Y': 'У', 'X': 'Х',
+}
+
+// NormalizePlate приводит госномер к единому виду: верхний регистр, кириллица,
+// без пробелов и разделителей ("a 123 bc-77" -> "А123ВС77")
+func NormalizePlate(plate string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(plate) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			continue
+		}
+		if cyrillic, ok := plateLookalikes[r]; ok {
+			r = cyrillic
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func init() {
+	// normalize_plate(title) позволяет искать по номеру в SQL независимо от написания
+	sqlite.MustRegisterDeterministicScalarFunction("normalize_plate", 1,
+		func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			plate, _ := args[0].(string)
+			return NormalizePlate(plate), nil
+		})
+}
+
 // ValidateRecordTime проверяет валидность времени записи
 func ValidateRecordTime(recordTime time.Time) error {
+	return checkRecordTimeIn(db, recordTime, 0, "")
+}
+
+// checkRecordTimeIn проверяет время записи, читая занятость через q, не считая
+// занятым слот записи excludeID (при переносе запись не конфликтует сама с собой)
+// и удержание holdToken, которое принадлежит самому клиенту. Внутри транзакции
+// видны и еще не зафиксированные ею записи
+func checkRecordTimeIn(q queryRower, recordTime time.Time, excludeID int64, holdToken string) error {
 	// Приводим к локальному времени и обнуляем секунды/наносекунды
 	recordTime = recordTime.Local().Truncate(time.Minute)
 	currentTime := time.Now().Local().Truncate(time.Minute)
@@ -46,7 +118,7 @@ func ValidateRecordTime(recordTime time.Time) error {
 	}
 
 	// 4. Проверка занятости времени
-	isTaken, err := IsTimeSlotTaken(recordTime)
+	isTaken, err := isTimeSlotTaken(q, recordTime, excludeID, holdToken)
 	if err != nil {
 		return fmt.Errorf("ошибка проверки занятости времени: %w", err)
 	}
@@ -60,21 +132,31 @@ func ValidateRecordTime(recordTime time.Time) error {
 
 // IsTimeSlotTaken проверяет, занято ли время
 func IsTimeSlotTaken(recordTime time.Time) (bool, error) {
+	return isTimeSlotTaken(db, recordTime, 0, "")
+}
+
+// isTimeSlotTaken проверяет, занято ли время другой записью, кроме excludeID,
+// или чужим действующим удержанием (свое удержание holdToken не мешает)
+func isTimeSlotTaken(q queryRower, recordTime time.Time, excludeID int64, holdToken string) (bool, error) {
 	// Рассчитываем границы интервала
 	intervalStart := recordTime
 	intervalEnd := recordTime.Add(time.Duration(Interval) * time.Minute)
 
 	query := `
         SELECT COUNT(*) FROM tire_service 
-        WHERE record BETWEEN ? AND ? 
+        WHERE record >= ? AND record < ?
         AND status = 'wait'
         AND id != ?` // исключаем текущую запись при обновлении
 
 	var count int
-	err := db.QueryRow(query, intervalStart, intervalEnd, 0).Scan(&count)
+	err := q.QueryRow(query, intervalStart, intervalEnd, excludeID).Scan(&count)
 	if err != nil {
 		return false, err
 	}
 
-	return count > 0, nil
+	if count > 0 {
+		return true, nil
+	}
+
+	return isSlotHeld(q, recordTime, holdToken)
 }
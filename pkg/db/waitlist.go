@@ -0,0 +1,430 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+	"tire-pepair-record-service/pkg/events"
+)
+
+var (
+	ErrInvalidWindow = errors.New("некорректное окно времени")
+	ErrNoOffer       = errors.New("нет действующего предложения")
+	ErrOfferExpired  = errors.New("срок предложения истек")
+)
+
+// Статусы заявки в листе ожидания
+const (
+	WaitlistWaiting   = "waiting"   // ждет освободившегося времени
+	WaitlistOffered   = "offered"   // клиенту предложено время
+	WaitlistClaimed   = "claimed"   // клиент записался на предложенное время
+	WaitlistExpired   = "expired"   // окно ожидания прошло
+	WaitlistCancelled = "cancelled" // клиент покинул лист ожидания
+)
+
+// WaitlistOfferTTL сколько клиент может думать над предложенным временем
+var WaitlistOfferTTL = 15 * time.Minute
+
+// WaitlistEntry заявка в листе ожидания
+type WaitlistEntry struct {
+	ID             int64
+	Title          string
+	Comment        string
+	Service        string
+	WindowStart    time.Time
+	WindowEnd      time.Time
+	Status         string
+	OfferSlot      *time.Time
+	OfferExpiresAt *time.Time
+	RecordID       *int64
+	HoldToken      string // удержание предложенного времени
+	AccessToken    string
+	CreatedAt      time.Time
+	Contacts       Contacts // контакты для уведомления о предложенном времени
+}
+
+const waitlistColumns = `id, title, comment, service, window_start, window_end, status,
+        offer_slot, offer_expires_at, record_id, IFNULL(hold_token, ''), access_token, created_at,
+        phone, email, telegram, lang`
+
+// SetWaitlistPolicy читает срок предложения из TODO_WAITLIST_OFFER_TTL (например 20m)
+func SetWaitlistPolicy(logger *log.Logger) {
+	if value := os.Getenv("TODO_WAITLIST_OFFER_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			logger.Printf("WARN: invalid waitlist offer TTL %s, is using %s\n", value, WaitlistOfferTTL)
+		} else {
+			WaitlistOfferTTL = ttl
+		}
+	}
+}
+
+func scanWaitlistEntry(row rowScanner) (WaitlistEntry, error) {
+	var entry WaitlistEntry
+	var offerSlot, offerExpiresAt sql.NullTime
+	var recordID sql.NullInt64
+
+	err := row.Scan(&entry.ID, &entry.Title, &entry.Comment, &entry.Service,
+		&entry.WindowStart, &entry.WindowEnd, &entry.Status,
+		&offerSlot, &offerExpiresAt, &recordID, &entry.HoldToken, &entry.AccessToken, &entry.CreatedAt,
+		&entry.Contacts.Phone, &entry.Contacts.Email, &entry.Contacts.Telegram, &entry.Contacts.Language)
+	if err != nil {
+		return entry, err
+	}
+
+	if offerSlot.Valid {
+		entry.OfferSlot = &offerSlot.Time
+	}
+	if offerExpiresAt.Valid {
+		entry.OfferExpiresAt = &offerExpiresAt.Time
+	}
+	if recordID.Valid {
+		entry.RecordID = &recordID.Int64
+	}
+
+	return entry, nil
+}
+
+// AddWaitlistEntry ставит клиента в лист ожидания на окно времени
+func AddWaitlistEntry(entry WaitlistEntry) (*WaitlistEntry, error) {
+	now := time.Now()
+	if !entry.WindowStart.Before(entry.WindowEnd) || !entry.WindowEnd.After(now) {
+		return nil, ErrInvalidWindow
+	}
+
+	if entry.Service == "" {
+		entry.Service = DefaultServiceType
+	}
+	if !IsValidService(entry.Service) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidService, entry.Service)
+	}
+
+	contacts, err := entry.Contacts.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := newAccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO waitlist (title, comment, service, window_start, window_end, status, access_token, created_at,
+            phone, email, telegram, lang)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        RETURNING ` + waitlistColumns
+
+	created, err := scanWaitlistEntry(db.QueryRow(query, entry.Title, entry.Comment, entry.Service,
+		entry.WindowStart, entry.WindowEnd, WaitlistWaiting, accessToken, now,
+		contacts.Phone, contacts.Email, contacts.Telegram, contacts.Language))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка добавления в лист ожидания: %w", err)
+	}
+
+	return &created, nil
+}
+
+// GetWaitlistEntry возвращает заявку по ID
+func GetWaitlistEntry(id int64) (*WaitlistEntry, error) {
+	query := `SELECT ` + waitlistColumns + ` FROM waitlist WHERE id = ?`
+
+	entry, err := scanWaitlistEntry(db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: ID %d", ErrRecordNotFound, id)
+		}
+		return nil, fmt.Errorf("ошибка получения заявки: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// GetWaitlistEntryByToken возвращает заявку по токену из ссылки клиента
+func GetWaitlistEntryByToken(token string) (*WaitlistEntry, error) {
+	if token == "" {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `SELECT ` + waitlistColumns + ` FROM waitlist WHERE access_token = ?`
+
+	entry, err := scanWaitlistEntry(db.QueryRow(query, token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRecordNotFound
+		}
+		return nil, fmt.Errorf("ошибка получения заявки: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// GetWaitlist возвращает заявки в порядке очереди. Пустой статус - действующие заявки
+func GetWaitlist(status string) ([]WaitlistEntry, error) {
+	query := `SELECT ` + waitlistColumns + ` FROM waitlist
+        WHERE status IN (?, ?)
+        ORDER BY created_at ASC, id ASC`
+	args := []any{WaitlistWaiting, WaitlistOffered}
+
+	if status != "" {
+		query = `SELECT ` + waitlistColumns + ` FROM waitlist
+            WHERE status = ?
+            ORDER BY created_at ASC, id ASC`
+		args = []any{status}
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []WaitlistEntry
+	for rows.Next() {
+		entry, err := scanWaitlistEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования заявки: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по заявкам: %w", err)
+	}
+
+	return entries, nil
+}
+
+// LeaveWaitlist снимает действующую заявку по токену. Предложенное заявке время
+// освобождается сразу, не дожидаясь конца удержания, и предлагается следующей
+// заявке так же, как время отмененной записи (событие WaitlistLeft)
+func LeaveWaitlist(token string) error {
+	entry, err := GetWaitlistEntryByToken(token)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Статус и удержание перечитываются в транзакции: предложение могло истечь
+	// или появиться после чтения заявки
+	current, err := scanWaitlistEntry(tx.QueryRow(`SELECT `+waitlistColumns+` FROM waitlist WHERE id = ?`, entry.ID))
+	if err != nil {
+		return fmt.Errorf("ошибка получения заявки: %w", err)
+	}
+	if current.Status != WaitlistWaiting && current.Status != WaitlistOffered {
+		return ErrNotModifiable
+	}
+
+	if _, err := tx.Exec(`UPDATE waitlist SET status = ? WHERE id = ?`, WaitlistCancelled, entry.ID); err != nil {
+		return fmt.Errorf("ошибка обновления заявки: %w", err)
+	}
+
+	var evs []events.Event
+	if current.Status == WaitlistOffered && current.HoldToken != "" {
+		if _, err := tx.Exec(`DELETE FROM slot_holds WHERE token = ?`, current.HoldToken); err != nil {
+			return fmt.Errorf("ошибка снятия удержания: %w", err)
+		}
+		evs = append(evs, events.Event{
+			Name:           events.WaitlistLeft,
+			WaitlistID:     entry.ID,
+			Status:         WaitlistCancelled,
+			PreviousStatus: WaitlistOffered,
+			PreviousRecord: current.OfferSlot,
+			At:             time.Now(),
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка обновления заявки: %w", err)
+	}
+
+	publish(evs)
+	return nil
+}
+
+// OfferSlot предлагает освободившееся время первой подходящей заявке и удерживает
+// его на срок предложения. Заявке не предлагается повторно время, от которого
+// она уже отказалась. Возвращает nil, если время занято или подходящих заявок нет
+func OfferSlot(slot time.Time, now time.Time) (*WaitlistEntry, error) {
+	slot = holdSlotTime(slot)
+	if err := ValidateRecordTime(slot); err != nil {
+		return nil, nil
+	}
+
+	var candidates int
+	err := db.QueryRow(`
+        SELECT COUNT(*) FROM waitlist
+        WHERE status = ? AND window_start <= ? AND window_end > ?
+        AND (offer_slot IS NULL OR offer_slot != ?)`,
+		WaitlistWaiting, slot, slot, slot).Scan(&candidates)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска заявок: %w", err)
+	}
+	if candidates == 0 {
+		return nil, nil
+	}
+
+	// Удержание не дает занять время, пока клиент решает
+	hold, err := HoldSlot(slot, WaitlistOfferTTL, "")
+	if err != nil {
+		if errors.Is(err, ErrTimeSlotTaken) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	entry, err := offerToEntry(slot, hold, now)
+	if err != nil {
+		ReleaseSlotHold(hold.Token)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// offerToEntry отдает удержанное время заявке и ставит уведомление о предложении
+// в очередь в одной транзакции
+func offerToEntry(slot time.Time, hold *SlotHold, now time.Time) (*WaitlistEntry, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        UPDATE waitlist
+        SET status = ?, offer_slot = ?, offer_expires_at = ?, hold_token = ?
+        WHERE id = (
+            SELECT id FROM waitlist
+            WHERE status = ? AND window_start <= ? AND window_end > ?
+            AND (offer_slot IS NULL OR offer_slot != ?)
+            ORDER BY created_at ASC, id ASC
+            LIMIT 1
+        )
+        RETURNING ` + waitlistColumns
+
+	entry, err := scanWaitlistEntry(tx.QueryRow(query, WaitlistOffered, slot, hold.ExpiresAt, hold.Token,
+		WaitlistWaiting, slot, slot, slot))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("ошибка предложения времени: %w", err)
+	}
+
+	if err := enqueueWaitlistOffer(tx, entry, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка предложения времени: %w", err)
+	}
+	return &entry, nil
+}
+
+// ExpireWaitlist возвращает просроченные предложения в ожидание и закрывает
+// заявки с прошедшим окном. Возвращает время из просроченных предложений,
+// которое можно предложить следующим
+func ExpireWaitlist(now time.Time) ([]time.Time, error) {
+	rows, err := db.Query(`
+        UPDATE waitlist
+        SET status = ?, offer_expires_at = NULL
+        WHERE status = ? AND offer_expires_at < ?
+        RETURNING offer_slot`, WaitlistWaiting, WaitlistOffered, now)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка истечения предложений: %w", err)
+	}
+
+	var slots []time.Time
+	for rows.Next() {
+		var slot time.Time
+		if err := rows.Scan(&slot); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка сканирования предложения: %w", err)
+		}
+		slots = append(slots, slot)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по предложениям: %w", err)
+	}
+
+	_, err = db.Exec(`UPDATE waitlist SET status = ? WHERE status = ? AND window_end < ?`,
+		WaitlistExpired, WaitlistWaiting, now)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка закрытия заявок: %w", err)
+	}
+
+	return slots, nil
+}
+
+// ClaimWaitlistOffer записывает клиента на предложенное время обычным путем
+// создания записи, со всеми проверками времени. Контакты из заявки переходят
+// в запись, чтобы клиент получал уведомления о ней. Запись создается и заявка
+// закрывается в одной транзакции: предложение не используется дважды
+func ClaimWaitlistOffer(token string, now time.Time) (*Record, error) {
+	entry, err := GetWaitlistEntryByToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Status != WaitlistOffered || entry.OfferSlot == nil {
+		return nil, ErrNoOffer
+	}
+	if entry.OfferExpiresAt != nil && entry.OfferExpiresAt.Before(now) {
+		return nil, ErrOfferExpired
+	}
+
+	record, err := prepareRecord(Record{
+		Title:    entry.Title,
+		Record:   entry.OfferSlot,
+		Comment:  entry.Comment,
+		Service:  entry.Service,
+		Status:   "wait",
+		Contacts: entry.Contacts,
+	}, entry.HoldToken)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created, evs, err := insertRecord(tx, record, entry.HoldToken, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Заявку могли снять или отдать ее время другой заявке после чтения
+	result, err := tx.Exec(`
+        UPDATE waitlist SET status = ?, record_id = ?, offer_expires_at = NULL
+        WHERE id = ? AND status = ? AND hold_token = ?`,
+		WaitlistClaimed, created.ID, entry.ID, WaitlistOffered, entry.HoldToken)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка обновления заявки: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, ErrNoOffer
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка обновления заявки: %w", err)
+	}
+
+	publish(evs)
+	return &created, nil
+}
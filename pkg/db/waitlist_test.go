@@ -0,0 +1,137 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"tire-pepair-record-service/pkg/events"
+)
+
+// offeredEntry ставит заявку с окном вокруг slot и предлагает ей это время
+func offeredEntry(t *testing.T, slot time.Time) *WaitlistEntry {
+	t.Helper()
+
+	entry, err := AddWaitlistEntry(WaitlistEntry{
+		Title:       "А123ВС77",
+		WindowStart: slot.Add(-time.Hour),
+		WindowEnd:   slot.Add(time.Hour),
+		Contacts:    Contacts{Phone: "+79991234567"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offered, err := OfferSlot(slot, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offered == nil || offered.ID != entry.ID {
+		t.Fatalf("offered to %+v, want entry %d", offered, entry.ID)
+	}
+	return offered
+}
+
+func countRecords(t *testing.T) int {
+	t.Helper()
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM tire_service`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestClaimWaitlistOffer(t *testing.T) {
+	setupDB(t)
+	slot := freeSlots(t, 1)[0]
+	entry := offeredEntry(t, slot)
+
+	record, err := ClaimWaitlistOffer(entry.AccessToken, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Record == nil || !record.Record.Equal(slot) || record.Contacts.Phone != "+79991234567" {
+		t.Errorf("record %+v, want a booking at %s with the entry contacts", record, slot)
+	}
+
+	claimed, err := GetWaitlistEntry(entry.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed.Status != WaitlistClaimed || claimed.RecordID == nil || *claimed.RecordID != record.ID {
+		t.Errorf("entry status %s, record %v; want claimed by record %d", claimed.Status, claimed.RecordID, record.ID)
+	}
+
+	// Предложение используется один раз
+	if _, err := ClaimWaitlistOffer(entry.AccessToken, time.Now()); !errors.Is(err, ErrNoOffer) {
+		t.Errorf("second claim: %v, want %v", err, ErrNoOffer)
+	}
+	if got := countRecords(t); got != 1 {
+		t.Errorf("%d records, want 1", got)
+	}
+}
+
+func TestClaimWaitlistOfferRollback(t *testing.T) {
+	setupDB(t)
+	slot := freeSlots(t, 1)[0]
+	entry := offeredEntry(t, slot)
+
+	// Ошибка при создании записи оставляет предложение действующим
+	saved := NotificationMessages
+	t.Cleanup(func() { NotificationMessages = saved })
+	NotificationMessages = func(events.Event, Record) ([]Notification, error) {
+		return nil, errors.New("template error")
+	}
+	if _, err := ClaimWaitlistOffer(entry.AccessToken, time.Now()); err == nil {
+		t.Fatal("claim succeeded although the record could not be saved")
+	}
+
+	current, err := GetWaitlistEntry(entry.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Status != WaitlistOffered || current.RecordID != nil {
+		t.Errorf("entry status %s, record %v; want still offered", current.Status, current.RecordID)
+	}
+	if got := countRecords(t); got != 0 {
+		t.Errorf("%d records, want 0", got)
+	}
+	if _, err := GetSlotHold(entry.HoldToken); err != nil {
+		t.Errorf("offer hold: %v", err)
+	}
+
+	NotificationMessages = saved
+	if _, err := ClaimWaitlistOffer(entry.AccessToken, time.Now()); err != nil {
+		t.Errorf("claim after the failure: %v", err)
+	}
+}
+
+func TestLeaveWaitlist(t *testing.T) {
+	setupDB(t)
+	slot := freeSlots(t, 1)[0]
+	entry := offeredEntry(t, slot)
+
+	if err := LeaveWaitlist(entry.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+
+	left, err := GetWaitlistEntry(entry.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left.Status != WaitlistCancelled {
+		t.Errorf("entry status %s, want %s", left.Status, WaitlistCancelled)
+	}
+
+	// Удержание снято вместе с заявкой: время снова свободно
+	if _, err := GetSlotHold(entry.HoldToken); !errors.Is(err, ErrHoldNotFound) {
+		t.Errorf("offer hold: %v, want %v", err, ErrHoldNotFound)
+	}
+	if err := ValidateRecordTime(slot); err != nil {
+		t.Errorf("slot after leaving: %v", err)
+	}
+
+	if err := LeaveWaitlist(entry.AccessToken); !errors.Is(err, ErrNotModifiable) {
+		t.Errorf("leaving twice: %v, want %v", err, ErrNotModifiable)
+	}
+}
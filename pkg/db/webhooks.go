@@ -0,0 +1,453 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"tire-pepair-record-service/pkg/events"
+)
+
+var (
+	ErrWebhookNotFound     = errors.New("вебхук не найден")
+	ErrInvalidWebhookURL   = errors.New("адрес вебхука должен быть абсолютным http(s) URL")
+	ErrInvalidWebhookEvent = errors.New("неизвестное событие вебхука")
+	ErrDeliveryNotFound    = errors.New("доставка вебхука не найдена")
+)
+
+// WebhookEvents события, на которые можно подписать вебхук. "*" - все события
+var WebhookEvents = []string{events.RecordCreated, events.RecordUpdated, events.RecordStatusChanged, events.RecordDeleted}
+
+// Webhook подписка внешней системы на события по записям
+type Webhook struct {
+	ID        int64
+	URL       string
+	Events    []string // имена событий или "*"
+	Secret    string   // ключ подписи HMAC-SHA256
+	Active    bool
+	CreatedAt time.Time
+}
+
+// Matches проверяет, подписан ли вебхук на событие
+func (w Webhook) Matches(event string) bool {
+	return w.Active && (slices.Contains(w.Events, "*") || slices.Contains(w.Events, event))
+}
+
+// WebhookPatch изменение вебхука: nil-поля не изменяются
+type WebhookPatch struct {
+	URL    *string
+	Events []string
+	Secret *string
+	Active *bool
+}
+
+// Статусы доставки
+const (
+	DeliveryPending   = "pending" // ожидает отправки или повторной попытки
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead" // попытки исчерпаны, доставка в списке недоставленных
+)
+
+// Delivery доставка события одному вебхуку
+type Delivery struct {
+	ID            int64
+	WebhookID     int64
+	Event         string
+	Payload       string // тело запроса, фиксируется при постановке в очередь
+	Status        string
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	DeliveredAt   *time.Time
+}
+
+// DeliveryAttempt запись журнала попыток доставки
+type DeliveryAttempt struct {
+	ID          int64
+	DeliveryID  int64
+	AttemptedAt time.Time
+	StatusCode  int // 0 - ответа не было
+	Error       string
+	Duration    time.Duration
+}
+
+// NewWebhookSecret генерирует ключ подписи
+func NewWebhookSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("ошибка генерации ключа: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// normalizeWebhook проверяет адрес и список событий
+func normalizeWebhook(webhook Webhook) (Webhook, error) {
+	webhook.URL = strings.TrimSpace(webhook.URL)
+	parsed, err := url.Parse(webhook.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return webhook, fmt.Errorf("%w: %s", ErrInvalidWebhookURL, webhook.URL)
+	}
+
+	if len(webhook.Events) == 0 {
+		webhook.Events = []string{"*"}
+	}
+	for _, event := range webhook.Events {
+		if event != "*" && !slices.Contains(WebhookEvents, event) {
+			return webhook, fmt.Errorf("%w: %s", ErrInvalidWebhookEvent, event)
+		}
+	}
+	slices.Sort(webhook.Events)
+	webhook.Events = slices.Compact(webhook.Events)
+
+	return webhook, nil
+}
+
+const webhookColumns = `id, url, events, secret, active, created_at`
+
+func scanWebhook(row rowScanner) (Webhook, error) {
+	var webhook Webhook
+	var eventList string
+
+	if err := row.Scan(&webhook.ID, &webhook.URL, &eventList, &webhook.Secret, &webhook.Active, &webhook.CreatedAt); err != nil {
+		return webhook, err
+	}
+	webhook.Events = strings.Split(eventList, ",")
+	return webhook, nil
+}
+
+// AddWebhook создает вебхук. Пустой ключ генерируется
+func AddWebhook(webhook Webhook, now time.Time) (*Webhook, error) {
+	webhook, err := normalizeWebhook(webhook)
+	if err != nil {
+		return nil, err
+	}
+
+	if webhook.Secret == "" {
+		if webhook.Secret, err = NewWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	created, err := scanWebhook(db.QueryRow(`
+        INSERT INTO webhooks (url, events, secret, active, created_at)
+        VALUES (?, ?, ?, 1, ?)
+        RETURNING `+webhookColumns,
+		webhook.URL, strings.Join(webhook.Events, ","), webhook.Secret, now))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка добавления вебхука: %w", err)
+	}
+	return &created, nil
+}
+
+// GetWebhook возвращает вебхук по ID
+func GetWebhook(id int64) (*Webhook, error) {
+	webhook, err := scanWebhook(db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: ID %d", ErrWebhookNotFound, id)
+		}
+		return nil, fmt.Errorf("ошибка получения вебхука: %w", err)
+	}
+	return &webhook, nil
+}
+
+// ListWebhooks возвращает все вебхуки
+func ListWebhooks() ([]Webhook, error) {
+	return listWebhooks(db)
+}
+
+// querier общий интерфейс *sql.DB и *sql.Tx для запросов с несколькими строками
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func listWebhooks(q querier) ([]Webhook, error) {
+	rows, err := q.Query(`SELECT ` + webhookColumns + ` FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования вебхука: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// UpdateWebhook изменяет адрес, события, ключ или активность вебхука
+func UpdateWebhook(id int64, patch WebhookPatch) (*Webhook, error) {
+	webhook, err := GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.URL != nil {
+		webhook.URL = *patch.URL
+	}
+	if patch.Events != nil {
+		webhook.Events = patch.Events
+	}
+	if patch.Active != nil {
+		webhook.Active = *patch.Active
+	}
+	if patch.Secret != nil {
+		webhook.Secret = *patch.Secret
+		if webhook.Secret == "" {
+			if webhook.Secret, err = NewWebhookSecret(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	normalized, err := normalizeWebhook(*webhook)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := scanWebhook(db.QueryRow(`
+        UPDATE webhooks SET url = ?, events = ?, secret = ?, active = ?
+        WHERE id = ?
+        RETURNING `+webhookColumns,
+		normalized.URL, strings.Join(normalized.Events, ","), normalized.Secret, normalized.Active, id))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка обновления вебхука: %w", err)
+	}
+	return &updated, nil
+}
+
+// DeleteWebhook удаляет вебхук вместе с доставками
+func DeleteWebhook(id int64) error {
+	result, err := db.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления вебхука: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("%w: ID %d", ErrWebhookNotFound, id)
+	}
+	return nil
+}
+
+const deliveryColumns = `id, webhook_id, event, payload, status, attempts, last_error, next_attempt_at, created_at, delivered_at`
+
+func scanDelivery(row rowScanner) (Delivery, error) {
+	var d Delivery
+	var deliveredAt sql.NullTime
+
+	err := row.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.LastError,
+		&d.NextAttemptAt, &d.CreatedAt, &deliveredAt)
+	if err != nil {
+		return d, err
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return d, nil
+}
+
+func scanDeliveries(rows *sql.Rows) ([]Delivery, error) {
+	deliveries := []Delivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования доставки: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// EnqueueDelivery ставит доставку события вебхуку в очередь
+func EnqueueDelivery(webhookID int64, event, payload string, now time.Time) (*Delivery, error) {
+	return insertDelivery(db, webhookID, event, payload, now)
+}
+
+func insertDelivery(q queryRower, webhookID int64, event, payload string, now time.Time) (*Delivery, error) {
+	d, err := scanDelivery(q.QueryRow(`
+        INSERT INTO webhook_deliveries (webhook_id, event, payload, next_attempt_at, created_at)
+        VALUES (?, ?, ?, ?, ?)
+        RETURNING `+deliveryColumns,
+		webhookID, event, payload, now, now))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка добавления доставки: %w", err)
+	}
+	return &d, nil
+}
+
+// GetDelivery возвращает доставку по ID
+func GetDelivery(id int64) (*Delivery, error) {
+	d, err := scanDelivery(db.QueryRow(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: ID %d", ErrDeliveryNotFound, id)
+		}
+		return nil, fmt.Errorf("ошибка получения доставки: %w", err)
+	}
+	return &d, nil
+}
+
+// DueDeliveries возвращает доставки вебхука (webhookID != 0 - только его), время
+// отправки которых наступило. Доставки отключенных вебхуков ждут, пока вебхук снова включат
+func DueDeliveries(webhookID int64, now time.Time, limit int) ([]Delivery, error) {
+	rows, err := db.Query(`
+        SELECT `+deliveryColumns+`
+        FROM webhook_deliveries
+        WHERE status = ? AND next_attempt_at <= ? AND (? = 0 OR webhook_id = ?)
+          AND webhook_id IN (SELECT id FROM webhooks WHERE active)
+        ORDER BY next_attempt_at, id
+        LIMIT ?`, DeliveryPending, now, webhookID, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения доставок: %w", err)
+	}
+	defer rows.Close()
+
+	return scanDeliveries(rows)
+}
+
+// ListDeliveries возвращает доставки вебхука (webhookID != 0) и/или со статусом,
+// новые первыми
+func ListDeliveries(webhookID int64, status string, limit int) ([]Delivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE 1 = 1`
+	var args []any
+	if webhookID != 0 {
+		query += ` AND webhook_id = ?`
+		args = append(args, webhookID)
+	}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения доставок: %w", err)
+	}
+	defer rows.Close()
+
+	return scanDeliveries(rows)
+}
+
+// RecordDeliveryAttempt записывает попытку в журнал и обновляет доставку: успех,
+// повтор в next или, если next = nil и попытка неудачна, перенос в недоставленные
+func RecordDeliveryAttempt(id int64, attempt DeliveryAttempt, delivered bool, next *time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+        INSERT INTO webhook_attempts (delivery_id, attempted_at, status_code, error, duration_ms)
+        VALUES (?, ?, ?, ?, ?)`,
+		id, attempt.AttemptedAt, attempt.StatusCode, attempt.Error, attempt.Duration.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("ошибка записи попытки доставки: %w", err)
+	}
+
+	switch {
+	case delivered:
+		_, err = tx.Exec(`
+            UPDATE webhook_deliveries SET status = ?, attempts = attempts + 1, last_error = '', delivered_at = ?
+            WHERE id = ?`, DeliveryDelivered, attempt.AttemptedAt, id)
+	case next != nil:
+		_, err = tx.Exec(`
+            UPDATE webhook_deliveries SET attempts = attempts + 1, last_error = ?, next_attempt_at = ?
+            WHERE id = ?`, attempt.Error, *next, id)
+	default:
+		_, err = tx.Exec(`
+            UPDATE webhook_deliveries SET status = ?, attempts = attempts + 1, last_error = ?
+            WHERE id = ?`, DeliveryDead, attempt.Error, id)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка обновления доставки: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// DeliveryAttempts возвращает журнал попыток доставки по порядку
+func DeliveryAttempts(deliveryID int64) ([]DeliveryAttempt, error) {
+	rows, err := db.Query(`
+        SELECT id, delivery_id, attempted_at, status_code, error, duration_ms
+        FROM webhook_attempts
+        WHERE delivery_id = ?
+        ORDER BY id`, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения попыток доставки: %w", err)
+	}
+	defer rows.Close()
+
+	attempts := []DeliveryAttempt{}
+	for rows.Next() {
+		var a DeliveryAttempt
+		var ms int64
+		if err := rows.Scan(&a.ID, &a.DeliveryID, &a.AttemptedAt, &a.StatusCode, &a.Error, &ms); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования попытки доставки: %w", err)
+		}
+		a.Duration = time.Duration(ms) * time.Millisecond
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// WebhookPayload собирает тело доставки по событию и состоянию записи
+// (nil для удаленной). Задается пакетом webhooks; пока не задан, изменения
+// записей в очередь доставки не попадают
+var WebhookPayload func(e events.Event, record *Record) (string, error)
+
+// enqueueWebhooks ставит события в очередь доставки подписанным вебхукам
+// в транзакции изменения записи: доставка создается тогда и только тогда,
+// когда изменение сохранено, а тело фиксирует запись на момент изменения
+func enqueueWebhooks(tx *sql.Tx, evs []events.Event, record *Record) error {
+	if WebhookPayload == nil {
+		return nil
+	}
+
+	webhooks, err := listWebhooks(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range evs {
+		var payload string
+		for _, webhook := range webhooks {
+			if !webhook.Matches(e.Name) {
+				continue
+			}
+			if payload == "" {
+				if payload, err = WebhookPayload(e, record); err != nil {
+					return fmt.Errorf("ошибка формирования тела вебхука: %w", err)
+				}
+			}
+			if _, err := insertDelivery(tx, webhook.ID, e.Name, payload, e.At); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Redeliver ставит в очередь новую доставку с тем же телом, что у доставки id.
+// Исходная доставка и ее журнал не меняются
+func Redeliver(id int64, now time.Time) (*Delivery, error) {
+	original, err := GetDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := GetWebhook(original.WebhookID); err != nil {
+		return nil, err
+	}
+	return EnqueueDelivery(original.WebhookID, original.Event, original.Payload, now)
+}
@@ -0,0 +1,456 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrWorkOrderNotFound = errors.New("заказ-наряд не найден")
+	ErrWorkOrderClosed   = errors.New("заказ-наряд закрыт для изменений")
+	ErrWorkOrderNotReady = errors.New("заказ-наряд нельзя закрыть")
+	ErrOrderLineNotFound = errors.New("строка заказ-наряда не найдена")
+	ErrInvalidOrderLine  = errors.New("некорректная строка заказ-наряда")
+	ErrInvalidPayment    = errors.New("неизвестный способ оплаты")
+)
+
+// Статусы заказ-наряда
+const (
+	WorkOrderDraft = "draft" // строки можно менять
+	WorkOrderFinal = "final" // итог зафиксирован, ожидает оплаты
+	WorkOrderPaid  = "paid"  // оплачен, изменения запрещены
+)
+
+// PaymentMethods способы оплаты заказ-наряда
+var PaymentMethods = map[string]string{
+	"cash":     "Наличные",
+	"card":     "Банковская карта",
+	"transfer": "Безналичный перевод",
+}
+
+// OrderLine строка заказ-наряда. Название, цена и ставка НДС копируются из
+// справочника при добавлении строки. Суммы в копейках, цены включают НДС
+type OrderLine struct {
+	ID       int64
+	Code     string
+	Kind     string
+	Name     string
+	Unit     string
+	Quantity int
+	Price    int64
+	Discount int64 // скидка на строку
+	VATRate  int
+
+	Amount int64 // Quantity * Price - Discount
+	VAT    int64 // НДС в составе Amount
+}
+
+// WorkOrder заказ-наряд по записи
+type WorkOrder struct {
+	ID          int64
+	RecordID    int64
+	Status      string
+	Payment     string
+	Lines       []OrderLine
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	FinalizedAt *time.Time
+	PaidAt      *time.Time
+
+	Subtotal int64 // сумма без скидок
+	Discount int64
+	Total    int64 // к оплате
+	VAT      int64 // НДС в составе Total
+}
+
+// OrderLineInput добавление или изменение строки. При изменении nil-поля
+// не меняются. DiscountPercent пересчитывается в копейки от суммы строки
+type OrderLineInput struct {
+	Code            string
+	Quantity        *int
+	Discount        *int64
+	DiscountPercent *int
+}
+
+// vatIncluded выделяет НДС из суммы с НДС с округлением до копейки
+func vatIncluded(amount int64, rate int) int64 {
+	if rate <= 0 || amount <= 0 {
+		return 0
+	}
+	divisor := int64(100 + rate)
+	return (amount*int64(rate)*2 + divisor) / (2 * divisor)
+}
+
+// computeTotals пересчитывает суммы строк и итоги заказ-наряда
+func (o *WorkOrder) computeTotals() {
+	o.Subtotal, o.Discount, o.Total, o.VAT = 0, 0, 0, 0
+	for i := range o.Lines {
+		line := &o.Lines[i]
+		line.Amount = int64(line.Quantity)*line.Price - line.Discount
+		line.VAT = vatIncluded(line.Amount, line.VATRate)
+
+		o.Subtotal += int64(line.Quantity) * line.Price
+		o.Discount += line.Discount
+		o.Total += line.Amount
+		o.VAT += line.VAT
+	}
+}
+
+// apply применяет изменения к строке и проверяет ее
+func (in OrderLineInput) apply(line *OrderLine) error {
+	if in.Quantity != nil {
+		line.Quantity = *in.Quantity
+	}
+	if line.Quantity <= 0 {
+		return fmt.Errorf("%w: количество должно быть положительным", ErrInvalidOrderLine)
+	}
+
+	gross := int64(line.Quantity) * line.Price
+	switch {
+	case in.DiscountPercent != nil:
+		if *in.DiscountPercent < 0 || *in.DiscountPercent > 100 {
+			return fmt.Errorf("%w: скидка %d%%", ErrInvalidOrderLine, *in.DiscountPercent)
+		}
+		line.Discount = (gross*int64(*in.DiscountPercent) + 50) / 100
+	case in.Discount != nil:
+		line.Discount = *in.Discount
+	}
+	if line.Discount < 0 || line.Discount > gross {
+		return fmt.Errorf("%w: скидка больше суммы строки", ErrInvalidOrderLine)
+	}
+
+	return nil
+}
+
+const workOrderColumns = `id, record_id, status, payment, created_at, updated_at, finalized_at, paid_at`
+
+const orderLineColumns = `id, code, kind, name, unit, quantity, price, discount, vat_rate`
+
+// scanWorkOrder читает заказ-наряд без строк, выбранный с колонками workOrderColumns
+func scanWorkOrder(row rowScanner) (WorkOrder, error) {
+	var order WorkOrder
+	var finalizedAt, paidAt sql.NullTime
+
+	err := row.Scan(&order.ID, &order.RecordID, &order.Status, &order.Payment, &order.CreatedAt, &order.UpdatedAt,
+		&finalizedAt, &paidAt)
+	if err != nil {
+		return order, err
+	}
+	if finalizedAt.Valid {
+		order.FinalizedAt = &finalizedAt.Time
+	}
+	if paidAt.Valid {
+		order.PaidAt = &paidAt.Time
+	}
+	order.Lines = []OrderLine{}
+	return order, nil
+}
+
+// scanOrderLine читает строку заказ-наряда, выбранную с колонками orderLineColumns
+func scanOrderLine(row rowScanner) (OrderLine, error) {
+	var line OrderLine
+	err := row.Scan(&line.ID, &line.Code, &line.Kind, &line.Name, &line.Unit,
+		&line.Quantity, &line.Price, &line.Discount, &line.VATRate)
+	return line, err
+}
+
+// GetWorkOrder возвращает заказ-наряд записи со строками и итогами
+func GetWorkOrder(recordID int64) (*WorkOrder, error) {
+	order, err := scanWorkOrder(db.QueryRow(`SELECT `+workOrderColumns+` FROM work_orders WHERE record_id = ?`, recordID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: запись %d", ErrWorkOrderNotFound, recordID)
+		}
+		return nil, fmt.Errorf("ошибка получения заказ-наряда: %w", err)
+	}
+
+	query := `
+        SELECT ` + orderLineColumns + `
+        FROM work_order_lines
+        WHERE order_id = ?
+        ORDER BY id`
+
+	rows, err := db.Query(query, order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		line, err := scanOrderLine(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования строки заказ-наряда: %w", err)
+		}
+		order.Lines = append(order.Lines, line)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по строкам заказ-наряда: %w", err)
+	}
+
+	order.computeTotals()
+	return &order, nil
+}
+
+// CreateWorkOrder открывает заказ-наряд по записи и добавляет в него работу
+// из записи. Если наряд уже есть, возвращает его и created = false
+func CreateWorkOrder(recordID int64, now time.Time) (order *WorkOrder, created bool, err error) {
+	record, err := GetRecordByID(recordID)
+	if err != nil {
+		return nil, false, err
+	}
+	if record.Status == "cancel" || record.Status == "no_show" {
+		return nil, false, fmt.Errorf("%w: запись в статусе %s", ErrNotModifiable, record.Status)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	var orderID int64
+	err = tx.QueryRow(`
+        INSERT INTO work_orders (record_id, status, created_at, updated_at)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT (record_id) DO NOTHING
+        RETURNING id`, recordID, WorkOrderDraft, now, now).Scan(&orderID)
+	if err == sql.ErrNoRows {
+		order, err := GetWorkOrder(recordID)
+		return order, false, err
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("ошибка создания заказ-наряда: %w", err)
+	}
+
+	if item, err := GetCatalogItem(record.Service); err == nil && item.Active {
+		line := OrderLine{Code: item.Code, Kind: item.Kind, Name: item.Name, Unit: item.Unit,
+			Quantity: 1, Price: item.Price, VATRate: item.VATRate}
+		if err := insertOrderLine(tx, orderID, line); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	order, err = GetWorkOrder(recordID)
+	return order, true, err
+}
+
+func insertOrderLine(tx *sql.Tx, orderID int64, line OrderLine) error {
+	_, err := tx.Exec(`
+        INSERT INTO work_order_lines (order_id, code, kind, name, unit, quantity, price, discount, vat_rate)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		orderID, line.Code, line.Kind, line.Name, line.Unit, line.Quantity, line.Price, line.Discount, line.VATRate)
+	if err != nil {
+		return fmt.Errorf("ошибка добавления строки заказ-наряда: %w", err)
+	}
+	return nil
+}
+
+// draftOrderID возвращает ID черновика заказ-наряда записи и отмечает его изменение
+func draftOrderID(tx *sql.Tx, recordID int64, now time.Time) (int64, error) {
+	var orderID int64
+	var status string
+
+	err := tx.QueryRow(`SELECT id, status FROM work_orders WHERE record_id = ?`, recordID).Scan(&orderID, &status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("%w: запись %d", ErrWorkOrderNotFound, recordID)
+		}
+		return 0, fmt.Errorf("ошибка получения заказ-наряда: %w", err)
+	}
+	if status != WorkOrderDraft {
+		return 0, fmt.Errorf("%w: статус %s", ErrWorkOrderClosed, status)
+	}
+
+	if _, err := tx.Exec(`UPDATE work_orders SET updated_at = ? WHERE id = ?`, now, orderID); err != nil {
+		return 0, fmt.Errorf("ошибка обновления заказ-наряда: %w", err)
+	}
+
+	return orderID, nil
+}
+
+// AddOrderLine добавляет в черновик заказ-наряда позицию справочника.
+// Количество по умолчанию 1
+func AddOrderLine(recordID int64, input OrderLineInput, now time.Time) (*WorkOrder, error) {
+	item, err := GetCatalogItem(input.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !item.Active {
+		return nil, fmt.Errorf("%w: позиция %s снята с продажи", ErrInvalidOrderLine, item.Code)
+	}
+
+	line := OrderLine{Code: item.Code, Kind: item.Kind, Name: item.Name, Unit: item.Unit,
+		Quantity: 1, Price: item.Price, VATRate: item.VATRate}
+	if err := input.apply(&line); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	orderID, err := draftOrderID(tx, recordID, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertOrderLine(tx, orderID, line); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return GetWorkOrder(recordID)
+}
+
+// UpdateOrderLine меняет количество или скидку строки черновика
+func UpdateOrderLine(recordID, lineID int64, input OrderLineInput, now time.Time) (*WorkOrder, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	orderID, err := draftOrderID(tx, recordID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var line OrderLine
+	err = tx.QueryRow(`SELECT quantity, price, discount FROM work_order_lines WHERE id = ? AND order_id = ?`,
+		lineID, orderID).Scan(&line.Quantity, &line.Price, &line.Discount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: ID %d", ErrOrderLineNotFound, lineID)
+		}
+		return nil, fmt.Errorf("ошибка получения строки заказ-наряда: %w", err)
+	}
+
+	if err := input.apply(&line); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE work_order_lines SET quantity = ?, discount = ? WHERE id = ?`,
+		line.Quantity, line.Discount, lineID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка обновления строки заказ-наряда: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return GetWorkOrder(recordID)
+}
+
+// RemoveOrderLine удаляет строку черновика
+func RemoveOrderLine(recordID, lineID int64, now time.Time) (*WorkOrder, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	orderID, err := draftOrderID(tx, recordID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`DELETE FROM work_order_lines WHERE id = ? AND order_id = ?`, lineID, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка удаления строки заказ-наряда: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("%w: ID %d", ErrOrderLineNotFound, lineID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return GetWorkOrder(recordID)
+}
+
+// FinalizeWorkOrder фиксирует итог заказ-наряда. Закрыть можно непустой
+// наряд по записи в статусе done
+func FinalizeWorkOrder(recordID int64, now time.Time) (*WorkOrder, error) {
+	order, err := GetWorkOrder(recordID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != WorkOrderDraft {
+		return nil, fmt.Errorf("%w: статус %s", ErrWorkOrderClosed, order.Status)
+	}
+	if len(order.Lines) == 0 {
+		return nil, fmt.Errorf("%w: нет строк", ErrWorkOrderNotReady)
+	}
+
+	record, err := GetRecordByID(recordID)
+	if err != nil {
+		return nil, err
+	}
+	if record.Status != "done" {
+		return nil, fmt.Errorf("%w: работы по записи не завершены", ErrWorkOrderNotReady)
+	}
+
+	result, err := db.Exec(`
+        UPDATE work_orders SET status = ?, finalized_at = ?, updated_at = ?
+        WHERE id = ? AND status = ?`, WorkOrderFinal, now, now, order.ID, WorkOrderDraft)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка закрытия заказ-наряда: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrWorkOrderClosed
+	}
+
+	return GetWorkOrder(recordID)
+}
+
+// LockWorkOrder отмечает оплату закрытого заказ-наряда. После оплаты наряд
+// и запись удалить нельзя
+func LockWorkOrder(recordID int64, payment string, now time.Time) (*WorkOrder, error) {
+	if _, ok := PaymentMethods[payment]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPayment, payment)
+	}
+
+	result, err := db.Exec(`
+        UPDATE work_orders SET status = ?, payment = ?, paid_at = ?, updated_at = ?
+        WHERE record_id = ? AND status = ?`, WorkOrderPaid, payment, now, now, recordID, WorkOrderFinal)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка оплаты заказ-наряда: %w", err)
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		order, err := GetWorkOrder(recordID)
+		if err != nil {
+			return nil, err
+		}
+		if order.Status == WorkOrderDraft {
+			return nil, fmt.Errorf("%w: итог не зафиксирован", ErrWorkOrderNotReady)
+		}
+		return nil, fmt.Errorf("%w: статус %s", ErrWorkOrderClosed, order.Status)
+	}
+
+	return GetWorkOrder(recordID)
+}
+
+// hasClosedWorkOrder сообщает, есть ли у записи закрытый заказ-наряд
+func hasClosedWorkOrder(recordID int64) (bool, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM work_orders WHERE record_id = ? AND status != ?`,
+		recordID, WorkOrderDraft).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения заказ-наряда: %w", err)
+	}
+	return count > 0, nil
+}
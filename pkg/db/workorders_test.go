@@ -0,0 +1,120 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVATIncluded(t *testing.T) {
+	for _, tt := range []struct {
+		amount int64
+		rate   int
+		want   int64
+	}{
+		{120000, 20, 20000},
+		{100, 20, 17}, // 16,67 -> 17
+		{3, 20, 1},    // ровно 0,5 округляется вверх
+		{1, 20, 0},    // 0,17 -> 0
+		{20000, 20, 3333},
+		{110, 10, 10},
+		{120000, 0, 0},
+		{-120000, 20, 0},
+		{0, 20, 0},
+	} {
+		if got := vatIncluded(tt.amount, tt.rate); got != tt.want {
+			t.Errorf("vatIncluded(%d, %d) = %d, want %d", tt.amount, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestComputeTotals(t *testing.T) {
+	order := WorkOrder{
+		Lines: []OrderLine{
+			{Quantity: 4, Price: 30000, VATRate: 20},
+			{Quantity: 4, Price: 45000, Discount: 18000, VATRate: 20},
+			{Quantity: 4, Price: 5000, VATRate: 20},
+			{Quantity: 1, Price: 50000, Discount: 5000}, // без НДС
+		},
+		// Итоги пересчитываются, а не накапливаются
+		Subtotal: 1, Discount: 1, Total: 1, VAT: 1,
+	}
+	order.computeTotals()
+
+	lines := []struct{ amount, vat int64 }{
+		{120000, 20000},
+		{162000, 27000},
+		{20000, 3333},
+		{45000, 0},
+	}
+	for i, want := range lines {
+		line := order.Lines[i]
+		if line.Amount != want.amount || line.VAT != want.vat {
+			t.Errorf("line %d: amount %d, VAT %d; want %d, %d", i, line.Amount, line.VAT, want.amount, want.vat)
+		}
+	}
+
+	if order.Subtotal != 370000 || order.Discount != 23000 || order.Total != 347000 || order.VAT != 50333 {
+		t.Errorf("totals: subtotal %d, discount %d, total %d, VAT %d; want 370000, 23000, 347000, 50333",
+			order.Subtotal, order.Discount, order.Total, order.VAT)
+	}
+
+	var empty WorkOrder
+	empty.computeTotals()
+	if empty.Subtotal != 0 || empty.Total != 0 || empty.VAT != 0 {
+		t.Errorf("empty order totals: %+v", empty)
+	}
+}
+
+func TestOrderLineInputApply(t *testing.T) {
+	intp := func(v int) *int { return &v }
+	int64p := func(v int64) *int64 { return &v }
+
+	for _, tt := range []struct {
+		name     string
+		line     OrderLine
+		in       OrderLineInput
+		quantity int
+		discount int64
+		invalid  bool
+	}{
+		{"unchanged", OrderLine{Quantity: 2, Price: 1000, Discount: 300}, OrderLineInput{}, 2, 300, false},
+		{"quantity", OrderLine{Quantity: 1, Price: 1000}, OrderLineInput{Quantity: intp(4)}, 4, 0, false},
+		{"zero quantity", OrderLine{Quantity: 1, Price: 1000}, OrderLineInput{Quantity: intp(0)}, 0, 0, true},
+		{"negative quantity", OrderLine{Quantity: 1, Price: 1000}, OrderLineInput{Quantity: intp(-1)}, 0, 0, true},
+		{"discount", OrderLine{Quantity: 2, Price: 1000}, OrderLineInput{Discount: int64p(500)}, 2, 500, false},
+		{"full discount", OrderLine{Quantity: 2, Price: 1000}, OrderLineInput{Discount: int64p(2000)}, 2, 2000, false},
+		{"discount over gross", OrderLine{Quantity: 2, Price: 1000}, OrderLineInput{Discount: int64p(2001)}, 0, 0, true},
+		{"negative discount", OrderLine{Quantity: 2, Price: 1000}, OrderLineInput{Discount: int64p(-1)}, 0, 0, true},
+		{"percent", OrderLine{Quantity: 4, Price: 45000}, OrderLineInput{DiscountPercent: intp(10)}, 4, 18000, false},
+		{"percent rounds half up", OrderLine{Quantity: 1, Price: 333}, OrderLineInput{DiscountPercent: intp(5)}, 1, 17, false},
+		{"percent rounds down", OrderLine{Quantity: 1, Price: 333}, OrderLineInput{DiscountPercent: intp(1)}, 1, 3, false},
+		{"percent 100", OrderLine{Quantity: 3, Price: 1000}, OrderLineInput{DiscountPercent: intp(100)}, 3, 3000, false},
+		{"percent 0 resets", OrderLine{Quantity: 3, Price: 1000, Discount: 500}, OrderLineInput{DiscountPercent: intp(0)}, 3, 0, false},
+		{"percent over 100", OrderLine{Quantity: 1, Price: 1000}, OrderLineInput{DiscountPercent: intp(101)}, 0, 0, true},
+		{"negative percent", OrderLine{Quantity: 1, Price: 1000}, OrderLineInput{DiscountPercent: intp(-1)}, 0, 0, true},
+		{"percent wins over discount", OrderLine{Quantity: 1, Price: 1000},
+			OrderLineInput{Discount: int64p(900), DiscountPercent: intp(10)}, 1, 100, false},
+		{"percent of new quantity", OrderLine{Quantity: 1, Price: 1000},
+			OrderLineInput{Quantity: intp(3), DiscountPercent: intp(50)}, 3, 1500, false},
+		// Уменьшение количества не оставляет скидку больше суммы строки
+		{"quantity below discount", OrderLine{Quantity: 4, Price: 1000, Discount: 2000},
+			OrderLineInput{Quantity: intp(1)}, 0, 0, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			line := tt.line
+			err := tt.in.apply(&line)
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidOrderLine) {
+					t.Fatalf("got %v, want ErrInvalidOrderLine", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line.Quantity != tt.quantity || line.Discount != tt.discount {
+				t.Errorf("quantity %d, discount %d; want %d, %d", line.Quantity, line.Discount, tt.quantity, tt.discount)
+			}
+		})
+	}
+}
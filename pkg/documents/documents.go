@@ -0,0 +1,271 @@
+package documents
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/pdf"
+)
+
+var (
+	ErrNoFont  = errors.New("не найден шрифт для печатных форм")
+	ErrNotPaid = errors.New("заказ-наряд не оплачен")
+)
+
+//go:embed templates/*.tpl
+var builtinTemplates embed.FS
+
+// Shop реквизиты шиномонтажа для шапки печатных форм
+type Shop struct {
+	Name    string
+	Address string
+	Phone   string
+	INN     string
+}
+
+// ShopInfo реквизиты, настраиваются переменными окружения в SetConfig
+var ShopInfo = Shop{Name: "Шиномонтаж"}
+
+// TemplatesDir каталог, в котором шиномонтаж может заменить шаблоны форм
+var TemplatesDir string
+
+// PublicURL адрес сервиса для клиентов (https://shina.example.ru), из него
+// строятся ссылки в печатных формах и QR-кодах
+var PublicURL string
+
+// fontPaths шрифты с кириллицей, которые ищутся, если шрифт не задан явно
+var fontPaths = [][2]string{
+	{"/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf", "/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf"},
+	{"/usr/share/fonts/dejavu/DejaVuSans.ttf", "/usr/share/fonts/dejavu/DejaVuSans-Bold.ttf"},
+	{"/usr/share/fonts/TTF/DejaVuSans.ttf", "/usr/share/fonts/TTF/DejaVuSans-Bold.ttf"},
+	{"C:\\Windows\\Fonts\\arial.ttf", "C:\\Windows\\Fonts\\arialbd.ttf"},
+}
+
+var fonts pdf.Fonts
+
+// SetConfig читает настройки печатных форм из окружения:
+// TODO_SHOP_NAME, TODO_SHOP_ADDRESS, TODO_SHOP_PHONE, TODO_SHOP_INN - реквизиты,
+// TODO_PDF_FONT и TODO_PDF_FONT_BOLD - файлы шрифтов TrueType с кириллицей,
+// TODO_TEMPLATES_DIR - каталог с измененными шаблонами (work_order.tpl, receipt.tpl),
+// TODO_PUBLIC_URL - адрес сервиса для клиентов
+func SetConfig(logger *log.Logger) {
+	if value := os.Getenv("TODO_SHOP_NAME"); value != "" {
+		ShopInfo.Name = value
+	}
+	ShopInfo.Address = os.Getenv("TODO_SHOP_ADDRESS")
+	ShopInfo.Phone = os.Getenv("TODO_SHOP_PHONE")
+	ShopInfo.INN = os.Getenv("TODO_SHOP_INN")
+	TemplatesDir = os.Getenv("TODO_TEMPLATES_DIR")
+	PublicURL = strings.TrimRight(os.Getenv("TODO_PUBLIC_URL"), "/")
+
+	candidates := fontPaths
+	if regular := os.Getenv("TODO_PDF_FONT"); regular != "" {
+		candidates = [][2]string{{regular, os.Getenv("TODO_PDF_FONT_BOLD")}}
+	}
+
+	for _, paths := range candidates {
+		regular, err := pdf.LoadFont(paths[0])
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logger.Printf("WARN: loading font error, %v\n", err)
+			}
+			continue
+		}
+
+		fonts = pdf.Fonts{Regular: regular}
+		if paths[1] != "" {
+			if bold, err := pdf.LoadFont(paths[1]); err == nil {
+				fonts.Bold = bold
+			} else {
+				logger.Printf("WARN: loading bold font error, %v\n", err)
+			}
+		}
+		logger.Printf("INFO: printable forms use font %s\n", regular.Name)
+		return
+	}
+
+	logger.Printf("WARN: no TrueType font found, set TODO_PDF_FONT to print work orders\n")
+}
+
+// loadTemplate возвращает шаблон из TemplatesDir или встроенный
+func loadTemplate(name string) (string, error) {
+	if TemplatesDir != "" {
+		data, err := os.ReadFile(filepath.Join(TemplatesDir, name))
+		if err == nil {
+			return string(data), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	data, err := builtinTemplates.ReadFile("templates/" + name)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// render заполняет шаблон формы и возвращает PDF
+func render(name, title string, data any) ([]byte, error) {
+	if fonts.Regular == nil {
+		return nil, ErrNoFont
+	}
+
+	source, err := loadTemplate(name)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения шаблона %s: %w", name, err)
+	}
+
+	doc, err := pdf.Execute(source, funcs, data, fonts)
+	if err != nil {
+		return nil, err
+	}
+	doc.Title = title
+	return doc.Bytes()
+}
+
+var funcs = template.FuncMap{
+	"money":    Money,
+	"date":     func(t time.Time) string { return t.Local().Format("02.01.2006") },
+	"datetime": func(t time.Time) string { return t.Local().Format("02.01.2006 15:04") },
+}
+
+// Money форматирует сумму в копейках: 226200 -> "2 262,00"
+func Money(kopecks int64) string {
+	sign := ""
+	if kopecks < 0 {
+		sign = "-"
+		kopecks = -kopecks
+	}
+
+	rubles := fmt.Sprintf("%d", kopecks/100)
+	var grouped strings.Builder
+	for i, digit := range rubles {
+		if i > 0 && (len(rubles)-i)%3 == 0 {
+			grouped.WriteByte(' ')
+		}
+		grouped.WriteRune(digit)
+	}
+
+	return fmt.Sprintf("%s%s,%02d", sign, grouped.String(), kopecks%100)
+}
+
+// clean готовит пользовательский текст к подстановке в разметку: одна строка
+// без разделителя ячеек
+func clean(s string) string {
+	s = strings.NewReplacer("|", "/", "\r", " ", "\n", " ").Replace(s)
+	return strings.TrimSpace(s)
+}
+
+// line строка заказ-наряда для шаблона
+type line struct {
+	N        int
+	Name     string
+	Unit     string
+	Quantity int
+	Price    int64
+	Discount int64
+	Amount   int64
+}
+
+// orderView данные шаблонов work_order.tpl и receipt.tpl
+type orderView struct {
+	Shop     Shop
+	Number   string
+	Date     time.Time
+	Ticket   string
+	Link     string // страница статуса записи для QR-кода
+	Plate    string
+	Comment  string
+	Mechanic string
+	Record   *time.Time // время предварительной записи
+	Started  *time.Time
+	Finished *time.Time
+
+	Services []line
+	Parts    []line
+	Subtotal int64
+	Discount int64
+	Total    int64
+	VAT      int64
+	Status   string
+	Payment  string
+	PaidAt   *time.Time
+}
+
+func newOrderView(record db.Record, order db.WorkOrder, ticket, link string, now time.Time) orderView {
+	view := orderView{
+		Shop: Shop{
+			Name:    clean(ShopInfo.Name),
+			Address: clean(ShopInfo.Address),
+			Phone:   clean(ShopInfo.Phone),
+			INN:     clean(ShopInfo.INN),
+		},
+		Number:   fmt.Sprintf("%06d", order.ID),
+		Date:     now,
+		Ticket:   ticket,
+		Link:     link,
+		Plate:    clean(record.Title),
+		Comment:  clean(record.Comment),
+		Record:   record.Record,
+		Started:  record.StartedAt,
+		Finished: record.FinishedAt,
+		Services: []line{},
+		Parts:    []line{},
+		Subtotal: order.Subtotal,
+		Discount: order.Discount,
+		Total:    order.Total,
+		VAT:      order.VAT,
+		Status:   order.Status,
+		Payment:  db.PaymentMethods[order.Payment],
+		PaidAt:   order.PaidAt,
+	}
+	if order.FinalizedAt != nil {
+		view.Date = *order.FinalizedAt
+	}
+
+	if record.MechanicID != nil {
+		if mechanic, err := db.GetStaff(*record.MechanicID); err == nil {
+			view.Mechanic = clean(mechanic.Name)
+		}
+	}
+
+	for _, l := range order.Lines {
+		item := line{Name: clean(l.Name), Unit: clean(l.Unit), Quantity: l.Quantity,
+			Price: l.Price, Discount: l.Discount, Amount: l.Amount}
+		if l.Kind == db.CatalogPart {
+			item.N = len(view.Parts) + 1
+			view.Parts = append(view.Parts, item)
+		} else {
+			item.N = len(view.Services) + 1
+			view.Services = append(view.Services, item)
+		}
+	}
+
+	return view
+}
+
+// WorkOrderPDF печатная форма заказ-наряда с подписями мастера и клиента.
+// link - полная ссылка на страницу статуса записи для QR-кода
+func WorkOrderPDF(record db.Record, order db.WorkOrder, ticket, link string, now time.Time) ([]byte, error) {
+	view := newOrderView(record, order, ticket, link, now)
+	return render("work_order.tpl", "Заказ-наряд № "+view.Number, view)
+}
+
+// ReceiptPDF товарный чек по оплаченному заказ-наряду
+func ReceiptPDF(record db.Record, order db.WorkOrder, ticket, link string, now time.Time) ([]byte, error) {
+	if order.Status != db.WorkOrderPaid {
+		return nil, ErrNotPaid
+	}
+
+	view := newOrderView(record, order, ticket, link, now)
+	return render("receipt.tpl", "Товарный чек № "+view.Number, view)
+}
@@ -0,0 +1,169 @@
+package documents
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/pdf"
+)
+
+// update перезаписывает эталоны: go test ./pkg/documents -update
+var update = flag.Bool("update", false, "перезаписать эталонные PDF в testdata")
+
+// setup задает шрифты из testdata, реквизиты и часовой пояс, от которых зависит PDF
+func setup(t *testing.T) {
+	t.Helper()
+
+	regular, err := pdf.LoadFont(filepath.Join("testdata", "font.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bold, err := pdf.LoadFont(filepath.Join("testdata", "font-bold.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	savedFonts, savedShop, savedDir, savedLocal := fonts, ShopInfo, TemplatesDir, time.Local
+	t.Cleanup(func() {
+		fonts, ShopInfo, TemplatesDir, time.Local = savedFonts, savedShop, savedDir, savedLocal
+	})
+
+	fonts = pdf.Fonts{Regular: regular, Bold: bold}
+	ShopInfo = Shop{
+		Name:    "Шиномонтаж «Колесо»",
+		Address: "г. Москва, ул. Шинная, д. 1",
+		Phone:   "+7 (495) 123-45-67",
+		INN:     "7701234567",
+	}
+	TemplatesDir = ""
+	time.Local = time.FixedZone("MSK", 3*60*60)
+}
+
+// testOrder запись с заказ-нарядом из работ и материалов со скидкой и НДС
+func testOrder(status string) (db.Record, db.WorkOrder) {
+	at := func(hour, minute int) *time.Time {
+		t := time.Date(2026, 3, 14, hour, minute, 0, 0, time.UTC)
+		return &t
+	}
+
+	record := db.Record{
+		ID:         42,
+		Title:      "А123ВС77",
+		Record:     at(7, 0),
+		Comment:    "Сезонная замена | R16\nхранение",
+		StartedAt:  at(7, 5),
+		FinishedAt: at(7, 50),
+	}
+
+	order := db.WorkOrder{
+		ID:       17,
+		RecordID: record.ID,
+		Status:   status,
+		Lines: []db.OrderLine{
+			{Kind: db.CatalogService, Name: "Снятие и установка колеса", Unit: "шт", Quantity: 4,
+				Price: 30000, Amount: 120000},
+			{Kind: db.CatalogService, Name: "Балансировка колеса R16 с грузиками и проверкой биения диска",
+				Unit: "шт", Quantity: 4, Price: 45000, Discount: 18000, Amount: 162000},
+			{Kind: db.CatalogPart, Name: "Вентиль TR414", Unit: "шт", Quantity: 4, Price: 5000, Amount: 20000},
+		},
+		FinalizedAt: at(7, 55),
+		Subtotal:    320000,
+		Discount:    18000,
+		Total:       302000,
+		VAT:         50333,
+	}
+	if status == db.WorkOrderPaid {
+		order.Payment = "card"
+		order.PaidAt = at(8, 0)
+	}
+
+	return record, order
+}
+
+// checkGolden сравнивает PDF с эталоном testdata/name
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (go test -update создаст эталон)", err)
+	}
+	if !bytes.Equal(got, want) {
+		out := filepath.Join(t.TempDir(), name)
+		os.WriteFile(out, got, 0o644)
+		t.Errorf("%s differs from golden file, got %d bytes, want %d; output saved to %s",
+			name, len(got), len(want), out)
+	}
+}
+
+func TestWorkOrderPDF(t *testing.T) {
+	setup(t)
+	record, order := testOrder(db.WorkOrderFinal)
+	now := time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)
+
+	got, err := WorkOrderPDF(record, order, "П042", "https://shina.example.ru/status.html?token=abc", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "work_order.pdf", got)
+
+	again, err := WorkOrderPDF(record, order, "П042", "https://shina.example.ru/status.html?token=abc", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, again) {
+		t.Error("work order PDF is not deterministic")
+	}
+}
+
+func TestReceiptPDF(t *testing.T) {
+	setup(t)
+	record, order := testOrder(db.WorkOrderPaid)
+	now := time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)
+
+	got, err := ReceiptPDF(record, order, "П042", "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "receipt.pdf", got)
+}
+
+func TestReceiptPDFRequiresPayment(t *testing.T) {
+	setup(t)
+	record, order := testOrder(db.WorkOrderFinal)
+
+	_, err := ReceiptPDF(record, order, "П042", "", time.Now())
+	if !errors.Is(err, ErrNotPaid) {
+		t.Fatalf("got %v, want ErrNotPaid", err)
+	}
+}
+
+func TestMoney(t *testing.T) {
+	for _, tt := range []struct {
+		kopecks int64
+		want    string
+	}{
+		{0, "0,00"},
+		{5, "0,05"},
+		{100, "1,00"},
+		{226200, "2 262,00"},
+		{100000000, "1 000 000,00"},
+		{-123456, "-1 234,56"},
+	} {
+		if got := Money(tt.kopecks); got != tt.want {
+			t.Errorf("Money(%d) = %q, want %q", tt.kopecks, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+# Товарный чек по оплаченному заказ-наряду. Чтобы изменить форму, скопируйте файл
+# в каталог TODO_TEMPLATES_DIR
+size 12
+center {{.Shop.Name}}
+size 9
+{{if .Shop.Address}}center {{.Shop.Address}}{{end}}
+{{if .Shop.INN}}center ИНН {{.Shop.INN}}{{end}}
+space 10
+size 13
+center Товарный чек № {{.Number}} от {{date .Date}}
+space 10
+
+size 10
+columns * 44:r 40:c 70:r 80:r
+header Наименование | Кол-во | Ед. | Цена | Сумма
+{{range .Services}}row {{.Name}} | {{.Quantity}} | {{.Unit}} | {{money .Price}} | {{money .Amount}}
+{{end}}
+{{range .Parts}}row {{.Name}} | {{.Quantity}} | {{.Unit}} | {{money .Price}} | {{money .Amount}}
+{{end}}
+
+hr
+columns * 100:r
+{{if .Discount}}row Скидка, руб.: | {{money .Discount}}{{end}}
+boldrow Итого, руб.: | {{money .Total}}
+{{if .VAT}}row В том числе НДС, руб.: | {{money .VAT}}{{else}}row Без НДС |{{end}}
+row Оплата: {{.Payment}} | {{if .PaidAt}}{{datetime .PaidAt}}{{end}}
+row Автомобиль: {{.Plate}} |
+
+space 24
+signatures Продавец
@@ -0,0 +1,60 @@
+# Заказ-наряд. Чтобы изменить форму, скопируйте файл в каталог TODO_TEMPLATES_DIR.
+# Команды разметки описаны у функции pdf.Execute, суммы в копейках выводит money
+size 13
+bold {{.Shop.Name}}
+size 9
+{{if .Shop.Address}}text {{.Shop.Address}}{{end}}
+{{if .Shop.Phone}}text Телефон: {{.Shop.Phone}}{{end}}
+{{if .Shop.INN}}text ИНН {{.Shop.INN}}{{end}}
+hr
+space 10
+size 14
+center Заказ-наряд № {{.Number}} от {{date .Date}}
+space 10
+
+size 10
+columns 150 *
+row Автомобиль (госномер) | {{.Plate}}
+row Талон | {{.Ticket}}
+{{if .Record}}row Время записи | {{datetime .Record}}{{end}}
+{{if .Mechanic}}row Мастер | {{.Mechanic}}{{end}}
+{{if .Started}}row Начало работ | {{datetime .Started}}{{end}}
+{{if .Finished}}row Окончание работ | {{datetime .Finished}}{{end}}
+{{if .Comment}}row Комментарий | {{.Comment}}{{end}}
+
+{{if .Services}}
+space 12
+bold Выполненные работы
+columns 24 * 44:r 40:c 70:r 60:r 80:r
+header № | Наименование | Кол-во | Ед. | Цена | Скидка | Сумма
+{{range .Services}}row {{.N}} | {{.Name}} | {{.Quantity}} | {{.Unit}} | {{money .Price}} | {{money .Discount}} | {{money .Amount}}
+{{end}}
+{{end}}
+
+{{if .Parts}}
+space 12
+bold Материалы
+columns 24 * 44:r 40:c 70:r 60:r 80:r
+header № | Наименование | Кол-во | Ед. | Цена | Скидка | Сумма
+{{range .Parts}}row {{.N}} | {{.Name}} | {{.Quantity}} | {{.Unit}} | {{money .Price}} | {{money .Discount}} | {{money .Amount}}
+{{end}}
+{{end}}
+
+space 8
+hr
+columns * 100:r
+row Сумма без скидки, руб.: | {{money .Subtotal}}
+{{if .Discount}}row Скидка, руб.: | {{money .Discount}}{{end}}
+boldrow Итого к оплате, руб.: | {{money .Total}}
+{{if .VAT}}row В том числе НДС, руб.: | {{money .VAT}}{{else}}row Без НДС |{{end}}
+
+space 16
+size 9
+text Работы выполнены полностью и в срок. Претензий по объему, качеству и срокам выполнения работ не имею.
+space 24
+signatures Мастер | Клиент
+{{if .Link}}
+space 12
+qr 72:r {{.Link}}
+right Статус заказа - по QR-коду
+{{end}}
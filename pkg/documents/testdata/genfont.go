@@ -0,0 +1,213 @@
+//go:build ignore
+
+// genfont создает шрифты TrueType для эталонных PDF в тестах: каждый символ -
+// прямоугольник своей ширины. Шрифт не зависит от шрифтов системы, поэтому
+// эталоны не меняются от машины к машине.
+//
+//	go run testdata/genfont.go
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"os"
+	"sort"
+	"unicode/utf16"
+)
+
+// runes символы шрифта: ASCII, кириллица и знаки из шаблонов форм
+var runes = func() []rune {
+	var list []rune
+	for r := rune(0x20); r <= 0x7E; r++ {
+		list = append(list, r)
+	}
+	for r := rune(0x0400); r <= 0x045F; r++ {
+		list = append(list, r)
+	}
+	return append(list, '№', '«', '»', '—', '–')
+}()
+
+func main() {
+	for _, font := range []struct {
+		file, name string
+		weight     int
+	}{
+		{"testdata/font.ttf", "TestSans", 0},
+		{"testdata/font-bold.ttf", "TestSans-Bold", 60},
+	} {
+		if err := os.WriteFile(font.file, build(font.name, font.weight), 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// advance ширина символа: разная для разных символов, чтобы перенос строк
+// и выравнивание в эталонах зависели от текста
+func advance(r rune, weight int) int {
+	if r == ' ' {
+		return 280
+	}
+	return 420 + int(r%7)*40 + weight
+}
+
+func build(name string, weight int) []byte {
+	numGlyphs := len(runes) + 1
+
+	hmtx := make([]byte, numGlyphs*4)
+	loca := make([]byte, (numGlyphs+1)*4)
+	var glyf []byte
+
+	box := func(glyph, width int) {
+		binary.BigEndian.PutUint16(hmtx[glyph*4:], uint16(width))
+		binary.BigEndian.PutUint16(hmtx[glyph*4+2:], 40)
+		binary.BigEndian.PutUint32(loca[glyph*4:], uint32(len(glyf)))
+		if width <= 300 {
+			return // пробел без контура
+		}
+		glyf = append(glyf, rectangle(40, 0, width-40, 700)...)
+	}
+
+	box(0, 500)
+	for i, r := range runes {
+		box(i+1, advance(r, weight))
+	}
+	binary.BigEndian.PutUint32(loca[numGlyphs*4:], uint32(len(glyf)))
+
+	head := make([]byte, 54)
+	binary.BigEndian.PutUint32(head[0:], 0x00010000)
+	binary.BigEndian.PutUint32(head[12:], 0x5F0F3CF5)
+	binary.BigEndian.PutUint16(head[18:], 1000) // unitsPerEm
+	binary.BigEndian.PutUint16(head[40:], 1000) // xMax
+	binary.BigEndian.PutUint16(head[42:], 800)  // yMax
+	binary.BigEndian.PutUint16(head[38:], 0xFF38)
+	binary.BigEndian.PutUint16(head[50:], 1) // длинный формат loca
+
+	hhea := make([]byte, 36)
+	binary.BigEndian.PutUint32(hhea[0:], 0x00010000)
+	binary.BigEndian.PutUint16(hhea[4:], 800)
+	binary.BigEndian.PutUint16(hhea[6:], 0xFF38) // -200
+	binary.BigEndian.PutUint16(hhea[10:], 1000)
+	binary.BigEndian.PutUint16(hhea[34:], uint16(numGlyphs))
+
+	maxp := make([]byte, 32)
+	binary.BigEndian.PutUint32(maxp[0:], 0x00010000)
+	binary.BigEndian.PutUint16(maxp[4:], uint16(numGlyphs))
+	binary.BigEndian.PutUint16(maxp[6:], 4) // maxPoints
+	binary.BigEndian.PutUint16(maxp[8:], 1) // maxContours
+
+	return font(map[string][]byte{
+		"head": head,
+		"hhea": hhea,
+		"maxp": maxp,
+		"hmtx": hmtx,
+		"loca": loca,
+		"glyf": glyf,
+		"cmap": cmap(),
+		"name": nameTable(name),
+	})
+}
+
+// rectangle простой глиф из одного контура в четыре точки
+func rectangle(x0, y0, x1, y1 int) []byte {
+	data := make([]byte, 10, 32)
+	binary.BigEndian.PutUint16(data[0:], 1)
+	binary.BigEndian.PutUint16(data[2:], uint16(x0))
+	binary.BigEndian.PutUint16(data[4:], uint16(y0))
+	binary.BigEndian.PutUint16(data[6:], uint16(x1))
+	binary.BigEndian.PutUint16(data[8:], uint16(y1))
+
+	data = binary.BigEndian.AppendUint16(data, 3) // последняя точка контура
+	data = binary.BigEndian.AppendUint16(data, 0) // без инструкций
+	data = append(data, 1, 1, 1, 1)               // все точки на контуре
+	for _, dx := range []int{x0, x1 - x0, 0, x0 - x1} {
+		data = binary.BigEndian.AppendUint16(data, uint16(int16(dx)))
+	}
+	for _, dy := range []int{y0, 0, y1 - y0, 0} {
+		data = binary.BigEndian.AppendUint16(data, uint16(int16(dy)))
+	}
+	for len(data)%4 != 0 {
+		data = append(data, 0)
+	}
+	return data
+}
+
+// cmap таблица символов формата 4: по сегменту на каждую серию символов,
+// идущих подряд, глифы нумеруются в порядке runes
+func cmap() []byte {
+	type segment struct{ start, end, glyph int }
+	var segments []segment
+	for i, r := range runes {
+		last := len(segments) - 1
+		if last >= 0 && segments[last].end+1 == int(r) && segments[last].glyph+int(r)-segments[last].start == i+1 {
+			segments[last].end = int(r)
+			continue
+		}
+		segments = append(segments, segment{int(r), int(r), i + 1})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].start < segments[j].start })
+	segments = append(segments, segment{0xFFFF, 0xFFFF, 1})
+
+	n := len(segments)
+	sub := make([]byte, 16+n*8)
+	binary.BigEndian.PutUint16(sub[0:], 4)
+	binary.BigEndian.PutUint16(sub[2:], uint16(len(sub)))
+	binary.BigEndian.PutUint16(sub[6:], uint16(n*2))
+	for i, s := range segments {
+		binary.BigEndian.PutUint16(sub[14+i*2:], uint16(s.end))
+		binary.BigEndian.PutUint16(sub[16+n*2+i*2:], uint16(s.start))
+		binary.BigEndian.PutUint16(sub[16+n*4+i*2:], uint16(s.glyph-s.start))
+	}
+
+	table := make([]byte, 12)
+	binary.BigEndian.PutUint16(table[2:], 1)
+	binary.BigEndian.PutUint16(table[4:], 3)
+	binary.BigEndian.PutUint16(table[6:], 1)
+	binary.BigEndian.PutUint32(table[8:], 12)
+	return append(table, sub...)
+}
+
+// nameTable таблица name с одним PostScript-именем
+func nameTable(name string) []byte {
+	var value []byte
+	for _, unit := range utf16.Encode([]rune(name)) {
+		value = binary.BigEndian.AppendUint16(value, unit)
+	}
+
+	table := make([]byte, 18)
+	binary.BigEndian.PutUint16(table[2:], 1)
+	binary.BigEndian.PutUint16(table[4:], 18)
+	binary.BigEndian.PutUint16(table[6:], 3)
+	binary.BigEndian.PutUint16(table[8:], 1)
+	binary.BigEndian.PutUint16(table[10:], 0x0409)
+	binary.BigEndian.PutUint16(table[12:], 6)
+	binary.BigEndian.PutUint16(table[14:], uint16(len(value)))
+	return append(table, value...)
+}
+
+// font записывает файл TrueType из таблиц
+func font(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	header := make([]byte, 12+16*len(tags))
+	binary.BigEndian.PutUint32(header, 0x00010000)
+	binary.BigEndian.PutUint16(header[4:], uint16(len(tags)))
+
+	var body []byte
+	for i, tag := range tags {
+		table := tables[tag]
+		record := header[12+i*16:]
+		copy(record, tag)
+		binary.BigEndian.PutUint32(record[8:], uint32(len(header)+len(body)))
+		binary.BigEndian.PutUint32(record[12:], uint32(len(table)))
+
+		body = append(body, table...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+	return append(header, body...)
+}
@@ -0,0 +1,141 @@
+// Package escpos формирует команды ESC/POS для чековых термопринтеров
+// и отправляет их на принтер
+package escpos
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// Команды ESC/POS
+const (
+	esc = 0x1b
+	gs  = 0x1d
+	lf  = 0x0a
+)
+
+// Выравнивание строк
+const (
+	AlignLeft   = 0
+	AlignCenter = 1
+	AlignRight  = 2
+)
+
+// CodePage866 номер кодовой страницы PC866 (кириллица) в командах ESC t
+// у принтеров, совместимых с Epson
+const CodePage866 = 17
+
+// Builder накапливает команды для одного документа
+type Builder struct {
+	buf bytes.Buffer
+}
+
+// New начинает документ: сброс настроек принтера и выбор кодовой страницы codePage
+func New(codePage byte) *Builder {
+	b := &Builder{}
+	b.buf.Write([]byte{esc, '@'})
+	b.buf.Write([]byte{esc, 't', codePage})
+	return b
+}
+
+// Align задает выравнивание следующих строк
+func (b *Builder) Align(align byte) *Builder {
+	b.buf.Write([]byte{esc, 'a', align})
+	return b
+}
+
+// Bold включает или выключает жирный шрифт
+func (b *Builder) Bold(on bool) *Builder {
+	b.buf.Write([]byte{esc, 'E', flag(on)})
+	return b
+}
+
+// Size задает увеличение символов по ширине и высоте, от 1 до 8
+func (b *Builder) Size(width, height int) *Builder {
+	width = min(max(width, 1), 8)
+	height = min(max(height, 1), 8)
+	b.buf.Write([]byte{gs, '!', byte((width-1)<<4 | (height - 1))})
+	return b
+}
+
+// Line печатает строку текста в кодировке CP866 и переводит строку
+func (b *Builder) Line(s string) *Builder {
+	b.buf.Write(EncodeCP866(s))
+	b.buf.WriteByte(lf)
+	return b
+}
+
+// Feed прогоняет бумагу на n строк
+func (b *Builder) Feed(n int) *Builder {
+	b.buf.Write([]byte{esc, 'd', byte(min(max(n, 0), 255))})
+	return b
+}
+
+// Image печатает черно-белое растровое изображение шириной width и высотой
+// height точек (команда GS v 0). dark сообщает, что точка (x, y) черная
+func (b *Builder) Image(width, height int, dark func(x, y int) bool) *Builder {
+	rowBytes := (width + 7) / 8
+	b.buf.Write([]byte{gs, 'v', '0', 0, byte(rowBytes), byte(rowBytes >> 8), byte(height), byte(height >> 8)})
+
+	row := make([]byte, rowBytes)
+	for y := 0; y < height; y++ {
+		clear(row)
+		for x := 0; x < width; x++ {
+			if dark(x, y) {
+				row[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		b.buf.Write(row)
+	}
+	b.buf.WriteByte(lf)
+	return b
+}
+
+// Cut прогоняет бумагу и отрезает чек с перемычкой
+func (b *Builder) Cut() *Builder {
+	b.buf.Write([]byte{gs, 'V', 66, 0})
+	return b
+}
+
+// Bytes возвращает накопленные команды
+func (b *Builder) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func flag(on bool) byte {
+	if on {
+		return 1
+	}
+	return 0
+}
+
+// cp866 символы за пределами ASCII и кириллицы, которые есть в кодовой странице
+var cp866 = map[rune]byte{
+	'Ё': 0xf0, 'ё': 0xf1, '°': 0xf8, '·': 0xfa, '№': 0xfc,
+	'—': '-', '–': '-', '«': '"', '»': '"', '\u00a0': ' ',
+}
+
+// EncodeCP866 перекодирует строку из UTF-8 в CP866. Символы, которых нет
+// в кодовой странице, заменяются на '?'
+func EncodeCP866(s string) []byte {
+	out := make([]byte, 0, utf8.RuneCountInString(s))
+	for _, r := range s {
+		switch {
+		case r < 0x80:
+			out = append(out, byte(r))
+		case r >= 'А' && r <= 'Я':
+			out = append(out, byte(0x80+r-'А'))
+		case r >= 'а' && r <= 'п':
+			out = append(out, byte(0xa0+r-'а'))
+		case r >= 'р' && r <= 'я':
+			out = append(out, byte(0xe0+r-'р'))
+		default:
+			if c, ok := cp866[r]; ok {
+				out = append(out, c)
+			} else {
+				out = append(out, '?')
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+package escpos
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	got := New(CodePage866).
+		Align(AlignCenter).
+		Bold(true).Line("№ 1").Bold(false).
+		Size(2, 3).Size(0, 9).
+		Feed(2).Feed(300).
+		Cut().
+		Bytes()
+
+	want := []byte{
+		esc, '@', // сброс
+		esc, 't', 17, // кодовая страница
+		esc, 'a', 1,
+		esc, 'E', 1, 0xfc, ' ', '1', lf, esc, 'E', 0,
+		gs, '!', 0x12, // ширина x2, высота x3
+		gs, '!', 0x07, // ширина и высота ограничены 1..8
+		esc, 'd', 2,
+		esc, 'd', 255,
+		gs, 'V', 66, 0,
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got  % x\nwant % x", got, want)
+	}
+}
+
+func TestImage(t *testing.T) {
+	// 10x2: первая строка - черная точка в начале каждого байта, вторая - последняя точка
+	got := New(0).Image(10, 2, func(x, y int) bool {
+		if y == 0 {
+			return x == 0 || x == 8
+		}
+		return x == 9
+	}).Bytes()
+
+	want := []byte{
+		esc, '@', esc, 't', 0,
+		gs, 'v', '0', 0, 2, 0, 2, 0, // 2 байта в строке, 2 строки
+		0x80, 0x80,
+		0x00, 0x40,
+		lf,
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got  % x\nwant % x", got, want)
+	}
+}
+
+func TestEncodeCP866(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want []byte
+	}{
+		{"AZ 09", []byte("AZ 09")},
+		{"АЯ", []byte{0x80, 0x9f}},
+		{"ап", []byte{0xa0, 0xaf}},
+		{"ря", []byte{0xe0, 0xef}},
+		{"Ёё№", []byte{0xf0, 0xf1, 0xfc}},
+		{"«А—Б»", []byte{'"', 0x80, '-', 0x81, '"'}},
+		{"€ї", []byte{'?', '?'}},
+	} {
+		if got := EncodeCP866(tt.in); !bytes.Equal(got, tt.want) {
+			t.Errorf("EncodeCP866(%q) = % x, want % x", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Package escpostest сетевой принтер ESC/POS для тестов пакетов, печатающих через escpos
+package escpostest
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// Printer принимает соединения на 127.0.0.1 так же, как принтер на порту 9100:
+// байты каждого соединения приходят после его закрытия
+type Printer struct {
+	// Address адрес host:port без схемы
+	Address  string
+	received chan []byte
+}
+
+// NewPrinter запускает принтер на случайном порту и останавливает его по окончании теста
+func NewPrinter(t testing.TB) *Printer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	printer := &Printer{Address: listener.Addr().String(), received: make(chan []byte, 4)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			data, _ := io.ReadAll(conn)
+			conn.Close()
+			printer.received <- data
+		}
+	}()
+
+	return printer
+}
+
+// Target адрес принтера для escpos.Printer: tcp://host:port
+func (p *Printer) Target() string {
+	return "tcp://" + p.Address
+}
+
+// Receive ждет следующий документ и возвращает его байты
+func (p *Printer) Receive(t testing.TB) []byte {
+	t.Helper()
+
+	select {
+	case data := <-p.received:
+		return data
+	case <-time.After(5 * time.Second):
+		t.Fatal("printer received nothing")
+		return nil
+	}
+}
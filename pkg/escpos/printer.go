@@ -0,0 +1,73 @@
+package escpos
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrPrinter = errors.New("принтер недоступен")
+
+// Время на подключение к сетевому принтеру и передачу документа
+const printerTimeout = 5 * time.Second
+
+// Printer принтер, на который отправляются документы. Адрес tcp://host:port
+// или host:port - сетевой принтер (обычно порт 9100), иначе путь к файлу или
+// устройству (/dev/usb/lp0)
+type Printer struct {
+	Target string
+	mu     sync.Mutex // документы не должны перемешиваться
+}
+
+// network возвращает адрес сетевого принтера или пустую строку для файла
+func (p *Printer) network() string {
+	if address, ok := strings.CutPrefix(p.Target, "tcp://"); ok {
+		return address
+	}
+	if strings.ContainsAny(p.Target, `/\`) {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(p.Target); err == nil {
+		return p.Target
+	}
+	return ""
+}
+
+// Print отправляет документ на принтер
+func (p *Printer) Print(data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if address := p.network(); address != "" {
+		conn, err := net.DialTimeout("tcp", address, printerTimeout)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrPrinter, err)
+		}
+		defer conn.Close()
+
+		if err := conn.SetDeadline(time.Now().Add(printerTimeout)); err != nil {
+			return fmt.Errorf("%w: %v", ErrPrinter, err)
+		}
+		if _, err := conn.Write(data); err != nil {
+			return fmt.Errorf("%w: %v", ErrPrinter, err)
+		}
+		return nil
+	}
+
+	file, err := os.OpenFile(p.Target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPrinter, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("%w: %v", ErrPrinter, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("%w: %v", ErrPrinter, err)
+	}
+	return nil
+}
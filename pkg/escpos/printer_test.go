@@ -0,0 +1,74 @@
+package escpos
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"tire-pepair-record-service/pkg/escpos/escpostest"
+)
+
+func TestPrintNetwork(t *testing.T) {
+	fake := escpostest.NewPrinter(t)
+	document := New(CodePage866).Line("Талон О001").Cut().Bytes()
+
+	for _, target := range []string{fake.Target(), fake.Address} {
+		printer := &Printer{Target: target}
+		if err := printer.Print(document); err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		if got := fake.Receive(t); !bytes.Equal(got, document) {
+			t.Errorf("%s: printer received % x, want % x", target, got, document)
+		}
+	}
+}
+
+func TestPrintNetworkUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	err = (&Printer{Target: address}).Print([]byte{esc, '@'})
+	if !errors.Is(err, ErrPrinter) {
+		t.Errorf("got %v, want ErrPrinter", err)
+	}
+}
+
+func TestPrintFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lp0")
+	printer := &Printer{Target: path}
+
+	for _, document := range [][]byte{{esc, '@', 'A', lf}, {esc, '@', 'B', lf}} {
+		if err := printer.Print(document); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{esc, '@', 'A', lf, esc, '@', 'B', lf}; !bytes.Equal(got, want) {
+		t.Errorf("file has % x, want % x", got, want)
+	}
+}
+
+func TestPrinterNetwork(t *testing.T) {
+	for target, want := range map[string]string{
+		"tcp://192.168.1.50:9100": "192.168.1.50:9100",
+		"192.168.1.50:9100":       "192.168.1.50:9100",
+		"printer.local:9100":      "printer.local:9100",
+		"/dev/usb/lp0":            "",
+		`C:\tickets\out.bin`:      "",
+		"tickets.bin":             "",
+	} {
+		if got := (&Printer{Target: target}).network(); got != want {
+			t.Errorf("network(%q) = %q, want %q", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Package events рассылает внутренние события об изменении записей
+// подписчикам (лист ожидания, уведомления и т.п.)
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Имена событий
+const (
+	RecordCreated       = "record.created"
+	RecordUpdated       = "record.updated"
+	RecordStatusChanged = "record.status_changed"
+	RecordDeleted       = "record.deleted"
+
+	WaitlistOffered = "waitlist.offered" // заявке из листа ожидания предложено время
+	WaitlistLeft    = "waitlist.left"    // клиент снял заявку, предложенное ей время освободилось
+)
+
+// Event событие по записи. Подписчик при необходимости читает запись по RecordID,
+// заявку листа ожидания - по WaitlistID
+type Event struct {
+	Name           string
+	RecordID       int64
+	WaitlistID     int64      // только для событий листа ожидания
+	Status         string     // статус после изменения
+	PreviousStatus string     // пусто, если прежний статус неизвестен
+	Record         *time.Time // время предварительной записи, nil для живой очереди
+	PreviousRecord *time.Time // время записи до изменения
+	At             time.Time
+}
+
+// Handler обработчик события
+type Handler func(Event)
+
+var (
+	mu          sync.RWMutex
+	subscribers = map[string][]Handler{}
+	logger      = log.Default()
+	wg          sync.WaitGroup
+)
+
+// SetLogger задает журнал для ошибок обработчиков
+func SetLogger(l *log.Logger) {
+	mu.Lock()
+	defer mu.Unlock()
+	logger = l
+}
+
+// Subscribe подписывает обработчик на событие name
+func Subscribe(name string, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	subscribers[name] = append(subscribers[name], handler)
+}
+
+// Publish асинхронно передает событие подписчикам, не задерживая операцию с записью
+func Publish(event Event) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	mu.RLock()
+	handlers := subscribers[event.Name]
+	l := logger
+	mu.RUnlock()
+
+	for _, handler := range handlers {
+		wg.Add(1)
+		go func(handler Handler) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					l.Printf("ERROR: %s handler panicked, %v", event.Name, r)
+				}
+			}()
+			handler(event)
+		}(handler)
+	}
+}
+
+// Wait дожидается завершения запущенных обработчиков, используется при остановке
+func Wait() {
+	wg.Wait()
+}
@@ -0,0 +1,131 @@
+// Package ical формирует календари iCalendar (RFC 5545) с записями для
+// подписки в календаре телефона и для кнопки "добавить в календарь"
+package ical
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType тип ответа с календарем
+const ContentType = "text/calendar; charset=utf-8"
+
+// maxLineOctets максимальная длина строки без перевода строки (RFC 5545, 3.1)
+const maxLineOctets = 75
+
+// Event событие календаря
+type Event struct {
+	UID         string    // постоянный идентификатор: по нему календарь находит событие при обновлении
+	Sequence    int64     // растет при каждом изменении события
+	Stamp       time.Time // время последнего изменения
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Cancelled   bool // отмененное событие остается в календаре со статусом CANCELLED
+}
+
+// Calendar набор событий
+type Calendar struct {
+	Name    string
+	Refresh time.Duration // как часто клиенту перечитывать подписку, 0 - не указывать
+	Events  []Event
+}
+
+// Bytes возвращает календарь в формате iCalendar
+func (c Calendar) Bytes() []byte {
+	var w writer
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:-//tire-pepair-record-service//RU")
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:PUBLISH")
+	if c.Name != "" {
+		w.line("X-WR-CALNAME:" + escape(c.Name))
+	}
+	if c.Refresh > 0 {
+		w.line("REFRESH-INTERVAL;VALUE=DURATION:" + duration(c.Refresh))
+		w.line("X-PUBLISHED-TTL:" + duration(c.Refresh))
+	}
+
+	for _, e := range c.Events {
+		w.line("BEGIN:VEVENT")
+		w.line("UID:" + escape(e.UID))
+		w.line("SEQUENCE:" + strconv.FormatInt(e.Sequence, 10))
+		w.line("DTSTAMP:" + utc(e.Stamp))
+		w.line("LAST-MODIFIED:" + utc(e.Stamp))
+		w.line("DTSTART:" + utc(e.Start))
+		w.line("DTEND:" + utc(e.End))
+		w.line("SUMMARY:" + escape(e.Summary))
+		if e.Description != "" {
+			w.line("DESCRIPTION:" + escape(e.Description))
+		}
+		if e.Location != "" {
+			w.line("LOCATION:" + escape(e.Location))
+		}
+		if e.URL != "" {
+			w.line("URL:" + e.URL)
+		}
+		if e.Cancelled {
+			w.line("STATUS:CANCELLED")
+		} else {
+			w.line("STATUS:CONFIRMED")
+		}
+		w.line("END:VEVENT")
+	}
+
+	w.line("END:VCALENDAR")
+	return w.buf.Bytes()
+}
+
+// writer пишет строки содержимого с переносом длинных строк
+type writer struct {
+	buf bytes.Buffer
+}
+
+// line пишет строку, перенося ее по 75 октетов без разрыва символов UTF-8.
+// Продолжение начинается с пробела
+func (w *writer) line(s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.buf.WriteString(s[:cut])
+		w.buf.WriteString("\r\n ")
+		s = s[cut:]
+		limit = maxLineOctets - 1 // пробел продолжения входит в длину
+	}
+	w.buf.WriteString(s)
+	w.buf.WriteString("\r\n")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// escape экранирует значение типа TEXT
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// utc форматирует время в UTC: 20261019T090000Z
+func utc(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// duration форматирует длительность: PT15M, PT1H
+func duration(d time.Duration) string {
+	result := "PT"
+	if h := int64(d / time.Hour); h > 0 {
+		result += strconv.FormatInt(h, 10) + "H"
+	}
+	if m := int64(d % time.Hour / time.Minute); m > 0 || result == "PT" {
+		result += strconv.FormatInt(m, 10) + "M"
+	}
+	return result
+}
@@ -0,0 +1,141 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// unfold склеивает перенесенные строки обратно (RFC 5545, 3.1)
+func unfold(data string) []string {
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(data, "\r\n ", ""), "\r\n"), "\r\n")
+}
+
+func TestLineFolding(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		line string
+	}{
+		{"short", "SUMMARY:А123ВС77"},
+		{"exactly 75 octets", "SUMMARY:" + strings.Repeat("x", 67)},
+		{"76 octets", "SUMMARY:" + strings.Repeat("x", 68)},
+		{"cyrillic", "DESCRIPTION:" + strings.Repeat("Сезонная замена колес с балансировкой, ", 6)},
+		// Двухбайтовые символы со сдвигом на один октет: граница переноса попадает внутрь символа
+		{"cyrillic odd offset", "X:" + strings.Repeat("ж", 100)},
+		{"four-byte runes", "X:" + strings.Repeat("🛞", 40)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var w writer
+			w.line(tt.line)
+			data := w.buf.String()
+
+			if !strings.HasSuffix(data, "\r\n") {
+				t.Fatalf("line does not end with CRLF: %q", data)
+			}
+			physical := strings.Split(strings.TrimSuffix(data, "\r\n"), "\r\n")
+			for i, line := range physical {
+				if len(line) > maxLineOctets {
+					t.Errorf("line %d is %d octets: %q", i, len(line), line)
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line %d splits a UTF-8 character: %q", i, line)
+				}
+				if i > 0 && !strings.HasPrefix(line, " ") {
+					t.Errorf("continuation line %d does not start with a space: %q", i, line)
+				}
+			}
+			if len(tt.line) <= maxLineOctets && len(physical) != 1 {
+				t.Errorf("line of %d octets folded into %d lines", len(tt.line), len(physical))
+			}
+
+			if got := unfold(data); len(got) != 1 || got[0] != tt.line {
+				t.Errorf("unfolded to %q, want %q", got, tt.line)
+			}
+		})
+	}
+}
+
+func TestEscape(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  string
+	}{
+		{"Замена колес", "Замена колес"},
+		{"шины, диски; колпаки", `шины\, диски\; колпаки`},
+		{`C:\шины`, `C:\\шины`},
+		{"строка 1\nстрока 2", `строка 1\nстрока 2`},
+		{"строка 1\r\nстрока 2", `строка 1\nстрока 2`},
+		{`\,`, `\\\,`},
+		{"", ""},
+	} {
+		if got := escape(tt.value); got != tt.want {
+			t.Errorf("escape(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	for _, tt := range []struct {
+		d    time.Duration
+		want string
+	}{
+		{15 * time.Minute, "PT15M"},
+		{time.Hour, "PT1H"},
+		{90 * time.Minute, "PT1H30M"},
+		{0, "PT0M"},
+	} {
+		if got := duration(tt.d); got != tt.want {
+			t.Errorf("duration(%s) = %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestCalendarBytes(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*60*60)
+	start := time.Date(2026, 10, 20, 12, 0, 0, 0, msk)
+	calendar := Calendar{
+		Name:    "Шиномонтаж, Ленина 1",
+		Refresh: 15 * time.Minute,
+		Events: []Event{{
+			UID:         "record-7@tire-pepair-record-service",
+			Sequence:    3,
+			Stamp:       time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+			Start:       start,
+			End:         start.Add(40 * time.Minute),
+			Summary:     "А123ВС77 - Сезонная замена колес",
+			Description: "Талон О007\nЗимняя резина; 4 шт",
+			URL:         "https://example.ru/s/abc",
+			Cancelled:   true,
+		}},
+	}
+
+	want := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//tire-pepair-record-service//RU",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		`X-WR-CALNAME:Шиномонтаж\, Ленина 1`,
+		"REFRESH-INTERVAL;VALUE=DURATION:PT15M",
+		"X-PUBLISHED-TTL:PT15M",
+		"BEGIN:VEVENT",
+		"UID:record-7@tire-pepair-record-service",
+		"SEQUENCE:3",
+		"DTSTAMP:20261019T090000Z",
+		"LAST-MODIFIED:20261019T090000Z",
+		"DTSTART:20261020T090000Z",
+		"DTEND:20261020T094000Z",
+		"SUMMARY:А123ВС77 - Сезонная замена колес",
+		`DESCRIPTION:Талон О007\nЗимняя резина\; 4 шт`,
+		"URL:https://example.ru/s/abc",
+		"STATUS:CANCELLED",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+
+	got := unfold(string(calendar.Bytes()))
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,197 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Каналы доставки
+const (
+	ChannelEmail    = "email"
+	ChannelSMS      = "sms"
+	ChannelTelegram = "telegram"
+)
+
+// Message сообщение одному получателю
+type Message struct {
+	Recipient string // адрес, телефон или чат - в зависимости от канала
+	Subject   string // используется только в письмах
+	Body      string
+}
+
+// Channel способ доставки уведомлений. Ошибка Send приводит к повторной попытке
+type Channel interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var (
+	channelsMu sync.RWMutex
+	channels   = map[string]Channel{}
+)
+
+// Register подключает канал name. Повторная регистрация заменяет канал
+func Register(name string, channel Channel) {
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+	channels[name] = channel
+}
+
+func channel(name string) Channel {
+	channelsMu.RLock()
+	defer channelsMu.RUnlock()
+	return channels[name]
+}
+
+// SMTP отправка писем через почтовый сервер
+type SMTP struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", s.From)
+	fmt.Fprintf(&body, "To: %s\r\n", msg.Recipient)
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	body.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	// net/smtp не принимает контекст, поэтому отправка идет в горутине
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(net.JoinHostPort(s.Host, s.Port), auth, s.From, []string{msg.Recipient}, body.Bytes())
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HTTPSMS отправка SMS через шлюз, принимающий POST с JSON {"to": "+7...", "text": "..."}
+type HTTPSMS struct {
+	URL   string
+	Token string // передается в заголовке Authorization: Bearer
+}
+
+func (s *HTTPSMS) Send(ctx context.Context, msg Message) error {
+	payload, err := json.Marshal(map[string]string{"to": msg.Recipient, "text": msg.Body})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	return doRequest(req)
+}
+
+// Telegram отправка сообщений ботом в чат клиента
+type Telegram struct {
+	Token  string
+	APIURL string // по умолчанию https://api.telegram.org
+}
+
+func (t *Telegram) Send(ctx context.Context, msg Message) error {
+	apiURL := t.APIURL
+	if apiURL == "" {
+		apiURL = "https://api.telegram.org"
+	}
+
+	payload, err := json.Marshal(map[string]string{"chat_id": msg.Recipient, "text": msg.Body})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimRight(apiURL, "/")+"/bot"+t.Token+"/sendMessage", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return doRequest(req)
+}
+
+// doRequest выполняет запрос к шлюзу, ответ не из 2xx считается ошибкой
+func doRequest(req *http.Request) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("шлюз ответил %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// Sent сообщение, принятое локальным приемником
+type Sent struct {
+	Channel string
+	Message
+}
+
+// Fake локальный приемник вместо настоящих каналов: сообщения пишутся в журнал
+// и хранятся в памяти. Включается TODO_NOTIFY_FAKE для разработки и проверки
+type Fake struct {
+	Name   string
+	Logger *log.Logger
+	Sink   *Sink
+}
+
+// Sink общее хранилище сообщений приемников Fake
+type Sink struct {
+	mu       sync.Mutex
+	messages []Sent
+}
+
+// Messages возвращает принятые сообщения
+func (s *Sink) Messages() []Sent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Sent(nil), s.messages...)
+}
+
+func (f *Fake) Send(ctx context.Context, msg Message) error {
+	f.Sink.mu.Lock()
+	defer f.Sink.mu.Unlock()
+
+	f.Sink.messages = append(f.Sink.messages, Sent{Channel: f.Name, Message: msg})
+	if f.Logger != nil {
+		f.Logger.Printf("INFO: [fake %s] to %s: %s", f.Name, msg.Recipient, strings.ReplaceAll(msg.Body, "\n", " / "))
+	}
+	return nil
+}
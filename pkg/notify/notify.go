@@ -0,0 +1,384 @@
+// Package notify уведомляет клиентов о записи по SMS, почте и в Telegram.
+// Сообщения сначала сохраняются в таблицу notifications и отправляются из нее
+// с повторными попытками, поэтому сбой канала не теряет уведомление
+package notify
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/documents"
+	"tire-pepair-record-service/pkg/events"
+	"tire-pepair-record-service/pkg/tickets"
+)
+
+// События, о которых сообщается клиенту. Имя события - имя шаблона
+const (
+	EventBooked  = "booked"  // предварительная запись создана
+	EventQueued  = "queued"  // машина поставлена в живую очередь
+	EventWelcome = "welcome" // клиента пригласили на пост
+	EventDone    = "done"    // работы завершены
+
+	EventReminder = "reminder" // напоминание о предварительной записи
+
+	EventWaitlistOffer = "waitlist_offer" // клиенту из листа ожидания предложено время
+)
+
+//go:embed templates/*.tpl
+var builtinTemplates embed.FS
+
+// Повторные попытки: задержка удваивается после каждой неудачи
+const (
+	firstRetryDelay = time.Minute
+	maxRetryDelay   = time.Hour
+	sendTimeout     = 15 * time.Second
+	dispatchBatch   = 50
+)
+
+// MaxAttempts число попыток доставки, после которого уведомление считается недоставленным
+var MaxAttempts = 5
+
+// SetConfig подключает каналы, настроенные в окружении:
+// TODO_SMTP_HOST, TODO_SMTP_PORT (587), TODO_SMTP_USER, TODO_SMTP_PASSWORD, TODO_SMTP_FROM - почта,
+// TODO_SMS_URL, TODO_SMS_TOKEN - HTTP-шлюз SMS,
+// TODO_TELEGRAM_TOKEN - бот Telegram,
+// TODO_NOTIFY_FAKE - вместо всех каналов писать сообщения в журнал,
+// TODO_NOTIFY_MAX_ATTEMPTS - число попыток доставки.
+// Настройки напоминаний см. setReminderConfig
+func SetConfig(logger *log.Logger) {
+	setReminderConfig(logger)
+
+	if value := os.Getenv("TODO_NOTIFY_MAX_ATTEMPTS"); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts < 1 {
+			logger.Printf("WARN: invalid notification attempts %s, is using %d\n", value, MaxAttempts)
+		} else {
+			MaxAttempts = attempts
+		}
+	}
+
+	if fake, _ := strconv.ParseBool(os.Getenv("TODO_NOTIFY_FAKE")); fake {
+		sink := &Sink{}
+		for _, name := range []string{ChannelEmail, ChannelSMS, ChannelTelegram} {
+			Register(name, &Fake{Name: name, Logger: logger, Sink: sink})
+		}
+		logger.Printf("INFO: notifications are written to the log instead of being sent\n")
+		return
+	}
+
+	if host := os.Getenv("TODO_SMTP_HOST"); host != "" {
+		port := os.Getenv("TODO_SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		Register(ChannelEmail, &SMTP{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("TODO_SMTP_USER"),
+			Password: os.Getenv("TODO_SMTP_PASSWORD"),
+			From:     os.Getenv("TODO_SMTP_FROM"),
+		})
+		logger.Printf("INFO: email notifications are sent via %s\n", host)
+	}
+
+	if url := os.Getenv("TODO_SMS_URL"); url != "" {
+		Register(ChannelSMS, &HTTPSMS{URL: url, Token: os.Getenv("TODO_SMS_TOKEN")})
+		logger.Printf("INFO: SMS notifications are sent via gateway\n")
+	}
+
+	if token := os.Getenv("TODO_TELEGRAM_TOKEN"); token != "" {
+		Register(ChannelTelegram, &Telegram{Token: token})
+		logger.Printf("INFO: Telegram notifications are enabled\n")
+	}
+}
+
+// view данные шаблонов уведомлений
+type view struct {
+	Shop   documents.Shop
+	Ticket string
+	Plate  string
+	Record time.Time // время предварительной записи, нулевое для живой очереди
+	Bay    int       // 0 - пост не назначен
+	Link   string    // страница статуса записи, если задан TODO_PUBLIC_URL
+
+	Expires time.Time // срок, до которого можно принять предложение из листа ожидания
+}
+
+var funcs = template.FuncMap{
+	"date":     func(t time.Time) string { return t.Local().Format("02.01.2006") },
+	"datetime": func(t time.Time) string { return t.Local().Format("02.01.2006 15:04") },
+	"time":     func(t time.Time) string { return t.Local().Format("15:04") },
+}
+
+// loadTemplate возвращает шаблон события на языке lang: из каталога
+// TODO_TEMPLATES_DIR/notify, встроенный или русский, если перевода нет
+func loadTemplate(event, lang string) (string, error) {
+	for _, name := range []string{event + "." + lang + ".tpl", event + ".ru.tpl"} {
+		if documents.TemplatesDir != "" {
+			data, err := os.ReadFile(filepath.Join(documents.TemplatesDir, "notify", name))
+			if err == nil {
+				return string(data), nil
+			}
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+
+		if data, err := builtinTemplates.ReadFile("templates/" + name); err == nil {
+			return string(data), nil
+		}
+	}
+	return "", fmt.Errorf("нет шаблона уведомления %s", event)
+}
+
+// Render заполняет шаблон события. Первая строка шаблона - тема письма, остальное - текст
+func Render(event string, record db.Record) (Message, error) {
+	data := view{
+		Shop:   documents.ShopInfo,
+		Ticket: tickets.Number(record.ID, record.Record),
+		Plate:  record.Title,
+	}
+	if record.Record != nil {
+		data.Record = record.Record.Local()
+	}
+	if record.Bay != nil {
+		data.Bay = *record.Bay
+	}
+	if documents.PublicURL != "" {
+		data.Link = documents.PublicURL + tickets.StatusPath(record.AccessToken)
+	}
+
+	return render(event, record.Contacts.Language, data)
+}
+
+// RenderWaitlistOffer заполняет шаблон предложения времени клиенту из листа ожидания
+func RenderWaitlistOffer(entry db.WaitlistEntry) (Message, error) {
+	data := view{
+		Shop:  documents.ShopInfo,
+		Plate: entry.Title,
+	}
+	if entry.OfferSlot != nil {
+		data.Record = entry.OfferSlot.Local()
+	}
+	if entry.OfferExpiresAt != nil {
+		data.Expires = entry.OfferExpiresAt.Local()
+	}
+	if documents.PublicURL != "" {
+		data.Link = documents.PublicURL + tickets.WaitlistPath(entry.AccessToken)
+	}
+
+	return render(EventWaitlistOffer, entry.Contacts.Language, data)
+}
+
+func render(event, lang string, data view) (Message, error) {
+	source, err := loadTemplate(event, lang)
+	if err != nil {
+		return Message{}, err
+	}
+
+	tpl, err := template.New(event).Funcs(funcs).Parse(source)
+	if err != nil {
+		return Message{}, fmt.Errorf("ошибка в шаблоне уведомления %s: %w", event, err)
+	}
+
+	var out bytes.Buffer
+	if err := tpl.Execute(&out, data); err != nil {
+		return Message{}, fmt.Errorf("ошибка в шаблоне уведомления %s: %w", event, err)
+	}
+
+	subject, body, _ := strings.Cut(strings.TrimSpace(out.String()), "\n")
+	return Message{Subject: strings.TrimSpace(subject), Body: strings.TrimSpace(body)}, nil
+}
+
+// recipients возвращает адресатов записи по подключенным каналам
+func recipients(contacts db.Contacts) map[string]string {
+	result := map[string]string{}
+	for name, recipient := range map[string]string{
+		ChannelEmail:    contacts.Email,
+		ChannelSMS:      contacts.Phone,
+		ChannelTelegram: contacts.Telegram,
+	} {
+		if recipient != "" && channel(name) != nil {
+			result[name] = recipient
+		}
+	}
+	return result
+}
+
+// Enqueue ставит уведомления о событии в очередь по всем каналам, для которых
+// у клиента есть контакт
+func Enqueue(event string, record db.Record, now time.Time) ([]db.Notification, error) {
+	messages, err := compose(event, record)
+	if err != nil {
+		return nil, err
+	}
+
+	var queued []db.Notification
+	for _, msg := range messages {
+		n, err := db.EnqueueNotification(msg, now)
+		if err != nil {
+			return queued, err
+		}
+		queued = append(queued, *n)
+	}
+	return queued, nil
+}
+
+// compose готовит уведомления о событии по всем каналам, для которых у клиента
+// есть контакт, не сохраняя их
+func compose(event string, record db.Record) ([]db.Notification, error) {
+	if len(recipients(record.Contacts)) == 0 {
+		return nil, nil
+	}
+
+	msg, err := Render(event, record)
+	if err != nil {
+		return nil, err
+	}
+	return address(db.Notification{RecordID: record.ID, Event: event}, record.Contacts, msg), nil
+}
+
+// address размножает сообщение по всем каналам, для которых у клиента есть контакт
+func address(base db.Notification, contacts db.Contacts, msg Message) []db.Notification {
+	targets := recipients(contacts)
+
+	var messages []db.Notification
+	for _, name := range []string{ChannelEmail, ChannelSMS, ChannelTelegram} {
+		recipient, ok := targets[name]
+		if !ok {
+			continue
+		}
+		n := base
+		n.Channel = name
+		n.Recipient = recipient
+		n.Subject = msg.Subject
+		n.Body = msg.Body
+		messages = append(messages, n)
+	}
+	return messages
+}
+
+// waitlistOfferMessages готовит уведомления о предложенном заявке времени, см. db.WaitlistOfferMessages
+func waitlistOfferMessages(entry db.WaitlistEntry) ([]db.Notification, error) {
+	if len(recipients(entry.Contacts)) == 0 {
+		return nil, nil
+	}
+
+	msg, err := RenderWaitlistOffer(entry)
+	if err != nil {
+		return nil, err
+	}
+	return address(db.Notification{WaitlistID: entry.ID, Event: EventWaitlistOffer}, entry.Contacts, msg), nil
+}
+
+// recordMessages готовит уведомления об изменении записи, см. db.NotificationMessages
+func recordMessages(e events.Event, record db.Record) ([]db.Notification, error) {
+	event := eventFor(e)
+	if event == "" {
+		return nil, nil
+	}
+	return compose(event, record)
+}
+
+// retryDelay задержка перед попыткой номер attempts+1
+func retryDelay(attempts int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// dispatchMu не дает одновременно отправлять одно уведомление из события и из планировщика
+var dispatchMu sync.Mutex
+
+// Dispatch отправляет уведомления, время которых наступило
+func Dispatch(now time.Time, logger *log.Logger) error {
+	dispatchMu.Lock()
+	defer dispatchMu.Unlock()
+
+	due, err := db.DueNotifications(now, dispatchBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range due {
+		err := send(n)
+		if err == nil {
+			if err := db.MarkNotificationSent(n.ID, time.Now()); err != nil {
+				return err
+			}
+			logger.Printf("INFO: notification %d (%s) sent via %s", n.ID, n.Event, n.Channel)
+			continue
+		}
+
+		var next *time.Time
+		if n.Attempts+1 < MaxAttempts {
+			at := time.Now().Add(retryDelay(n.Attempts + 1))
+			next = &at
+			logger.Printf("WARN: notification %d via %s failed, retry at %s, %v",
+				n.ID, n.Channel, at.Format(time.RFC3339), err)
+		} else {
+			logger.Printf("ERROR: notification %d via %s failed after %d attempts, %v",
+				n.ID, n.Channel, n.Attempts+1, err)
+		}
+		if err := db.MarkNotificationFailed(n.ID, err, next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func send(n db.Notification) error {
+	ch := channel(n.Channel)
+	if ch == nil {
+		return fmt.Errorf("канал %s не настроен", n.Channel)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	return ch.Send(ctx, Message{Recipient: n.Recipient, Subject: n.Subject, Body: n.Body})
+}
+
+// eventFor возвращает событие уведомления для изменения записи или пустую строку
+func eventFor(e events.Event) string {
+	switch {
+	case e.Name == events.RecordCreated && e.Record != nil:
+		return EventBooked
+	case e.Name == events.RecordCreated:
+		return EventQueued
+	case e.Name == events.RecordStatusChanged && e.Status == "welcome":
+		return EventWelcome
+	case e.Name == events.RecordStatusChanged && e.Status == "done":
+		return EventDone
+	}
+	return ""
+}
+
+// Subscribe включает постановку уведомлений в очередь при создании записи, смене
+// статуса и предложении времени из листа ожидания. Уведомления сохраняются в
+// транзакции изменения, а после события сразу отправляются, не дожидаясь планировщика
+func Subscribe(logger *log.Logger) {
+	db.NotificationMessages = recordMessages
+	db.WaitlistOfferMessages = waitlistOfferMessages
+
+	handler := func(e events.Event) {
+		if err := Dispatch(time.Now(), logger); err != nil {
+			logger.Printf("ERROR: sending notifications error, %v", err)
+		}
+	}
+
+	events.Subscribe(events.RecordCreated, handler)
+	events.Subscribe(events.RecordStatusChanged, handler)
+	events.Subscribe(events.WaitlistOffered, handler)
+}
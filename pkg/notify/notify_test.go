@@ -0,0 +1,506 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/documents"
+	"tire-pepair-record-service/pkg/events"
+)
+
+const link = "https://shina.example.ru/status.html?token=abc"
+
+// setup открывает пустую базу во временном каталоге и задает реквизиты,
+// часовой пояс и каналы, от которых зависят уведомления
+func setup(t *testing.T) {
+	t.Helper()
+
+	if err := db.Init(filepath.Join(t.TempDir(), "test.db"), log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.CloseDatabase)
+
+	savedShop, savedURL, savedDir, savedLocal := documents.ShopInfo, documents.PublicURL, documents.TemplatesDir, time.Local
+	savedChannels, savedAttempts := channels, MaxAttempts
+	t.Cleanup(func() {
+		documents.ShopInfo, documents.PublicURL, documents.TemplatesDir, time.Local = savedShop, savedURL, savedDir, savedLocal
+		channels, MaxAttempts = savedChannels, savedAttempts
+	})
+
+	documents.ShopInfo = documents.Shop{Name: "Колесо", Phone: "+7 495 123-45-67"}
+	documents.PublicURL = "https://shina.example.ru"
+	documents.TemplatesDir = ""
+	time.Local = time.FixedZone("MSK", 3*60*60)
+	channels = map[string]Channel{}
+}
+
+// testRecord предварительная запись на 14.03.2026 11:00 по Москве
+func testRecord(lang string) db.Record {
+	at := time.Date(2026, 3, 14, 8, 0, 0, 0, time.UTC)
+	bay := 2
+	return db.Record{
+		ID:          42,
+		Title:       "А123ВС77",
+		Record:      &at,
+		Bay:         &bay,
+		AccessToken: "abc",
+		Contacts:    db.Contacts{Phone: "+79991234567", Email: "ivan@example.ru", Telegram: "123456", Language: lang},
+	}
+}
+
+// failing канал, который не может доставить сообщение, пока задана ошибка
+type failing struct {
+	err   error
+	calls int
+}
+
+func (f *failing) Send(ctx context.Context, msg Message) error {
+	f.calls++
+	return f.err
+}
+
+func TestRender(t *testing.T) {
+	setup(t)
+
+	walkIn := testRecord("")
+	walkIn.ID, walkIn.Record, walkIn.Bay = 7, nil, nil
+
+	noBay := testRecord("ru")
+	noBay.Bay = nil
+
+	for _, tt := range []struct {
+		event   string
+		record  db.Record
+		subject string
+		body    string
+	}{
+		{EventBooked, testRecord("ru"), "Запись подтверждена - Колесо",
+			"Колесо: вы записаны на 14.03.2026 11:00, автомобиль А123ВС77, талон З042.\n" +
+				"Статус, перенос и отмена: " + link},
+		{EventBooked, testRecord("en"), "Booking confirmed - Колесо",
+			"Колесо: your booking for А123ВС77 is confirmed for 14.03.2026 11:00, ticket З042.\n" +
+				"Status, reschedule and cancel: " + link},
+		{EventQueued, walkIn, "Вы в очереди - Колесо",
+			"Колесо: автомобиль А123ВС77 в живой очереди, талон О007. Мы сообщим, когда подойдет ваша очередь.\n" +
+				"Место в очереди: " + link},
+		{EventQueued, func() db.Record { r := walkIn; r.Contacts.Language = "en"; return r }(),
+			"You are in the queue - Колесо",
+			"Колесо: А123ВС77 is in the walk-in queue, ticket О007. We will let you know when it is your turn.\n" +
+				"Queue position: " + link},
+		{EventWelcome, testRecord("ru"), "Ваша очередь - Колесо",
+			"Колесо: талон З042, ваша очередь подошла. Подъезжайте к посту 2."},
+		{EventWelcome, noBay, "Ваша очередь - Колесо",
+			"Колесо: талон З042, ваша очередь подошла. Подъезжайте к боксу."},
+		{EventWelcome, testRecord("en"), "It is your turn - Колесо",
+			"Колесо: ticket З042, it is your turn. Please drive to bay 2."},
+		{EventDone, testRecord("ru"), "Автомобиль готов - Колесо",
+			"Колесо: работы по автомобилю А123ВС77 завершены, можно забирать. Телефон: +7 495 123-45-67"},
+		{EventDone, testRecord("en"), "Your car is ready - Колесо",
+			"Колесо: work on А123ВС77 is finished, the car is ready for pickup. Phone: +7 495 123-45-67"},
+		{EventReminder, testRecord("ru"), "Напоминание о записи - Колесо",
+			"Колесо: напоминаем, вы записаны на 14.03.2026 11:00, автомобиль А123ВС77, талон З042. " +
+				"Не получается приехать - позвоните +7 495 123-45-67.\nПеренос и отмена: " + link},
+		{EventReminder, testRecord("en"), "Booking reminder - Колесо",
+			"Колесо: a reminder that А123ВС77 is booked for 14.03.2026 11:00, ticket З042. " +
+				"Can't make it? Call +7 495 123-45-67.\nReschedule or cancel: " + link},
+	} {
+		msg, err := Render(tt.event, tt.record)
+		if err != nil {
+			t.Fatalf("%s.%s: %v", tt.event, tt.record.Contacts.Language, err)
+		}
+		if msg.Subject != tt.subject || msg.Body != tt.body {
+			t.Errorf("%s.%s:\ngot  %q / %q\nwant %q / %q",
+				tt.event, tt.record.Contacts.Language, msg.Subject, msg.Body, tt.subject, tt.body)
+		}
+	}
+}
+
+func TestRenderWithoutPublicURL(t *testing.T) {
+	setup(t)
+	documents.PublicURL = ""
+
+	msg, err := Render(EventBooked, testRecord("ru"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Колесо: вы записаны на 14.03.2026 11:00, автомобиль А123ВС77, талон З042."; msg.Body != want {
+		t.Errorf("got %q, want %q", msg.Body, want)
+	}
+}
+
+func TestRenderTemplates(t *testing.T) {
+	setup(t)
+
+	// Шаблон из каталога заменяет встроенный, недостающий перевод берется русский
+	documents.TemplatesDir = t.TempDir()
+	os.Mkdir(filepath.Join(documents.TemplatesDir, "notify"), 0o755)
+	err := os.WriteFile(filepath.Join(documents.TemplatesDir, "notify", "done.en.tpl"),
+		[]byte("Ready\n{{.Plate}} is ready\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := Render(EventDone, testRecord("en"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Ready" || msg.Body != "А123ВС77 is ready" {
+		t.Errorf("custom template: got %q / %q", msg.Subject, msg.Body)
+	}
+
+	msg, err = Render(EventDone, testRecord("kk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Автомобиль готов - Колесо" {
+		t.Errorf("fallback to Russian: got %q", msg.Subject)
+	}
+
+	if _, err := Render("unknown", testRecord("ru")); err == nil {
+		t.Error("unknown event rendered without error")
+	}
+}
+
+func TestRenderWaitlistOffer(t *testing.T) {
+	setup(t)
+
+	slot := time.Date(2026, 3, 14, 8, 0, 0, 0, time.UTC)
+	expires := time.Date(2026, 3, 14, 7, 15, 0, 0, time.UTC)
+	entry := db.WaitlistEntry{
+		ID:             5,
+		Title:          "А123ВС77",
+		OfferSlot:      &slot,
+		OfferExpiresAt: &expires,
+		AccessToken:    "wl",
+	}
+	offerLink := "https://shina.example.ru/status.html?waitlist=wl"
+
+	for _, tt := range []struct {
+		lang    string
+		subject string
+		body    string
+	}{
+		{"ru", "Освободилось время - Колесо",
+			"Колесо: для автомобиля А123ВС77 освободилось время 14.03.2026 11:00. Подтвердите запись до 10:15, " +
+				"иначе время предложат следующему клиенту.\nПринять или отказаться: " + offerLink},
+		{"en", "A slot is available - Колесо",
+			"Колесо: a slot at 14.03.2026 11:00 is available for А123ВС77. Please confirm by 10:15, " +
+				"otherwise it will be offered to the next customer.\nAccept or decline: " + offerLink},
+	} {
+		entry.Contacts.Language = tt.lang
+		msg, err := RenderWaitlistOffer(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Subject != tt.subject || msg.Body != tt.body {
+			t.Errorf("%s:\ngot  %q / %q\nwant %q / %q", tt.lang, msg.Subject, msg.Body, tt.subject, tt.body)
+		}
+	}
+}
+
+func TestEnqueueAndDispatch(t *testing.T) {
+	setup(t)
+
+	// Telegram не подключен: уведомления уходят только почтой и SMS
+	sink := &Sink{}
+	Register(ChannelEmail, &Fake{Name: ChannelEmail, Sink: sink})
+	Register(ChannelSMS, &Fake{Name: ChannelSMS, Sink: sink})
+
+	now := time.Now()
+	queued, err := Enqueue(EventDone, testRecord("ru"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 2 || queued[0].Channel != ChannelEmail || queued[1].Channel != ChannelSMS {
+		t.Fatalf("queued %+v, want email and sms", queued)
+	}
+
+	if err := Dispatch(now, log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := sink.Messages()
+	if len(sent) != 2 {
+		t.Fatalf("sink received %d messages, want 2", len(sent))
+	}
+	for i, want := range []Sent{
+		{Channel: ChannelEmail, Message: Message{Recipient: "ivan@example.ru"}},
+		{Channel: ChannelSMS, Message: Message{Recipient: "+79991234567"}},
+	} {
+		if sent[i].Channel != want.Channel || sent[i].Recipient != want.Recipient ||
+			sent[i].Subject != "Автомобиль готов - Колесо" || sent[i].Body != queued[i].Body {
+			t.Errorf("message %d: %+v", i, sent[i])
+		}
+
+		n, err := db.GetNotification(queued[i].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Status != db.NotificationSent || n.Attempts != 1 || n.SentAt == nil {
+			t.Errorf("notification %d: status %s, attempts %d, sent at %v", n.ID, n.Status, n.Attempts, n.SentAt)
+		}
+	}
+
+	// Отправленные уведомления не отправляются повторно
+	if err := Dispatch(time.Now().Add(time.Hour), log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.Messages()) != 2 {
+		t.Errorf("sink received %d messages after second dispatch, want 2", len(sink.Messages()))
+	}
+}
+
+func TestEnqueueWithoutContacts(t *testing.T) {
+	setup(t)
+	Register(ChannelSMS, &Fake{Name: ChannelSMS, Sink: &Sink{}})
+
+	record := testRecord("ru")
+	record.Contacts = db.Contacts{Email: "ivan@example.ru"} // почта не подключена
+	queued, err := Enqueue(EventDone, record, time.Now())
+	if err != nil || len(queued) != 0 {
+		t.Fatalf("got %v, %v; want nothing queued", queued, err)
+	}
+
+	all, err := db.ListNotifications(0, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 0 {
+		t.Errorf("%d notifications stored, want 0", len(all))
+	}
+}
+
+func TestDispatchRetry(t *testing.T) {
+	setup(t)
+	MaxAttempts = 3
+	logger := log.New(io.Discard, "", 0)
+
+	gateway := &failing{err: errors.New("gateway down")}
+	Register(ChannelSMS, gateway)
+
+	record := testRecord("ru")
+	record.Contacts = db.Contacts{Phone: "+79991234567", Language: "ru"}
+	queued, err := Enqueue(EventDone, record, time.Now())
+	if err != nil || len(queued) != 1 {
+		t.Fatalf("got %v, %v; want one notification", queued, err)
+	}
+	id := queued[0].ID
+
+	// Каждая неудача откладывает попытку вдвое дольше, последняя закрывает уведомление
+	at := time.Now()
+	for attempt, delay := range []time.Duration{time.Minute, 2 * time.Minute, 0} {
+		before := time.Now()
+		if err := Dispatch(at, logger); err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := db.GetNotification(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Attempts != attempt+1 || n.LastError != "gateway down" {
+			t.Fatalf("attempt %d: attempts %d, last error %q", attempt+1, n.Attempts, n.LastError)
+		}
+
+		if delay == 0 {
+			if n.Status != db.NotificationFailed {
+				t.Fatalf("attempt %d: status %s, want failed", attempt+1, n.Status)
+			}
+			break
+		}
+		if n.Status != db.NotificationPending {
+			t.Fatalf("attempt %d: status %s, want pending", attempt+1, n.Status)
+		}
+		if n.NextAttemptAt.Before(before.Add(delay-time.Second)) || n.NextAttemptAt.After(time.Now().Add(delay+time.Second)) {
+			t.Errorf("attempt %d: next attempt at %s, want about %s later", attempt+1, n.NextAttemptAt, delay)
+		}
+
+		// До назначенного времени уведомление не отправляется
+		if err := Dispatch(n.NextAttemptAt.Add(-time.Second), logger); err != nil {
+			t.Fatal(err)
+		}
+		if gateway.calls != attempt+1 {
+			t.Fatalf("attempt %d: gateway called %d times before retry time", attempt+1, gateway.calls)
+		}
+		at = n.NextAttemptAt
+	}
+
+	if err := Dispatch(time.Now().Add(24*time.Hour), logger); err != nil {
+		t.Fatal(err)
+	}
+	if gateway.calls != 3 {
+		t.Errorf("gateway called %d times, want %d", gateway.calls, MaxAttempts)
+	}
+
+	// Ручной повтор возвращает уведомление в очередь со сброшенным счетчиком
+	gateway.err = nil
+	if _, err := db.RetryNotification(id, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := Dispatch(time.Now(), logger); err != nil {
+		t.Fatal(err)
+	}
+	n, err := db.GetNotification(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Status != db.NotificationSent || n.Attempts != 1 {
+		t.Errorf("after retry: status %s, attempts %d", n.Status, n.Attempts)
+	}
+}
+
+func TestDispatchUnknownChannel(t *testing.T) {
+	setup(t)
+
+	n, err := db.EnqueueNotification(db.Notification{RecordID: 42, Event: EventDone, Channel: ChannelTelegram,
+		Recipient: "123456", Body: "text"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Dispatch(time.Now(), log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.GetNotification(n.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != db.NotificationPending || got.Attempts != 1 || got.LastError == "" {
+		t.Errorf("status %s, attempts %d, last error %q; want a scheduled retry", got.Status, got.Attempts, got.LastError)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for _, tt := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour}, // 64 минуты ограничены часом
+		{100, time.Hour},
+	} {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// subscribeMessages подключает подготовку уведомлений к изменениям записей, как Subscribe
+func subscribeMessages(t *testing.T) {
+	t.Helper()
+
+	savedRecord, savedOffer := db.NotificationMessages, db.WaitlistOfferMessages
+	t.Cleanup(func() { db.NotificationMessages, db.WaitlistOfferMessages = savedRecord, savedOffer })
+	db.NotificationMessages, db.WaitlistOfferMessages = recordMessages, waitlistOfferMessages
+}
+
+// queuedEvents события уведомлений записи в порядке постановки в очередь
+func queuedEvents(t *testing.T, recordID int64) []string {
+	t.Helper()
+
+	notifications, err := db.ListNotifications(recordID, "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make([]string, len(notifications))
+	for i, n := range notifications {
+		events[len(notifications)-1-i] = n.Event
+	}
+	return events
+}
+
+func TestRecordChangesQueueNotifications(t *testing.T) {
+	setup(t)
+	subscribeMessages(t)
+	Register(ChannelSMS, &Fake{Name: ChannelSMS, Sink: &Sink{}})
+	time.Local = time.UTC // часы работы StartTime и FinishTime заданы в UTC
+	contacts := db.Contacts{Phone: "+79991234567"}
+
+	walkIn, err := db.AddRecord(db.Record{Title: "А123ВС77", Contacts: contacts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []string{"welcome", "in work", "done"} {
+		if err := db.UpdateRecordStatus(walkIn.ID, status, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := queuedEvents(t, walkIn.ID), []string{EventQueued, EventWelcome, EventDone}; !slices.Equal(got, want) {
+		t.Errorf("walk-in notifications %v, want %v", got, want)
+	}
+
+	slot, err := db.FindNextAvailable(time.Now().Add(db.MinLeadTime+time.Hour), time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	booked, err := db.AddRecord(db.Record{Title: "В456ОР77", Record: slot, Contacts: contacts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := queuedEvents(t, booked.ID), []string{EventBooked}; !slices.Equal(got, want) {
+		t.Errorf("booking notifications %v, want %v", got, want)
+	}
+
+	// Уведомления ставятся в очередь в транзакции записи: ошибка отменяет и изменение
+	db.NotificationMessages = func(events.Event, db.Record) ([]db.Notification, error) {
+		return nil, errors.New("template error")
+	}
+	if err := db.UpdateRecordStatus(booked.ID, "cancel", 0); err == nil {
+		t.Fatal("status changed although notifications could not be queued")
+	}
+	record, err := db.GetRecordByID(booked.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != "wait" {
+		t.Errorf("status %s after a failed change, want wait", record.Status)
+	}
+}
+
+func TestWaitlistOfferQueuesNotification(t *testing.T) {
+	setup(t)
+	subscribeMessages(t)
+	Register(ChannelSMS, &Fake{Name: ChannelSMS, Sink: &Sink{}})
+	time.Local = time.UTC // часы работы StartTime и FinishTime заданы в UTC
+
+	slot, err := db.FindNextAvailable(time.Now().Add(db.MinLeadTime+time.Hour), time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := db.AddWaitlistEntry(db.WaitlistEntry{
+		Title:       "А123ВС77",
+		WindowStart: slot.Add(-time.Hour),
+		WindowEnd:   slot.Add(time.Hour),
+		Contacts:    db.Contacts{Phone: "+79991234567"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offered, err := db.OfferSlot(*slot, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offered == nil || offered.ID != entry.ID {
+		t.Fatalf("offered to %+v, want entry %d", offered, entry.ID)
+	}
+
+	notifications, err := db.ListNotifications(0, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 1 || notifications[0].WaitlistID != entry.ID || notifications[0].Event != EventWaitlistOffer {
+		t.Errorf("notifications %+v, want one offer to entry %d", notifications, entry.ID)
+	}
+}
@@ -0,0 +1,145 @@
+package notify
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+)
+
+// ReminderOffsets за сколько до начала записи напоминать, по убыванию
+var ReminderOffsets = []time.Duration{24 * time.Hour, 2 * time.Hour}
+
+// quietHours время суток, когда напоминания не отправляются. Интервал может
+// переходить через полночь: 22:00-08:00
+type quietHours struct {
+	from, to time.Duration
+}
+
+// Quiet тихие часы по местному времени сервера
+var Quiet = quietHours{from: 22 * time.Hour, to: 8 * time.Hour}
+
+// contains проверяет, попадает ли t в тихие часы
+func (q quietHours) contains(t time.Time) bool {
+	if q.from == q.to {
+		return false
+	}
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if q.from < q.to {
+		return offset >= q.from && offset < q.to
+	}
+	return offset >= q.from || offset < q.to
+}
+
+// parseQuietHours разбирает интервал вида "22:00-08:00" или "13:00-14:00"
+func parseQuietHours(value string) (quietHours, error) {
+	if r, err := db.ParseDayRange(value); err == nil {
+		return quietHours{from: r.From, to: r.To}, nil
+	}
+
+	// Интервал через полночь - дополнение к дневному интервалу
+	from, to, _ := strings.Cut(value, "-")
+	r, err := db.ParseDayRange(to + "-" + from)
+	if err != nil {
+		return quietHours{}, err
+	}
+	return quietHours{from: r.To, to: r.From}, nil
+}
+
+// setReminderConfig читает настройки напоминаний из окружения:
+// TODO_REMINDERS - интервалы до начала записи через запятую (24h,2h), off - не напоминать,
+// TODO_QUIET_HOURS - тихие часы (22:00-08:00), off - напоминать в любое время
+func setReminderConfig(logger *log.Logger) {
+	if value := os.Getenv("TODO_REMINDERS"); value == "off" {
+		ReminderOffsets = nil
+	} else if value != "" {
+		var offsets []time.Duration
+		for _, part := range strings.Split(value, ",") {
+			offset, err := time.ParseDuration(strings.TrimSpace(part))
+			if err != nil || offset < time.Minute {
+				offsets = nil
+				break
+			}
+			offsets = append(offsets, offset)
+		}
+
+		if offsets == nil {
+			logger.Printf("WARN: invalid reminder offsets %s, is using %v\n", value, ReminderOffsets)
+		} else {
+			sort.Slice(offsets, func(i, j int) bool { return offsets[i] > offsets[j] })
+			ReminderOffsets = offsets
+		}
+	}
+
+	if value := os.Getenv("TODO_QUIET_HOURS"); value == "off" {
+		Quiet = quietHours{}
+	} else if value != "" {
+		quiet, err := parseQuietHours(value)
+		if err != nil {
+			logger.Printf("WARN: invalid quiet hours %s, is using default\n", value)
+		} else {
+			Quiet = quiet
+		}
+	}
+}
+
+// dueReminder выбирает напоминание, которое пора отправить: ближайшее к началу
+// записи из наступивших. Более ранние наступившие пропускаются - после простоя
+// сервера клиент получит одно напоминание, а не все сразу. Напоминания, время
+// которых прошло до того, как клиент записался, не отправляются
+func dueReminder(record db.Record, now time.Time) (offset time.Duration, skipped []time.Duration, ok bool) {
+	var due []time.Duration
+	for _, offset := range ReminderOffsets {
+		moment := record.Record.Add(-offset)
+		if !now.Before(moment) && record.Date.Before(moment) {
+			due = append(due, offset)
+		}
+	}
+
+	if len(due) == 0 {
+		return 0, nil, false
+	}
+	return due[len(due)-1], due[:len(due)-1], true
+}
+
+// Remind ставит в очередь напоминания о предварительных записях и отправляет их.
+// В тихие часы ничего не делает: напоминания уйдут, когда они закончатся
+func Remind(now time.Time, logger *log.Logger) error {
+	if len(ReminderOffsets) == 0 || Quiet.contains(now.Local()) {
+		return nil
+	}
+
+	records, err := db.ReminderCandidates(now, ReminderOffsets[0])
+	if err != nil {
+		return err
+	}
+
+	queued := 0
+	for _, record := range records {
+		offset, skipped, ok := dueReminder(record, now)
+		if !ok {
+			continue
+		}
+
+		messages, err := compose(EventReminder, record)
+		if err != nil {
+			return err
+		}
+
+		claimed, err := db.ClaimReminder(record, offset, skipped, messages, now)
+		if err != nil {
+			return err
+		}
+		if claimed {
+			queued += len(messages)
+			logger.Printf("INFO: %s reminder for record %d queued via %d channels", offset, record.ID, len(messages))
+		}
+	}
+
+	if queued == 0 {
+		return nil
+	}
+	return Dispatch(now, logger)
+}
@@ -0,0 +1,271 @@
+package notify
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+)
+
+// setupReminders включает напоминания за 24 и 2 часа с тихими часами 22:00-08:00
+// и отправку SMS в приемник
+func setupReminders(t *testing.T) *Sink {
+	t.Helper()
+	setup(t)
+
+	savedOffsets, savedQuiet := ReminderOffsets, Quiet
+	t.Cleanup(func() { ReminderOffsets, Quiet = savedOffsets, savedQuiet })
+	ReminderOffsets = []time.Duration{24 * time.Hour, 2 * time.Hour}
+	Quiet = quietHours{from: 22 * time.Hour, to: 8 * time.Hour}
+
+	sink := &Sink{}
+	Register(ChannelSMS, &Fake{Name: ChannelSMS, Sink: sink})
+	return sink
+}
+
+// msk время по Москве
+func msk(day, hour, minute int) time.Time {
+	return time.Date(2026, 3, day, hour, minute, 0, 0, time.FixedZone("MSK", 3*60*60))
+}
+
+// importRecord добавляет запись импортом: время записи и создания задаются явно
+func importRecord(t *testing.T, record db.Record, created time.Time) db.Record {
+	t.Helper()
+
+	record.Contacts = db.Contacts{Phone: "+79991234567", Language: "ru"}
+	result, err := db.ImportRecords([]db.ImportRow{{Line: 1, Record: record, Created: &created}},
+		db.ImportOptions{SkipTimeChecks: true}, created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Committed {
+		t.Fatalf("import not committed: %+v", result.Errors)
+	}
+
+	imported, err := db.GetRecordByID(result.IDs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *imported
+}
+
+// remind запускает Remind и возвращает число сообщений, полученных приемником всего
+func remind(t *testing.T, sink *Sink, now time.Time) int {
+	t.Helper()
+
+	if err := Remind(now, log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	return len(sink.Messages())
+}
+
+// reminderStates состояния напоминаний записи: смещение -> статус
+func reminderStates(t *testing.T, recordID int64) map[time.Duration]string {
+	t.Helper()
+
+	reminders, err := db.GetReminders(recordID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(map[time.Duration]string)
+	for _, r := range reminders {
+		states[r.Offset] = r.Status
+	}
+	return states
+}
+
+func TestRemindOncePerOffset(t *testing.T) {
+	sink := setupReminders(t)
+	at := msk(14, 11, 0)
+	record := importRecord(t, db.Record{Title: "А123ВС77", Record: &at}, msk(10, 12, 0))
+
+	if got := remind(t, sink, at.Add(-25*time.Hour)); got != 0 {
+		t.Fatalf("%d reminders before the 24h mark", got)
+	}
+	if got := remind(t, sink, at.Add(-24*time.Hour)); got != 1 {
+		t.Fatalf("%d reminders at the 24h mark, want 1", got)
+	}
+
+	// Состояние хранится в базе: повторные запуски, в том числе после
+	// перезапуска сервера, не ставят напоминание снова
+	for _, now := range []time.Time{at.Add(-24 * time.Hour), at.Add(-23 * time.Hour), at.Add(-3 * time.Hour)} {
+		if got := remind(t, sink, now); got != 1 {
+			t.Fatalf("%d reminders after a repeated run at %s, want 1", got, now)
+		}
+	}
+
+	if got := remind(t, sink, at.Add(-2*time.Hour)); got != 2 {
+		t.Fatalf("%d reminders at the 2h mark, want 2", got)
+	}
+	if got := remind(t, sink, at.Add(-time.Hour)); got != 2 {
+		t.Fatalf("%d reminders after a repeated run, want 2", got)
+	}
+
+	notifications, err := db.ListNotifications(record.ID, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 2 {
+		t.Errorf("%d notifications stored, want 2", len(notifications))
+	}
+	if states := reminderStates(t, record.ID); states[24*time.Hour] != db.ReminderSent || states[2*time.Hour] != db.ReminderSent {
+		t.Errorf("reminder states %v", states)
+	}
+}
+
+func TestRemindOverlappingOffsets(t *testing.T) {
+	sink := setupReminders(t)
+	missedAt, lateAt := msk(14, 11, 0), msk(14, 12, 0)
+
+	// Сервер не работал, пока наступили оба напоминания: уходит одно, ближайшее к записи
+	missed := importRecord(t, db.Record{Title: "А001АА77", Record: &missedAt}, msk(12, 12, 0))
+	// Записался позже отметки 24 часа: напоминание за сутки ему не положено
+	late := importRecord(t, db.Record{Title: "А002АА77", Record: &lateAt}, lateAt.Add(-21*time.Hour))
+
+	if got := remind(t, sink, msk(14, 10, 30)); got != 2 {
+		t.Fatalf("%d reminders sent, want one per record", got)
+	}
+	if got := remind(t, sink, msk(14, 10, 40)); got != 2 {
+		t.Fatalf("%d reminders after a repeated run, want 2", got)
+	}
+
+	if states := reminderStates(t, missed.ID); states[2*time.Hour] != db.ReminderSent || states[24*time.Hour] != db.ReminderSkipped {
+		t.Errorf("missed record reminder states %v, want 2h sent and 24h skipped", states)
+	}
+	if states := reminderStates(t, late.ID); len(states) != 1 || states[2*time.Hour] != db.ReminderSent {
+		t.Errorf("late record reminder states %v, want only 2h sent", states)
+	}
+}
+
+func TestRemindSkipsClosedAndArrived(t *testing.T) {
+	sink := setupReminders(t)
+	at := msk(14, 11, 0)
+
+	for _, status := range []string{"cancel", "welcome", "in work", "done", "no_show"} {
+		importRecord(t, db.Record{Title: "А123ВС77", Record: &at, Status: status}, msk(10, 12, 0))
+	}
+	importRecord(t, db.Record{Title: "А456ВС77"}, msk(13, 10, 0)) // живая очередь
+
+	if got := remind(t, sink, at.Add(-2*time.Hour)); got != 0 {
+		t.Errorf("%d reminders sent, want none", got)
+	}
+}
+
+func TestRemindRescheduled(t *testing.T) {
+	sink := setupReminders(t)
+
+	// Перенос проверяет время записи по текущему времени, поэтому записи в будущем
+	afternoon, err := db.ParseDayRange("12:00-17:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot := func(after time.Time) time.Time {
+		t.Helper()
+		at, err := db.FindNextAvailable(after, time.Hour, []db.DayRange{afternoon})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *at
+	}
+
+	first := slot(time.Now().AddDate(0, 0, 3))
+	record, err := db.AddRecord(db.Record{Title: "А123ВС77", Record: &first,
+		Contacts: db.Contacts{Phone: "+79991234567", Language: "ru"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := remind(t, sink, first.Add(-24*time.Hour)); got != 1 {
+		t.Fatalf("%d reminders before reschedule, want 1", got)
+	}
+
+	second := slot(first.AddDate(0, 0, 2))
+	if _, err := db.PatchRecord(record.ID, db.RecordPatch{Record: &second}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Напоминания о новом времени начинаются заново
+	if got := remind(t, sink, second.Add(-24*time.Hour)); got != 2 {
+		t.Fatalf("%d reminders after reschedule, want 2", got)
+	}
+	if got := remind(t, sink, second.Add(-2*time.Hour)); got != 3 {
+		t.Fatalf("%d reminders at the 2h mark, want 3", got)
+	}
+
+	reminders, err := db.GetReminders(record.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range reminders {
+		if !r.RecordAt.Equal(second) || r.Status != db.ReminderSent {
+			t.Errorf("reminder %s: record at %s, status %s; want %s, sent", r.Offset, r.RecordAt, r.Status, second)
+		}
+	}
+}
+
+func TestRemindQuietHours(t *testing.T) {
+	sink := setupReminders(t)
+	at := msk(14, 9, 0)
+	importRecord(t, db.Record{Title: "А123ВС77", Record: &at}, msk(13, 12, 0))
+
+	// Напоминание за 2 часа наступает в 07:00, в тихие часы, и уходит в 08:00
+	for _, tt := range []struct {
+		now  time.Time
+		want int
+	}{
+		{msk(14, 7, 0), 0},
+		{msk(14, 7, 59), 0},
+		{msk(14, 8, 0), 1},
+	} {
+		if got := remind(t, sink, tt.now); got != tt.want {
+			t.Errorf("at %s: %d reminders, want %d", tt.now.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		quiet []string // время суток в тихих часах
+		loud  []string // время суток вне их
+	}{
+		{"22:00-08:00", []string{"22:00", "23:59", "00:00", "07:59"}, []string{"21:59", "08:00", "12:00"}},
+		{"13:00-14:00", []string{"13:00", "13:59"}, []string{"12:59", "14:00", "00:00"}},
+		{"00:00-24:00", []string{"00:00", "12:00", "23:59"}, nil},
+		{"23:30-00:30", []string{"23:30", "00:00", "00:29"}, []string{"23:29", "00:30"}},
+	} {
+		q, err := parseQuietHours(tt.value)
+		if err != nil {
+			t.Errorf("parseQuietHours(%q): %v", tt.value, err)
+			continue
+		}
+
+		check := func(clock string, want bool) {
+			at, err := time.Parse("15:04", clock)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := q.contains(at); got != want {
+				t.Errorf("%s contains %s = %t, want %t", tt.value, clock, got, want)
+			}
+		}
+		for _, clock := range tt.quiet {
+			check(clock, true)
+		}
+		for _, clock := range tt.loud {
+			check(clock, false)
+		}
+	}
+
+	for _, value := range []string{"", "22:00", "25:00-08:00", "22:00-22:00", "22:60-08:00", "ночь"} {
+		if _, err := parseQuietHours(value); err == nil {
+			t.Errorf("parseQuietHours(%q) accepted", value)
+		}
+	}
+
+	// Отключенные тихие часы не действуют никогда
+	if (quietHours{}).contains(time.Date(2026, 3, 14, 3, 0, 0, 0, time.UTC)) {
+		t.Error("zero quiet hours contain 03:00")
+	}
+}
@@ -0,0 +1,4 @@
+Booking confirmed - {{.Shop.Name}}
+{{.Shop.Name}}: your booking for {{.Plate}} is confirmed for {{datetime .Record}}, ticket {{.Ticket}}.
+{{- if .Link}}
+Status, reschedule and cancel: {{.Link}}{{end}}
@@ -0,0 +1,4 @@
+Запись подтверждена - {{.Shop.Name}}
+{{.Shop.Name}}: вы записаны на {{datetime .Record}}, автомобиль {{.Plate}}, талон {{.Ticket}}.
+{{- if .Link}}
+Статус, перенос и отмена: {{.Link}}{{end}}
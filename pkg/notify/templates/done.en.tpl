@@ -0,0 +1,2 @@
+Your car is ready - {{.Shop.Name}}
+{{.Shop.Name}}: work on {{.Plate}} is finished, the car is ready for pickup.{{if .Shop.Phone}} Phone: {{.Shop.Phone}}{{end}}
@@ -0,0 +1,2 @@
+Автомобиль готов - {{.Shop.Name}}
+{{.Shop.Name}}: работы по автомобилю {{.Plate}} завершены, можно забирать.{{if .Shop.Phone}} Телефон: {{.Shop.Phone}}{{end}}
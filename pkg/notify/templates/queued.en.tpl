@@ -0,0 +1,4 @@
+You are in the queue - {{.Shop.Name}}
+{{.Shop.Name}}: {{.Plate}} is in the walk-in queue, ticket {{.Ticket}}. We will let you know when it is your turn.
+{{- if .Link}}
+Queue position: {{.Link}}{{end}}
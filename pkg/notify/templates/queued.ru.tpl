@@ -0,0 +1,4 @@
+Вы в очереди - {{.Shop.Name}}
+{{.Shop.Name}}: автомобиль {{.Plate}} в живой очереди, талон {{.Ticket}}. Мы сообщим, когда подойдет ваша очередь.
+{{- if .Link}}
+Место в очереди: {{.Link}}{{end}}
@@ -0,0 +1,4 @@
+Booking reminder - {{.Shop.Name}}
+{{.Shop.Name}}: a reminder that {{.Plate}} is booked for {{datetime .Record}}, ticket {{.Ticket}}.{{if .Shop.Phone}} Can't make it? Call {{.Shop.Phone}}.{{end}}
+{{- if .Link}}
+Reschedule or cancel: {{.Link}}{{end}}
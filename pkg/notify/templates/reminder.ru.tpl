@@ -0,0 +1,4 @@
+Напоминание о записи - {{.Shop.Name}}
+{{.Shop.Name}}: напоминаем, вы записаны на {{datetime .Record}}, автомобиль {{.Plate}}, талон {{.Ticket}}.{{if .Shop.Phone}} Не получается приехать - позвоните {{.Shop.Phone}}.{{end}}
+{{- if .Link}}
+Перенос и отмена: {{.Link}}{{end}}
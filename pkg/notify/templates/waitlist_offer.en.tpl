@@ -0,0 +1,4 @@
+A slot is available - {{.Shop.Name}}
+{{.Shop.Name}}: a slot at {{datetime .Record}} is available for {{.Plate}}. Please confirm by {{time .Expires}}, otherwise it will be offered to the next customer.
+{{- if .Link}}
+Accept or decline: {{.Link}}{{end}}
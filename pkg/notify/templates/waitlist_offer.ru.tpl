@@ -0,0 +1,4 @@
+Освободилось время - {{.Shop.Name}}
+{{.Shop.Name}}: для автомобиля {{.Plate}} освободилось время {{datetime .Record}}. Подтвердите запись до {{time .Expires}}, иначе время предложат следующему клиенту.
+{{- if .Link}}
+Принять или отказаться: {{.Link}}{{end}}
@@ -0,0 +1,2 @@
+It is your turn - {{.Shop.Name}}
+{{.Shop.Name}}: ticket {{.Ticket}}, it is your turn.{{if .Bay}} Please drive to bay {{.Bay}}.{{else}} Please drive to the workshop.{{end}}
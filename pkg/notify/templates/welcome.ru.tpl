@@ -0,0 +1,2 @@
+Ваша очередь - {{.Shop.Name}}
+{{.Shop.Name}}: талон {{.Ticket}}, ваша очередь подошла.{{if .Bay}} Подъезжайте к посту {{.Bay}}.{{else}} Подъезжайте к боксу.{{end}}
@@ -0,0 +1,297 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// Размер страницы A4 в пунктах
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Document PDF-документ из страниц с текстом и линиями. Вывод детерминирован:
+// одинаковое содержимое дает побайтно одинаковый файл
+type Document struct {
+	Title string
+	pages []*Page
+	fonts []*fontUsage
+}
+
+// fontUsage шрифт документа и использованные в нем глифы
+type fontUsage struct {
+	font   *Font
+	glyphs map[uint16]rune
+}
+
+// Page страница документа. Координаты в пунктах от левого нижнего угла
+type Page struct {
+	doc     *Document
+	content bytes.Buffer
+}
+
+// New создает пустой документ
+func New() *Document {
+	return &Document{}
+}
+
+// AddPage добавляет страницу A4
+func (d *Document) AddPage() *Page {
+	page := &Page{doc: d}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// fontIndex возвращает номер шрифта в ресурсах документа
+func (d *Document) fontIndex(font *Font) int {
+	for i, usage := range d.fonts {
+		if usage.font == font {
+			return i
+		}
+	}
+	d.fonts = append(d.fonts, &fontUsage{font: font, glyphs: make(map[uint16]rune)})
+	return len(d.fonts) - 1
+}
+
+// Text выводит строку шрифтом font кеглем size от точки (x, y) на базовой линии
+func (p *Page) Text(font *Font, size, x, y float64, s string) {
+	index := p.doc.fontIndex(font)
+	usage := p.doc.fonts[index]
+
+	var hex strings.Builder
+	for _, r := range s {
+		glyph := font.glyph(r)
+		if _, ok := usage.glyphs[glyph]; !ok && glyph != 0 {
+			usage.glyphs[glyph] = r
+		}
+		fmt.Fprintf(&hex, "%04X", glyph)
+	}
+
+	fmt.Fprintf(&p.content, "BT /F%d %s Tf %s %s Td <%s> Tj ET\n",
+		index+1, number(size), number(x), number(y), hex.String())
+}
+
+// Line рисует отрезок толщиной width
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s m %s %s l S\n",
+		number(width), number(x1), number(y1), number(x2), number(y2))
+}
+
+// Rect рисует контур прямоугольника толщиной width
+func (p *Page) Rect(x, y, w, h, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s %s %s re S\n",
+		number(width), number(x), number(y), number(w), number(h))
+}
+
+// FillRect закрашивает прямоугольник черным
+func (p *Page) FillRect(x, y, w, h float64) {
+	fmt.Fprintf(&p.content, "%s %s %s %s re f\n", number(x), number(y), number(w), number(h))
+}
+
+// number форматирует число для PDF: не более двух знаков после точки, без лишних нулей
+func number(value float64) string {
+	s := fmt.Sprintf("%.2f", value)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// writer нумерует объекты PDF и запоминает их смещения для таблицы xref
+type writer struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+// reserve выделяет номер объекта, который будет записан позже
+func (w *writer) reserve() int {
+	w.offsets = append(w.offsets, 0)
+	return len(w.offsets)
+}
+
+func (w *writer) object(id int, body string) {
+	w.offsets[id-1] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+func (w *writer) stream(id int, dict string, data []byte, compress bool) error {
+	if compress {
+		var packed bytes.Buffer
+		zw := zlib.NewWriter(&packed)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		data = packed.Bytes()
+		dict += " /Filter /FlateDecode"
+	}
+
+	w.offsets[id-1] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n<< %s /Length %d >>\nstream\n", id, dict, len(data))
+	w.buf.Write(data)
+	w.buf.WriteString("\nendstream\nendobj\n")
+	return nil
+}
+
+// WriteTo записывает документ в формате PDF 1.7
+func (d *Document) WriteTo(out io.Writer) (int64, error) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	w := &writer{}
+	w.buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+
+	catalog := w.reserve()
+	pagesID := w.reserve()
+	info := w.reserve()
+
+	fontIDs := make([]int, len(d.fonts))
+	for i, usage := range d.fonts {
+		id, err := w.writeFont(usage)
+		if err != nil {
+			return 0, err
+		}
+		fontIDs[i] = id
+	}
+
+	var fontRefs strings.Builder
+	for i, id := range fontIDs {
+		fmt.Fprintf(&fontRefs, " /F%d %d 0 R", i+1, id)
+	}
+
+	kids := make([]string, len(d.pages))
+	for i, page := range d.pages {
+		contentID := w.reserve()
+		if err := w.stream(contentID, "", page.content.Bytes(), true); err != nil {
+			return 0, err
+		}
+
+		pageID := w.reserve()
+		w.object(pageID, fmt.Sprintf(
+			"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << /Font <<%s >> >> /Contents %d 0 R >>",
+			pagesID, number(PageWidth), number(PageHeight), fontRefs.String(), contentID))
+		kids[i] = fmt.Sprintf("%d 0 R", pageID)
+	}
+
+	w.object(pagesID, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	w.object(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesID))
+	w.object(info, fmt.Sprintf("<< /Title %s /Producer (tire-repair-record-service) >>", textString(d.Title)))
+
+	xref := w.buf.Len()
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+	for _, offset := range w.offsets {
+		fmt.Fprintf(&w.buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&w.buf, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(w.offsets)+1, catalog, info, xref)
+
+	n, err := out.Write(w.buf.Bytes())
+	return int64(n), err
+}
+
+// Bytes возвращает документ в формате PDF
+func (d *Document) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := d.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFont записывает составной шрифт Type0 с встроенным файлом TrueType,
+// ширинами использованных глифов и таблицей ToUnicode для поиска и копирования текста
+func (w *writer) writeFont(usage *fontUsage) (int, error) {
+	font := usage.font
+
+	// Встраиваются только использованные глифы, иначе шрифт с кириллицей занимает сотни килобайт
+	file := font.subset(usage.glyphs)
+	fileID := w.reserve()
+	if err := w.stream(fileID, fmt.Sprintf("/Length1 %d", len(file)), file, true); err != nil {
+		return 0, err
+	}
+
+	descriptorID := w.reserve()
+	w.object(descriptorID, fmt.Sprintf(
+		"<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 "+
+			"/Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		font.Name, font.scaled(font.bbox[0]), font.scaled(font.bbox[1]), font.scaled(font.bbox[2]),
+		font.scaled(font.bbox[3]), font.scaled(font.ascent), font.scaled(font.descent),
+		font.scaled(font.ascent), fileID))
+
+	glyphs := make([]int, 0, len(usage.glyphs))
+	for glyph := range usage.glyphs {
+		glyphs = append(glyphs, int(glyph))
+	}
+	sort.Ints(glyphs)
+
+	var widths strings.Builder
+	for _, glyph := range glyphs {
+		fmt.Fprintf(&widths, "%d [%d] ", glyph, font.scaled(int(font.advances[glyph])))
+	}
+
+	cidID := w.reserve()
+	w.object(cidID, fmt.Sprintf(
+		"<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s "+
+			"/CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> "+
+			"/FontDescriptor %d 0 R /DW %d /W [%s] /CIDToGIDMap /Identity >>",
+		font.Name, descriptorID, font.scaled(int(font.advances[0])), strings.TrimSpace(widths.String())))
+
+	toUnicodeID := w.reserve()
+	if err := w.stream(toUnicodeID, "", toUnicode(glyphs, usage.glyphs), true); err != nil {
+		return 0, err
+	}
+
+	fontID := w.reserve()
+	w.object(fontID, fmt.Sprintf(
+		"<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		font.Name, cidID, toUnicodeID))
+
+	return fontID, nil
+}
+
+// toUnicode строит CMap соответствия глифов символам
+func toUnicode(glyphs []int, runes map[uint16]rune) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+
+	// В одном блоке bfchar допускается не более 100 записей
+	for start := 0; start < len(glyphs); start += 100 {
+		end := min(start+100, len(glyphs))
+		fmt.Fprintf(&buf, "%d beginbfchar\n", end-start)
+		for _, glyph := range glyphs[start:end] {
+			var hex strings.Builder
+			for _, unit := range utf16.Encode([]rune{runes[uint16(glyph)]}) {
+				fmt.Fprintf(&hex, "%04X", unit)
+			}
+			fmt.Fprintf(&buf, "<%04X> <%s>\n", glyph, hex.String())
+		}
+		buf.WriteString("endbfchar\n")
+	}
+
+	buf.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return buf.Bytes()
+}
+
+// textString кодирует строку метаданных в UTF-16BE с меткой порядка байтов
+func textString(s string) string {
+	var hex strings.Builder
+	hex.WriteString("<FEFF")
+	for _, unit := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&hex, "%04X", unit)
+	}
+	hex.WriteString(">")
+	return hex.String()
+}
@@ -0,0 +1,466 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+var ErrInvalidFont = errors.New("некорректный файл шрифта TrueType")
+
+// Font шрифт TrueType, встраиваемый в документ. Текст выводится номерами
+// глифов (кодировка Identity-H), поэтому кириллица не требует отдельной
+// кодовой страницы
+type Font struct {
+	Name       string // PostScript-имя шрифта
+	tables     map[string][]byte
+	longLoca   bool
+	unitsPerEm int
+	ascent     int
+	descent    int
+	bbox       [4]int
+	advances   []uint16
+	glyphs     map[rune]uint16
+}
+
+// LoadFont читает шрифт TrueType из файла
+func LoadFont(path string) (*Font, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	font, err := ParseFont(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return font, nil
+}
+
+// ParseFont разбирает таблицы шрифта TrueType, нужные для вывода текста:
+// метрики (head, hhea, hmtx), соответствие символов глифам (cmap) и имя (name)
+func ParseFont(data []byte) (*Font, error) {
+	if len(data) < 12 {
+		return nil, ErrInvalidFont
+	}
+	if version := binary.BigEndian.Uint32(data); version != 0x00010000 && version != 0x74727565 {
+		return nil, fmt.Errorf("%w: поддерживаются только шрифты с контурами TrueType", ErrInvalidFont)
+	}
+
+	tables := make(map[string][]byte)
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < numTables; i++ {
+		record := 12 + i*16
+		if record+16 > len(data) {
+			return nil, ErrInvalidFont
+		}
+		tag := string(data[record : record+4])
+		offset := int(binary.BigEndian.Uint32(data[record+8:]))
+		length := int(binary.BigEndian.Uint32(data[record+12:]))
+		if offset+length > len(data) {
+			return nil, fmt.Errorf("%w: таблица %s за пределами файла", ErrInvalidFont, tag)
+		}
+		tables[tag] = data[offset : offset+length]
+	}
+
+	for _, tag := range []string{"head", "hhea", "hmtx", "maxp", "cmap", "loca", "glyf"} {
+		if _, ok := tables[tag]; !ok {
+			return nil, fmt.Errorf("%w: нет таблицы %s", ErrInvalidFont, tag)
+		}
+	}
+
+	font := &Font{tables: tables}
+
+	head := tables["head"]
+	if len(head) < 54 {
+		return nil, ErrInvalidFont
+	}
+	font.unitsPerEm = int(binary.BigEndian.Uint16(head[18:]))
+	font.longLoca = binary.BigEndian.Uint16(head[50:]) == 1
+	for i := range font.bbox {
+		font.bbox[i] = int(int16(binary.BigEndian.Uint16(head[36+i*2:])))
+	}
+	if font.unitsPerEm == 0 {
+		return nil, ErrInvalidFont
+	}
+
+	hhea := tables["hhea"]
+	if len(hhea) < 36 {
+		return nil, ErrInvalidFont
+	}
+	font.ascent = int(int16(binary.BigEndian.Uint16(hhea[4:])))
+	font.descent = int(int16(binary.BigEndian.Uint16(hhea[6:])))
+	numHMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+
+	maxp := tables["maxp"]
+	if len(maxp) < 6 {
+		return nil, ErrInvalidFont
+	}
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+
+	hmtx := tables["hmtx"]
+	if numHMetrics == 0 || numHMetrics > numGlyphs || len(hmtx) < numHMetrics*4 {
+		return nil, ErrInvalidFont
+	}
+	font.advances = make([]uint16, numGlyphs)
+	for i := 0; i < numGlyphs; i++ {
+		if i < numHMetrics {
+			font.advances[i] = binary.BigEndian.Uint16(hmtx[i*4:])
+		} else {
+			font.advances[i] = font.advances[numHMetrics-1]
+		}
+	}
+
+	glyphs, err := parseCmap(tables["cmap"])
+	if err != nil {
+		return nil, err
+	}
+	font.glyphs = glyphs
+
+	font.Name = parseName(tables["name"])
+	if font.Name == "" {
+		font.Name = "EmbeddedFont"
+	}
+
+	return font, nil
+}
+
+// parseCmap читает таблицу символов Unicode: формат 12 (полный Unicode)
+// или формат 4 (базовая плоскость)
+func parseCmap(cmap []byte) (map[rune]uint16, error) {
+	if len(cmap) < 4 {
+		return nil, ErrInvalidFont
+	}
+
+	var format4, format12 []byte
+	numTables := int(binary.BigEndian.Uint16(cmap[2:]))
+	for i := 0; i < numTables; i++ {
+		record := 4 + i*8
+		if record+8 > len(cmap) {
+			return nil, ErrInvalidFont
+		}
+		platform := binary.BigEndian.Uint16(cmap[record:])
+		encoding := binary.BigEndian.Uint16(cmap[record+2:])
+		offset := int(binary.BigEndian.Uint32(cmap[record+4:]))
+		if offset+4 > len(cmap) {
+			return nil, ErrInvalidFont
+		}
+
+		unicode := platform == 0 || (platform == 3 && (encoding == 1 || encoding == 10))
+		if !unicode {
+			continue
+		}
+		switch binary.BigEndian.Uint16(cmap[offset:]) {
+		case 4:
+			format4 = cmap[offset:]
+		case 12:
+			format12 = cmap[offset:]
+		}
+	}
+
+	glyphs := make(map[rune]uint16)
+	switch {
+	case format12 != nil:
+		if len(format12) < 16 {
+			return nil, ErrInvalidFont
+		}
+		groups := int(binary.BigEndian.Uint32(format12[12:]))
+		if len(format12) < 16+groups*12 {
+			return nil, ErrInvalidFont
+		}
+		for i := 0; i < groups; i++ {
+			group := format12[16+i*12:]
+			start := binary.BigEndian.Uint32(group)
+			end := binary.BigEndian.Uint32(group[4:])
+			glyph := binary.BigEndian.Uint32(group[8:])
+			for c := start; c <= end && c <= 0x10FFFF; c++ {
+				glyphs[rune(c)] = uint16(glyph + c - start)
+			}
+		}
+
+	case format4 != nil:
+		if len(format4) < 14 {
+			return nil, ErrInvalidFont
+		}
+		segCount := int(binary.BigEndian.Uint16(format4[6:])) / 2
+		ends := 14
+		starts := ends + segCount*2 + 2
+		deltas := starts + segCount*2
+		rangeOffsets := deltas + segCount*2
+		if len(format4) < rangeOffsets+segCount*2 {
+			return nil, ErrInvalidFont
+		}
+		for i := 0; i < segCount; i++ {
+			end := int(binary.BigEndian.Uint16(format4[ends+i*2:]))
+			start := int(binary.BigEndian.Uint16(format4[starts+i*2:]))
+			delta := int(binary.BigEndian.Uint16(format4[deltas+i*2:]))
+			rangeOffset := int(binary.BigEndian.Uint16(format4[rangeOffsets+i*2:]))
+
+			for c := start; c <= end && c != 0xFFFF; c++ {
+				var glyph int
+				if rangeOffset == 0 {
+					glyph = (c + delta) & 0xFFFF
+				} else {
+					addr := rangeOffsets + i*2 + rangeOffset + (c-start)*2
+					if addr+2 > len(format4) {
+						continue
+					}
+					glyph = int(binary.BigEndian.Uint16(format4[addr:]))
+					if glyph != 0 {
+						glyph = (glyph + delta) & 0xFFFF
+					}
+				}
+				if glyph != 0 {
+					glyphs[rune(c)] = uint16(glyph)
+				}
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("%w: нет таблицы символов Unicode", ErrInvalidFont)
+	}
+
+	return glyphs, nil
+}
+
+// parseName возвращает PostScript-имя шрифта (nameID 6)
+func parseName(name []byte) string {
+	if len(name) < 6 {
+		return ""
+	}
+
+	count := int(binary.BigEndian.Uint16(name[2:]))
+	storage := int(binary.BigEndian.Uint16(name[4:]))
+	for i := 0; i < count; i++ {
+		record := 6 + i*12
+		if record+12 > len(name) {
+			return ""
+		}
+		platform := binary.BigEndian.Uint16(name[record:])
+		nameID := binary.BigEndian.Uint16(name[record+6:])
+		length := int(binary.BigEndian.Uint16(name[record+8:]))
+		offset := storage + int(binary.BigEndian.Uint16(name[record+10:]))
+		if nameID != 6 || offset+length > len(name) {
+			continue
+		}
+
+		raw := name[offset : offset+length]
+		var value string
+		if platform == 1 {
+			value = string(raw)
+		} else {
+			units := make([]uint16, len(raw)/2)
+			for j := range units {
+				units[j] = binary.BigEndian.Uint16(raw[j*2:])
+			}
+			value = string(utf16.Decode(units))
+		}
+
+		// Имя попадает в словарь PDF как имя-объект и не должно содержать разделителей
+		return strings.Map(func(r rune) rune {
+			if r <= ' ' || r > '~' || strings.ContainsRune("()<>[]{}/%#", r) {
+				return -1
+			}
+			return r
+		}, value)
+	}
+
+	return ""
+}
+
+// glyph возвращает номер глифа символа, 0 - символа в шрифте нет
+func (f *Font) glyph(r rune) uint16 {
+	glyph := f.glyphs[r]
+	if int(glyph) >= len(f.advances) {
+		return 0
+	}
+	return glyph
+}
+
+// scaled переводит величину из единиц шрифта в тысячные доли кегля
+func (f *Font) scaled(value int) int {
+	return value * 1000 / f.unitsPerEm
+}
+
+// Width возвращает ширину строки в пунктах при кегле size
+func (f *Font) Width(s string, size float64) float64 {
+	var units int
+	for _, r := range s {
+		units += int(f.advances[f.glyph(r)])
+	}
+	return float64(units) * size / float64(f.unitsPerEm)
+}
+
+// Флаги составного глифа
+const (
+	argsAreWords   = 0x0001
+	haveScale      = 0x0008
+	moreComponents = 0x0020
+	haveXYScale    = 0x0040
+	haveTwoByTwo   = 0x0080
+)
+
+// glyphData возвращает описание глифа из таблицы glyf
+func (f *Font) glyphData(glyph int) []byte {
+	loca, glyf := f.tables["loca"], f.tables["glyf"]
+
+	var start, end int
+	if f.longLoca {
+		if (glyph+2)*4 > len(loca) {
+			return nil
+		}
+		start = int(binary.BigEndian.Uint32(loca[glyph*4:]))
+		end = int(binary.BigEndian.Uint32(loca[glyph*4+4:]))
+	} else {
+		if (glyph+2)*2 > len(loca) {
+			return nil
+		}
+		start = int(binary.BigEndian.Uint16(loca[glyph*2:])) * 2
+		end = int(binary.BigEndian.Uint16(loca[glyph*2+2:])) * 2
+	}
+
+	if start >= end || end > len(glyf) {
+		return nil
+	}
+	return glyf[start:end]
+}
+
+// components возвращает глифы, из которых собран составной глиф
+func components(data []byte) []int {
+	if len(data) < 10 || int16(binary.BigEndian.Uint16(data)) >= 0 {
+		return nil
+	}
+
+	var glyphs []int
+	for offset := 10; offset+4 <= len(data); {
+		flags := binary.BigEndian.Uint16(data[offset:])
+		glyphs = append(glyphs, int(binary.BigEndian.Uint16(data[offset+2:])))
+
+		offset += 4
+		if flags&argsAreWords != 0 {
+			offset += 4
+		} else {
+			offset += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			offset += 2
+		case flags&haveXYScale != 0:
+			offset += 4
+		case flags&haveTwoByTwo != 0:
+			offset += 8
+		}
+
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+	return glyphs
+}
+
+// subset собирает файл шрифта, в котором оставлены только использованные глифы.
+// Номера глифов не меняются, поэтому /CIDToGIDMap /Identity остается верным
+func (f *Font) subset(used map[uint16]rune) []byte {
+	keep := map[int]bool{0: true}
+	queue := make([]int, 0, len(used))
+	for glyph := range used {
+		queue = append(queue, int(glyph))
+	}
+	for len(queue) > 0 {
+		glyph := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if keep[glyph] && glyph != 0 {
+			continue
+		}
+		keep[glyph] = true
+		queue = append(queue, components(f.glyphData(glyph))...)
+	}
+
+	var glyf []byte
+	loca := make([]byte, (len(f.advances)+1)*4)
+	for glyph := range f.advances {
+		binary.BigEndian.PutUint32(loca[glyph*4:], uint32(len(glyf)))
+		if keep[glyph] {
+			glyf = append(glyf, f.glyphData(glyph)...)
+			for len(glyf)%4 != 0 {
+				glyf = append(glyf, 0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(loca[len(f.advances)*4:], uint32(len(glyf)))
+
+	head := append([]byte(nil), f.tables["head"]...)
+	binary.BigEndian.PutUint32(head[8:], 0)  // checkSumAdjustment
+	binary.BigEndian.PutUint16(head[50:], 1) // длинный формат loca
+
+	tables := map[string][]byte{
+		"head": head,
+		"hhea": f.tables["hhea"],
+		"hmtx": f.tables["hmtx"],
+		"maxp": f.tables["maxp"],
+		"loca": loca,
+		"glyf": glyf,
+	}
+	// Инструкции хинтинга нужны глифам при растеризации
+	for _, tag := range []string{"cvt ", "fpgm", "prep"} {
+		if table, ok := f.tables[tag]; ok {
+			tables[tag] = table
+		}
+	}
+
+	return buildFont(tables)
+}
+
+// buildFont записывает файл TrueType из таблиц
+func buildFont(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= len(tags) {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	header := make([]byte, 12+16*len(tags))
+	binary.BigEndian.PutUint32(header, 0x00010000)
+	binary.BigEndian.PutUint16(header[4:], uint16(len(tags)))
+	binary.BigEndian.PutUint16(header[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(header[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(header[10:], uint16(len(tags)*16-searchRange))
+
+	var body []byte
+	for i, tag := range tags {
+		table := tables[tag]
+		record := header[12+i*16:]
+		copy(record, tag)
+		binary.BigEndian.PutUint32(record[4:], checksum(table))
+		binary.BigEndian.PutUint32(record[8:], uint32(len(header)+len(body)))
+		binary.BigEndian.PutUint32(record[12:], uint32(len(table)))
+
+		body = append(body, table...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+
+	return append(header, body...)
+}
+
+// checksum контрольная сумма таблицы TrueType
+func checksum(table []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(table); i += 4 {
+		var word [4]byte
+		copy(word[:], table[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
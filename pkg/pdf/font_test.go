@@ -0,0 +1,350 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Глифы тестового шрифта
+const (
+	glyphNotdef = iota
+	glyphA
+	glyphB
+	glyphAcute // только как часть составного глифа, в cmap его нет
+	glyphAAcute
+	glyphC
+	testGlyphs
+)
+
+// simpleGlyph прямоугольник шириной width из одного контура
+func simpleGlyph(width int) []byte {
+	data := make([]byte, 10)
+	binary.BigEndian.PutUint16(data[0:], 1)
+	binary.BigEndian.PutUint16(data[6:], uint16(width))
+	binary.BigEndian.PutUint16(data[8:], 700)
+
+	data = binary.BigEndian.AppendUint16(data, 3)
+	data = binary.BigEndian.AppendUint16(data, 0)
+	data = append(data, 1, 1, 1, 1)
+	for _, v := range []int{0, width, 0, -width, 0, 0, 700, 0} {
+		data = binary.BigEndian.AppendUint16(data, uint16(int16(v)))
+	}
+	return data
+}
+
+// compositeGlyph глиф из base со смещением в словах и mark с масштабом
+func compositeGlyph(base, mark int) []byte {
+	data := make([]byte, 10)
+	binary.BigEndian.PutUint16(data[0:], 0xFFFF) // numberOfContours = -1
+
+	data = binary.BigEndian.AppendUint16(data, argsAreWords|moreComponents)
+	data = binary.BigEndian.AppendUint16(data, uint16(base))
+	data = append(data, 0, 0, 0, 0)
+
+	data = binary.BigEndian.AppendUint16(data, haveScale)
+	data = binary.BigEndian.AppendUint16(data, uint16(mark))
+	data = append(data, 10, 20) // смещение в байтах
+	data = append(data, 0x40, 0x00)
+	return data
+}
+
+// cmapFormat4 таблица cmap формата 4 с сегментами {start, end, glyph}
+func cmapFormat4(segments [][3]int) []byte {
+	segments = append(segments, [3]int{0xFFFF, 0xFFFF, 1})
+	n := len(segments)
+
+	sub := make([]byte, 16+n*8)
+	binary.BigEndian.PutUint16(sub[0:], 4)
+	binary.BigEndian.PutUint16(sub[2:], uint16(len(sub)))
+	binary.BigEndian.PutUint16(sub[6:], uint16(n*2))
+	for i, s := range segments {
+		binary.BigEndian.PutUint16(sub[14+i*2:], uint16(s[1]))
+		binary.BigEndian.PutUint16(sub[16+n*2+i*2:], uint16(s[0]))
+		binary.BigEndian.PutUint16(sub[16+n*4+i*2:], uint16(s[2]-s[0]))
+	}
+
+	return cmapTable(3, 1, sub)
+}
+
+// cmapTable таблица cmap из одной подтаблицы
+func cmapTable(platform, encoding uint16, sub []byte) []byte {
+	table := make([]byte, 12)
+	binary.BigEndian.PutUint16(table[2:], 1)
+	binary.BigEndian.PutUint16(table[4:], platform)
+	binary.BigEndian.PutUint16(table[6:], encoding)
+	binary.BigEndian.PutUint32(table[8:], 12)
+	return append(table, sub...)
+}
+
+// testFontData шрифт из testGlyphs глифов с коротким форматом loca.
+// extra добавляет или заменяет таблицы, nil - удаляет таблицу
+func testFontData(extra map[string][]byte) []byte {
+	glyphs := [testGlyphs][]byte{
+		glyphNotdef: simpleGlyph(500),
+		glyphA:      simpleGlyph(600),
+		glyphB:      simpleGlyph(620),
+		glyphAcute:  simpleGlyph(200),
+		glyphAAcute: compositeGlyph(glyphA, glyphAcute),
+		glyphC:      simpleGlyph(640),
+	}
+
+	var glyf []byte
+	loca := make([]byte, (testGlyphs+1)*2)
+	for i, data := range glyphs {
+		binary.BigEndian.PutUint16(loca[i*2:], uint16(len(glyf)/2))
+		glyf = append(glyf, data...)
+		for len(glyf)%4 != 0 {
+			glyf = append(glyf, 0)
+		}
+	}
+	binary.BigEndian.PutUint16(loca[testGlyphs*2:], uint16(len(glyf)/2))
+
+	head := make([]byte, 54)
+	binary.BigEndian.PutUint32(head[0:], 0x00010000)
+	binary.BigEndian.PutUint32(head[8:], 0x12345678) // checkSumAdjustment исходного файла
+	binary.BigEndian.PutUint16(head[18:], 2048)
+	binary.BigEndian.PutUint16(head[40:], 1000)
+	binary.BigEndian.PutUint16(head[42:], 800)
+
+	hhea := make([]byte, 36)
+	binary.BigEndian.PutUint16(hhea[4:], 1600)
+	binary.BigEndian.PutUint16(hhea[6:], 0xFE00)
+	binary.BigEndian.PutUint16(hhea[34:], 4) // у последних глифов ширина последней метрики
+
+	maxp := make([]byte, 6)
+	binary.BigEndian.PutUint32(maxp[0:], 0x00005000)
+	binary.BigEndian.PutUint16(maxp[4:], testGlyphs)
+
+	hmtx := make([]byte, 4*4)
+	for i, advance := range []uint16{1024, 1200, 1240, 400} {
+		binary.BigEndian.PutUint16(hmtx[i*4:], advance)
+	}
+
+	tables := map[string][]byte{
+		"head": head,
+		"hhea": hhea,
+		"maxp": maxp,
+		"hmtx": hmtx,
+		"loca": loca,
+		"glyf": glyf,
+		"cmap": cmapFormat4([][3]int{{'A', 'B', glyphA}, {'C', 'C', glyphC}, {'Á', 'Á', glyphAAcute}}),
+		"prep": {0xB0, 0x00},
+	}
+	for tag, table := range extra {
+		if table == nil {
+			delete(tables, tag)
+		} else {
+			tables[tag] = table
+		}
+	}
+	return buildFont(tables)
+}
+
+func testFont(t *testing.T) *Font {
+	t.Helper()
+	font, err := ParseFont(testFontData(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return font
+}
+
+// fontTables разбирает каталог таблиц файла TrueType и проверяет контрольные суммы
+func fontTables(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+
+	tables := make(map[string][]byte)
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < numTables; i++ {
+		record := data[12+i*16:]
+		tag := string(record[:4])
+		sum := binary.BigEndian.Uint32(record[4:])
+		offset := int(binary.BigEndian.Uint32(record[8:]))
+		length := int(binary.BigEndian.Uint32(record[12:]))
+
+		if offset%4 != 0 {
+			t.Errorf("table %s at unaligned offset %d", tag, offset)
+		}
+		if offset+length > len(data) {
+			t.Fatalf("table %s is out of file bounds", tag)
+		}
+		tables[tag] = data[offset : offset+length]
+		if got := checksum(tables[tag]); got != sum {
+			t.Errorf("table %s checksum %08x, directory says %08x", tag, got, sum)
+		}
+	}
+	return tables
+}
+
+func TestParseFont(t *testing.T) {
+	font := testFont(t)
+
+	for r, want := range map[rune]uint16{'A': glyphA, 'B': glyphB, 'C': glyphC, 'Á': glyphAAcute, 'Z': 0} {
+		if got := font.glyph(r); got != want {
+			t.Errorf("glyph(%q) = %d, want %d", r, got, want)
+		}
+	}
+
+	// Глифы после numberOfHMetrics берут ширину последней метрики
+	if got := font.advances[glyphC]; got != 400 {
+		t.Errorf("advance of glyph %d = %d, want 400", glyphC, got)
+	}
+	if got, want := font.Width("AB", 10), float64(1200+1240)*10/2048; got != want {
+		t.Errorf("Width(AB) = %v, want %v", got, want)
+	}
+	if font.Name != "EmbeddedFont" {
+		t.Errorf("font without name table is called %q", font.Name)
+	}
+}
+
+func TestParseFontRejectsBrokenFiles(t *testing.T) {
+	valid := testFontData(nil)
+
+	for name, data := range map[string][]byte{
+		"empty":        nil,
+		"cff outlines": append([]byte("OTTO"), valid[4:]...),
+		"truncated":    valid[:len(valid)/2],
+		"no glyf":      testFontData(map[string][]byte{"glyf": nil}),
+	} {
+		if _, err := ParseFont(data); !errors.Is(err, ErrInvalidFont) {
+			t.Errorf("%s: got %v, want ErrInvalidFont", name, err)
+		}
+	}
+}
+
+func TestParseCmapFormat12(t *testing.T) {
+	sub := make([]byte, 16, 40)
+	binary.BigEndian.PutUint16(sub[0:], 12)
+	binary.BigEndian.PutUint32(sub[12:], 2)
+	for _, group := range [][3]uint32{{'a', 'c', 10}, {0x1F697, 0x1F697, 20}} {
+		for _, v := range group {
+			sub = binary.BigEndian.AppendUint32(sub, v)
+		}
+	}
+
+	glyphs, err := parseCmap(cmapTable(3, 10, sub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[rune]uint16{'a': 10, 'b': 11, 'c': 12, 0x1F697: 20}
+	if !reflect.DeepEqual(glyphs, want) {
+		t.Errorf("got %v, want %v", glyphs, want)
+	}
+}
+
+func TestParseCmapSkipsNonUnicode(t *testing.T) {
+	// Подтаблица Macintosh Roman (платформа 1) не подходит для Unicode
+	cmap := cmapFormat4([][3]int{{'A', 'A', 1}})
+	binary.BigEndian.PutUint16(cmap[4:], 1)
+	binary.BigEndian.PutUint16(cmap[6:], 0)
+
+	if _, err := parseCmap(cmap); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("got %v, want ErrInvalidFont", err)
+	}
+}
+
+func TestComponents(t *testing.T) {
+	font := testFont(t)
+
+	if got := components(font.glyphData(glyphAAcute)); !reflect.DeepEqual(got, []int{glyphA, glyphAcute}) {
+		t.Errorf("components of composite glyph = %v", got)
+	}
+	if got := components(font.glyphData(glyphA)); got != nil {
+		t.Errorf("components of simple glyph = %v", got)
+	}
+	if got := font.glyphData(testGlyphs + 5); got != nil {
+		t.Errorf("glyph out of loca range has data %v", got)
+	}
+}
+
+func TestSubset(t *testing.T) {
+	font := testFont(t)
+
+	data := font.subset(map[uint16]rune{glyphAAcute: 'Á', glyphB: 'B'})
+	tables := fontTables(t, data)
+
+	var tags []string
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	if got := strings.Join(tags, ","); got != "glyf,head,hhea,hmtx,loca,maxp,prep" {
+		t.Errorf("subset tables %s", got)
+	}
+
+	head := tables["head"]
+	if format := binary.BigEndian.Uint16(head[50:]); format != 1 {
+		t.Errorf("indexToLocFormat = %d, want long", format)
+	}
+	if adjustment := binary.BigEndian.Uint32(head[8:]); adjustment != 0 {
+		t.Errorf("checkSumAdjustment = %08x, want 0", adjustment)
+	}
+	if !bytes.Equal(tables["hmtx"], font.tables["hmtx"]) {
+		t.Error("hmtx changed, glyph widths would be wrong")
+	}
+
+	loca, glyf := tables["loca"], tables["glyf"]
+	if len(loca) != (testGlyphs+1)*4 {
+		t.Fatalf("loca has %d bytes, want %d", len(loca), (testGlyphs+1)*4)
+	}
+	if end := binary.BigEndian.Uint32(loca[testGlyphs*4:]); int(end) != len(glyf) {
+		t.Errorf("last loca offset %d, glyf has %d bytes", end, len(glyf))
+	}
+
+	// Номера глифов сохраняются: использованные и их составляющие на месте, остальные пустые
+	kept := map[int]bool{glyphNotdef: true, glyphA: true, glyphB: true, glyphAcute: true, glyphAAcute: true}
+	for glyph := 0; glyph < testGlyphs; glyph++ {
+		start := binary.BigEndian.Uint32(loca[glyph*4:])
+		end := binary.BigEndian.Uint32(loca[glyph*4+4:])
+		if end < start {
+			t.Fatalf("loca is not monotonic at glyph %d", glyph)
+		}
+		if start%4 != 0 {
+			t.Errorf("glyph %d at unaligned offset %d", glyph, start)
+		}
+
+		original := font.glyphData(glyph)
+		got := glyf[start:end]
+		switch {
+		case kept[glyph] && !bytes.Equal(bytes.TrimRight(got, "\x00"), bytes.TrimRight(original, "\x00")):
+			t.Errorf("glyph %d data changed", glyph)
+		case !kept[glyph] && len(got) != 0:
+			t.Errorf("unused glyph %d kept %d bytes", glyph, len(got))
+		}
+	}
+}
+
+func TestDocumentEmbedsSubset(t *testing.T) {
+	font := testFont(t)
+
+	doc := New()
+	doc.AddPage().Text(font, 10, 50, 50, "BÁ")
+	data, err := doc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"/Subtype /Type0 /BaseFont /EmbeddedFont /Encoding /Identity-H",
+		"/CIDToGIDMap /Identity",
+		"/W [2 [605] 4 [195]]",
+	} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("PDF has no %q", want)
+		}
+	}
+
+	used := doc.fonts[0].glyphs
+	if !reflect.DeepEqual(used, map[uint16]rune{glyphB: 'B', glyphAAcute: 'Á'}) {
+		t.Errorf("used glyphs %v", used)
+	}
+	cmap := string(toUnicode([]int{glyphB, glyphAAcute}, used))
+	if !strings.Contains(cmap, "2 beginbfchar\n<0002> <0042>\n<0004> <00C1>\n") {
+		t.Errorf("ToUnicode CMap:\n%s", cmap)
+	}
+}
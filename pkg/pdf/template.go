@@ -0,0 +1,391 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"tire-pepair-record-service/pkg/qr"
+)
+
+var ErrTemplate = errors.New("ошибка в шаблоне документа")
+
+// Поля страницы и межстрочный интервал
+const (
+	margin      = 42.0
+	lineSpacing = 1.3
+	cellPadding = 3.0
+)
+
+// Fonts шрифты документа. Если Bold не задан, жирный текст выводится обычным шрифтом
+type Fonts struct {
+	Regular *Font
+	Bold    *Font
+}
+
+// Execute заполняет шаблон данными (text/template) и раскладывает результат
+// по страницам. Каждая строка результата - команда разметки:
+//
+//	# комментарий
+//	size 10                  кегль следующих строк
+//	text Текст               абзац с переносом по ширине страницы
+//	bold Текст               жирный абзац
+//	center Текст             абзац по центру
+//	right Текст              абзац по правому краю
+//	space 12                 отступ по вертикали в пунктах
+//	hr                       горизонтальная линия
+//	columns 24 * 60:r 80:r   ширины колонок таблицы, * - остаток; :l :c :r - выравнивание
+//	header № | Наименование  строка заголовка таблицы, повторяется на новой странице
+//	row 1 | Балансировка     строка таблицы, ячейки переносятся по ширине колонки
+//	boldrow Итого | 100,00   жирная строка таблицы
+//	signatures Мастер | Клиент  линии для подписей с подписями под ними
+//	qr 72:r https://...      QR-код со стороной 72 пункта; :l :c :r - выравнивание
+//	page                     новая страница
+//
+// Пустые строки пропускаются
+func Execute(source string, funcs template.FuncMap, data any, fonts Fonts) (*Document, error) {
+	tpl, err := template.New("document").Funcs(funcs).Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTemplate, err)
+	}
+
+	var markup bytes.Buffer
+	if err := tpl.Execute(&markup, data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTemplate, err)
+	}
+
+	layout := NewLayout(fonts)
+	if err := layout.Run(markup.String()); err != nil {
+		return nil, err
+	}
+	return layout.Document(), nil
+}
+
+type column struct {
+	width float64
+	align byte
+}
+
+// Layout раскладывает строки разметки сверху вниз с переносом на новые страницы
+type Layout struct {
+	doc     *Document
+	page    *Page
+	fonts   Fonts
+	size    float64
+	y       float64 // верх следующей строки
+	columns []column
+	header  []string
+}
+
+// NewLayout создает документ с первой страницей
+func NewLayout(fonts Fonts) *Layout {
+	if fonts.Bold == nil {
+		fonts.Bold = fonts.Regular
+	}
+	l := &Layout{doc: New(), fonts: fonts, size: 10}
+	l.newPage()
+	return l
+}
+
+// Document возвращает размеченный документ
+func (l *Layout) Document() *Document {
+	return l.doc
+}
+
+func (l *Layout) newPage() {
+	l.page = l.doc.AddPage()
+	l.y = PageHeight - margin
+}
+
+func (l *Layout) lineHeight() float64 {
+	return l.size * lineSpacing
+}
+
+// ensure переходит на новую страницу, если блок высотой height не помещается
+func (l *Layout) ensure(height float64) bool {
+	if l.y-height >= margin {
+		return false
+	}
+	l.newPage()
+	return true
+}
+
+// Run выполняет строки разметки
+func (l *Layout) Run(markup string) error {
+	for n, line := range strings.Split(markup, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		command, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		if err := l.exec(command, arg); err != nil {
+			return fmt.Errorf("%w: строка %d: %v", ErrTemplate, n+1, err)
+		}
+	}
+	return nil
+}
+
+func (l *Layout) exec(command, arg string) error {
+	switch command {
+	case "size":
+		size, err := strconv.ParseFloat(arg, 64)
+		if err != nil || size <= 0 || size > 72 {
+			return fmt.Errorf("некорректный кегль %q", arg)
+		}
+		l.size = size
+	case "text":
+		l.paragraph(l.fonts.Regular, arg, 'l')
+	case "bold":
+		l.paragraph(l.fonts.Bold, arg, 'l')
+	case "center":
+		l.paragraph(l.fonts.Regular, arg, 'c')
+	case "right":
+		l.paragraph(l.fonts.Regular, arg, 'r')
+	case "space":
+		space, err := strconv.ParseFloat(arg, 64)
+		if err != nil || space < 0 {
+			return fmt.Errorf("некорректный отступ %q", arg)
+		}
+		if !l.ensure(space) {
+			l.y -= space
+		}
+	case "hr":
+		l.ensure(l.size / 2)
+		l.y -= l.size / 4
+		l.page.Line(margin, l.y, PageWidth-margin, l.y, 0.5)
+		l.y -= l.size / 4
+	case "columns":
+		return l.setColumns(arg)
+	case "header":
+		l.header = splitCells(arg)
+		l.row(l.fonts.Bold, l.header, true)
+	case "row":
+		if len(l.columns) == 0 {
+			return errors.New("строка таблицы до команды columns")
+		}
+		l.row(l.fonts.Regular, splitCells(arg), false)
+	case "boldrow":
+		if len(l.columns) == 0 {
+			return errors.New("строка таблицы до команды columns")
+		}
+		l.row(l.fonts.Bold, splitCells(arg), false)
+	case "signatures":
+		l.signatures(splitCells(arg))
+	case "qr":
+		return l.qr(arg)
+	case "page":
+		l.newPage()
+	default:
+		return fmt.Errorf("неизвестная команда %q", command)
+	}
+	return nil
+}
+
+// setColumns разбирает ширины колонок. Колонки * делят оставшуюся ширину поровну
+func (l *Layout) setColumns(arg string) error {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 {
+		return errors.New("не заданы колонки")
+	}
+
+	columns := make([]column, len(fields))
+	var fixed float64
+	var flexible int
+	for i, field := range fields {
+		width, align, _ := strings.Cut(field, ":")
+		switch align {
+		case "", "l":
+			columns[i].align = 'l'
+		case "c", "r":
+			columns[i].align = align[0]
+		default:
+			return fmt.Errorf("некорректное выравнивание %q", field)
+		}
+
+		if width == "*" {
+			flexible++
+			continue
+		}
+		value, err := strconv.ParseFloat(width, 64)
+		if err != nil || value <= 0 {
+			return fmt.Errorf("некорректная ширина колонки %q", field)
+		}
+		columns[i].width = value
+		fixed += value
+	}
+
+	available := PageWidth - 2*margin
+	if fixed > available {
+		return errors.New("колонки шире страницы")
+	}
+	for i := range columns {
+		if columns[i].width == 0 {
+			columns[i].width = (available - fixed) / float64(flexible)
+		}
+	}
+
+	l.columns = columns
+	l.header = nil
+	return nil
+}
+
+func splitCells(arg string) []string {
+	cells := strings.Split(arg, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// wrap разбивает текст на строки не шире width
+func wrap(font *Font, size, width float64, text string) []string {
+	var lines []string
+	var current string
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if current != "" {
+			candidate = current + " " + word
+		}
+		if current == "" || font.Width(candidate, size) <= width {
+			current = candidate
+			continue
+		}
+		lines = append(lines, current)
+		current = word
+	}
+	if current != "" || len(lines) == 0 {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// aligned возвращает x начала строки с выравниванием align в полосе [left, left+width]
+func aligned(font *Font, size, left, width float64, text string, align byte) float64 {
+	switch align {
+	case 'c':
+		return left + (width-font.Width(text, size))/2
+	case 'r':
+		return left + width - font.Width(text, size)
+	}
+	return left
+}
+
+func (l *Layout) baseline() float64 {
+	return l.y - l.size
+}
+
+func (l *Layout) paragraph(font *Font, text string, align byte) {
+	width := PageWidth - 2*margin
+	for _, line := range wrap(font, l.size, width, text) {
+		l.ensure(l.lineHeight())
+		l.page.Text(font, l.size, aligned(font, l.size, margin, width, line, align), l.baseline(), line)
+		l.y -= l.lineHeight()
+	}
+}
+
+// row выводит строку таблицы. Лишние ячейки отбрасываются, недостающие остаются пустыми
+func (l *Layout) row(font *Font, cells []string, header bool) {
+	wrapped := make([][]string, len(l.columns))
+	height := 1
+	for i, col := range l.columns {
+		var text string
+		if i < len(cells) {
+			text = cells[i]
+		}
+		wrapped[i] = wrap(font, l.size, col.width-2*cellPadding, text)
+		height = max(height, len(wrapped[i]))
+	}
+
+	rowHeight := float64(height)*l.lineHeight() + cellPadding
+	if l.ensure(rowHeight) && !header && l.header != nil {
+		l.row(l.fonts.Bold, l.header, true)
+	}
+
+	left := margin
+	for i, col := range l.columns {
+		for j, line := range wrapped[i] {
+			x := aligned(font, l.size, left+cellPadding, col.width-2*cellPadding, line, col.align)
+			l.page.Text(font, l.size, x, l.baseline()-float64(j)*l.lineHeight(), line)
+		}
+		left += col.width
+	}
+	l.y -= rowHeight
+
+	if header {
+		l.page.Line(margin, l.y+cellPadding/2, PageWidth-margin, l.y+cellPadding/2, 0.5)
+	}
+}
+
+// signatures рисует линии для подписей в ряд, под каждой - подпись
+func (l *Layout) signatures(labels []string) {
+	height := 3 * l.lineHeight()
+	l.ensure(height)
+
+	gap := 24.0
+	width := (PageWidth - 2*margin - gap*float64(len(labels)-1)) / float64(len(labels))
+	lineY := l.y - 2*l.lineHeight()
+	small := l.size * 0.8
+
+	for i, label := range labels {
+		left := margin + float64(i)*(width+gap)
+		l.page.Line(left, lineY, left+width, lineY, 0.5)
+		l.page.Text(l.fonts.Regular, small, aligned(l.fonts.Regular, small, left, width, label, 'c'),
+			lineY-small*1.2, label)
+	}
+	l.y -= height
+}
+
+// qr выводит QR-код. Аргумент - сторона в пунктах с выравниванием и данные
+func (l *Layout) qr(arg string) error {
+	sizeArg, data, _ := strings.Cut(arg, " ")
+	data = strings.TrimSpace(data)
+	if data == "" {
+		return errors.New("не заданы данные QR-кода")
+	}
+
+	width, alignArg, _ := strings.Cut(sizeArg, ":")
+	size, err := strconv.ParseFloat(width, 64)
+	if err != nil || size <= 0 || size > PageWidth-2*margin {
+		return fmt.Errorf("некорректный размер QR-кода %q", sizeArg)
+	}
+
+	code, err := qr.Encode(data)
+	if err != nil {
+		return err
+	}
+
+	l.ensure(size)
+	left := margin
+	switch alignArg {
+	case "", "l":
+	case "c":
+		left = (PageWidth - size) / 2
+	case "r":
+		left = PageWidth - margin - size
+	default:
+		return fmt.Errorf("некорректное выравнивание %q", sizeArg)
+	}
+
+	// Светлая рамка входит в размер, темные модули строки объединяются в полосы
+	module := size / float64(code.Size+2*qr.QuietZone)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; {
+			if !code.Dark(x, y) {
+				x++
+				continue
+			}
+			start := x
+			for x < code.Size && code.Dark(x, y) {
+				x++
+			}
+			l.page.FillRect(left+float64(start+qr.QuietZone)*module,
+				l.y-float64(y+qr.QuietZone+1)*module, float64(x-start)*module, module)
+		}
+	}
+	l.y -= size
+	return nil
+}
@@ -0,0 +1,456 @@
+// Package qr строит QR-коды (ISO/IEC 18004) в байтовом режиме с уровнем
+// коррекции ошибок M и выводит их в PNG и SVG
+package qr
+
+import (
+	"errors"
+	"math"
+)
+
+var ErrTooLong = errors.New("данные не помещаются в QR-код")
+
+// Число кодовых слов коррекции в блоке и число блоков для уровня M, по версиям 1-40
+var (
+	eccPerBlock = [41]int{0,
+		10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26,
+		26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28}
+	eccBlocks = [41]int{0,
+		1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16,
+		17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49}
+)
+
+// Биты уровня коррекции M в информации о формате
+const formatBitsM = 0
+
+// Code QR-код: квадрат из Size x Size модулей
+type Code struct {
+	Size     int
+	modules  [][]bool
+	function [][]bool // служебные модули, которые не маскируются
+}
+
+// Dark сообщает, что модуль в столбце x строки y темный
+func (c *Code) Dark(x, y int) bool {
+	return x >= 0 && y >= 0 && x < c.Size && y < c.Size && c.modules[y][x]
+}
+
+// Encode строит QR-код минимальной версии, вмещающей данные
+func Encode(data string) (*Code, error) {
+	version := 0
+	for v := 1; v <= 40; v++ {
+		if 4+countBits(v)+8*len(data) <= dataCodewords(v)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	c := &Code{Size: version*4 + 17}
+	c.modules = grid(c.Size)
+	c.function = grid(c.Size)
+
+	c.drawFunctionPatterns(version)
+	c.drawCodewords(interleave(version, encodeData(version, data)))
+
+	// Выбирается маска с наименьшим штрафом
+	best, bestPenalty := 0, math.MaxInt
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		c.applyMask(mask)
+	}
+	c.applyMask(best)
+	c.drawFormatBits(best)
+
+	return c, nil
+}
+
+func grid(size int) [][]bool {
+	g := make([][]bool, size)
+	for i := range g {
+		g[i] = make([]bool, size)
+	}
+	return g
+}
+
+// countBits длина поля количества байтов для версии
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// rawModules число модулей под данные и коррекцию без служебных узоров
+func rawModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		result -= (25*align-10)*align - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// dataCodewords число кодовых слов данных для версии
+func dataCodewords(version int) int {
+	return rawModules(version)/8 - eccPerBlock[version]*eccBlocks[version]
+}
+
+// bitBuffer последовательность битов, старший бит первым
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, value>>i&1 == 1)
+	}
+}
+
+// encodeData кодирует данные в байтовом режиме и дополняет до емкости версии
+func encodeData(version int, data string) []byte {
+	var bits bitBuffer
+	bits.append(0b0100, 4)
+	bits.append(len(data), countBits(version))
+	for i := 0; i < len(data); i++ {
+		bits.append(int(data[i]), 8)
+	}
+
+	capacity := dataCodewords(version) * 8
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xec; len(bits) < capacity; pad ^= 0xec ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return codewords
+}
+
+// interleave делит данные на блоки, добавляет к ним коды Рида-Соломона
+// и перемежает кодовые слова блоков
+func interleave(version int, data []byte) []byte {
+	numBlocks := eccBlocks[version]
+	eccLen := eccPerBlock[version]
+	raw := rawModules(version) / 8
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+
+	divisor := rsDivisor(eccLen)
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		length := shortLen - eccLen
+		if i >= numShort {
+			length++
+		}
+		block := append([]byte(nil), data[k:k+length]...)
+		k += length
+
+		ecc := rsRemainder(block, divisor)
+		if i < numShort {
+			block = append(block, 0) // выравнивание с длинными блоками, не выводится
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, raw)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortLen-eccLen || j >= numShort {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// gfMultiply умножение в поле GF(256) с образующим многочленом 0x11d
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11d
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// rsDivisor порождающий многочлен кода Рида-Соломона степени degree
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 2)
+	}
+	return result
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMultiply(coef, factor)
+		}
+	}
+	return result
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.function[y][x] = true
+}
+
+// drawFunctionPatterns рисует поисковые, выравнивающие и синхронизирующие узоры,
+// резервирует место под формат и записывает номер версии
+func (c *Code) drawFunctionPatterns(version int) {
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	positions := alignmentPositions(version, c.Size)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Место под формат занимается заранее, биты пишутся после выбора маски
+	c.drawFormatBits(0)
+
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = rem<<1 ^ (rem>>11)*0x1f25
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := bits>>i&1 == 1
+			a, b := c.Size-11+i%3, i/3
+			c.setFunction(a, b, dark)
+			c.setFunction(b, a, dark)
+		}
+	}
+}
+
+// drawFinder рисует поисковый узор с разделителем вокруг центра (x, y)
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx >= 0 && xx < c.Size && yy >= 0 && yy < c.Size {
+				dist := max(abs(dx), abs(dy))
+				c.setFunction(xx, yy, dist != 2 && dist != 4)
+			}
+		}
+	}
+}
+
+// alignmentPositions координаты центров выравнивающих узоров
+func alignmentPositions(version, size int) []int {
+	if version == 1 {
+		return nil
+	}
+	count := version/7 + 2
+	step := (version*8 + count*3 + 5) / (count*4 - 4) * 2
+
+	result := make([]int, count)
+	result[0] = 6
+	for i, pos := count-1, size-7; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+	return result
+}
+
+// drawFormatBits записывает уровень коррекции и номер маски в обе копии поля формата
+func (c *Code) drawFormatBits(mask int) {
+	data := formatBitsM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(i))
+	}
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(i))
+	}
+	c.setFunction(8, c.Size-8, true) // темный модуль
+}
+
+// drawCodewords раскладывает кодовые слова зигзагом по столбцам пар модулей
+// снизу вверх и сверху вниз
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // столбец синхронизирующего узора пропускается
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+				if !c.function[y][x] && i < len(data)*8 {
+					c.modules[y][x] = data[i/8]>>(7-i%8)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask инвертирует модули данных по маске. Повторное наложение снимает маску
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !c.function[y][x] {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// Узоры, похожие на поисковый (1:1:3:1:1 со светлой полосой с одной стороны)
+var finderLike = [2][]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// penalty штраф по четырем правилам стандарта: серии одного цвета, квадраты 2x2,
+// узоры, похожие на поисковый, и перекос доли темных модулей
+func (c *Code) penalty() int {
+	result := 0
+	at := func(x, y int, transposed bool) bool {
+		if transposed {
+			return c.modules[x][y]
+		}
+		return c.modules[y][x]
+	}
+
+	for _, transposed := range []bool{false, true} {
+		for y := 0; y < c.Size; y++ {
+			run := 1
+			for x := 1; x < c.Size; x++ {
+				if at(x, y, transposed) == at(x-1, y, transposed) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					result += run - 2
+				}
+				run = 1
+			}
+			if run >= 5 {
+				result += run - 2
+			}
+
+			for x := 0; x+len(finderLike[0]) <= c.Size; x++ {
+				for _, pattern := range finderLike {
+					match := true
+					for k, dark := range pattern {
+						if at(x+k, y, transposed) != dark {
+							match = false
+							break
+						}
+					}
+					if match {
+						result += 40
+					}
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x+1 < c.Size && y+1 < c.Size {
+				color := c.modules[y][x]
+				if color == c.modules[y][x+1] && color == c.modules[y+1][x] && color == c.modules[y+1][x+1] {
+					result += 3
+				}
+			}
+		}
+	}
+
+	total := c.Size * c.Size
+	result += ((abs(dark*20-total*10)+total-1)/total - 1) * 10
+	return result
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
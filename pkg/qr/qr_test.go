@@ -0,0 +1,357 @@
+package qr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Таблицы стандарта для уровня M, независимые от кодировщика: центры
+// выравнивающих узоров и блоки (число блоков и кодовых слов данных в группах,
+// кодовых слов коррекции в блоке)
+var (
+	specAlignment = [11][]int{nil,
+		nil, {6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34}, {6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50}}
+
+	specBlocks = [11]struct{ count1, data1, count2, data2, ecc int }{{},
+		{1, 16, 0, 0, 10}, {1, 28, 0, 0, 16}, {1, 44, 0, 0, 26}, {2, 32, 0, 0, 18}, {2, 43, 0, 0, 24},
+		{4, 27, 0, 0, 16}, {4, 31, 0, 0, 18}, {2, 38, 2, 39, 22}, {3, 36, 2, 37, 22}, {4, 43, 1, 44, 26}}
+)
+
+// gf арифметика GF(256) по таблицам степеней для проверки синдромов
+type gf struct{ exp, log [256]int }
+
+func newGF() *gf {
+	var f gf
+	x := 1
+	for i := 0; i < 255; i++ {
+		f.exp[i] = x
+		f.log[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	return &f
+}
+
+func (f *gf) mul(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return f.exp[(f.log[a]+f.log[b])%255]
+}
+
+// decoder читает код так, как его читает сканер: формат, снятие маски,
+// зигзаг, разбор блоков и байтового режима
+type decoder struct {
+	t       *testing.T
+	code    *Code
+	version int
+}
+
+// reserved модули служебных узоров, вычисленные по стандарту
+func (d *decoder) reserved(x, y int) bool {
+	size := d.code.Size
+	switch {
+	case x <= 8 && y <= 8, x >= size-8 && y <= 8, x <= 8 && y >= size-8: // поиск, разделители, формат
+		return true
+	case x == 6 || y == 6: // синхронизация
+		return true
+	case d.version >= 7 && (x >= size-11 && x < size-8 && y < 6 || y >= size-11 && y < size-8 && x < 6): // версия
+		return true
+	}
+	positions := specAlignment[d.version]
+	last := len(positions) - 1
+	for i, cx := range positions {
+		for j, cy := range positions {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			if abs(x-cx) <= 2 && abs(y-cy) <= 2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// format возвращает маску из обеих копий поля формата и проверяет код БЧХ
+func (d *decoder) format() int {
+	size := d.code.Size
+	bit := func(x, y int) int {
+		if d.code.Dark(x, y) {
+			return 1
+		}
+		return 0
+	}
+
+	var first, second int
+	for i := 0; i <= 5; i++ {
+		first |= bit(8, i) << i
+	}
+	first |= bit(8, 7)<<6 | bit(8, 8)<<7 | bit(7, 8)<<8
+	for i := 9; i < 15; i++ {
+		first |= bit(14-i, 8) << i
+	}
+	for i := 0; i < 8; i++ {
+		second |= bit(size-1-i, 8) << i
+	}
+	for i := 8; i < 15; i++ {
+		second |= bit(8, size-15+i) << i
+	}
+	if first != second {
+		d.t.Fatalf("format copies differ: %015b and %015b", first, second)
+	}
+	if bit(8, size-8) != 1 {
+		d.t.Error("dark module is light")
+	}
+
+	bits := first ^ 0x5412
+	rem := bits
+	for i := 14; i >= 10; i-- {
+		if rem>>i&1 == 1 {
+			rem ^= 0x537 << (i - 10)
+		}
+	}
+	if rem != 0 {
+		d.t.Fatalf("format %015b fails BCH check", first)
+	}
+	if level := bits >> 13; level != 0b00 {
+		d.t.Fatalf("error correction level bits %02b, want M (00)", level)
+	}
+	return bits >> 10 & 7
+}
+
+// versionInfo проверяет блоки номера версии для версий 7 и выше
+func (d *decoder) versionInfo() {
+	if d.version < 7 {
+		return
+	}
+	var bottom, right int
+	for i := 0; i < 18; i++ {
+		a, b := d.code.Size-11+i%3, i/3
+		if d.code.Dark(b, a) {
+			bottom |= 1 << i
+		}
+		if d.code.Dark(a, b) {
+			right |= 1 << i
+		}
+	}
+	if bottom != right || bottom>>12 != d.version {
+		d.t.Errorf("version info %018b and %018b, want version %d", bottom, right, d.version)
+	}
+}
+
+// codewords снимает маску и читает кодовые слова зигзагом
+func (d *decoder) codewords(mask int, total int) []byte {
+	masks := [8]func(i, j int) bool{
+		func(i, j int) bool { return (i+j)%2 == 0 },
+		func(i, j int) bool { return i%2 == 0 },
+		func(i, j int) bool { return j%3 == 0 },
+		func(i, j int) bool { return (i+j)%3 == 0 },
+		func(i, j int) bool { return (i/2+j/3)%2 == 0 },
+		func(i, j int) bool { return i*j%2+i*j%3 == 0 },
+		func(i, j int) bool { return (i*j%2+i*j%3)%2 == 0 },
+		func(i, j int) bool { return ((i+j)%2+i*j%3)%2 == 0 },
+	}
+
+	size := d.code.Size
+	result := make([]byte, total)
+	n := 0
+	upward := true
+	for right := size - 1; right > 0; right -= 2 {
+		if right == 6 {
+			right--
+		}
+		for k := 0; k < size; k++ {
+			y := k
+			if upward {
+				y = size - 1 - k
+			}
+			for x := right; x >= right-1; x-- {
+				if d.reserved(x, y) || n >= total*8 {
+					continue
+				}
+				if d.code.Dark(x, y) != masks[mask](y, x) {
+					result[n/8] |= 1 << (7 - n%8)
+				}
+				n++
+			}
+		}
+		upward = !upward
+	}
+	if n < total*8 {
+		d.t.Fatalf("read %d bits, want %d", n, total*8)
+	}
+	return result
+}
+
+// decode возвращает данные кода
+func (d *decoder) decode() string {
+	d.version = (d.code.Size - 17) / 4
+	if d.version < 1 || d.version >= len(specBlocks) || d.code.Size != d.version*4+17 {
+		d.t.Fatalf("size %d is out of the test tables", d.code.Size)
+	}
+	d.versionInfo()
+	mask := d.format()
+
+	spec := specBlocks[d.version]
+	var lengths []int
+	for i := 0; i < spec.count1; i++ {
+		lengths = append(lengths, spec.data1)
+	}
+	for i := 0; i < spec.count2; i++ {
+		lengths = append(lengths, spec.data2)
+	}
+	total := 0
+	for _, length := range lengths {
+		total += length + spec.ecc
+	}
+	raw := d.codewords(mask, total)
+
+	// Кодовые слова данных перемежаются по блокам, затем слова коррекции
+	blocks := make([][]byte, len(lengths))
+	k := 0
+	for i := 0; i < max(spec.data1, spec.data2); i++ {
+		for j, length := range lengths {
+			if i < length {
+				blocks[j] = append(blocks[j], raw[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < spec.ecc; i++ {
+		for j := range blocks {
+			blocks[j] = append(blocks[j], raw[k])
+			k++
+		}
+	}
+
+	// Блок без ошибок - кратное порождающего многочлена: все синдромы нулевые
+	f := newGF()
+	var data []byte
+	for j, block := range blocks {
+		for s := 0; s < spec.ecc; s++ {
+			syndrome := 0
+			for _, c := range block {
+				syndrome = f.mul(syndrome, f.exp[s]) ^ int(c)
+			}
+			if syndrome != 0 {
+				d.t.Fatalf("block %d: syndrome %d is %d", j, s, syndrome)
+			}
+		}
+		data = append(data, block[:lengths[j]]...)
+	}
+
+	pos := 0
+	read := func(n int) int {
+		v := 0
+		for i := 0; i < n; i++ {
+			v = v<<1 | int(data[pos/8]>>(7-pos%8)&1)
+			pos++
+		}
+		return v
+	}
+	if mode := read(4); mode != 0b0100 {
+		d.t.Fatalf("mode %04b, want byte mode", mode)
+	}
+	countLength := 8
+	if d.version >= 10 {
+		countLength = 16
+	}
+	count := read(countLength)
+	if pos+8*count > len(data)*8 {
+		d.t.Fatalf("count %d exceeds capacity", count)
+	}
+	var out strings.Builder
+	for i := 0; i < count; i++ {
+		out.WriteByte(byte(read(8)))
+	}
+
+	if rest := len(data)*8 - pos; rest > 0 {
+		if terminator := read(min(4, rest)); terminator != 0 {
+			d.t.Errorf("terminator %04b, want zeros", terminator)
+		}
+		pos = (pos + 7) / 8 * 8
+		for pad := byte(0xec); pos < len(data)*8; pad ^= 0xec ^ 0x11 {
+			if got := data[pos/8]; got != pad {
+				d.t.Fatalf("pad byte %#x at %d, want %#x", got, pos/8, pad)
+			}
+			pos += 8
+		}
+	}
+	return out.String()
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		data    string
+		version int
+	}{
+		{"", 1},
+		{"https://a.ru", 1},
+		{strings.Repeat("a", 14), 1}, // предел версии 1 для уровня M
+		{strings.Repeat("a", 15), 2},
+		{"https://shina.example.ru/status.html?token=3f9a1c", 4},
+		{"Запись А123ВС77 на 14.03.2026", 3}, // UTF-8 кодируется байтами
+		{strings.Repeat("0123456789", 10), 6},
+		{strings.Repeat("x", 122), 7},
+		{strings.Repeat("y", 152), 8},
+		{strings.Repeat("z", 180), 9},
+		{strings.Repeat("\x00\xff", 106), 10}, // 16-битное поле длины
+		{strings.Repeat("w", 213), 10},
+	} {
+		code, err := Encode(tt.data)
+		if err != nil {
+			t.Fatalf("Encode(%d bytes): %v", len(tt.data), err)
+		}
+		if want := tt.version*4 + 17; code.Size != want {
+			t.Errorf("Encode(%d bytes): size %d, want %d (version %d)", len(tt.data), code.Size, want, tt.version)
+			continue
+		}
+
+		d := &decoder{t: t, code: code}
+		if got := d.decode(); got != tt.data {
+			t.Errorf("decoded %q, want %q", got, tt.data)
+		}
+	}
+}
+
+func TestEncodeFunctionPatterns(t *testing.T) {
+	code, err := Encode("https://shina.example.ru/status.html?token=3f9a1c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Поисковые узоры в трех углах: рамка 7x7, светлое кольцо и центр 3x3
+	for _, corner := range [][2]int{{0, 0}, {code.Size - 7, 0}, {0, code.Size - 7}} {
+		for dy := 0; dy < 7; dy++ {
+			for dx := 0; dx < 7; dx++ {
+				ring := max(abs(dx-3), abs(dy-3))
+				if want := ring != 2; code.Dark(corner[0]+dx, corner[1]+dy) != want {
+					t.Fatalf("finder at %v: module (%d, %d) dark %v", corner, dx, dy, !want)
+				}
+			}
+		}
+	}
+
+	for i := 8; i < code.Size-8; i++ {
+		if code.Dark(i, 6) != (i%2 == 0) || code.Dark(6, i) != (i%2 == 0) {
+			t.Fatalf("timing pattern broken at %d", i)
+		}
+	}
+
+	if code.Dark(-1, 0) || code.Dark(0, code.Size) {
+		t.Error("modules outside the code are dark")
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(strings.Repeat("a", 2331)); err != nil {
+		t.Errorf("2331 bytes (version 40 capacity): %v", err)
+	}
+	if _, err := Encode(strings.Repeat("a", 2332)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("2332 bytes: got %v, want ErrTooLong", err)
+	}
+}
@@ -0,0 +1,65 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// QuietZone светлая рамка вокруг кода в модулях, требуемая стандартом
+const QuietZone = 4
+
+// PNG выводит код черно-белым изображением, scale - пикселей на модуль
+func (c *Code) PNG(scale int) ([]byte, error) {
+	scale = max(scale, 1)
+	side := (c.Size + 2*QuietZone) * scale
+
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			top, left := (y+QuietZone)*scale, (x+QuietZone)*scale
+			for py := top; py < top+scale; py++ {
+				for px := left; px < left+scale; px++ {
+					img.SetColorIndex(px, py, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG выводит код векторным изображением: один путь из горизонтальных
+// отрезков темных модулей, размер задается в модулях и масштабируется стилями
+func (c *Code) SVG() []byte {
+	side := c.Size + 2*QuietZone
+
+	var path bytes.Buffer
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; {
+			if !c.modules[y][x] {
+				x++
+				continue
+			}
+			start := x
+			for x < c.Size && c.modules[y][x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start+QuietZone, y+QuietZone, x-start, x-start)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, side, side)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path d="%s" fill="#000"/></svg>`, side, side, path.String())
+	return buf.Bytes()
+}
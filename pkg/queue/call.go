@@ -0,0 +1,125 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+)
+
+var (
+	ErrQueueEmpty = errors.New("в очереди нет клиентов, которых можно вызвать")
+	ErrBayBusy    = errors.New("пост занят")
+	ErrNoFreeBay  = errors.New("нет свободных постов")
+	ErrInvalidBay = errors.New("нет поста с таким номером")
+)
+
+// callMu не дает двум одновременным вызовам выбрать одну и ту же запись
+var callMu sync.Mutex
+
+// Order упорядочивает сегодняшние записи: сначала принятые и в работе,
+// затем ожидающие в порядке вызова
+func Order(records []db.Record, estimates map[int64]Estimate) []db.Record {
+	ordered := make([]db.Record, len(records))
+	copy(ordered, records)
+
+	rank := func(r db.Record) int {
+		if r.Status != "wait" {
+			return 0
+		}
+		if estimate, ok := estimates[r.ID]; ok {
+			return estimate.Position
+		}
+		return len(records) + 1
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return rank(ordered[i]) < rank(ordered[j])
+	})
+	return ordered
+}
+
+// freeBay возвращает пост для вызова: указанный, если он свободен, или первый свободный.
+// Пост мастера по умолчанию мог остаться за пределами db.Bays после смены настройки
+func freeBay(records []db.Record, bay int) (int, error) {
+	if bay < 0 || bay > db.Bays {
+		return 0, fmt.Errorf("%w: %d", ErrInvalidBay, bay)
+	}
+
+	occupied := make(map[int]bool)
+	for _, r := range records {
+		if (r.Status == "welcome" || r.Status == "in work") && r.Bay != nil {
+			occupied[*r.Bay] = true
+		}
+	}
+
+	if bay > 0 {
+		if occupied[bay] {
+			return 0, ErrBayBusy
+		}
+		return bay, nil
+	}
+
+	for i := 1; i <= db.Bays; i++ {
+		if !occupied[i] {
+			return i, nil
+		}
+	}
+	return 0, ErrNoFreeBay
+}
+
+// CallNext выбирает следующего клиента на пост и переводит его запись в статус welcome.
+// bay = 0 - пост мастера по умолчанию или первый свободный пост. Если указан мастер,
+// запись назначается на него
+func CallNext(now time.Time, bay int, mechanicID *int64) (*db.Record, error) {
+	callMu.Lock()
+	defer callMu.Unlock()
+
+	if mechanicID != nil {
+		mechanic, err := db.GetStaff(*mechanicID)
+		if err != nil {
+			return nil, err
+		}
+		if !mechanic.Active {
+			return nil, fmt.Errorf("%w: ID %d", db.ErrStaffInactive, mechanic.ID)
+		}
+		if bay == 0 && mechanic.Bay != nil {
+			bay = *mechanic.Bay
+		}
+	}
+
+	s, err := load(now)
+	if err != nil {
+		return nil, err
+	}
+
+	bay, err = freeBay(s.records, bay)
+	if err != nil {
+		return nil, err
+	}
+
+	// Остальные посты освобождаются по мере завершения текущих работ
+	duration := durationOf(s.durations)
+	var otherFree []time.Time
+	if db.Bays > 1 {
+		otherFree = freeTimes(now, db.Bays-1, s.busy, duration)
+	}
+
+	i := pick(now, s.waiting, otherFree, duration)
+	if i < 0 {
+		return nil, ErrQueueEmpty
+	}
+
+	var record *db.Record
+	for _, r := range s.records {
+		if r.ID == s.waiting[i].ID {
+			record = &r
+			break
+		}
+	}
+
+	status := "welcome"
+	return db.PatchRecord(record.ID, db.RecordPatch{Status: &status, Bay: &bay, MechanicID: mechanicID}, record.Version)
+}
@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"sort"
+	"time"
+)
+
+// AppointmentGrace окно вокруг времени записи, в течение которого записавшийся
+// клиент обслуживается раньше живой очереди. После окна опоздавший встает
+// в общую очередь по времени своей записи
+var AppointmentGrace = 15 * time.Minute
+
+// Candidate ожидающая запись
+type Candidate struct {
+	ID      int64
+	Service string
+	Booked  bool      // предварительная запись на время
+	Ready   time.Time // время записи или время постановки в живую очередь
+}
+
+// durationFunc возвращает ожидаемую длительность вида работ
+type durationFunc func(service string) time.Duration
+
+// before задает детерминированный порядок: по времени готовности, затем по ID
+func before(a, b Candidate) bool {
+	if !a.Ready.Equal(b.Ready) {
+		return a.Ready.Before(b.Ready)
+	}
+	return a.ID < b.ID
+}
+
+// pick выбирает, кого вызвать на пост, освободившийся в момент t:
+//   - записавшийся клиент в пределах окна AppointmentGrace имеет приоритет;
+//   - иначе вызывается живая очередь (и опоздавшие) по времени готовности,
+//     если работа не помешает ближайшей записи: она успевает закончиться
+//     до конца окна записи или к этому времени освободится другой пост.
+//
+// otherFree время освобождения остальных постов. Возвращает индекс в pool или -1
+func pick(t time.Time, pool []Candidate, otherFree []time.Time, duration durationFunc) int {
+	due, walkIn, upcoming := -1, -1, -1
+
+	for i, c := range pool {
+		switch {
+		case c.Booked && !t.Before(c.Ready.Add(-AppointmentGrace)) && !t.After(c.Ready.Add(AppointmentGrace)):
+			if due < 0 || before(c, pool[due]) {
+				due = i
+			}
+		case c.Booked && t.Before(c.Ready.Add(-AppointmentGrace)):
+			if upcoming < 0 || before(c, pool[upcoming]) {
+				upcoming = i
+			}
+		case !c.Ready.After(t):
+			if walkIn < 0 || before(c, pool[walkIn]) {
+				walkIn = i
+			}
+		}
+	}
+
+	if due >= 0 {
+		return due
+	}
+	if walkIn < 0 {
+		return -1
+	}
+	if upcoming < 0 {
+		return walkIn
+	}
+
+	// Заполняем окно до ближайшей записи, не задерживая ее
+	deadline := pool[upcoming].Ready.Add(AppointmentGrace)
+	if !t.Add(duration(pool[walkIn].Service)).After(deadline) {
+		return walkIn
+	}
+	for _, free := range otherFree {
+		if !free.After(deadline) {
+			return walkIn
+		}
+	}
+
+	return -1
+}
+
+// nextReady ближайший после t момент, когда кого-то из pool можно будет вызвать
+func nextReady(t time.Time, pool []Candidate) time.Time {
+	var next time.Time
+	for _, c := range pool {
+		ready := c.Ready
+		if c.Booked {
+			ready = ready.Add(-AppointmentGrace)
+		}
+		if ready.After(t) && (next.IsZero() || ready.Before(next)) {
+			next = ready
+		}
+	}
+	return next
+}
+
+// Assignment запланированный вызов записи
+type Assignment struct {
+	Candidate
+	Start time.Time
+}
+
+// Plan моделирует вызовы на посты, начиная с моментов их освобождения free,
+// и возвращает ожидающие записи в порядке обслуживания
+func Plan(free []time.Time, waiting []Candidate, duration durationFunc) []Assignment {
+	bays := make([]time.Time, len(free))
+	copy(bays, free)
+
+	pool := make([]Candidate, len(waiting))
+	copy(pool, waiting)
+
+	plan := make([]Assignment, 0, len(pool))
+	for len(pool) > 0 && len(bays) > 0 {
+		sort.Slice(bays, func(a, b int) bool { return bays[a].Before(bays[b]) })
+		t := bays[0]
+
+		i := pick(t, pool, bays[1:], duration)
+		if i < 0 {
+			next := nextReady(t, pool)
+			if next.IsZero() {
+				break
+			}
+			bays[0] = next
+			continue
+		}
+
+		plan = append(plan, Assignment{Candidate: pool[i], Start: t})
+		bays[0] = t.Add(duration(pool[i].Service))
+		pool = append(pool[:i], pool[i+1:]...)
+	}
+
+	return plan
+}
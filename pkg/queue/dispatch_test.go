@@ -0,0 +1,187 @@
+package queue
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+)
+
+// clock время сегодняшнего дня
+func clock(hour, minute int) time.Time {
+	return time.Date(2026, 3, 14, hour, minute, 0, 0, time.UTC)
+}
+
+// testDuration 30 минут на любую работу, 60 на "long"
+func testDuration(service string) time.Duration {
+	if service == "long" {
+		return 60 * time.Minute
+	}
+	return 30 * time.Minute
+}
+
+func walkIn(id int64, ready time.Time) Candidate {
+	return Candidate{ID: id, Ready: ready}
+}
+
+func booked(id int64, at time.Time) Candidate {
+	return Candidate{ID: id, Booked: true, Ready: at}
+}
+
+func TestPick(t *testing.T) {
+	now := clock(10, 0)
+	long := walkIn(1, clock(9, 50))
+	long.Service = "long"
+
+	for _, tt := range []struct {
+		name      string
+		pool      []Candidate
+		otherFree []time.Time
+		want      int64 // ID выбранной записи, 0 - никого
+	}{
+		{"empty", nil, nil, 0},
+		{"walk-in not arrived yet", []Candidate{walkIn(1, clock(10, 5))}, nil, 0},
+		{"equal walk-in times by ID", []Candidate{walkIn(5, clock(9, 0)), walkIn(3, clock(9, 0))}, nil, 3},
+		{"equal booking times by ID", []Candidate{booked(7, clock(10, 0)), booked(4, clock(10, 0))}, nil, 4},
+		{"earliest walk-in", []Candidate{walkIn(1, clock(9, 30)), walkIn(2, clock(9, 10))}, nil, 2},
+
+		// Записавшийся в окне AppointmentGrace вызывается раньше живой очереди
+		{"booking ahead inside grace", []Candidate{walkIn(1, clock(9, 0)), booked(2, clock(10, 15))}, nil, 2},
+		{"late booking inside grace", []Candidate{walkIn(1, clock(9, 0)), booked(2, clock(9, 45))}, nil, 2},
+		{"earliest of due bookings", []Candidate{booked(1, clock(10, 10)), booked(2, clock(9, 50))}, nil, 2},
+
+		// За пределами окна опоздавший встает в очередь по времени своей записи
+		{"late booking outside grace after walk-in", []Candidate{walkIn(1, clock(9, 30)), booked(2, clock(9, 40))}, nil, 1},
+		{"late booking outside grace before walk-in", []Candidate{walkIn(1, clock(9, 42)), booked(2, clock(9, 40))}, nil, 2},
+		{"booking beyond grace is not called early", []Candidate{booked(1, clock(10, 16))}, nil, 0},
+
+		// Живая очередь заполняет окно до записи, если не задержит ее
+		{"walk-in fills gap", []Candidate{booked(1, clock(11, 0)), walkIn(2, clock(9, 50))}, nil, 2},
+		{"walk-in ends at grace end", []Candidate{booked(1, clock(10, 20)), walkIn(2, clock(9, 50))}, nil, 2},
+		{"long walk-in would delay booking", []Candidate{booked(2, clock(10, 20)), long}, nil, 0},
+		{"other bay frees in time", []Candidate{booked(2, clock(10, 20)), long}, []time.Time{clock(10, 35)}, 1},
+		{"other bay frees too late", []Candidate{booked(2, clock(10, 20)), long}, []time.Time{clock(10, 36)}, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got int64
+			if i := pick(now, tt.pool, tt.otherFree, testDuration); i >= 0 {
+				got = tt.pool[i].ID
+			}
+			if got != tt.want {
+				t.Errorf("picked %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	long := walkIn(2, clock(9, 55))
+	long.Service = "long"
+
+	for _, tt := range []struct {
+		name    string
+		free    []time.Time
+		waiting []Candidate
+		want    []Assignment
+	}{
+		{
+			name:    "equal times by ID",
+			free:    []time.Time{clock(10, 0)},
+			waiting: []Candidate{walkIn(3, clock(9, 0)), walkIn(1, clock(9, 0)), walkIn(2, clock(9, 0))},
+			want: []Assignment{
+				{walkIn(1, clock(9, 0)), clock(10, 0)},
+				{walkIn(2, clock(9, 0)), clock(10, 30)},
+				{walkIn(3, clock(9, 0)), clock(11, 0)},
+			},
+		},
+		{
+			name:    "walk-in fills the gap before a booking",
+			free:    []time.Time{clock(10, 0)},
+			waiting: []Candidate{booked(1, clock(10, 45)), walkIn(2, clock(9, 55)), walkIn(3, clock(9, 58))},
+			want: []Assignment{
+				{walkIn(2, clock(9, 55)), clock(10, 0)},
+				{booked(1, clock(10, 45)), clock(10, 30)},
+				{walkIn(3, clock(9, 58)), clock(11, 0)},
+			},
+		},
+		{
+			name:    "bay waits for a booking instead of a walk-in that would delay it",
+			free:    []time.Time{clock(10, 0)},
+			waiting: []Candidate{booked(1, clock(10, 30)), long},
+			want: []Assignment{
+				{booked(1, clock(10, 30)), clock(10, 15)},
+				{long, clock(10, 45)},
+			},
+		},
+		{
+			name:    "late booking outside grace queues by its time",
+			free:    []time.Time{clock(10, 0)},
+			waiting: []Candidate{walkIn(1, clock(9, 30)), booked(2, clock(9, 40)), walkIn(3, clock(9, 35))},
+			want: []Assignment{
+				{walkIn(1, clock(9, 30)), clock(10, 0)},
+				{walkIn(3, clock(9, 35)), clock(10, 30)},
+				{booked(2, clock(9, 40)), clock(11, 0)},
+			},
+		},
+		{
+			name:    "two bays",
+			free:    []time.Time{clock(10, 20), clock(10, 0)},
+			waiting: []Candidate{walkIn(1, clock(9, 0)), walkIn(2, clock(9, 5)), booked(3, clock(10, 30))},
+			want: []Assignment{
+				{walkIn(1, clock(9, 0)), clock(10, 0)},
+				{booked(3, clock(10, 30)), clock(10, 20)},
+				{walkIn(2, clock(9, 5)), clock(10, 30)},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Plan(tt.free, tt.waiting, testDuration)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+
+			// Порядок не зависит от порядка записей на входе и от повторных вызовов
+			reversed := slices.Clone(tt.waiting)
+			slices.Reverse(reversed)
+			for range 3 {
+				if again := Plan(tt.free, reversed, testDuration); !slices.Equal(again, got) {
+					t.Fatalf("reversed input planned as %v, want %v", again, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFreeBay(t *testing.T) {
+	savedBays := db.Bays
+	t.Cleanup(func() { db.Bays = savedBays })
+	db.Bays = 2
+
+	at := func(bay int, status string) db.Record {
+		return db.Record{Status: status, Bay: &bay}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		records []db.Record
+		bay     int
+		want    int
+		err     error
+	}{
+		{"first free", []db.Record{at(1, "in work")}, 0, 2, nil},
+		{"requested free", nil, 2, 2, nil},
+		{"finished job frees the bay", []db.Record{at(1, "done")}, 1, 1, nil},
+		{"requested busy", []db.Record{at(2, "welcome")}, 2, 0, ErrBayBusy},
+		{"all busy", []db.Record{at(1, "welcome"), at(2, "in work")}, 0, 0, ErrNoFreeBay},
+		{"bay above Bays", nil, 3, 0, ErrInvalidBay},
+		{"negative bay", nil, -1, 0, ErrInvalidBay},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := freeBay(tt.records, tt.bay)
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Errorf("got %d, %v; want %d, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Package queue управляет очередью на сегодня: решает, кого вызвать на
+// освободившийся пост, и оценивает ожидаемое время начала работ
+package queue
+
+import (
+	"time"
+	"tire-pepair-record-service/pkg/db"
+)
+
+// durationHistory период, по которому считается средняя длительность работ
+const durationHistory = 30 * 24 * time.Hour
+
+// minRemaining минимальный остаток работы, если норматив уже превышен
+const minRemaining = 5 * time.Minute
+
+// Estimate оценка для ожидающей записи
+type Estimate struct {
+	Position int           // место в очереди, с 1
+	ETA      time.Time     // ожидаемое время начала обслуживания
+	Wait     time.Duration // ожидание от текущего момента
+}
+
+// Minutes возвращает ожидание в целых минутах с округлением вверх
+func (e Estimate) Minutes() int {
+	return int((e.Wait + time.Minute - 1) / time.Minute)
+}
+
+// Job работа, занимающая пост
+type Job struct {
+	Service string
+	Started *time.Time // время начала работ, nil - машина принята, но работы не начаты
+}
+
+// durationOf возвращает функцию длительности по статистике с запасным нормативом
+func durationOf(durations map[string]time.Duration) durationFunc {
+	return func(service string) time.Duration {
+		if d, ok := durations[service]; ok && d > 0 {
+			return d
+		}
+		return db.ServiceDuration(service)
+	}
+}
+
+// freeTimes возвращает время освобождения каждого поста с учетом текущих работ
+func freeTimes(now time.Time, bays int, busy []Job, duration durationFunc) []time.Time {
+	if bays < 1 {
+		bays = 1
+	}
+
+	free := make([]time.Time, bays)
+	for i := range free {
+		free[i] = now
+	}
+
+	for _, job := range busy {
+		// Работа занимает пост, который освобождается раньше остальных
+		earliest := 0
+		for i := range free {
+			if free[i].Before(free[earliest]) {
+				earliest = i
+			}
+		}
+
+		remaining := duration(job.Service)
+		if job.Started != nil {
+			remaining -= now.Sub(*job.Started)
+			if remaining < minRemaining {
+				remaining = minRemaining
+			}
+		}
+		free[earliest] = free[earliest].Add(remaining)
+	}
+
+	return free
+}
+
+// Calculate строит план вызовов и возвращает оценки для ожидающих записей
+func Calculate(now time.Time, bays int, busy []Job, waiting []Candidate, durations map[string]time.Duration) map[int64]Estimate {
+	duration := durationOf(durations)
+	plan := Plan(freeTimes(now, bays, busy, duration), waiting, duration)
+
+	estimates := make(map[int64]Estimate, len(plan))
+	for position, assignment := range plan {
+		wait := assignment.Start.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		estimates[assignment.ID] = Estimate{Position: position + 1, ETA: assignment.Start, Wait: wait}
+	}
+
+	return estimates
+}
+
+// snapshot текущее состояние очереди
+type snapshot struct {
+	records   []db.Record
+	busy      []Job
+	waiting   []Candidate
+	durations map[string]time.Duration
+}
+
+// load читает сегодняшнюю очередь, текущие работы и статистику длительностей
+func load(now time.Time) (*snapshot, error) {
+	records, err := db.GetTodayRecords("")
+	if err != nil {
+		return nil, err
+	}
+
+	durations, err := db.AverageServiceDurations(now.Add(-durationHistory))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &snapshot{records: records, durations: durations}
+	for _, record := range records {
+		switch record.Status {
+		case "welcome":
+			s.busy = append(s.busy, Job{Service: record.Service})
+		case "in work":
+			s.busy = append(s.busy, Job{Service: record.Service, Started: record.StartedAt})
+		case "wait":
+			candidate := Candidate{ID: record.ID, Service: record.Service, Ready: record.Date}
+			switch {
+			case record.ConvertedAt != nil:
+				candidate.Ready = *record.ConvertedAt
+			case record.Record != nil:
+				candidate.Booked = true
+				candidate.Ready = *record.Record
+			}
+			s.waiting = append(s.waiting, candidate)
+		}
+	}
+
+	return s, nil
+}
+
+// Today возвращает оценки для всех ожидающих сегодня записей
+func Today(now time.Time) (map[int64]Estimate, error) {
+	s, err := load(now)
+	if err != nil {
+		return nil, err
+	}
+
+	return Calculate(now, db.Bays, s.busy, s.waiting, s.durations), nil
+}
@@ -0,0 +1,102 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+	"tire-pepair-record-service/pkg/commerceml"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/notify"
+	"tire-pepair-record-service/pkg/waitlist"
+	"tire-pepair-record-service/pkg/webhooks"
+)
+
+// NoShowJob отмечает неявки по прошедшим записям
+func NoShowJob(logger *log.Logger) Job {
+	return Job{
+		Name:     "no-show",
+		Interval: time.Minute,
+		Run: func(now time.Time) error {
+			records, err := db.MarkNoShows(now)
+			if err != nil {
+				return err
+			}
+			for _, record := range records {
+				logger.Printf("INFO: record %d for car %s marked as no-show", record.ID, record.Title)
+			}
+			return nil
+		},
+	}
+}
+
+// WaitlistJob снимает просроченные предложения листа ожидания и передает время следующим
+func WaitlistJob(logger *log.Logger) Job {
+	return Job{
+		Name:     "waitlist",
+		Interval: time.Minute,
+		Run: func(now time.Time) error {
+			return waitlist.Expire(now, logger)
+		},
+	}
+}
+
+// SlotHoldJob удаляет просроченные удержания времени
+func SlotHoldJob(logger *log.Logger) Job {
+	return Job{
+		Name:     "slot-holds",
+		Interval: time.Minute,
+		Run: func(now time.Time) error {
+			removed, err := db.CleanupSlotHolds(now)
+			if err != nil {
+				return err
+			}
+			if removed > 0 {
+				logger.Printf("INFO: %d expired slot holds removed", removed)
+			}
+			return nil
+		},
+	}
+}
+
+// NotificationJob отправляет уведомления из очереди и повторяет неудачные попытки
+func NotificationJob(logger *log.Logger) Job {
+	return Job{
+		Name:     "notifications",
+		Interval: 30 * time.Second,
+		Run: func(now time.Time) error {
+			return notify.Dispatch(now, logger)
+		},
+	}
+}
+
+// ReminderJob напоминает клиентам о предварительной записи
+func ReminderJob(logger *log.Logger) Job {
+	return Job{
+		Name:     "reminders",
+		Interval: time.Minute,
+		Run: func(now time.Time) error {
+			return notify.Remind(now, logger)
+		},
+	}
+}
+
+// WebhookJob доставляет вебхуки из очереди и повторяет неудачные попытки
+func WebhookJob(logger *log.Logger) Job {
+	return Job{
+		Name:     "webhooks",
+		Interval: 30 * time.Second,
+		Run: func(now time.Time) error {
+			return webhooks.Dispatch(now, logger)
+		},
+	}
+}
+
+// CommerceMLJob кладет выгрузку для 1С за прошедшие дни в каталог обмена
+func CommerceMLJob(logger *log.Logger) Job {
+	return Job{
+		Name:     "1c-export",
+		Interval: time.Minute,
+		Run: func(now time.Time) error {
+			return commerceml.Drop(now, logger)
+		},
+	}
+}
@@ -0,0 +1,77 @@
+// Package scheduler запускает периодические фоновые задачи сервиса
+package scheduler
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Job периодическая задача
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(now time.Time) error
+}
+
+// Scheduler запускает каждую задачу в отдельной горутине по ее интервалу
+type Scheduler struct {
+	jobs   []Job
+	logger *log.Logger
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func New(logger *log.Logger) *Scheduler {
+	return &Scheduler{logger: logger, stop: make(chan struct{})}
+}
+
+// Add добавляет задачу. Задачи нужно добавить до вызова Start
+func (s *Scheduler) Add(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Start запускает задачи: первый запуск сразу, далее по интервалу
+func (s *Scheduler) Start() {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(job)
+		s.logger.Printf("INFO: scheduled job %s every %s\n", job.Name, job.Interval)
+	}
+}
+
+// Stop останавливает задачи и дожидается завершения текущих запусков
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(job Job) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	s.run(job)
+	for {
+		select {
+		case <-ticker.C:
+			s.run(job)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// run выполняет задачу, не давая ошибке или панике остановить планировщик
+func (s *Scheduler) run(job Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Printf("ERROR: job %s panicked, %v", job.Name, r)
+		}
+	}()
+
+	if err := job.Run(time.Now()); err != nil {
+		s.logger.Printf("ERROR: job %s failed, %v", job.Name, err)
+	}
+}
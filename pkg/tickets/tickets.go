@@ -0,0 +1,193 @@
+// Package tickets печатает талоны очереди на чековом термопринтере
+package tickets
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/documents"
+	"tire-pepair-record-service/pkg/escpos"
+	"tire-pepair-record-service/pkg/events"
+	"tire-pepair-record-service/pkg/qr"
+)
+
+var ErrNoPrinter = errors.New("принтер талонов не настроен")
+
+// paperDots ширина печати ленты 58 мм в точках
+const paperDots = 384
+
+var (
+	printer   *escpos.Printer
+	codePage  byte = escpos.CodePage866
+	autoPrint bool
+)
+
+// SetConfig читает настройки печати талонов из окружения:
+// TODO_TICKET_PRINTER - tcp://host:9100, host:9100 или путь к файлу/устройству,
+// TODO_TICKET_CODEPAGE - номер кодовой страницы CP866 в ESC t (по умолчанию 17),
+// TODO_TICKET_AUTOPRINT - печатать талон при постановке в живую очередь
+func SetConfig(logger *log.Logger) {
+	if target := os.Getenv("TODO_TICKET_PRINTER"); target != "" {
+		printer = &escpos.Printer{Target: target}
+		logger.Printf("INFO: tickets are printed to %s\n", target)
+	}
+
+	if value := os.Getenv("TODO_TICKET_CODEPAGE"); value != "" {
+		page, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			logger.Printf("WARN: invalid ticket code page %s, is using %d\n", value, codePage)
+		} else {
+			codePage = byte(page)
+		}
+	}
+
+	if value := os.Getenv("TODO_TICKET_AUTOPRINT"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			logger.Printf("WARN: invalid ticket autoprint flag %s, is using %t\n", value, autoPrint)
+		} else {
+			autoPrint = enabled
+		}
+	}
+}
+
+// Number генерирует номер талона: О - живая очередь, З - предварительная запись,
+// и последние три цифры номера записи
+func Number(id int64, recordTime *time.Time) string {
+	prefix := "О" // Очередь
+	if recordTime != nil {
+		prefix = "З" // Запись
+	}
+
+	// Берем последние 3 цифры ID
+	idStr := fmt.Sprintf("%d", id)
+	if len(idStr) > 3 {
+		idStr = idStr[len(idStr)-3:]
+	} else {
+		idStr = fmt.Sprintf("%03s", idStr)
+	}
+
+	return prefix + idStr
+}
+
+// StatusPath путь страницы, на которой клиент следит за записью
+func StatusPath(token string) string {
+	return "/status.html?token=" + url.QueryEscape(token)
+}
+
+// WaitlistPath путь страницы, на которой клиент видит предложение из листа ожидания
+func WaitlistPath(token string) string {
+	return "/status.html?waitlist=" + url.QueryEscape(token)
+}
+
+// Ticket данные талона
+type Ticket struct {
+	Number  string
+	Plate   string
+	Service string
+	Issued  time.Time
+	Record  *time.Time // время предварительной записи
+	Link    string     // полная ссылка на страницу статуса для QR-кода, пусто - без кода
+}
+
+// NewTicket заполняет талон по записи. baseURL - адрес сервиса для ссылки в QR-коде
+func NewTicket(record db.Record, baseURL string, now time.Time) Ticket {
+	ticket := Ticket{
+		Number: Number(record.ID, record.Record),
+		Plate:  record.Title,
+		Issued: now,
+		Record: record.Record,
+	}
+
+	if item, err := db.GetCatalogItem(record.Service); err == nil {
+		ticket.Service = item.Name
+	}
+	if baseURL != "" && record.AccessToken != "" {
+		ticket.Link = strings.TrimRight(baseURL, "/") + StatusPath(record.AccessToken)
+	}
+
+	return ticket
+}
+
+// Render возвращает талон в командах ESC/POS
+func (t Ticket) Render() []byte {
+	b := escpos.New(codePage).Align(escpos.AlignCenter)
+
+	b.Bold(true).Line(documents.ShopInfo.Name).Bold(false)
+	if documents.ShopInfo.Phone != "" {
+		b.Line(documents.ShopInfo.Phone)
+	}
+	b.Line(strings.Repeat("-", 32))
+
+	b.Line("Ваш номер")
+	b.Size(4, 4).Bold(true).Line(t.Number).Bold(false).Size(1, 1)
+	b.Feed(1)
+
+	b.Size(2, 2).Line(t.Plate).Size(1, 1)
+	if t.Service != "" {
+		b.Line(t.Service)
+	}
+	if t.Record != nil {
+		b.Line("Запись на " + t.Record.Local().Format("02.01.2006 15:04"))
+	}
+	b.Line("Выдан " + t.Issued.Local().Format("02.01.2006 15:04"))
+
+	if t.Link != "" {
+		// Код строится здесь и печатается растром: встроенный генератор QR
+		// есть не у всех принтеров
+		if code, err := qr.Encode(t.Link); err == nil {
+			side := code.Size + 2*qr.QuietZone
+			scale := min(6, paperDots/side)
+			b.Image(side*scale, side*scale, func(x, y int) bool {
+				return code.Dark(x/scale-qr.QuietZone, y/scale-qr.QuietZone)
+			})
+			b.Line("Очередь и статус - по QR-коду")
+		}
+	}
+
+	return b.Feed(4).Cut().Bytes()
+}
+
+// Print печатает талон на настроенном принтере
+func Print(ticket Ticket) error {
+	if printer == nil {
+		return ErrNoPrinter
+	}
+	return printer.Print(ticket.Render())
+}
+
+// Subscribe включает печать талона при постановке машины в живую очередь,
+// если задан TODO_TICKET_AUTOPRINT
+func Subscribe(logger *log.Logger) {
+	if !autoPrint {
+		return
+	}
+	if printer == nil {
+		logger.Printf("WARN: ticket autoprint is enabled, but TODO_TICKET_PRINTER is not set\n")
+		return
+	}
+
+	events.Subscribe(events.RecordCreated, func(e events.Event) {
+		if e.Record != nil {
+			return
+		}
+
+		record, err := db.GetRecordByID(e.RecordID)
+		if err != nil {
+			logger.Printf("ERROR: getting record %d for ticket error, %v", e.RecordID, err)
+			return
+		}
+
+		if err := Print(NewTicket(*record, documents.PublicURL, time.Now())); err != nil {
+			logger.Printf("ERROR: printing ticket for record %d error, %v", record.ID, err)
+			return
+		}
+		logger.Printf("INFO: ticket for record %d printed", record.ID)
+	})
+}
@@ -0,0 +1,156 @@
+package tickets
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"tire-pepair-record-service/pkg/documents"
+	"tire-pepair-record-service/pkg/escpos"
+	"tire-pepair-record-service/pkg/escpos/escpostest"
+	"tire-pepair-record-service/pkg/qr"
+)
+
+// setup задает реквизиты, принтер и часовой пояс, от которых зависит талон
+func setup(t *testing.T, target string) {
+	t.Helper()
+
+	savedShop, savedPrinter, savedCodePage, savedLocal := documents.ShopInfo, printer, codePage, time.Local
+	t.Cleanup(func() {
+		documents.ShopInfo, printer, codePage, time.Local = savedShop, savedPrinter, savedCodePage, savedLocal
+	})
+
+	documents.ShopInfo = documents.Shop{Name: "Шиномонтаж «Колесо»", Phone: "+7 495 123-45-67"}
+	printer = nil
+	if target != "" {
+		printer = &escpos.Printer{Target: target}
+	}
+	codePage = escpos.CodePage866
+	time.Local = time.FixedZone("MSK", 3*60*60)
+}
+
+// line строка текста в CP866 с переводом строки
+func line(s string) []byte {
+	return append(escpos.EncodeCP866(s), 0x0a)
+}
+
+// raster команда GS v 0 с QR-кодом ссылки так, как его печатает талон
+func raster(t *testing.T, link string) []byte {
+	t.Helper()
+
+	code, err := qr.Encode(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	side := code.Size + 2*qr.QuietZone
+	scale := min(6, paperDots/side)
+	width := side * scale
+	rowBytes := (width + 7) / 8
+
+	out := []byte{0x1d, 'v', '0', 0, byte(rowBytes), byte(rowBytes >> 8), byte(width), byte(width >> 8)}
+	for y := 0; y < width; y++ {
+		row := make([]byte, rowBytes)
+		for x := 0; x < width; x++ {
+			if code.Dark(x/scale-qr.QuietZone, y/scale-qr.QuietZone) {
+				row[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		out = append(out, row...)
+	}
+	return append(out, 0x0a)
+}
+
+func TestPrintTicket(t *testing.T) {
+	fake := escpostest.NewPrinter(t)
+	setup(t, fake.Target())
+
+	recordTime := time.Date(2026, 3, 14, 8, 0, 0, 0, time.UTC)
+	ticket := Ticket{
+		Number:  "З042",
+		Plate:   "А123ВС77",
+		Service: "Шиномонтаж R16",
+		Issued:  time.Date(2026, 3, 14, 7, 30, 0, 0, time.UTC),
+		Record:  &recordTime,
+		Link:    "https://shina.example.ru" + StatusPath("abc"),
+	}
+
+	if err := Print(ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	got := fake.Receive(t)
+
+	var want bytes.Buffer
+	want.Write([]byte{0x1b, '@'})           // сброс принтера
+	want.Write([]byte{0x1b, 't', 17})       // кодовая страница CP866
+	want.Write([]byte{0x1b, 'a', 1})        // по центру
+	want.Write([]byte{0x1b, 'E', 1})        // жирный
+	want.Write(line("Шиномонтаж «Колесо»")) // кавычки заменяются на "
+	want.Write([]byte{0x1b, 'E', 0})
+	want.Write(line("+7 495 123-45-67"))
+	want.Write(line(strings.Repeat("-", 32)))
+	want.Write(line("Ваш номер"))
+	want.Write([]byte{0x1d, '!', 0x33, 0x1b, 'E', 1}) // номер в 4 раза крупнее
+	want.Write(line("З042"))
+	want.Write([]byte{0x1b, 'E', 0, 0x1d, '!', 0x00})
+	want.Write([]byte{0x1b, 'd', 1})
+	want.Write([]byte{0x1d, '!', 0x11})
+	want.Write(line("А123ВС77"))
+	want.Write([]byte{0x1d, '!', 0x00})
+	want.Write(line("Шиномонтаж R16"))
+	want.Write(line("Запись на 14.03.2026 11:00")) // местное время
+	want.Write(line("Выдан 14.03.2026 10:30"))
+	want.Write(raster(t, ticket.Link))
+	want.Write(line("Очередь и статус - по QR-коду"))
+	want.Write([]byte{0x1b, 'd', 4})     // прогон
+	want.Write([]byte{0x1d, 'V', 66, 0}) // отрез
+
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Fatalf("printer received %d bytes, want %d\ngot  % x\nwant % x", len(got), want.Len(), got, want.Bytes())
+	}
+
+	// Кириллица уходит на принтер в CP866, а не в UTF-8
+	if bytes.Contains(got, []byte("Ваш номер")) {
+		t.Error("ticket text is sent in UTF-8")
+	}
+}
+
+func TestTicketCodePage(t *testing.T) {
+	setup(t, "")
+	codePage = 46
+
+	got := Ticket{Number: "О001", Plate: "А001АА77", Issued: time.Now()}.Render()
+	if !bytes.HasPrefix(got, []byte{0x1b, '@', 0x1b, 't', 46}) {
+		t.Errorf("ticket starts with % x, want code page 46", got[:5])
+	}
+	if bytes.Contains(got, []byte{0x1d, 'v', '0'}) {
+		t.Error("ticket without link has a QR code")
+	}
+}
+
+func TestPrintWithoutPrinter(t *testing.T) {
+	setup(t, "")
+
+	if err := Print(Ticket{Number: "О001"}); !errors.Is(err, ErrNoPrinter) {
+		t.Errorf("got %v, want ErrNoPrinter", err)
+	}
+}
+
+func TestNumber(t *testing.T) {
+	recordTime := time.Date(2026, 3, 14, 8, 0, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		id     int64
+		record *time.Time
+		want   string
+	}{
+		{1, nil, "О001"},
+		{42, &recordTime, "З042"},
+		{12345, nil, "О345"},
+	} {
+		if got := Number(tt.id, tt.record); got != tt.want {
+			t.Errorf("Number(%d) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package waitlist предлагает освободившееся время клиентам из листа ожидания
+package waitlist
+
+import (
+	"log"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/events"
+)
+
+// freedSlot возвращает время, освобожденное изменением записи: отмена, удаление
+// или перенос ожидающей предварительной записи, или снятием заявки с предложением
+func freedSlot(e events.Event) *time.Time {
+	if e.Name == events.WaitlistLeft {
+		return e.PreviousRecord
+	}
+	if e.PreviousStatus != "wait" || e.PreviousRecord == nil {
+		return nil
+	}
+
+	switch {
+	case e.Name == events.RecordDeleted:
+	case e.Status == "cancel":
+	case e.Status == "wait" && (e.Record == nil || !e.Record.Equal(*e.PreviousRecord)):
+	default:
+		return nil
+	}
+
+	return e.PreviousRecord
+}
+
+// offer предлагает время первой подходящей заявке и сообщает о предложении
+// подписчикам, чтобы клиент узнал о нем
+func offer(slot time.Time, logger *log.Logger) bool {
+	entry, err := db.OfferSlot(slot, time.Now())
+	if err != nil {
+		logger.Printf("ERROR: offering slot %s error, %v", slot.Format(time.RFC3339), err)
+		return false
+	}
+	if entry == nil {
+		return false
+	}
+
+	logger.Printf("INFO: slot %s offered to waitlist entry %d until %s",
+		slot.Format(time.RFC3339), entry.ID, entry.OfferExpiresAt.Format(time.RFC3339))
+	events.Publish(events.Event{
+		Name:       events.WaitlistOffered,
+		WaitlistID: entry.ID,
+		Status:     entry.Status,
+		Record:     entry.OfferSlot,
+	})
+	return true
+}
+
+// offerToday предлагает ближайшее свободное сегодня время: неявка освобождает
+// пост прямо сейчас, а ее собственное время уже прошло
+func offerToday(logger *log.Logger) {
+	slots, err := db.GetAvailableSlots(time.Now())
+	if err != nil {
+		logger.Printf("ERROR: getting available slots error, %v", err)
+		return
+	}
+
+	for _, slot := range slots {
+		if offer(slot, logger) {
+			return
+		}
+	}
+}
+
+// handle обрабатывает изменение записи
+func handle(e events.Event, logger *log.Logger) {
+	if e.PreviousStatus == "wait" && e.Status == "no_show" {
+		offerToday(logger)
+		return
+	}
+
+	if slot := freedSlot(e); slot != nil {
+		offer(*slot, logger)
+	}
+}
+
+// Subscribe подписывает лист ожидания на события об изменении записей и снятии заявок
+func Subscribe(logger *log.Logger) {
+	handler := func(e events.Event) { handle(e, logger) }
+	events.Subscribe(events.RecordUpdated, handler)
+	events.Subscribe(events.RecordDeleted, handler)
+	events.Subscribe(events.WaitlistLeft, handler)
+}
+
+// Expire возвращает просроченные предложения в ожидание и предлагает
+// их время следующим заявкам
+func Expire(now time.Time, logger *log.Logger) error {
+	slots, err := db.ExpireWaitlist(now)
+	if err != nil {
+		return err
+	}
+
+	for _, slot := range slots {
+		logger.Printf("INFO: waitlist offer for slot %s expired", slot.Format(time.RFC3339))
+		offer(slot, logger)
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package waitlist
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/events"
+)
+
+func TestFreedSlot(t *testing.T) {
+	at := time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)
+	later := at.Add(time.Hour)
+
+	for _, tt := range []struct {
+		name  string
+		event events.Event
+		want  *time.Time
+	}{
+		{"cancelled booking", events.Event{Name: events.RecordStatusChanged, Status: "cancel", PreviousStatus: "wait", PreviousRecord: &at}, &at},
+		{"deleted booking", events.Event{Name: events.RecordDeleted, PreviousStatus: "wait", PreviousRecord: &at}, &at},
+		{"rescheduled booking", events.Event{Name: events.RecordUpdated, Status: "wait", PreviousStatus: "wait", Record: &later, PreviousRecord: &at}, &at},
+		{"booking kept its time", events.Event{Name: events.RecordUpdated, Status: "wait", PreviousStatus: "wait", Record: &at, PreviousRecord: &at}, nil},
+		{"arrived", events.Event{Name: events.RecordUpdated, Status: "welcome", PreviousStatus: "wait", Record: &at, PreviousRecord: &at}, nil},
+		{"walk-in cancelled", events.Event{Name: events.RecordUpdated, Status: "cancel", PreviousStatus: "wait"}, nil},
+		{"entry with an offer left", events.Event{Name: events.WaitlistLeft, PreviousStatus: db.WaitlistOffered, PreviousRecord: &at}, &at},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := freedSlot(tt.event)
+			if (got == nil) != (tt.want == nil) || got != nil && !got.Equal(*tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeaveReoffersSlot(t *testing.T) {
+	if err := db.Init(filepath.Join(t.TempDir(), "test.db"), log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.CloseDatabase)
+	Subscribe(log.New(io.Discard, "", 0))
+
+	slot, err := db.FindNextAvailable(time.Now().Add(db.MinLeadTime+time.Hour), time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []*db.WaitlistEntry
+	for _, title := range []string{"А001АА77", "А002АА77"} {
+		entry, err := db.AddWaitlistEntry(db.WaitlistEntry{Title: title, WindowStart: slot.Add(-time.Hour), WindowEnd: slot.Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if !offer(*slot, log.New(io.Discard, "", 0)) {
+		t.Fatal("slot was not offered")
+	}
+	first, err := db.GetWaitlistEntry(entries[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Время ушедшей заявки предлагается следующей так же, как время отмененной записи
+	if err := db.LeaveWaitlist(first.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	events.Wait()
+
+	next, err := db.GetWaitlistEntry(entries[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Status != db.WaitlistOffered || next.OfferSlot == nil || !next.OfferSlot.Equal(*slot) {
+		t.Fatalf("next entry status %s, offer %v; want offered %s", next.Status, next.OfferSlot, slot)
+	}
+	if _, err := db.GetSlotHold(next.HoldToken); err != nil {
+		t.Errorf("next entry hold: %v", err)
+	}
+}
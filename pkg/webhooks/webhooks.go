@@ -0,0 +1,353 @@
+// Package webhooks сообщает внешним системам (CRM, учет) об изменениях записей.
+// События сохраняются в очередь доставок в одной транзакции с изменением записи
+// и отправляются POST-запросами с JSON, подписанным HMAC-SHA256 ключом вебхука.
+// Неудачные доставки повторяются с растущей задержкой, после исчерпания попыток
+// попадают в недоставленные
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/events"
+	"tire-pepair-record-service/pkg/tickets"
+)
+
+// Заголовки запроса доставки
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	// HeaderSignature sha256=<hex HMAC-SHA256 от "<timestamp>.<тело>">. Метка времени
+	// входит в подпись, чтобы перехваченный запрос нельзя было повторить позже
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Повторные попытки: задержка удваивается после каждой неудачи
+const (
+	firstRetryDelay = 30 * time.Second
+	maxRetryDelay   = 6 * time.Hour
+	dispatchBatch   = 50
+)
+
+var (
+	// MaxAttempts число попыток, после которого доставка считается недоставленной
+	MaxAttempts = 10
+	// Timeout время ожидания ответа получателя
+	Timeout = 10 * time.Second
+	// Concurrency число вебхуков, которым доставки отправляются одновременно
+	Concurrency = 4
+)
+
+// SetConfig читает настройки доставки из окружения:
+// TODO_WEBHOOK_MAX_ATTEMPTS - число попыток (10),
+// TODO_WEBHOOK_TIMEOUT - время ожидания ответа (10s),
+// TODO_WEBHOOK_CONCURRENCY - число вебхуков, отправляемых одновременно (4)
+func SetConfig(logger *log.Logger) {
+	if value := os.Getenv("TODO_WEBHOOK_MAX_ATTEMPTS"); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts < 1 {
+			logger.Printf("WARN: invalid webhook attempts %s, is using %d\n", value, MaxAttempts)
+		} else {
+			MaxAttempts = attempts
+		}
+	}
+
+	if value := os.Getenv("TODO_WEBHOOK_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			logger.Printf("WARN: invalid webhook timeout %s, is using %s\n", value, Timeout)
+		} else {
+			Timeout = timeout
+		}
+	}
+
+	if value := os.Getenv("TODO_WEBHOOK_CONCURRENCY"); value != "" {
+		concurrency, err := strconv.Atoi(value)
+		if err != nil || concurrency < 1 {
+			logger.Printf("WARN: invalid webhook concurrency %s, is using %d\n", value, Concurrency)
+		} else {
+			Concurrency = concurrency
+		}
+	}
+}
+
+// recordView запись в теле вебхука, поля как в ответах API. Контактов клиента нет
+type recordView struct {
+	ID           int64      `json:"id"`
+	Date         time.Time  `json:"date"`
+	Title        string     `json:"title"`
+	Record       *time.Time `json:"record"`
+	Comment      string     `json:"comment"`
+	Status       string     `json:"status"`
+	Service      string     `json:"service"`
+	Bay          *int       `json:"bay"`
+	MechanicID   *int64     `json:"mechanicId"`
+	StartedAt    *time.Time `json:"startedAt"`
+	FinishedAt   *time.Time `json:"finishedAt"`
+	Version      int64      `json:"version"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+	TicketNumber string     `json:"ticketNumber"`
+}
+
+// Payload тело запроса доставки
+type Payload struct {
+	Event          string      `json:"event"`
+	OccurredAt     time.Time   `json:"occurredAt"`
+	RecordID       int64       `json:"recordId"`
+	Status         string      `json:"status,omitempty"`
+	PreviousStatus string      `json:"previousStatus,omitempty"`
+	PreviousRecord *time.Time  `json:"previousRecord,omitempty"`
+	Record         *recordView `json:"record,omitempty"` // состояние записи; нет для record.deleted
+}
+
+// NewPayload собирает тело вебхука по событию
+func NewPayload(e events.Event, record *db.Record) Payload {
+	payload := Payload{
+		Event:          e.Name,
+		OccurredAt:     e.At,
+		RecordID:       e.RecordID,
+		Status:         e.Status,
+		PreviousStatus: e.PreviousStatus,
+		PreviousRecord: e.PreviousRecord,
+	}
+
+	if record != nil {
+		payload.Record = &recordView{
+			ID:           record.ID,
+			Date:         record.Date,
+			Title:        record.Title,
+			Record:       record.Record,
+			Comment:      record.Comment,
+			Status:       record.Status,
+			Service:      record.Service,
+			Bay:          record.Bay,
+			MechanicID:   record.MechanicID,
+			StartedAt:    record.StartedAt,
+			FinishedAt:   record.FinishedAt,
+			Version:      record.Version,
+			UpdatedAt:    record.UpdatedAt,
+			TicketNumber: tickets.Number(record.ID, record.Record),
+		}
+	}
+	return payload
+}
+
+// Sign возвращает значение заголовка X-Webhook-Signature
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// payload тело доставки для очереди, см. db.WebhookPayload
+func payload(e events.Event, record *db.Record) (string, error) {
+	body, err := json.Marshal(NewPayload(e, record))
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// retryDelay задержка перед попыткой номер attempts+1
+func retryDelay(attempts int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+var (
+	busyMu sync.Mutex
+	busy   = map[int64]bool{} // вебхуки, доставки которых сейчас отправляются
+)
+
+// claim занимает вебхук за вызовом Dispatch. Занятый вебхук пропускается:
+// его доставки уже отправляет другой вызов, повторно их отправлять нельзя
+func claim(webhookID int64) bool {
+	busyMu.Lock()
+	defer busyMu.Unlock()
+	if busy[webhookID] {
+		return false
+	}
+	busy[webhookID] = true
+	return true
+}
+
+func release(webhookID int64) {
+	busyMu.Lock()
+	defer busyMu.Unlock()
+	delete(busy, webhookID)
+}
+
+// Dispatch отправляет доставки, время которых наступило. Вебхуки обслуживаются
+// параллельно, не больше Concurrency одновременно, доставки одного вебхука - по
+// порядку. Медленный или недоступный получатель не задерживает остальных
+func Dispatch(now time.Time, logger *log.Logger) error {
+	due, err := db.DueDeliveries(0, now, dispatchBatch)
+	if err != nil {
+		return err
+	}
+
+	var webhookIDs []int64
+	seen := map[int64]bool{}
+	for _, d := range due {
+		if !seen[d.WebhookID] {
+			seen[d.WebhookID] = true
+			webhookIDs = append(webhookIDs, d.WebhookID)
+		}
+	}
+
+	var (
+		wg    sync.WaitGroup
+		errMu sync.Mutex
+		errs  []error
+	)
+	slots := make(chan struct{}, max(Concurrency, 1))
+	for _, webhookID := range webhookIDs {
+		if !claim(webhookID) {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer release(webhookID)
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if err := dispatchWebhook(webhookID, now, logger); err != nil {
+				errMu.Lock()
+				errs = append(errs, err)
+				errMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// dispatchWebhook отправляет по порядку доставки одного вебхука. Список
+// читается после claim, чтобы не повторить доставку, которую закончил отправлять
+// предыдущий вызов, и перечитывается, пока в нем есть доставки: поставленные
+// в очередь во время отправки другой вызов пропустил, их отправляет этот
+func dispatchWebhook(webhookID int64, now time.Time, logger *log.Logger) error {
+	webhook, err := db.GetWebhook(webhookID)
+	if err != nil {
+		return err
+	}
+
+	for at := now; ; at = time.Now() {
+		due, err := db.DueDeliveries(webhookID, at, dispatchBatch)
+		if err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return nil
+		}
+
+		if err := deliver(*webhook, due, logger); err != nil {
+			return err
+		}
+	}
+}
+
+// deliver выполняет по попытке для каждой доставки и записывает результат
+func deliver(webhook db.Webhook, due []db.Delivery, logger *log.Logger) error {
+	for _, d := range due {
+		attempt := send(webhook, d)
+		delivered := attempt.Error == ""
+
+		var next *time.Time
+		switch {
+		case delivered:
+			logger.Printf("INFO: webhook delivery %d (%s) to %s delivered", d.ID, d.Event, webhook.URL)
+		case d.Attempts+1 < MaxAttempts:
+			at := time.Now().Add(retryDelay(d.Attempts + 1))
+			next = &at
+			logger.Printf("WARN: webhook delivery %d to %s failed, retry at %s, %s",
+				d.ID, webhook.URL, at.Format(time.RFC3339), attempt.Error)
+		default:
+			logger.Printf("ERROR: webhook delivery %d to %s failed after %d attempts, %s",
+				d.ID, webhook.URL, d.Attempts+1, attempt.Error)
+		}
+
+		if err := db.RecordDeliveryAttempt(d.ID, attempt, delivered, next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send выполняет одну попытку доставки. Ответ не из 2xx считается ошибкой
+func send(webhook db.Webhook, d db.Delivery) db.DeliveryAttempt {
+	started := time.Now()
+	attempt := db.DeliveryAttempt{DeliveryID: d.ID, AttemptedAt: started}
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	timestamp := started.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tire-service-webhooks/1")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, body))
+
+	resp, err := http.DefaultClient.Do(req)
+	attempt.Duration = time.Since(started)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		attempt.Error = strings.TrimSpace(resp.Status + " " + string(detail))
+	}
+	return attempt
+}
+
+// Subscribe включает постановку изменений записей в очередь доставки и
+// отправляет доставки сразу после события, не дожидаясь планировщика
+func Subscribe(logger *log.Logger) {
+	db.WebhookPayload = payload
+
+	handler := func(e events.Event) {
+		if err := Dispatch(time.Now(), logger); err != nil {
+			logger.Printf("ERROR: delivering webhooks error, %v", err)
+		}
+	}
+
+	for _, name := range db.WebhookEvents {
+		events.Subscribe(name, handler)
+	}
+}
@@ -0,0 +1,319 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"tire-pepair-record-service/pkg/db"
+	"tire-pepair-record-service/pkg/events"
+)
+
+var quiet = log.New(io.Discard, "", 0)
+
+// setup открывает пустую базу во временном каталоге и включает очередь доставок
+func setup(t *testing.T) {
+	t.Helper()
+
+	if err := db.Init(filepath.Join(t.TempDir(), "test.db"), quiet); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.CloseDatabase)
+
+	savedPayload, savedAttempts, savedConcurrency := db.WebhookPayload, MaxAttempts, Concurrency
+	t.Cleanup(func() {
+		events.Wait()
+		db.WebhookPayload, MaxAttempts, Concurrency = savedPayload, savedAttempts, savedConcurrency
+	})
+	db.WebhookPayload = payload
+}
+
+// request запрос, принятый тестовым получателем
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver получатель вебхуков: передает запросы в канал и отвечает 204
+func receiver(t *testing.T) (*httptest.Server, <-chan request) {
+	t.Helper()
+
+	received := make(chan request, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		received <- request{header: req.Header, body: body}
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func addWebhook(t *testing.T, url string, names ...string) *db.Webhook {
+	t.Helper()
+
+	webhook, err := db.AddWebhook(db.Webhook{URL: url, Events: names}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return webhook
+}
+
+// payloads тела доставок вебхука по порядку постановки в очередь
+func payloads(t *testing.T, webhookID int64) []Payload {
+	t.Helper()
+
+	deliveries, err := db.ListDeliveries(webhookID, "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make([]Payload, len(deliveries))
+	for i, d := range deliveries {
+		var p Payload
+		if err := json.Unmarshal([]byte(d.Payload), &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Event != d.Event {
+			t.Errorf("delivery %d: event %s, payload event %s", d.ID, d.Event, p.Event)
+		}
+		result[len(deliveries)-1-i] = p
+	}
+	return result
+}
+
+func TestOutbox(t *testing.T) {
+	setup(t)
+	all := addWebhook(t, "https://crm.example.ru/hook")
+	deletions := addWebhook(t, "https://erp.example.ru/hook", events.RecordDeleted)
+
+	created, err := db.AddRecord(db.Record{Title: "А123ВС77"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := "in work"
+	if _, err := db.PatchRecord(created.ID, db.RecordPatch{Status: &status}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Неудавшееся изменение не ставит доставок
+	comment := "не сохранится"
+	if _, err := db.PatchRecord(created.ID, db.RecordPatch{Comment: &comment}, 100); !errors.Is(err, db.ErrVersionConflict) {
+		t.Fatalf("got %v, want ErrVersionConflict", err)
+	}
+
+	if err := db.DeleteRecord(created.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	got := payloads(t, all.ID)
+	want := []struct{ event, status, recordStatus string }{
+		{events.RecordCreated, "wait", "wait"},
+		{events.RecordUpdated, "in work", "in work"},
+		{events.RecordStatusChanged, "in work", "in work"},
+		{events.RecordDeleted, "", ""},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d deliveries, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		p := got[i]
+		if p.Event != w.event || p.Status != w.status || p.RecordID != created.ID {
+			t.Errorf("delivery %d: event %s, status %q, record %d", i, p.Event, p.Status, p.RecordID)
+		}
+		// Тело фиксирует запись на момент изменения, а не на момент отправки
+		switch {
+		case w.recordStatus == "" && p.Record != nil:
+			t.Errorf("delivery %d: deleted record in payload", i)
+		case w.recordStatus != "" && (p.Record == nil || p.Record.Status != w.recordStatus):
+			t.Errorf("delivery %d: record snapshot %+v, want status %s", i, p.Record, w.recordStatus)
+		}
+	}
+	if got[2].PreviousStatus != "wait" {
+		t.Errorf("status change: previous status %q, want wait", got[2].PreviousStatus)
+	}
+	if got[1].Record.Version != created.Version+1 || got[0].Record.TicketNumber != "О001" {
+		t.Errorf("snapshots: version %d, ticket %s", got[1].Record.Version, got[0].Record.TicketNumber)
+	}
+
+	if got := payloads(t, deletions.ID); len(got) != 1 || got[0].Event != events.RecordDeleted {
+		t.Errorf("deletion webhook got %+v, want one record.deleted", got)
+	}
+}
+
+func TestOutboxWithoutSubscription(t *testing.T) {
+	setup(t)
+	webhook := addWebhook(t, "https://crm.example.ru/hook")
+	db.WebhookPayload = nil
+
+	if _, err := db.AddRecord(db.Record{Title: "А123ВС77"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := payloads(t, webhook.ID); len(got) != 0 {
+		t.Errorf("got %d deliveries, want 0", len(got))
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	setup(t)
+	server, received := receiver(t)
+	webhook := addWebhook(t, server.URL)
+
+	var ids []int64
+	for i := range 3 {
+		d, err := db.EnqueueDelivery(webhook.ID, events.RecordUpdated, `{"n":`+strconv.Itoa(i)+`}`, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, d.ID)
+	}
+
+	if err := Dispatch(time.Now(), quiet); err != nil {
+		t.Fatal(err)
+	}
+
+	// Доставки одного вебхука уходят по порядку и подписаны его ключом
+	for i, id := range ids {
+		var r request
+		select {
+		case r = <-received:
+		default:
+			t.Fatalf("receiver got %d requests, want %d", i, len(ids))
+		}
+
+		if got := r.header.Get(HeaderDelivery); got != strconv.FormatInt(id, 10) {
+			t.Errorf("request %d: delivery %s, want %d", i, got, id)
+		}
+		timestamp, _ := strconv.ParseInt(r.header.Get(HeaderTimestamp), 10, 64)
+		if got, want := r.header.Get(HeaderSignature), Sign(webhook.Secret, timestamp, r.body); got != want {
+			t.Errorf("request %d: signature %s, want %s", i, got, want)
+		}
+
+		d, err := db.GetDelivery(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Status != db.DeliveryDelivered || d.Attempts != 1 {
+			t.Errorf("delivery %d: status %s, attempts %d", id, d.Status, d.Attempts)
+		}
+	}
+}
+
+func TestDispatchConcurrent(t *testing.T) {
+	setup(t)
+
+	// Медленный получатель не отвечает, пока его не отпустят
+	release := make(chan struct{})
+	var releaseOnce sync.Once
+	unblock := func() { releaseOnce.Do(func() { close(release) }) }
+	t.Cleanup(unblock)
+
+	slowStarted := make(chan struct{}, 1)
+	slow := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		slowStarted <- struct{}{}
+		<-release
+		res.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(slow.Close)
+	fast, received := receiver(t)
+
+	slowHook := addWebhook(t, slow.URL)
+	fastHook := addWebhook(t, fast.URL)
+	for _, id := range []int64{slowHook.ID, fastHook.ID} {
+		if _, err := db.EnqueueDelivery(id, events.RecordCreated, `{}`, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- Dispatch(time.Now(), quiet) }()
+
+	select {
+	case <-slowStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow receiver got nothing")
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fast receiver waits for the slow one")
+	}
+
+	// Пока первый вызов занят медленным вебхуком, второй его пропускает
+	if err := Dispatch(time.Now(), quiet); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-slowStarted:
+		t.Fatal("busy webhook delivery sent twice")
+	default:
+	}
+
+	unblock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []int64{slowHook.ID, fastHook.ID} {
+		deliveries, err := db.ListDeliveries(id, db.DeliveryDelivered, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) != 1 {
+			t.Errorf("webhook %d: %d delivered, want 1", id, len(deliveries))
+		}
+	}
+}
+
+func TestDispatchRetry(t *testing.T) {
+	setup(t)
+	MaxAttempts = 2
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		http.Error(res, "maintenance", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	webhook := addWebhook(t, server.URL)
+	d, err := db.EnqueueDelivery(webhook.ID, events.RecordCreated, `{}`, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	if err := Dispatch(time.Now(), quiet); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.GetDelivery(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != db.DeliveryPending || got.Attempts != 1 || got.NextAttemptAt.Before(before.Add(firstRetryDelay-time.Second)) {
+		t.Fatalf("after first attempt: status %s, attempts %d, next %s", got.Status, got.Attempts, got.NextAttemptAt)
+	}
+
+	if err := Dispatch(got.NextAttemptAt, quiet); err != nil {
+		t.Fatal(err)
+	}
+	got, err = db.GetDelivery(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != db.DeliveryDead || got.Attempts != 2 || got.LastError != "503 Service Unavailable maintenance" {
+		t.Errorf("after last attempt: status %s, attempts %d, error %q", got.Status, got.Attempts, got.LastError)
+	}
+
+	attempts, err := db.DeliveryAttempts(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 || attempts[0].StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("attempt log %+v", attempts)
+	}
+}
@@ -0,0 +1,221 @@
+// Package xlsx пишет книгу Excel (Office Open XML) из одного листа построчно,
+// не держа строки в памяти. Строки записываются встроенными (inlineStr),
+// поэтому общая таблица строк не нужна
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentType тип ответа с книгой
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Money сумма в копейках, записывается числом в рублях с двумя знаками
+type Money int64
+
+// Индексы стилей ячеек из styles.xml
+const (
+	styleDefault = iota
+	styleHeader
+	styleDateTime
+	styleMoney
+)
+
+// excelEpoch начало отсчета дат Excel с учетом ошибки 1900 года
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// Writer пишет лист книги
+type Writer struct {
+	zip     *zip.Writer
+	sheet   *bufio.Writer
+	rows    int
+	columns int // ширина шапки для автофильтра
+}
+
+// NewWriter начинает книгу с листом sheetName. Если передана шапка, она
+// выделяется жирным, закрепляется и получает автофильтр
+func NewWriter(w io.Writer, sheetName string, header ...string) (*Writer, error) {
+	z := zip.NewWriter(w)
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", fmt.Sprintf(workbook, escape(sheetName))},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+		{"xl/styles.xml", styles},
+	}
+	for _, part := range parts {
+		f, err := z.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	// Лист пишется последним: следующий файл архива закрыл бы его
+	f, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	xw := &Writer{zip: z, sheet: bufio.NewWriter(f), columns: len(header)}
+	xw.sheet.WriteString(xml.Header)
+	xw.sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if len(header) > 0 {
+		xw.sheet.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	}
+	xw.sheet.WriteString(`<sheetData>`)
+
+	if len(header) > 0 {
+		cells := make([]any, len(header))
+		for i, name := range header {
+			cells[i] = name
+		}
+		if err := xw.writeRow(cells, styleHeader); err != nil {
+			return nil, err
+		}
+	}
+
+	return xw, nil
+}
+
+// WriteRow добавляет строку. Поддерживаются string, int, int64, float64, Money,
+// time.Time и *time.Time; nil и нулевое время дают пустую ячейку
+func (w *Writer) WriteRow(cells ...any) error {
+	return w.writeRow(cells, styleDefault)
+}
+
+func (w *Writer) writeRow(cells []any, style int) error {
+	w.rows++
+	fmt.Fprintf(w.sheet, `<row r="%d">`, w.rows)
+
+	for i, value := range cells {
+		ref := columnName(i) + strconv.Itoa(w.rows)
+
+		if t, ok := value.(*time.Time); ok {
+			if t == nil {
+				continue
+			}
+			value = *t
+		}
+
+		switch v := value.(type) {
+		case nil:
+		case string:
+			if v == "" {
+				continue
+			}
+			fmt.Fprintf(w.sheet, `<c r="%s" t="inlineStr"%s><is><t xml:space="preserve">%s</t></is></c>`, ref, styleAttr(style), escape(v))
+		case int:
+			fmt.Fprintf(w.sheet, `<c r="%s"%s><v>%d</v></c>`, ref, styleAttr(style), v)
+		case int64:
+			fmt.Fprintf(w.sheet, `<c r="%s"%s><v>%d</v></c>`, ref, styleAttr(style), v)
+		case float64:
+			fmt.Fprintf(w.sheet, `<c r="%s"%s><v>%s</v></c>`, ref, styleAttr(style), strconv.FormatFloat(v, 'f', -1, 64))
+		case Money:
+			fmt.Fprintf(w.sheet, `<c r="%s" s="%d"><v>%s</v></c>`, ref, styleMoney, strconv.FormatFloat(float64(v)/100, 'f', 2, 64))
+		case time.Time:
+			if v.IsZero() {
+				continue
+			}
+			fmt.Fprintf(w.sheet, `<c r="%s" s="%d"><v>%s</v></c>`, ref, styleDateTime, strconv.FormatFloat(serial(v), 'f', -1, 64))
+		default:
+			return fmt.Errorf("xlsx: неподдерживаемый тип ячейки %T", value)
+		}
+	}
+
+	_, err := w.sheet.WriteString(`</row>`)
+	return err
+}
+
+// Close завершает лист и архив
+func (w *Writer) Close() error {
+	w.sheet.WriteString(`</sheetData>`)
+	if w.columns > 0 {
+		fmt.Fprintf(w.sheet, `<autoFilter ref="A1:%s%d"/>`, columnName(w.columns-1), w.rows)
+	}
+	w.sheet.WriteString(`</worksheet>`)
+
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
+
+// serial время в формате Excel: дни от 30.12.1899 по местным часам
+func serial(t time.Time) float64 {
+	t = t.Local()
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	return wall.Sub(excelEpoch).Seconds() / 86400
+}
+
+// columnName имя колонки по индексу с нуля: 0 -> A, 26 -> AA
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+func styleAttr(style int) string {
+	if style == styleDefault {
+		return ""
+	}
+	return fmt.Sprintf(` s="%d"`, style)
+}
+
+// escape экранирует текст для XML. Недопустимые в XML символы заменяются
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const contentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`</Types>`
+
+const rootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+	`</workbook>`
+
+const workbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+// styles стили в порядке styleDefault, styleHeader, styleDateTime, styleMoney.
+// Формат 4 встроенный: # ##0,00 с разделителями по региональным настройкам
+const styles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="dd.mm.yyyy hh:mm"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
@@ -29,6 +29,9 @@ class AdminPanel {
 
         // Фильтры записей
         document.getElementById('applyFilters').addEventListener('click', () => this.loadRecords());
+        document.getElementById('exportCsv').addEventListener('click', () => this.exportRecords('csv'));
+        document.getElementById('exportXlsx').addEventListener('click', () => this.exportRecords('xlsx'));
+        document.getElementById('export1c').addEventListener('click', () => this.exportCommerceML());
 
         // Управление календарем
         document.getElementById('prevMonth').addEventListener('click', () => this.changeMonth(-1));
@@ -66,6 +69,32 @@ class AdminPanel {
         }
     }
 
+    // Выгрузка записей за период с фильтром по статусу из списка записей
+    exportRecords(format) {
+        const params = new URLSearchParams({ format });
+        const from = document.getElementById('exportFrom').value;
+        const to = document.getElementById('exportTo').value;
+        const status = document.getElementById('filterStatus').value;
+
+        if (from) params.set('from', from);
+        if (to) params.set('to', to);
+        if (status) params.set('status', status);
+
+        window.location.href = '/api/v1/records/export?' + params.toString();
+    }
+
+    // Выгрузка для 1С за период из тех же полей, без периода - текущий месяц
+    exportCommerceML() {
+        const params = new URLSearchParams();
+        const from = document.getElementById('exportFrom').value;
+        const to = document.getElementById('exportTo').value;
+
+        if (from) params.set('from', from);
+        if (to) params.set('to', to);
+
+        window.location.href = '/api/v1/accounting/commerceml?' + params.toString();
+    }
+
     async loadQueue() {
         try {
             const response = await axios.get('/api/GetTodayRecords');
@@ -77,6 +106,9 @@ class AdminPanel {
     }
 
     displayQueue(records) {
+        // Версии записей из списка нужны для If-Match при смене статуса
+        this.queueVersions = new Map(records.map(record => [record.id, record.version]));
+
         const inWorkRecords = records.filter(record => 
             record.status === 'in work' || record.status === 'welcome'
         );
@@ -133,6 +165,143 @@ class AdminPanel {
         }
     }
 
+    async nextCustomer() {
+        try {
+            const response = await axios.post('/api/CallNext', {});
+            const record = response.data.record;
+            alert(`Вызван ${record.ticketNumber} (${record.title}) на пост ${record.bay}`);
+            this.loadQueue();
+        } catch (error) {
+            const message = error.response?.data?.error || 'Не удалось вызвать следующего клиента';
+            alert(message);
+        }
+    }
+
+    // Смена статуса из очереди. Версия берется из загруженного списка: если запись
+    // уже изменили, сервер ответит конфликтом, а не затрет чужие правки
+    async updateStatus(id, status) {
+        const version = this.queueVersions?.get(id);
+        const headers = version ? { 'If-Match': `"${version}"` } : {};
+        try {
+            await axios.patch(`/api/v1/records/${id}`, { status }, { headers });
+            this.loadQueue();
+        } catch (error) {
+            this.handleWriteError(error, 'Не удалось изменить статус записи');
+        }
+    }
+
+    // Открывает запись на редактирование и запоминает ее ETag: изменения и удаление
+    // отправляются с If-Match
+    async editRecord(id) {
+        try {
+            const response = await axios.get(`/api/v1/records/${id}`);
+            this.fillEditForm(response.data.record, response.headers.etag);
+            document.getElementById('editModal').style.display = 'flex';
+        } catch (error) {
+            alert(error.response?.data?.error || 'Не удалось загрузить запись');
+        }
+    }
+
+    fillEditForm(record, etag) {
+        this.editing = record;
+        this.editETag = etag || `"${record.version}"`;
+
+        document.getElementById('editId').value = record.id;
+        document.getElementById('editCarNumber').value = record.title;
+        document.getElementById('editComment').value = record.comment || '';
+        document.getElementById('editRecordDate').value = this.toDateTimeInput(record.record);
+        document.getElementById('editStatus').value = record.status;
+    }
+
+    closeModal() {
+        document.getElementById('editModal').style.display = 'none';
+        this.editing = null;
+        this.editETag = null;
+    }
+
+    // Отправляет только измененные поля, чтобы не проверять заново время,
+    // которое не менялось
+    async saveRecord() {
+        if (!this.editing) return;
+
+        const record = this.editing;
+        const patch = {};
+        const title = document.getElementById('editCarNumber').value.trim();
+        const comment = document.getElementById('editComment').value;
+        const recordDate = document.getElementById('editRecordDate').value;
+        const status = document.getElementById('editStatus').value;
+
+        if (title !== record.title) patch.title = title;
+        if (comment !== (record.comment || '')) patch.comment = comment;
+        if (status !== record.status) patch.status = status;
+        if (recordDate !== this.toDateTimeInput(record.record)) {
+            patch.record = recordDate ? new Date(recordDate).toISOString() : null;
+        }
+
+        if (Object.keys(patch).length === 0) {
+            this.closeModal();
+            return;
+        }
+
+        try {
+            await axios.patch(`/api/v1/records/${record.id}`, patch, {
+                headers: { 'If-Match': this.editETag }
+            });
+            this.closeModal();
+            this.loadQueue();
+        } catch (error) {
+            this.handleWriteError(error, 'Не удалось сохранить запись');
+        }
+    }
+
+    async deleteRecord() {
+        if (!this.editing) return;
+        if (!confirm(`Удалить запись ${this.editing.title}?`)) return;
+
+        try {
+            await axios.delete(`/api/v1/records/${this.editing.id}`, {
+                headers: { 'If-Match': this.editETag }
+            });
+            this.closeModal();
+            this.loadQueue();
+        } catch (error) {
+            this.handleWriteError(error, 'Не удалось удалить запись');
+        }
+    }
+
+    // Конфликт версий (409 version_conflict или 412): запись успели изменить.
+    // Предлагаем перечитать ее - ответ на конфликт уже содержит текущее состояние
+    handleWriteError(error, fallback) {
+        const response = error.response;
+        const conflict = response && (response.status === 412 ||
+            (response.status === 409 && response.data?.code === 'version_conflict'));
+
+        if (!conflict) {
+            alert(response?.data?.error || fallback);
+            return;
+        }
+
+        const reload = confirm('Запись уже изменил другой пользователь. Загрузить актуальную версию? Несохраненные изменения будут потеряны.');
+        if (reload && this.editing) {
+            const current = response.data?.record;
+            if (current) {
+                this.fillEditForm(current, response.headers.etag);
+            } else {
+                this.editRecord(this.editing.id);
+            }
+        }
+        this.loadQueue();
+    }
+
+    // Значение для поля datetime-local по местному времени
+    toDateTimeInput(dateTime) {
+        if (!dateTime) return '';
+        const date = new Date(dateTime);
+        const pad = (n) => String(n).padStart(2, '0');
+        return `${date.getFullYear()}-${pad(date.getMonth() + 1)}-${pad(date.getDate())}` +
+            `T${pad(date.getHours())}:${pad(date.getMinutes())}`;
+    }
+
     // ... остальные методы для админки
 
     escapeHtml(text) {
@@ -154,7 +323,8 @@ class AdminPanel {
             'welcome': 'Принят',
             'in work': 'В работе',
             'done': 'Завершен',
-            'cancel': 'Отменен'
+            'cancel': 'Отменен',
+            'no_show': 'Не явился'
         };
         return statusMap[status] || status;
     }
@@ -45,10 +45,10 @@ class QueueDisplay {
             record.status === 'in work' || record.status === 'welcome'
         ).slice(0, 3);
 
-        // Очередь ожидания
+        // Очередь ожидания в порядке обслуживания
         const waitingRecords = records.filter(record => 
             record.status === 'wait'
-        );
+        ).sort((a, b) => (a.position || 0) - (b.position || 0));
 
         // Отображаем текущие в работе
         if (inWorkRecords.length > 0) {
@@ -70,6 +70,7 @@ class QueueDisplay {
                     <div class="queue-position">${index + 1}</div>
                     <div class="queue-ticket">${record.ticketNumber}</div>
                     <div class="queue-car">${this.escapeHtml(record.title)}</div>
+                    <div class="queue-eta">${this.formatEta(record)}</div>
                 </div>
             `).join('');
         } else {
@@ -77,13 +78,21 @@ class QueueDisplay {
         }
     }
 
+    formatEta(record) {
+        if (!record.eta) return '';
+        if (!record.waitMinutes) return 'СЕЙЧАС';
+        const eta = new Date(record.eta);
+        return '~' + eta.toLocaleTimeString('ru-RU', { hour: '2-digit', minute: '2-digit' });
+    }
+
     getStatusText(status) {
         const statusMap = {
             'wait': 'ОЖИДАНИЕ',
             'welcome': 'ПРИНЯТ',
             'in work': 'В РАБОТЕ',
             'done': 'ЗАВЕРШЕН',
-            'cancel': 'ОТМЕНЕН'
+            'cancel': 'ОТМЕНЕН',
+            'no_show': 'НЕ ЯВИЛСЯ'
         };
         return statusMap[status] || status;
     }
@@ -0,0 +1,207 @@
+class BookingStatus {
+    constructor() {
+        const params = new URLSearchParams(window.location.search);
+        this.token = params.get('token');
+        this.waitlistToken = params.get('waitlist');
+
+        this.ticketNumber = document.getElementById('ticketNumber');
+        this.carNumber = document.getElementById('carNumber');
+        this.status = document.getElementById('status');
+        this.recordInfo = document.getElementById('recordInfo');
+        this.calendarLink = document.getElementById('calendarLink');
+        this.errorMessage = document.getElementById('errorMessage');
+        this.changeSection = document.getElementById('changeSection');
+        this.rescheduleDate = document.getElementById('rescheduleDate');
+        this.rescheduleSlot = document.getElementById('rescheduleSlot');
+        this.rescheduleBtn = document.getElementById('rescheduleBtn');
+        this.rescheduleFields = document.getElementById('rescheduleFields');
+        this.cancelBtn = document.getElementById('cancelBtn');
+        this.offerSection = document.getElementById('offerSection');
+        this.offerInfo = document.getElementById('offerInfo');
+        this.claimBtn = document.getElementById('claimBtn');
+        this.waitlistSection = document.getElementById('waitlistSection');
+        this.leaveBtn = document.getElementById('leaveBtn');
+
+        this.init();
+    }
+
+    init() {
+        this.loadStatus();
+        setInterval(() => this.loadStatus(), 15000);
+
+        this.rescheduleDate.addEventListener('change', () => this.loadSlots());
+        this.rescheduleBtn.addEventListener('click', () => this.reschedule());
+        this.cancelBtn.addEventListener('click', () => this.cancel());
+        this.claimBtn.addEventListener('click', () => this.claim());
+        this.leaveBtn.addEventListener('click', () => this.leave());
+    }
+
+    async loadStatus() {
+        if (this.waitlistToken) {
+            return this.loadWaitlist();
+        }
+
+        try {
+            const response = await axios.get(`/api/v1/self/${encodeURIComponent(this.token)}`);
+            this.display(response.data.record);
+        } catch (error) {
+            this.showError(error);
+        }
+    }
+
+    display(record) {
+        this.errorMessage.style.display = 'none';
+        this.ticketNumber.textContent = `Талон: ${record.ticketNumber}`;
+        this.carNumber.textContent = record.title;
+        this.status.textContent = this.getStatusText(record.status);
+
+        // Опоздавший клиент переведен в живую очередь: ему важнее место в ней
+        if (record.record && !record.convertedAt) {
+            this.recordInfo.textContent = `Запись на: ${new Date(record.record).toLocaleString('ru-RU')}`;
+        } else if (record.position > 0) {
+            this.recordInfo.textContent = `Место в очереди: ${record.position}`;
+            if (record.waitMinutes > 0) {
+                this.recordInfo.textContent += `, ожидание около ${record.waitMinutes} мин.`;
+            }
+        } else {
+            this.recordInfo.textContent = '';
+        }
+
+        // Отмененная запись тоже скачивается: календарь отметит событие отмененным
+        if (record.record) {
+            this.calendarLink.href = `/api/v1/self/${encodeURIComponent(this.token)}/event.ics`;
+            this.calendarLink.style.display = 'inline-block';
+        } else {
+            this.calendarLink.style.display = 'none';
+        }
+
+        this.changeSection.style.display = record.canChange ? 'block' : 'none';
+        // Место в живой очереди можно только отменить, перенести нельзя
+        this.rescheduleFields.style.display = record.record && !record.convertedAt ? 'block' : 'none';
+    }
+
+    async loadWaitlist() {
+        try {
+            const response = await axios.get(`/api/v1/waitlist/${encodeURIComponent(this.waitlistToken)}`);
+            this.displayWaitlist(response.data.entry);
+        } catch (error) {
+            this.showError(error);
+        }
+    }
+
+    displayWaitlist(entry) {
+        const waitlistStatuses = {
+            'waiting': 'Лист ожидания',
+            'offered': 'Предложено время',
+            'claimed': 'Записан',
+            'expired': 'Ожидание завершено',
+            'cancelled': 'Вы покинули лист ожидания'
+        };
+
+        this.errorMessage.style.display = 'none';
+        this.ticketNumber.textContent = waitlistStatuses[entry.status] || entry.status;
+        this.carNumber.textContent = entry.title;
+        this.status.textContent = `Желаемое время: ${new Date(entry.from).toLocaleString('ru-RU')} - ${new Date(entry.to).toLocaleString('ru-RU')}`;
+        this.recordInfo.textContent = '';
+
+        const offered = entry.status === 'offered';
+        this.offerSection.style.display = offered ? 'block' : 'none';
+        if (offered) {
+            const slot = new Date(entry.offerSlot).toLocaleString('ru-RU');
+            const until = new Date(entry.offerExpiresAt).toLocaleTimeString('ru-RU', { hour: '2-digit', minute: '2-digit' });
+            this.offerInfo.textContent = `Время ${slot}. Предложение действует до ${until}`;
+        }
+
+        this.waitlistSection.style.display = offered || entry.status === 'waiting' ? 'block' : 'none';
+    }
+
+    async claim() {
+        try {
+            const response = await axios.post(`/api/v1/waitlist/${encodeURIComponent(this.waitlistToken)}/claim`);
+            // Дальше клиент следит за обычной записью
+            window.location.href = response.data.link;
+        } catch (error) {
+            this.showError(error);
+        }
+    }
+
+    async leave() {
+        if (!confirm('Покинуть лист ожидания?')) {
+            return;
+        }
+
+        try {
+            await axios.delete(`/api/v1/waitlist/${encodeURIComponent(this.waitlistToken)}`);
+            this.loadWaitlist();
+        } catch (error) {
+            this.showError(error);
+        }
+    }
+
+    async loadSlots() {
+        try {
+            const response = await axios.get('/api/v1/slots', { params: { date: this.rescheduleDate.value } });
+            const slots = response.data.slots || [];
+            this.rescheduleSlot.innerHTML = slots.map(slot => {
+                const time = new Date(slot).toLocaleTimeString('ru-RU', { hour: '2-digit', minute: '2-digit' });
+                return `<option value="${slot}">${time}</option>`;
+            }).join('');
+        } catch (error) {
+            this.showError(error);
+        }
+    }
+
+    async reschedule() {
+        if (!this.rescheduleSlot.value) {
+            alert('Выберите свободное время');
+            return;
+        }
+
+        try {
+            const response = await axios.post(`/api/v1/self/${encodeURIComponent(this.token)}/reschedule`, {
+                record: this.rescheduleSlot.value
+            });
+            this.display(response.data.record);
+        } catch (error) {
+            this.showError(error);
+        }
+    }
+
+    async cancel() {
+        if (!confirm('Отменить запись?')) {
+            return;
+        }
+
+        try {
+            const response = await axios.post(`/api/v1/self/${encodeURIComponent(this.token)}/cancel`);
+            this.display(response.data.record);
+        } catch (error) {
+            this.showError(error);
+        }
+    }
+
+    showError(error) {
+        let message = 'Не удалось загрузить запись';
+        if (error.response && error.response.data && error.response.data.error) {
+            message = error.response.data.error;
+        }
+        this.errorMessage.textContent = message;
+        this.errorMessage.style.display = 'block';
+    }
+
+    getStatusText(status) {
+        const statusMap = {
+            'wait': 'Ожидание',
+            'welcome': 'Принят',
+            'in work': 'В работе',
+            'done': 'Завершен',
+            'cancel': 'Отменен',
+            'no_show': 'Не явился'
+        };
+        return statusMap[status] || status;
+    }
+}
+
+document.addEventListener('DOMContentLoaded', () => {
+    new BookingStatus();
+});
@@ -5,6 +5,7 @@ class TireService {
         this.queueList = document.getElementById('queueList');
         this.carNumberInput = document.getElementById('carNumber');
         this.commentInput = document.getElementById('comment');
+        this.phoneInput = document.getElementById('phone');
         this.preRecordCheckbox = document.getElementById('preRecord');
         this.preRecordFields = document.getElementById('preRecordFields');
         this.recordDateInput = document.getElementById('recordDate');
@@ -12,7 +13,12 @@ class TireService {
         this.ticketModal = document.getElementById('ticketModal');
         this.ticketNumber = document.getElementById('ticketNumber');
         this.ticketInfo = document.getElementById('ticketInfo');
+        this.ticketLink = document.getElementById('ticketLink');
+        this.ticketQR = document.getElementById('ticketQR');
         this.closeModalBtn = document.getElementById('closeModalBtn');
+        this.waitlistBlock = document.getElementById('waitlistBlock');
+        this.waitlistDateInput = document.getElementById('waitlistDate');
+        this.waitlistBtn = document.getElementById('waitlistBtn');
 
         this.availableSlotsCache = {};
         this.workStations = 3; // Количество рабочих постов
@@ -31,7 +37,9 @@ class TireService {
         this.preRecordCheckbox.addEventListener('change', () => this.togglePreRecord());
         this.getTicketBtn.addEventListener('click', () => this.getTicket());
         this.closeModalBtn.addEventListener('click', () => this.closeModal());
+        this.waitlistBtn.addEventListener('click', () => this.joinWaitlist());
         this.recordDateInput.addEventListener('focus', () => this.loadAvailableSlots());
+        this.recordDateInput.addEventListener('change', () => this.holdSlot());
 
         console.log('TireService initialized');
     }
@@ -55,14 +63,16 @@ class TireService {
         } else {
             this.preRecordFields.style.display = 'none';
             this.recordDateInput.value = '';
+            this.releaseHold();
         }
     }
 
     async loadAvailableSlots() {
         try {
             const today = new Date().toISOString().split('T')[0];
-            const response = await axios.post('/api/GetAvailableSlots', { date: today });
-            const slots = response.data.slots || [];
+            // Свободное время на две недели одним запросом
+            const response = await axios.get('/api/v1/calendar', { params: { from: today } });
+            const slots = (response.data.days || []).flatMap(day => day.slots);
             
             // Получаем текущую очередь для расчета времени
             const queueResponse = await axios.get('/api/GetTodayRecords');
@@ -72,6 +82,12 @@ class TireService {
             
             const availableSlots = this.calculateRealAvailableSlots(slots, waitingRecords.length);
             this.updateDateTimeInput(availableSlots);
+
+            // Свободного времени нет - предлагаем лист ожидания
+            this.waitlistBlock.style.display = availableSlots.length === 0 ? 'block' : 'none';
+            if (!this.waitlistDateInput.value) {
+                this.waitlistDateInput.value = today;
+            }
             
         } catch (error) {
             console.error('Ошибка загрузки доступных слотов:', error);
@@ -172,7 +188,8 @@ class TireService {
             'welcome': 'Принят',
             'in work': 'В работе',
             'done': 'Завершен',
-            'cancel': 'Отменен'
+            'cancel': 'Отменен',
+            'no_show': 'Не явился'
         };
         return statusMap[status] || status;
     }
@@ -180,6 +197,7 @@ class TireService {
     async getTicket() {
         const carNumber = this.carNumberInput.value.trim();
         const comment = this.commentInput.value.trim();
+        const phone = this.phoneInput.value.trim();
         const isPreRecord = this.preRecordCheckbox.checked;
         const recordDate = isPreRecord ? this.recordDateInput.value : null;
 
@@ -199,20 +217,28 @@ class TireService {
                 comment: comment
             };
 
+            if (phone) {
+                requestData.contacts = { phone: phone };
+            }
+
             if (isPreRecord && recordDate) {
                 requestData.record = new Date(recordDate).toISOString();
+                if (this.holdToken) {
+                    requestData.holdToken = this.holdToken;
+                }
             }
 
-            const response = await axios.post('/api/AddRecord', requestData);
+            // Один ключ на отправку формы: повтор после обрыва связи не создаст дубль
+            if (!this.idempotencyKey) {
+                this.idempotencyKey = crypto.randomUUID();
+            }
+
+            const response = await axios.post('/api/v1/records', requestData, {
+                headers: { 'Idempotency-Key': this.idempotencyKey }
+            });
             
-            if (response.data.message === 'Record added successfully') {
-                // Получаем ID новой записи для отображения номера талона
-                const queueResponse = await axios.get('/api/GetTodayRecords');
-                const newRecord = queueResponse.data.records.find(r => 
-                    r.title === carNumber && r.status === 'wait'
-                );
-                
-                this.showSuccessModal(newRecord?.ticketNumber || carNumber, isPreRecord, recordDate);
+            if (response.data.success) {
+                this.showSuccessModal(response.data.ticketNumber, isPreRecord, recordDate, response.data.link);
                 this.clearForm();
                 this.loadQueue();
             } else {
@@ -230,8 +256,93 @@ class TireService {
         }
     }
 
-    showSuccessModal(ticketNumber, isPreRecord, recordDate) {
+    // Удерживаем выбранное время, чтобы его не заняли, пока заполняется форма
+    async holdSlot() {
+        await this.releaseHold();
+
+        const recordDate = this.recordDateInput.value;
+        if (!recordDate) return;
+
+        try {
+            const response = await axios.post('/api/v1/holds', {
+                record: new Date(recordDate).toISOString()
+            });
+            this.holdToken = response.data.token;
+        } catch (error) {
+            let errorMessage = 'Это время недоступно, выберите другое';
+            if (error.response && error.response.data && error.response.data.error) {
+                errorMessage = error.response.data.error;
+            }
+            alert(errorMessage);
+            this.recordDateInput.value = '';
+            this.loadAvailableSlots();
+        }
+    }
+
+    async releaseHold() {
+        if (!this.holdToken) return;
+
+        const token = this.holdToken;
+        this.holdToken = null;
+        try {
+            await axios.delete(`/api/v1/holds/${encodeURIComponent(token)}`);
+        } catch (error) {
+            // Удержание уже истекло или использовано
+        }
+    }
+
+    async joinWaitlist() {
+        const carNumber = this.carNumberInput.value.trim().toUpperCase();
+        const date = this.waitlistDateInput.value;
+        const phone = this.phoneInput.value.trim();
+
+        if (!carNumber) {
+            alert('Пожалуйста, введите номер автомобиля');
+            return;
+        }
+        if (!date) {
+            alert('Пожалуйста, выберите желаемую дату');
+            return;
+        }
+
+        // Окно ожидания - весь выбранный день
+        const from = new Date(`${date}T00:00`);
+        const to = new Date(from.getTime() + 24 * 60 * 60 * 1000);
+
+        try {
+            const requestData = {
+                title: carNumber,
+                comment: this.commentInput.value.trim(),
+                from: from.toISOString(),
+                to: to.toISOString()
+            };
+
+            // По телефону придет SMS, когда освободится время
+            if (phone) {
+                requestData.contacts = { phone: phone };
+            }
+
+            const response = await axios.post('/api/v1/waitlist', requestData);
+
+            this.ticketNumber.textContent = 'Вы в листе ожидания';
+            this.ticketInfo.textContent = `Дата: ${from.toLocaleDateString('ru-RU')}. Следите за предложением по ссылке`;
+            this.ticketLink.href = response.data.link;
+            this.ticketQR.style.display = 'none';
+            this.ticketModal.style.display = 'flex';
+            this.clearForm();
+        } catch (error) {
+            let errorMessage = 'Не удалось встать в лист ожидания';
+            if (error.response && error.response.data && error.response.data.error) {
+                errorMessage = error.response.data.error;
+            }
+            alert(errorMessage);
+        }
+    }
+
+    showSuccessModal(ticketNumber, isPreRecord, recordDate, link) {
         this.ticketNumber.textContent = `Талон: ${ticketNumber}`;
+        this.ticketLink.href = link;
+        this.showQR(link);
         
         if (isPreRecord && recordDate) {
             const date = new Date(recordDate);
@@ -243,16 +354,31 @@ class TireService {
         this.ticketModal.style.display = 'flex';
     }
 
+    // QR-код ссылки на статус записи, чтобы открыть ее с телефона
+    showQR(link) {
+        const token = new URL(link, window.location.origin).searchParams.get('token');
+        if (!token) {
+            this.ticketQR.style.display = 'none';
+            return;
+        }
+        this.ticketQR.src = `/api/v1/self/${encodeURIComponent(token)}/qr?format=svg`;
+        this.ticketQR.style.display = 'block';
+    }
+
     closeModal() {
         this.ticketModal.style.display = 'none';
     }
 
     clearForm() {
+        this.idempotencyKey = null;
+        this.holdToken = null;
         this.carNumberInput.value = '';
         this.commentInput.value = '';
+        this.phoneInput.value = '';
         this.preRecordCheckbox.checked = false;
         this.preRecordFields.style.display = 'none';
         this.recordDateInput.value = '';
+        this.waitlistBlock.style.display = 'none';
     }
 
     showError(message) {